@@ -212,6 +212,31 @@ func initConstantEnv() {
 		constant.TaskPricePatches = taskPricePatches
 	}
 
+	// Prometheus 指标端点
+	constant.MetricsEnabled = GetEnvOrDefaultBool("METRICS_ENABLED", false)
+	constant.MetricsToken = GetEnvOrDefaultString("METRICS_TOKEN", "")
+	var metricsAllowedIPs []string
+	for _, ip := range strings.Split(GetEnvOrDefaultString("METRICS_ALLOWED_IPS", ""), ",") {
+		if trimmedIP := strings.TrimSpace(ip); trimmedIP != "" {
+			metricsAllowedIPs = append(metricsAllowedIPs, trimmedIP)
+		}
+	}
+	constant.MetricsAllowedIPs = metricsAllowedIPs
+
+	// OpenTelemetry 链路追踪
+	constant.TracingEnabled = GetEnvOrDefaultBool("TRACING_ENABLED", false)
+	constant.TracingEndpoint = GetEnvOrDefaultString("TRACING_OTLP_ENDPOINT", "")
+	constant.TracingServiceName = GetEnvOrDefaultString("TRACING_SERVICE_NAME", "new-api")
+	constant.TracingSampleRatio = 1
+	if sampleRatioStr := GetEnvOrDefaultString("TRACING_SAMPLE_RATIO", ""); sampleRatioStr != "" {
+		sampleRatio, err := strconv.ParseFloat(sampleRatioStr, 64)
+		if err != nil || sampleRatio < 0 || sampleRatio > 1 {
+			SysError(fmt.Sprintf("invalid TRACING_SAMPLE_RATIO %q, using default value: 1", sampleRatioStr))
+		} else {
+			constant.TracingSampleRatio = sampleRatio
+		}
+	}
+
 	// Initialize trusted redirect domains for URL validation
 	trustedDomainsStr := GetEnvOrDefaultString("TRUSTED_REDIRECT_DOMAINS", "")
 	var trustedDomains []string
@@ -16,6 +16,10 @@ var (
 		"prefix:imagen-",
 		"flux-",
 		"flux.1-",
+		"titan-image-",
+		"nova-canvas",
+		"stable-image-",
+		"sd3-5-",
 	}
 	OpenAITextModels = []string{
 		"gpt-",
@@ -110,6 +110,55 @@ func RedisHSetObj(key string, obj interface{}, expiration time.Duration) error {
 	}
 	ctx := context.Background()
 
+	data := redisHashFields(obj)
+
+	txn := RDB.TxPipeline()
+	txn.HSet(ctx, key, data)
+
+	// 只有在 expiration 大于 0 时才设置过期时间
+	if expiration > 0 {
+		txn.Expire(ctx, key, expiration)
+	}
+
+	_, err := txn.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to execute transaction: %w", err)
+	}
+	return nil
+}
+
+// RedisHSetObjUnlessFenced works like RedisHSetObj but writes nothing while
+// fenceKey exists, checked atomically with the write. It reports whether the
+// hash was written.
+func RedisHSetObjUnlessFenced(key string, fenceKey string, obj interface{}, expiration time.Duration) (bool, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HSET unless %s: key=%s, obj=%+v, expiration=%v", fenceKey, key, obj, expiration))
+	}
+	const script = `
+if redis.call('EXISTS', KEYS[2]) == 1 then
+  return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+if tonumber(ARGV[1]) > 0 then
+  redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return 1`
+	data := redisHashFields(obj)
+	args := make([]interface{}, 0, 1+2*len(data))
+	args = append(args, int64(expiration/time.Second))
+	for field, value := range data {
+		args = append(args, field, value)
+	}
+	written, err := RDB.Eval(context.Background(), script, []string{key, fenceKey}, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return written == 1, nil
+}
+
+// redisHashFields converts the fields of the struct obj points to into hash
+// fields, skipping gorm.DeletedAt.
+func redisHashFields(obj interface{}) map[string]interface{} {
 	data := make(map[string]interface{})
 
 	// 使用反射遍历结构体字段
@@ -142,20 +191,7 @@ func RedisHSetObj(key string, obj interface{}, expiration time.Duration) error {
 		// 其他类型直接转换为字符串
 		data[field.Name] = fmt.Sprintf("%v", value.Interface())
 	}
-
-	txn := RDB.TxPipeline()
-	txn.HSet(ctx, key, data)
-
-	// 只有在 expiration 大于 0 时才设置过期时间
-	if expiration > 0 {
-		txn.Expire(ctx, key, expiration)
-	}
-
-	_, err := txn.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to execute transaction: %w", err)
-	}
-	return nil
+	return data
 }
 
 func RedisHGetObj(key string, obj interface{}) error {
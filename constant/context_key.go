@@ -19,6 +19,9 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenParamOverride     ContextKey = "token_param_override"
+	ContextKeyTokenParentId          ContextKey = "token_parent_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -38,6 +41,39 @@ const (
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
 
+	/* batch related keys */
+	// ContextKeyBatchId marks a relay request executed by the gateway batch
+	// runner; ContextKeyBatchRatio is the discount applied when billing it.
+	ContextKeyBatchId    ContextKey = "batch_id"
+	ContextKeyBatchRatio ContextKey = "batch_ratio"
+
+	/* response cache related keys */
+	// ContextKeyResponseCacheCapture holds the pending capture of a cacheable
+	// response; ContextKeyResponseCacheHit marks a response replayed from cache.
+	ContextKeyResponseCacheCapture ContextKey = "response_cache_capture"
+	ContextKeyResponseCacheHit     ContextKey = "response_cache_hit"
+
+	/* body capture related keys */
+	// ContextKeyBodyCaptured marks a request whose bodies are stored for audit.
+	ContextKeyBodyCaptured ContextKey = "body_captured"
+
+	/* prompt moderation related keys */
+	// ContextKeyModerationVerdict holds the verdict of the external
+	// moderation provider on the prompt of the request.
+	ContextKeyModerationVerdict ContextKey = "moderation_verdict"
+
+	/* completion moderation related keys */
+	// ContextKeyCompletionSensitiveWords holds the sensitive words found in
+	// the streamed completion; ContextKeyCompletionSensitiveStopped marks a
+	// stream terminated because of them.
+	ContextKeyCompletionSensitiveWords   ContextKey = "completion_sensitive_words"
+	ContextKeyCompletionSensitiveStopped ContextKey = "completion_sensitive_stopped"
+
+	/* hedged request related keys */
+	// ContextKeyHedgeAttempt holds the hedge attempt a relay context belongs
+	// to when the request is hedged across two channels.
+	ContextKeyHedgeAttempt ContextKey = "hedge_attempt"
+
 	ContextKeyAutoGroup           ContextKey = "auto_group"
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
@@ -72,4 +108,8 @@ const (
 	// fallback in authHelper (finishAdminAudit) skips its record to avoid
 	// duplicate entries.
 	ContextKeyAuditLogged ContextKey = "audit_logged"
+
+	// ContextKeyTraceId stores the OpenTelemetry trace ID of a sampled relay
+	// request, written to its logs so they can be matched with the trace.
+	ContextKeyTraceId ContextKey = "trace_id"
 )
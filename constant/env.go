@@ -22,6 +22,19 @@ var TaskTimeoutMinutes int
 // temporary variable for sora patch, will be removed in future
 var TaskPricePatches []string
 
+// MetricsEnabled exposes the Prometheus endpoint /metrics. Scrapers must send
+// MetricsToken as a bearer token or connect from one of MetricsAllowedIPs.
+var MetricsEnabled bool
+var MetricsToken string
+var MetricsAllowedIPs []string
+
+// TracingEnabled exports OpenTelemetry traces of relay requests over OTLP/HTTP
+// to TracingEndpoint, recording TracingSampleRatio of new traces.
+var TracingEnabled bool
+var TracingEndpoint string
+var TracingSampleRatio float64
+var TracingServiceName string
+
 // TrustedRedirectDomains is a list of trusted domains for redirect URL validation.
 // Domains support subdomain matching (e.g., "example.com" matches "sub.example.com").
 var TrustedRedirectDomains []string
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	batchListDefaultLimit = 20
+	batchListMaxLimit     = 100
+	// batchCompletionWindow is the only completion window OpenAI accepts.
+	batchCompletionWindow = "24h"
+)
+
+// getOwnedBatch loads the :id batch for the calling token and writes a 404
+// when it does not exist or belongs to another token.
+func getOwnedBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetTokenBatch(c.GetInt("id"), c.GetInt("token_id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			logger.LogError(c, fmt.Sprintf("failed to query batch %s: %s", c.Param("id"), err.Error()))
+			openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to query batch")
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+func CreateBatch(c *gin.Context) {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	var request dto.OpenAIBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "invalid request body")
+		return
+	}
+	if request.InputFileId == "" {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "'input_file_id' is a required property")
+		return
+	}
+	if !operation_setting.IsBatchEndpointSupported(request.Endpoint) {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("endpoint %s is not supported for batches", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "completion_window must be 24h")
+		return
+	}
+
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+	inputFile, err := model.GetTokenFile(userId, tokenId, request.InputFileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIFileError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No such File object: %s", request.InputFileId))
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("failed to query batch input file: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to query input file")
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "the input file must be uploaded with purpose batch")
+		return
+	}
+
+	batchId, err := model.GenerateBatchId()
+	if err != nil {
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to generate batch id")
+		return
+	}
+	batch := &model.Batch{
+		BatchId:          batchId,
+		UserId:           userId,
+		TokenId:          tokenId,
+		Endpoint:         request.Endpoint,
+		InputFileId:      request.InputFileId,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		ClientIp:         c.ClientIP(),
+		CreatedAt:        common.GetTimestamp(),
+	}
+	batch.ExpiresAt = batch.CreatedAt + int64((24 * time.Hour).Seconds())
+	if len(request.Metadata) > 0 {
+		metadata, err := common.Marshal(request.Metadata)
+		if err != nil {
+			openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "invalid metadata")
+			return
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to create batch: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to create batch")
+		return
+	}
+	// wake the runner instead of waiting for the next scheduler pass
+	if _, _, err := service.EnqueueSystemTask(model.SystemTaskTypeBatchProcess, nil); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to enqueue batch runner: %s", err.Error()))
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAIObject(batch))
+}
+
+func RetrieveBatch(c *gin.Context) {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	batch, ok := getOwnedBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAIObject(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	batch, ok := getOwnedBatch(c)
+	if !ok {
+		return
+	}
+	if batch.Status == model.BatchStatusValidating || batch.Status == model.BatchStatusInProgress {
+		now := common.GetTimestamp()
+		updated, err := model.UpdateBatchStatus(batch.BatchId, batch.Status, model.BatchStatusCancelling, map[string]any{"cancelling_at": now})
+		if err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to cancel batch %s: %s", batch.BatchId, err.Error()))
+			openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to cancel batch")
+			return
+		}
+		if updated {
+			batch.Status = model.BatchStatusCancelling
+			batch.CancellingAt = now
+		} else if batch, ok = getOwnedBatch(c); !ok {
+			return
+		}
+	}
+	if batch.Status != model.BatchStatusCancelling && batch.Status != model.BatchStatusCancelled {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Cannot cancel a batch with status %s.", batch.Status))
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAIObject(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	limit := batchListDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			limit = min(parsed, batchListMaxLimit)
+		}
+	}
+	// fetch one extra row to compute has_more
+	batches, err := model.ListTokenBatches(c.GetInt("id"), c.GetInt("token_id"), c.Query("after"), limit+1)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to list batches: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to list batches")
+		return
+	}
+	response := dto.OpenAIBatchList{
+		Object: "list",
+		Data:   make([]dto.OpenAIBatch, 0, len(batches)),
+	}
+	if len(batches) > limit {
+		response.HasMore = true
+		batches = batches[:limit]
+	}
+	for _, batch := range batches {
+		response.Data = append(response.Data, service.BatchToOpenAIObject(batch))
+	}
+	if len(response.Data) > 0 {
+		response.FirstId = response.Data[0].Id
+		response.LastId = response.Data[len(response.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,436 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// batchRunnerPassLimit bounds how many batches one runner pass picks up.
+	batchRunnerPassLimit = 20
+	// batchStatusCheckInterval throttles the cancellation check between lines.
+	batchStatusCheckInterval = 2 * time.Second
+	batchResultPageSize      = 500
+)
+
+// batchProcessHandler executes gateway-side batches. Enabled() folds in the
+// runnable batch existence check so an idle system schedules no rows.
+type batchProcessHandler struct{}
+
+func (batchProcessHandler) Type() string { return model.SystemTaskTypeBatchProcess }
+
+func (batchProcessHandler) Enabled() bool {
+	return operation_setting.GetBatchSetting().Enabled && model.HasRunnableBatches()
+}
+
+func (batchProcessHandler) Interval() time.Duration { return 10 * time.Second }
+
+func (batchProcessHandler) NewPayload() any { return nil }
+
+type batchProcessSummary struct {
+	Batches   int `json:"batches"`
+	Requests  int `json:"requests"`
+	Completed int `json:"completed"`
+}
+
+func (batchProcessHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	batches, err := model.GetRunnableBatches(batchRunnerPassLimit)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, nil, err)
+		return
+	}
+	report := service.NewSystemTaskProgressReporter(task, runnerID)
+	summary := batchProcessSummary{Batches: len(batches)}
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+		processed, err := processBatch(ctx, batch, report)
+		summary.Requests += processed
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s processing failed: %v", batch.BatchId, err))
+			continue
+		}
+		if batch.IsTerminal() {
+			summary.Completed++
+		}
+	}
+	if ctx.Err() != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, summary, ctx.Err())
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// processBatch advances one batch as far as possible and returns the number of
+// requests executed in this pass.
+func processBatch(ctx context.Context, batch *model.Batch, report func(processed, total int)) (int, error) {
+	switch batch.Status {
+	case model.BatchStatusValidating:
+		lines, err := validateBatch(ctx, batch)
+		if err != nil || lines == nil {
+			return 0, err
+		}
+		return executeBatch(ctx, batch, lines, report)
+	case model.BatchStatusInProgress:
+		lines, err := loadBatchInput(ctx, batch)
+		if err != nil {
+			return 0, failBatch(batch, "file_unavailable", err.Error())
+		}
+		return executeBatch(ctx, batch, lines, report)
+	case model.BatchStatusFinalizing:
+		if batch.ExpiredAt > 0 {
+			// expired before an earlier pass finished writing its files
+			return 0, finalizeBatch(ctx, batch, model.BatchStatusExpired)
+		}
+		return 0, finalizeBatch(ctx, batch, model.BatchStatusCompleted)
+	case model.BatchStatusCancelling:
+		return 0, finalizeBatch(ctx, batch, model.BatchStatusCancelled)
+	}
+	return 0, nil
+}
+
+func loadBatchInput(ctx context.Context, batch *model.Batch) ([]dto.OpenAIBatchInputLine, error) {
+	file, err := model.GetTokenFile(batch.UserId, batch.TokenId, batch.InputFileId)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := service.OpenStoredFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	lines, _, err := service.ParseBatchInput(reader, batch.Endpoint, 0)
+	return lines, err
+}
+
+// validateBatch parses the input file and moves the batch to in_progress, or
+// to failed when the file is invalid. It returns nil lines when the batch must
+// not be executed.
+func validateBatch(ctx context.Context, batch *model.Batch) ([]dto.OpenAIBatchInputLine, error) {
+	file, err := model.GetTokenFile(batch.UserId, batch.TokenId, batch.InputFileId)
+	if err != nil {
+		return nil, failBatch(batch, "file_unavailable", fmt.Sprintf("input file %s is not available", batch.InputFileId))
+	}
+	reader, err := service.OpenStoredFile(ctx, file)
+	if err != nil {
+		return nil, failBatch(batch, "file_unavailable", fmt.Sprintf("input file %s is not available", batch.InputFileId))
+	}
+	lines, validationErrors, err := service.ParseBatchInput(reader, batch.Endpoint, operation_setting.GetBatchSetting().MaxRequestsPerBatch)
+	_ = reader.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(validationErrors) > 0 {
+		return nil, failBatchWithErrors(batch, validationErrors)
+	}
+
+	now := common.GetTimestamp()
+	updated, err := model.UpdateBatchStatus(batch.BatchId, model.BatchStatusValidating, model.BatchStatusInProgress, map[string]any{
+		"total_count":    len(lines),
+		"in_progress_at": now,
+	})
+	if err != nil || !updated {
+		// cancelled while validating; the next pass finalizes it
+		return nil, err
+	}
+	batch.Status = model.BatchStatusInProgress
+	batch.TotalCount = len(lines)
+	batch.InProgressAt = now
+	return lines, nil
+}
+
+// executeBatch relays every line that has no result yet, then finalizes the
+// batch. Lines finished by an earlier interrupted pass are skipped.
+func executeBatch(ctx context.Context, batch *model.Batch, lines []dto.OpenAIBatchInputLine, report func(processed, total int)) (int, error) {
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil || token.UserId != batch.UserId {
+		return 0, failBatch(batch, "token_unavailable", "the token that created this batch is no longer available")
+	}
+	done, err := model.GetBatchDoneLineIndexes(batch.BatchId)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		processed atomic.Int64
+		executed  int
+		lastCheck time.Time
+	)
+	sem := make(chan struct{}, operation_setting.GetBatchConcurrency())
+	processed.Store(int64(len(done)))
+	stopStatus := ""
+dispatch:
+	for index, line := range lines {
+		if done[index] {
+			continue
+		}
+		if batch.ExpiresAt > 0 && common.GetTimestamp() > batch.ExpiresAt {
+			stopStatus = model.BatchStatusExpired
+			break
+		}
+		if time.Since(lastCheck) >= batchStatusCheckInterval {
+			lastCheck = time.Now()
+			if status, err := model.GetBatchStatus(batch.BatchId); err == nil && status != model.BatchStatusInProgress {
+				stopStatus = status
+				break
+			}
+			report(int(processed.Load()), len(lines))
+		}
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case sem <- struct{}{}:
+		}
+		executed++
+		wg.Add(1)
+		go func(index int, line dto.OpenAIBatchInputLine) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := relayBatchLine(ctx, batch, token.Key, index, line)
+			if ctx.Err() != nil {
+				// the lease was lost; leave the line to be replayed by the next runner
+				return
+			}
+			if err := model.SaveBatchRequestResult(result); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("batch %s failed to save line %d: %v", batch.BatchId, index, err))
+				return
+			}
+			processed.Add(1)
+		}(index, line)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return executed, ctx.Err()
+	}
+	report(int(processed.Load()), len(lines))
+
+	switch stopStatus {
+	case "":
+		return executed, finalizeBatch(ctx, batch, model.BatchStatusCompleted)
+	case model.BatchStatusExpired:
+		return executed, finalizeBatch(ctx, batch, model.BatchStatusExpired)
+	case model.BatchStatusCancelling:
+		batch.Status = model.BatchStatusCancelling
+		return executed, finalizeBatch(ctx, batch, model.BatchStatusCancelled)
+	}
+	return executed, nil
+}
+
+// batchRelayContextKey carries the batch into the internal relay engine.
+type batchRelayContextKey struct{}
+
+// batchRelayEngine replays batch lines through the regular relay pipeline so
+// they get the same token checks, channel selection, retries and billing as a
+// live request.
+var batchRelayEngine = sync.OnceValue(func() *gin.Engine {
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	engine.Use(middleware.RequestId())
+	engine.Use(middleware.I18n())
+	engine.Use(middleware.BodyStorageCleanup())
+	engine.Use(middleware.RouteTag("relay"))
+	engine.Use(func(c *gin.Context) {
+		if batch, ok := c.Request.Context().Value(batchRelayContextKey{}).(*model.Batch); ok {
+			common.SetContextKey(c, constant.ContextKeyBatchId, batch.BatchId)
+			common.SetContextKey(c, constant.ContextKeyBatchRatio, operation_setting.GetBatchDiscountRatio())
+		}
+		c.Next()
+	})
+	engine.Use(middleware.TokenAuth(), middleware.Distribute())
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		Relay(c, types.RelayFormatOpenAI)
+	})
+	engine.POST("/v1/completions", func(c *gin.Context) {
+		Relay(c, types.RelayFormatOpenAI)
+	})
+	engine.POST("/v1/embeddings", func(c *gin.Context) {
+		Relay(c, types.RelayFormatEmbedding)
+	})
+	engine.POST("/v1/responses", func(c *gin.Context) {
+		Relay(c, types.RelayFormatOpenAIResponses)
+	})
+	return engine
+})
+
+// relayBatchLine executes one input line as the batch owner's token and
+// returns the composed output line.
+func relayBatchLine(ctx context.Context, batch *model.Batch, tokenKey string, index int, line dto.OpenAIBatchInputLine) *model.BatchRequestResult {
+	result := &model.BatchRequestResult{
+		BatchId:   batch.BatchId,
+		LineIndex: index,
+		CustomId:  line.CustomId,
+	}
+	output := dto.OpenAIBatchOutputLine{
+		Id:       fmt.Sprintf("batch_req_%s_%d", batch.BatchId, index),
+		CustomId: line.CustomId,
+	}
+
+	// batch results are collected as a whole, streaming is never used
+	body, err := sjson.DeleteBytes(line.Body, "stream")
+	if err == nil {
+		body, err = sjson.DeleteBytes(body, "stream_options")
+	}
+	if err != nil {
+		output.Error = &dto.OpenAIBatchLineError{Code: "invalid_request", Message: err.Error()}
+		result.Body = marshalBatchOutputLine(output)
+		return result
+	}
+
+	req := httptest.NewRequest(http.MethodPost, line.Url, bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(ctx, batchRelayContextKey{}, batch))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+	// keep token IP allowlists working against the submitter's address
+	req.RemoteAddr = net.JoinHostPort(batch.ClientIp, "0")
+	recorder := httptest.NewRecorder()
+	batchRelayEngine().ServeHTTP(recorder, req)
+
+	responseBody := recorder.Body.Bytes()
+	if !gjson.ValidBytes(responseBody) {
+		responseBody, _ = common.Marshal(string(responseBody))
+	}
+	output.Response = &dto.OpenAIBatchOutputResponse{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       responseBody,
+	}
+	result.Success = recorder.Code == http.StatusOK
+	result.Body = marshalBatchOutputLine(output)
+	return result
+}
+
+func marshalBatchOutputLine(output dto.OpenAIBatchOutputLine) string {
+	data, err := common.Marshal(output)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// finalizeBatch writes the collected results to the output and error files
+// and moves the batch to its terminal status. The terminal status is only set
+// once the files are attached, so an interrupted pass is finished by the next.
+func finalizeBatch(ctx context.Context, batch *model.Batch, terminalStatus string) error {
+	now := common.GetTimestamp()
+	if batch.Status == model.BatchStatusInProgress {
+		updates := map[string]any{"finalizing_at": now}
+		if terminalStatus == model.BatchStatusExpired {
+			// marks the finalizing batch as expiring, see processBatch
+			updates["expired_at"] = now
+		}
+		updated, err := model.UpdateBatchStatus(batch.BatchId, model.BatchStatusInProgress, model.BatchStatusFinalizing, updates)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return nil // status changed concurrently, the next pass picks it up
+		}
+		batch.Status = model.BatchStatusFinalizing
+	}
+
+	var output, errorOutput bytes.Buffer
+	afterLineIndex := -1
+	for {
+		results, err := model.GetBatchRequestResults(batch.BatchId, afterLineIndex, batchResultPageSize)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			target := &output
+			if !result.Success {
+				target = &errorOutput
+			}
+			target.WriteString(result.Body)
+			target.WriteByte('\n')
+			afterLineIndex = result.LineIndex
+		}
+		if len(results) < batchResultPageSize {
+			break
+		}
+	}
+
+	updates := map[string]any{}
+	if output.Len() > 0 {
+		file, err := service.SaveGeneratedFile(batch.UserId, batch.TokenId, batch.BatchId+"_output.jsonl", "batch_output", output.Bytes())
+		if err != nil {
+			return err
+		}
+		updates["output_file_id"] = file.FileId
+	}
+	if errorOutput.Len() > 0 {
+		file, err := service.SaveGeneratedFile(batch.UserId, batch.TokenId, batch.BatchId+"_error.jsonl", "batch_output", errorOutput.Bytes())
+		if err != nil {
+			return err
+		}
+		updates["error_file_id"] = file.FileId
+	}
+	switch terminalStatus {
+	case model.BatchStatusCompleted:
+		updates["completed_at"] = now
+	case model.BatchStatusCancelled:
+		updates["cancelled_at"] = now
+	}
+
+	updated, err := model.UpdateBatchStatus(batch.BatchId, batch.Status, terminalStatus, updates)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return errors.New("batch status changed during finalization")
+	}
+	batch.Status = terminalStatus
+	if err := model.DeleteBatchRequestResults(batch.BatchId); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s failed to clean up results: %v", batch.BatchId, err))
+	}
+	return nil
+}
+
+func failBatch(batch *model.Batch, code string, message string) error {
+	return failBatchWithErrors(batch, []dto.OpenAIBatchError{{Code: code, Message: message}})
+}
+
+func failBatchWithErrors(batch *model.Batch, batchErrors []dto.OpenAIBatchError) error {
+	data, err := common.Marshal(batchErrors)
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	updated, err := model.UpdateBatchStatus(batch.BatchId, batch.Status, model.BatchStatusFailed, map[string]any{
+		"errors":    string(data),
+		"failed_at": now,
+	})
+	if err != nil {
+		return err
+	}
+	if updated {
+		batch.Status = model.BatchStatusFailed
+		batch.FailedAt = now
+	}
+	return nil
+}
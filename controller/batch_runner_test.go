@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"gorm.io/gorm"
+)
+
+// memoryFileStorage keeps stored files in memory and fails every Save while
+// failSave is set.
+type memoryFileStorage struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	failSave bool
+}
+
+func (s *memoryFileStorage) Name() string { return "controller-test" }
+
+func (s *memoryFileStorage) Save(key string, r io.Reader, limit int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failSave {
+		return 0, errors.New("storage unavailable")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return 0, service.ErrFileTooLarge
+	}
+	s.files[key] = data
+	return int64(len(data)), nil
+}
+
+func (s *memoryFileStorage) Open(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, errors.New("stored file not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryFileStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, key)
+	return nil
+}
+
+// useMemoryFileStorage makes the memory storage the active file backend for
+// the duration of the test.
+func useMemoryFileStorage(t *testing.T) *memoryFileStorage {
+	t.Helper()
+	storage := &memoryFileStorage{files: map[string][]byte{}}
+	service.RegisterFileStorage(storage)
+	setting := operation_setting.GetFileSetting()
+	previous := setting.StorageBackend
+	setting.StorageBackend = storage.Name()
+	t.Cleanup(func() { setting.StorageBackend = previous })
+	return storage
+}
+
+func setupBatchControllerTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTokenControllerTestDB(t)
+	if err := db.AutoMigrate(&model.File{}, &model.Batch{}, &model.BatchRequestResult{}); err != nil {
+		t.Fatalf("failed to migrate batch tables: %v", err)
+	}
+	return db
+}
+
+func TestFinalizeExpiredBatchWritesFilesBeforeTerminalStatus(t *testing.T) {
+	setupBatchControllerTestDB(t)
+	storage := useMemoryFileStorage(t)
+
+	batch := &model.Batch{BatchId: "batch_expired", UserId: 1, TokenId: 2, Status: model.BatchStatusInProgress}
+	if err := batch.Insert(); err != nil {
+		t.Fatalf("failed to insert batch: %v", err)
+	}
+	if err := model.SaveBatchRequestResult(&model.BatchRequestResult{BatchId: batch.BatchId, LineIndex: 0, Success: true, Body: `{"id":"line-0"}`}); err != nil {
+		t.Fatalf("failed to save batch result: %v", err)
+	}
+
+	storage.failSave = true
+	if err := finalizeBatch(context.Background(), batch, model.BatchStatusExpired); err == nil {
+		t.Fatal("expected finalize to fail while the storage is unavailable")
+	}
+	stored, err := model.GetBatchByBatchId(batch.BatchId)
+	if err != nil {
+		t.Fatalf("failed to load batch: %v", err)
+	}
+	if stored.Status != model.BatchStatusFinalizing || stored.ExpiredAt == 0 {
+		t.Fatalf("expected an expiring finalizing batch after a failed write, got status %q expired_at %d", stored.Status, stored.ExpiredAt)
+	}
+
+	// the next pass retries the write-out and only then expires the batch
+	storage.failSave = false
+	if _, err := processBatch(context.Background(), stored, func(int, int) {}); err != nil {
+		t.Fatalf("failed to finalize batch: %v", err)
+	}
+	stored, err = model.GetBatchByBatchId(batch.BatchId)
+	if err != nil {
+		t.Fatalf("failed to load batch: %v", err)
+	}
+	if stored.Status != model.BatchStatusExpired || stored.OutputFileId == "" {
+		t.Fatalf("expected an expired batch with an output file, got status %q output %q", stored.Status, stored.OutputFileId)
+	}
+}
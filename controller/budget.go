@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+)
+
+type BudgetRequest struct {
+	TokenId        int    `json:"token_id"`
+	Period         string `json:"period"`
+	QuotaLimit     int64  `json:"quota_limit"`
+	WarningPercent *int   `json:"warning_percent"`
+	Enabled        *bool  `json:"enabled"`
+}
+
+const defaultBudgetWarningPercent = 80
+
+func (req *BudgetRequest) applyTo(budget *model.Budget) {
+	budget.QuotaLimit = req.QuotaLimit
+	if req.WarningPercent != nil {
+		budget.WarningPercent = *req.WarningPercent
+	}
+	if req.Enabled != nil {
+		budget.Enabled = *req.Enabled
+	}
+}
+
+func listBudgetUsages(c *gin.Context, userId int) {
+	budgets, err := model.GetUserBudgets(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	usages, err := model.GetBudgetUsages(budgets)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usages)
+}
+
+func createBudget(c *gin.Context, userId int, adminManaged bool) {
+	var req BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.TokenId != 0 {
+		if _, err := model.GetTokenByIds(req.TokenId, userId); err != nil {
+			common.ApiErrorMsg(c, "令牌不存在")
+			return
+		}
+	}
+	budget := &model.Budget{
+		UserId:         userId,
+		TokenId:        req.TokenId,
+		Period:         req.Period,
+		WarningPercent: defaultBudgetWarningPercent,
+		Enabled:        true,
+		AdminManaged:   adminManaged,
+	}
+	req.applyTo(budget)
+	if err := budget.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var count int64
+	if err := model.DB.Model(&model.Budget{}).
+		Where("user_id = ? AND token_id = ? AND period = ?", budget.UserId, budget.TokenId, budget.Period).
+		Count(&count).Error; err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if count > 0 {
+		common.ApiErrorMsg(c, "该周期的预算已存在")
+		return
+	}
+	if err := budget.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budget)
+}
+
+func updateBudget(c *gin.Context, budget *model.Budget) {
+	var req BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	req.applyTo(budget)
+	if err := budget.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := budget.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budget)
+}
+
+// getSelfEditableBudget loads a budget of the current user that the user may
+// change, i.e. one not set by an admin.
+func getSelfEditableBudget(c *gin.Context) (*model.Budget, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	budget, err := model.GetUserBudgetById(id, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, model.ErrBudgetNotFound) {
+			common.ApiErrorMsg(c, "预算不存在")
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, false
+	}
+	if budget.AdminManaged {
+		common.ApiErrorMsg(c, "该预算由管理员设置，无法修改")
+		return nil, false
+	}
+	return budget, true
+}
+
+func getAdminBudget(c *gin.Context) (*model.Budget, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	budget, err := model.GetBudgetById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrBudgetNotFound) {
+			common.ApiErrorMsg(c, "预算不存在")
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, false
+	}
+	return budget, true
+}
+
+// ---- User APIs ----
+
+func GetSelfBudgets(c *gin.Context) {
+	listBudgetUsages(c, c.GetInt("id"))
+}
+
+func CreateSelfBudget(c *gin.Context) {
+	createBudget(c, c.GetInt("id"), false)
+}
+
+func UpdateSelfBudget(c *gin.Context) {
+	budget, ok := getSelfEditableBudget(c)
+	if !ok {
+		return
+	}
+	updateBudget(c, budget)
+}
+
+func DeleteSelfBudget(c *gin.Context) {
+	budget, ok := getSelfEditableBudget(c)
+	if !ok {
+		return
+	}
+	if err := budget.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetTokenBudgetUsage returns the budgets limiting the token of the request,
+// its own and the ones of its user, with the spend of their current window.
+func GetTokenBudgetUsage(c *gin.Context) {
+	tokenId := c.GetInt("token_id")
+	budgets, err := model.GetUserBudgets(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	applicable := make([]*model.Budget, 0, len(budgets))
+	for _, budget := range budgets {
+		if budget.Enabled && budget.AppliesTo(tokenId) {
+			applicable = append(applicable, budget)
+		}
+	}
+	usages, err := model.GetBudgetUsages(applicable)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usages)
+}
+
+// ---- Admin APIs ----
+
+func AdminListUserBudgets(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	if userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户ID")
+		return
+	}
+	listBudgetUsages(c, userId)
+}
+
+func AdminCreateUserBudget(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	if userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户ID")
+		return
+	}
+	createBudget(c, userId, true)
+}
+
+func AdminUpdateBudget(c *gin.Context) {
+	budget, ok := getAdminBudget(c)
+	if !ok {
+		return
+	}
+	updateBudget(c, budget)
+}
+
+func AdminDeleteBudget(c *gin.Context) {
+	budget, ok := getAdminBudget(c)
+	if !ok {
+		return
+	}
+	if err := budget.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
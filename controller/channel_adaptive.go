@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	channelscore "github.com/QuantumNous/new-api/pkg/channel_score"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelAdaptiveScores returns the live adaptive routing scores. With
+// group and model the channels serving them are scored tier by tier as the
+// channel selection sees them; otherwise every tracked channel is scored on
+// its own, so its factor only reflects its success rate.
+func GetChannelAdaptiveScores(c *gin.Context) {
+	group := c.Query("group")
+	modelName := c.Query("model")
+	if group != "" && modelName != "" {
+		tiers, err := model.GetAdaptiveChannelScores(group, modelName)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		common.ApiSuccess(c, gin.H{
+			"enabled": channelscore.Enabled(),
+			"tiers":   tiers,
+		})
+		return
+	}
+
+	channelIds := channelscore.TrackedChannelIds()
+	sort.Ints(channelIds)
+	scores := make([]channelscore.Score, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		scores = append(scores, channelscore.Scores([]int{channelId})...)
+	}
+	common.ApiSuccess(c, gin.H{
+		"enabled": channelscore.Enabled(),
+		"scores":  scores,
+	})
+}
+
+// ResetChannelAdaptiveScores drops all scores so every channel falls back to
+// its static weight.
+func ResetChannelAdaptiveScores(c *gin.Context) {
+	channelscore.Reset()
+	common.ApiSuccess(c, nil)
+}
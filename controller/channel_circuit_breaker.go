@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelCircuitBreakers lists the channels and keys whose circuit
+// breaker is open or half-open.
+func GetChannelCircuitBreakers(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"enabled":  operation_setting.GetCircuitBreakerSetting().Enabled,
+		"breakers": circuitbreaker.Statuses(),
+	})
+}
+
+// ResetChannelCircuitBreakers closes the breakers of channel_id, or all
+// breakers when no channel is given.
+func ResetChannelCircuitBreakers(c *gin.Context) {
+	raw := c.Query("channel_id")
+	if raw == "" {
+		circuitbreaker.ResetAll()
+		common.ApiSuccess(c, nil)
+		return
+	}
+	channelId, err := strconv.Atoi(raw)
+	if err != nil {
+		common.ApiErrorMsg(c, "invalid channel_id")
+		return
+	}
+	circuitbreaker.ResetChannel(channelId)
+	common.ApiSuccess(c, nil)
+}
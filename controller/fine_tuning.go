@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	taskfinetune "github.com/QuantumNous/new-api/relay/channel/task/finetune"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	fineTuningListDefaultLimit = 20
+	fineTuningListMaxLimit     = 100
+)
+
+// getOwnedFineTuningJob loads the :id fine-tuning task of the calling user
+// and writes a 404 when it does not exist.
+func getOwnedFineTuningJob(c *gin.Context) (*model.Task, bool) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to query fine-tuning job %s: %s", c.Param("id"), err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to query fine-tuning job")
+		return nil, false
+	}
+	if !exist || task.Platform != constant.TaskPlatformFineTune {
+		openAIFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such fine-tuning job: %s", c.Param("id")))
+		return nil, false
+	}
+	return task, true
+}
+
+// fineTuningJobObject returns the last known upstream job of a task with the
+// public task id in place of the upstream id.
+func fineTuningJobObject(task *model.Task) json.RawMessage {
+	data, err := taskfinetune.PublicJobData(task.Data, task.TaskID)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{
+			"id":     task.TaskID,
+			"object": "fine_tuning.job",
+			"status": task.Status,
+		})
+	}
+	return data
+}
+
+func ListFineTuningJobs(c *gin.Context) {
+	limit := fineTuningListDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			limit = min(parsed, fineTuningListMaxLimit)
+		}
+	}
+	// fetch one extra row to compute has_more
+	tasks, err := model.ListUserPlatformTasks(c.GetInt("id"), constant.TaskPlatformFineTune, c.Query("after"), limit+1)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to list fine-tuning jobs: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to list fine-tuning jobs")
+		return
+	}
+	hasMore := false
+	if len(tasks) > limit {
+		hasMore = true
+		tasks = tasks[:limit]
+	}
+	data := make([]json.RawMessage, 0, len(tasks))
+	for _, task := range tasks {
+		data = append(data, fineTuningJobObject(task))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	})
+}
+
+func RetrieveFineTuningJob(c *gin.Context) {
+	task, ok := getOwnedFineTuningJob(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", fineTuningJobObject(task))
+}
+
+func CancelFineTuningJob(c *gin.Context) {
+	task, ok := getOwnedFineTuningJob(c)
+	if !ok {
+		return
+	}
+	body, ok := proxyFineTuningJobRequest(c, task, http.MethodPost, "/cancel", nil)
+	if !ok {
+		return
+	}
+	data, err := taskfinetune.PublicJobData(body, task.TaskID)
+	if err != nil {
+		openAIFileError(c, http.StatusBadGateway, "upstream_error", "invalid upstream response")
+		return
+	}
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+func ListFineTuningJobEvents(c *gin.Context) {
+	task, ok := getOwnedFineTuningJob(c)
+	if !ok {
+		return
+	}
+	query := url.Values{}
+	for _, name := range []string{"after", "limit"} {
+		if value := c.Query(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	body, ok := proxyFineTuningJobRequest(c, task, http.MethodGet, "/events", query)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// proxyFineTuningJobRequest forwards a job request upstream and writes an
+// error response when it fails.
+func proxyFineTuningJobRequest(c *gin.Context, task *model.Task, method string, subPath string, query url.Values) ([]byte, bool) {
+	resp, err := service.DoFineTuningJobRequest(c.Request.Context(), task, method, subPath, query)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("fine-tuning job %s request failed: %s", task.TaskID, err.Error()))
+		openAIFileError(c, http.StatusBadGateway, "upstream_error", "failed to reach upstream")
+		return nil, false
+	}
+	body, err := service.ReadFineTuningJobResponse(resp)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("fine-tuning job %s request failed: %s", task.TaskID, err.Error()))
+		openAIFileError(c, http.StatusBadGateway, "upstream_error", "upstream rejected the request")
+		return nil, false
+	}
+	return body, true
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -149,3 +150,17 @@ func GetLogsSelfStat(c *gin.Context) {
 	})
 	return
 }
+
+// GetLogBody returns the request and response bodies captured for a request.
+func GetLogBody(c *gin.Context) {
+	body, err := model.GetLogBodyByRequestId(c.Param("request_id"))
+	if err != nil {
+		if errors.Is(err, model.ErrLogBodyNotFound) {
+			common.ApiErrorMsg(c, "未记录该请求的内容")
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, body)
+}
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	fileListDefaultLimit = 20
+	fileListMaxLimit     = 10000
+	fileFormMemoryBytes  = 32 << 20
+)
+
+// openAIFileError writes an OpenAI-style error for the /v1/files family.
+func openAIFileError(c *gin.Context, status int, errType string, message string) {
+	c.JSON(status, gin.H{
+		"error": types.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    errType,
+		},
+	})
+}
+
+// getOwnedFile loads the :id file for the calling token and writes a 404 when
+// it does not exist or belongs to another token.
+func getOwnedFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetTokenFile(c.GetInt("id"), c.GetInt("token_id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIFileError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			logger.LogError(c, fmt.Sprintf("failed to query file %s: %s", c.Param("id"), err.Error()))
+			openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to query file")
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+func UploadFile(c *gin.Context) {
+	if !operation_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+
+	group := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	quota := common.GetContextKeyInt(c, constant.ContextKeyUserQuota)
+	limit, err := service.FileUploadLimit(userId, group, quota)
+	if err != nil {
+		if errors.Is(err, service.ErrFileStorageQuotaExceeded) {
+			openAIFileError(c, http.StatusForbidden, "insufficient_quota", "file storage quota exceeded, delete unused files first")
+			return
+		}
+		if errors.Is(err, service.ErrFileUploadQuotaExhausted) {
+			openAIFileError(c, http.StatusForbidden, "insufficient_quota", "user quota is exhausted")
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("failed to compute file upload limit: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to check file storage quota")
+		return
+	}
+
+	form, err := readFileUploadForm(c)
+	if err != nil {
+		if common.IsRequestBodyTooLargeError(err) {
+			openAIFileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", err.Error())
+			return
+		}
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	defer form.RemoveAll()
+
+	purpose := ""
+	if values := form.Value["purpose"]; len(values) > 0 {
+		purpose = values[0]
+	}
+	if purpose == "" {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "'purpose' is a required property")
+		return
+	}
+	if !operation_setting.IsFilePurposeAllowed(purpose) {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("purpose %s is not allowed", purpose))
+		return
+	}
+	fileHeaders := form.File["file"]
+	if len(fileHeaders) == 0 {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", "'file' is a required property")
+		return
+	}
+	fileHeader := fileHeaders[0]
+	if fileHeader.Size > limit {
+		openAIFileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("file exceeds the maximum allowed size of %d bytes", limit))
+		return
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		openAIFileError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	file, err := service.SaveUploadedFile(userId, tokenId, fileHeader.Filename, purpose, src, limit)
+	_ = src.Close()
+	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) {
+			openAIFileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", err.Error())
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("failed to save uploaded file: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to save file")
+		return
+	}
+
+	// The distributor only selects a channel when the form names a model.
+	channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+	channelType := common.GetContextKeyInt(c, constant.ContextKeyChannelType)
+	if channelId != 0 && operation_setting.GetFileSetting().ForwardToUpstream && service.IsFileForwardableChannel(channelType) {
+		keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+		if err := service.ForwardFileToChannel(c.Request.Context(), file, channelId, keyIndex); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to forward file %s to channel #%d: %s", file.FileId, channelId, err.Error()))
+			_ = service.DeleteStoredFile(c.Request.Context(), file)
+			openAIFileError(c, http.StatusBadGateway, "upstream_error", "failed to upload file to upstream channel")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, service.FileToOpenAIObject(file))
+}
+
+// readFileUploadForm parses the cached request body as multipart form data.
+// Parts larger than fileFormMemoryBytes spill to temporary files.
+func readFileUploadForm(c *gin.Context) (*multipart.Form, error) {
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, errors.New("request must be multipart/form-data")
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return multipart.NewReader(storage, params["boundary"]).ReadForm(fileFormMemoryBytes)
+}
+
+func ListFiles(c *gin.Context) {
+	if !operation_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	limit := fileListDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			limit = min(parsed, fileListMaxLimit)
+		}
+	}
+	// fetch one extra row to compute has_more
+	files, err := model.ListTokenFiles(c.GetInt("id"), c.GetInt("token_id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to list files: %s", err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to list files")
+		return
+	}
+	response := dto.OpenAIFileList{
+		Object: "list",
+		Data:   make([]dto.OpenAIFile, 0, len(files)),
+	}
+	if len(files) > limit {
+		response.HasMore = true
+		files = files[:limit]
+	}
+	for _, file := range files {
+		response.Data = append(response.Data, service.FileToOpenAIObject(file))
+	}
+	if len(response.Data) > 0 {
+		response.FirstId = response.Data[0].Id
+		response.LastId = response.Data[len(response.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	if !operation_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	file, ok := getOwnedFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAIObject(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	if !operation_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	file, ok := getOwnedFile(c)
+	if !ok {
+		return
+	}
+	reader, err := service.OpenStoredFile(c.Request.Context(), file)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to open file %s: %s", file.FileId, err.Error()))
+		openAIFileError(c, http.StatusNotFound, "invalid_request_error", "file content is no longer available")
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, nil)
+}
+
+func DeleteFile(c *gin.Context) {
+	if !operation_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	file, ok := getOwnedFile(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteStoredFile(c.Request.Context(), file); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to delete file %s: %s", file.FileId, err.Error()))
+		openAIFileError(c, http.StatusInternalServerError, "server_error", "failed to delete file")
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{
+		Id:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
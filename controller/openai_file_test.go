@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+)
+
+type fileTestCaller struct {
+	userId  int
+	tokenId int
+	group   string
+	quota   int
+}
+
+// useFileSetting enables the files API and applies update to its setting for
+// the duration of the test.
+func useFileSetting(t *testing.T, update func(setting *operation_setting.FileSetting)) {
+	t.Helper()
+	current := operation_setting.GetFileSetting()
+	saved := *current
+	current.Enabled = true
+	if update != nil {
+		update(current)
+	}
+	t.Cleanup(func() { *current = saved })
+}
+
+func setupFileControllerTest(t *testing.T) *memoryFileStorage {
+	t.Helper()
+	db := setupBatchControllerTestDB(t)
+	if err := db.AutoMigrate(&model.Channel{}); err != nil {
+		t.Fatalf("failed to migrate channel table: %v", err)
+	}
+	memoryCacheEnabled := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	t.Cleanup(func() { common.MemoryCacheEnabled = memoryCacheEnabled })
+	if service.GetHttpClient() == nil {
+		service.InitHttpClient()
+	}
+	storage := useMemoryFileStorage(t)
+	useFileSetting(t, nil)
+	return storage
+}
+
+func newFileRequestContext(t *testing.T, caller fileTestCaller, method string, target string, fileId string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(method, target, nil)
+	ctx.Set("id", caller.userId)
+	ctx.Set("token_id", caller.tokenId)
+	common.SetContextKey(ctx, constant.ContextKeyUserGroup, caller.group)
+	common.SetContextKey(ctx, constant.ContextKeyUserQuota, caller.quota)
+	if fileId != "" {
+		ctx.Params = gin.Params{{Key: "id", Value: fileId}}
+	}
+	return ctx, recorder
+}
+
+// callUploadFile uploads content as caller, optionally through channelId as
+// if the distributor had selected it for the form's model.
+func callUploadFile(t *testing.T, caller fileTestCaller, content string, channelId int) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("purpose", "batch"); err != nil {
+		t.Fatalf("failed to write purpose: %v", err)
+	}
+	part, err := writer.CreateFormFile("file", "input.jsonl")
+	if err != nil {
+		t.Fatalf("failed to create file part: %v", err)
+	}
+	_, _ = io.WriteString(part, content)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close form: %v", err)
+	}
+
+	ctx, recorder := newFileRequestContext(t, caller, http.MethodPost, "/v1/files", "")
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	ctx.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	if channelId != 0 {
+		common.SetContextKey(ctx, constant.ContextKeyChannelId, channelId)
+		common.SetContextKey(ctx, constant.ContextKeyChannelType, constant.ChannelTypeOpenAI)
+	}
+	UploadFile(ctx)
+	common.CleanupBodyStorage(ctx)
+	return recorder
+}
+
+func uploadTestFile(t *testing.T, caller fileTestCaller, content string, channelId int) dto.OpenAIFile {
+	t.Helper()
+	recorder := callUploadFile(t, caller, content, channelId)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected upload to succeed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var file dto.OpenAIFile
+	if err := common.Unmarshal(recorder.Body.Bytes(), &file); err != nil {
+		t.Fatalf("failed to decode uploaded file: %v", err)
+	}
+	return file
+}
+
+func listTestFiles(t *testing.T, caller fileTestCaller) dto.OpenAIFileList {
+	t.Helper()
+	ctx, recorder := newFileRequestContext(t, caller, http.MethodGet, "/v1/files", "")
+	ListFiles(ctx)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected list to succeed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var list dto.OpenAIFileList
+	if err := common.Unmarshal(recorder.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode file list: %v", err)
+	}
+	return list
+}
+
+func TestFileHandlersDenyOtherTokens(t *testing.T) {
+	setupFileControllerTest(t)
+	owner := fileTestCaller{userId: 1, tokenId: 10, group: "default", quota: 1000}
+	sibling := fileTestCaller{userId: 1, tokenId: 11, group: "default", quota: 1000}
+	stranger := fileTestCaller{userId: 2, tokenId: 10, group: "default", quota: 1000}
+
+	file := uploadTestFile(t, owner, `{"custom_id":"a"}`, 0)
+
+	for _, caller := range []fileTestCaller{sibling, stranger} {
+		if list := listTestFiles(t, caller); len(list.Data) != 0 {
+			t.Fatalf("expected token %d of user %d to list no files, got %+v", caller.tokenId, caller.userId, list.Data)
+		}
+		for name, handler := range map[string]gin.HandlerFunc{
+			"retrieve": RetrieveFile,
+			"content":  RetrieveFileContent,
+			"delete":   DeleteFile,
+		} {
+			ctx, recorder := newFileRequestContext(t, caller, http.MethodGet, "/v1/files/"+file.Id, file.Id)
+			handler(ctx)
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected %s by token %d of user %d to be denied with 404, got %d", name, caller.tokenId, caller.userId, recorder.Code)
+			}
+		}
+	}
+
+	list := listTestFiles(t, owner)
+	if len(list.Data) != 1 || list.Data[0].Id != file.Id {
+		t.Fatalf("expected the owner to still list the file, got %+v", list.Data)
+	}
+	ctx, recorder := newFileRequestContext(t, owner, http.MethodGet, "/v1/files/"+file.Id+"/content", file.Id)
+	RetrieveFileContent(ctx)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"custom_id":"a"}` {
+		t.Fatalf("expected the owner to read the content, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	ctx, recorder = newFileRequestContext(t, owner, http.MethodDelete, "/v1/files/"+file.Id, file.Id)
+	DeleteFile(ctx)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the owner to delete the file, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestForwardedFileIdsMapToUpstream(t *testing.T) {
+	storage := setupFileControllerTest(t)
+	owner := fileTestCaller{userId: 1, tokenId: 10, group: "default", quota: 1000}
+
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/files":
+			_, _ = io.WriteString(w, `{"id":"file-upstream-1","object":"file"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/files/file-upstream-1/content":
+			_, _ = io.WriteString(w, "upstream content")
+		case r.Method == http.MethodDelete && r.URL.Path == "/v1/files/file-upstream-1":
+			_, _ = io.WriteString(w, `{"id":"file-upstream-1","deleted":true}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	baseURL := upstream.URL
+	channel := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-upstream", Name: "files", BaseURL: &baseURL, Status: common.ChannelStatusEnabled}
+	if err := model.DB.Create(channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+
+	file := uploadTestFile(t, owner, "local content", channel.Id)
+	if file.Id == "file-upstream-1" {
+		t.Fatal("expected the gateway to answer with its own file id")
+	}
+	stored, err := model.GetTokenFile(owner.userId, owner.tokenId, file.Id)
+	if err != nil {
+		t.Fatalf("failed to load stored file: %v", err)
+	}
+	if stored.ChannelId != channel.Id || stored.UpstreamFileId != "file-upstream-1" {
+		t.Fatalf("expected the file to map to the upstream id on channel %d, got channel %d id %q", channel.Id, stored.ChannelId, stored.UpstreamFileId)
+	}
+
+	ctx, recorder := newFileRequestContext(t, owner, http.MethodGet, "/v1/files/"+file.Id, file.Id)
+	RetrieveFile(ctx)
+	var retrieved dto.OpenAIFile
+	if err := common.Unmarshal(recorder.Body.Bytes(), &retrieved); err != nil || retrieved.Id != file.Id {
+		t.Fatalf("expected retrieve to answer with the gateway id, got %s", recorder.Body.String())
+	}
+
+	// without a local copy the content is read through the mapped upstream id
+	_ = storage.Delete(stored.StorageKey)
+	ctx, recorder = newFileRequestContext(t, owner, http.MethodGet, "/v1/files/"+file.Id+"/content", file.Id)
+	RetrieveFileContent(ctx)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "upstream content" {
+		t.Fatalf("expected the upstream content, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	ctx, recorder = newFileRequestContext(t, owner, http.MethodDelete, "/v1/files/"+file.Id, file.Id)
+	DeleteFile(ctx)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected delete to succeed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last := requests[len(requests)-1]; last != "DELETE /v1/files/file-upstream-1" {
+		t.Fatalf("expected the upstream copy to be deleted by its upstream id, got requests %v", requests)
+	}
+}
+
+func TestFileUploadLimitFollowsGroupAndQuota(t *testing.T) {
+	setupFileControllerTest(t)
+	useFileSetting(t, func(setting *operation_setting.FileSetting) {
+		setting.MaxUserStorageMB = 0
+		setting.GroupMaxUserStorageMB = map[string]int{"trial": 1}
+	})
+
+	broke := fileTestCaller{userId: 1, tokenId: 10, group: "default", quota: 0}
+	if recorder := callUploadFile(t, broke, "data", 0); recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected a user without quota to be refused, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	content := string(bytes.Repeat([]byte("a"), 1<<20+1))
+	trial := fileTestCaller{userId: 2, tokenId: 20, group: "trial", quota: 1000}
+	if recorder := callUploadFile(t, trial, content, 0); recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the trial group storage cap to apply, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	paid := fileTestCaller{userId: 3, tokenId: 30, group: "default", quota: 1000}
+	uploadTestFile(t, paid, content, 0)
+}
@@ -0,0 +1,493 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationRequest struct {
+	Name   string  `json:"name"`
+	Group  *string `json:"group"`
+	Status *int    `json:"status"`
+}
+
+type OrganizationQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+type OrganizationMemberRequest struct {
+	UserId         int     `json:"user_id"`
+	Username       string  `json:"username"`
+	Role           *string `json:"role"`
+	QuotaLimit     *int    `json:"quota_limit"`
+	ResetUsedQuota bool    `json:"reset_used_quota"`
+}
+
+type OrganizationSubscriptionRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+func (req *OrganizationRequest) applyTo(organization *model.Organization) {
+	if req.Name != "" {
+		organization.Name = req.Name
+	}
+	if req.Group != nil {
+		organization.Group = *req.Group
+	}
+	if req.Status != nil {
+		organization.Status = *req.Status
+	}
+}
+
+func (req *OrganizationMemberRequest) applyTo(member *model.OrganizationMember) {
+	if req.Role != nil {
+		member.Role = *req.Role
+	}
+	if req.QuotaLimit != nil {
+		member.QuotaLimit = *req.QuotaLimit
+	}
+}
+
+func respondOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrOrganizationNotFound):
+		common.ApiErrorMsg(c, "组织不存在")
+	case errors.Is(err, model.ErrOrganizationMemberNotFound):
+		common.ApiErrorMsg(c, "组织成员不存在")
+	case errors.Is(err, model.ErrUserAlreadyInOrganization):
+		common.ApiErrorMsg(c, "该用户已属于一个组织")
+	case errors.Is(err, model.ErrOrganizationInvitationNotFound):
+		common.ApiErrorMsg(c, "邀请不存在或已处理")
+	default:
+		common.ApiError(c, err)
+	}
+}
+
+func getAdminOrganization(c *gin.Context) (*model.Organization, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	organization, err := model.GetOrganizationById(id)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return nil, false
+	}
+	return organization, true
+}
+
+// getSelfAdminOrganization loads the organization of the current user,
+// which has to be one of its admins.
+func getSelfAdminOrganization(c *gin.Context) (*model.Organization, bool) {
+	organization, member, err := model.GetUserOrganization(c.GetInt("id"))
+	if err != nil {
+		respondOrganizationError(c, err)
+		return nil, false
+	}
+	if member.Role != model.OrganizationRoleAdmin {
+		common.ApiErrorMsg(c, "仅组织管理员可以执行此操作")
+		return nil, false
+	}
+	return organization, true
+}
+
+// getOrganizationMember loads the member given by the user_id path parameter
+// of organization.
+func getOrganizationMember(c *gin.Context, organization *model.Organization) (*model.OrganizationMember, bool) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	member, err := model.GetOrganizationMemberByUserId(userId)
+	if err == nil && member.OrganizationId != organization.Id {
+		err = model.ErrOrganizationMemberNotFound
+	}
+	if err != nil {
+		respondOrganizationError(c, err)
+		return nil, false
+	}
+	return member, true
+}
+
+func listOrganizationMembers(c *gin.Context, organization *model.Organization) {
+	members, err := model.GetOrganizationMembers(organization.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+// resolveOrganizationMemberUser returns the id of the user named by the
+// username or user_id of req, or 0 when there is no such user.
+func resolveOrganizationMemberUser(req *OrganizationMemberRequest) int {
+	if req.Username != "" {
+		user := model.User{Username: req.Username}
+		if err := model.DB.Select("id").Where("username = ?", req.Username).First(&user).Error; err != nil {
+			return 0
+		}
+		return user.Id
+	}
+	if _, err := model.GetUserById(req.UserId, false); err != nil {
+		return 0
+	}
+	return req.UserId
+}
+
+// addOrganizationMember adds a user directly; only site admins may do so.
+func addOrganizationMember(c *gin.Context, organization *model.Organization) {
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	userId := resolveOrganizationMemberUser(&req)
+	if userId == 0 {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	member := &model.OrganizationMember{
+		OrganizationId: organization.Id,
+		UserId:         userId,
+		Role:           model.OrganizationRoleMember,
+	}
+	req.applyTo(member)
+	if err := model.AddOrganizationMember(member); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func updateOrganizationMember(c *gin.Context, organization *model.Organization) {
+	member, ok := getOrganizationMember(c, organization)
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	req.applyTo(member)
+	if err := model.UpdateOrganizationMember(member); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.ResetUsedQuota {
+		if err := model.ResetOrganizationMemberUsedQuota(member); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	common.ApiSuccess(c, member)
+}
+
+func removeOrganizationMember(c *gin.Context, organization *model.Organization) {
+	member, ok := getOrganizationMember(c, organization)
+	if !ok {
+		return
+	}
+	if err := model.RemoveOrganizationMember(member); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func getOrganizationUsage(c *gin.Context, organization *model.Organization) {
+	startTimestamp, endTimestamp, ok := parseFlowQuotaTimeRange(c)
+	if !ok {
+		return
+	}
+	usage, err := model.GetOrganizationUsage(organization.Id, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usage)
+}
+
+// ---- User APIs ----
+
+// GetSelfOrganization returns the organization of the current user and its
+// membership, or null when the user belongs to none.
+func GetSelfOrganization(c *gin.Context) {
+	organization, member, err := model.GetUserOrganization(c.GetInt("id"))
+	if errors.Is(err, model.ErrOrganizationMemberNotFound) {
+		common.ApiSuccess(c, nil)
+		return
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": organization,
+		"member":       member,
+	})
+}
+
+func GetSelfOrganizationMembers(c *gin.Context) {
+	organization, ok := getSelfAdminOrganization(c)
+	if !ok {
+		return
+	}
+	listOrganizationMembers(c, organization)
+}
+
+// AddSelfOrganizationMember invites a user to the organization of the
+// current admin; the user joins once it accepts. The response is the same
+// whether the user exists or not, so it can not be used to probe usernames.
+func AddSelfOrganizationMember(c *gin.Context) {
+	organization, ok := getSelfAdminOrganization(c)
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	invitation := &model.OrganizationInvitation{
+		OrganizationId: organization.Id,
+		Role:           model.OrganizationRoleMember,
+		InviterId:      c.GetInt("id"),
+	}
+	if req.Role != nil {
+		invitation.Role = *req.Role
+	}
+	if req.QuotaLimit != nil {
+		invitation.QuotaLimit = *req.QuotaLimit
+	}
+	if userId := resolveOrganizationMemberUser(&req); userId != 0 && userId != invitation.InviterId {
+		invitation.UserId = userId
+		if err := model.InviteOrganizationMember(invitation); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetSelfOrganizationInvitations lists the pending invitations of the
+// current user.
+func GetSelfOrganizationInvitations(c *gin.Context) {
+	invitations, err := model.GetPendingOrganizationInvitations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invitations)
+}
+
+func AcceptSelfOrganizationInvitation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	member, err := model.AcceptOrganizationInvitation(id, c.GetInt("id"))
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func DeclineSelfOrganizationInvitation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeclineOrganizationInvitation(id, c.GetInt("id")); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func UpdateSelfOrganizationMember(c *gin.Context) {
+	organization, ok := getSelfAdminOrganization(c)
+	if !ok {
+		return
+	}
+	updateOrganizationMember(c, organization)
+}
+
+func RemoveSelfOrganizationMember(c *gin.Context) {
+	organization, ok := getSelfAdminOrganization(c)
+	if !ok {
+		return
+	}
+	if c.Param("user_id") == strconv.Itoa(c.GetInt("id")) {
+		common.ApiErrorMsg(c, "不能将自己移出组织")
+		return
+	}
+	removeOrganizationMember(c, organization)
+}
+
+func GetSelfOrganizationUsage(c *gin.Context) {
+	organization, ok := getSelfAdminOrganization(c)
+	if !ok {
+		return
+	}
+	getOrganizationUsage(c, organization)
+}
+
+// ---- Admin APIs ----
+
+func AdminListOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	organizations, total, err := model.GetAllOrganizations(pageInfo, c.Query("keyword"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(organizations)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AdminCreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	organization := &model.Organization{Status: model.OrganizationStatusEnabled}
+	req.applyTo(organization)
+	if err := organization.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := organization.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organization)
+}
+
+func AdminUpdateOrganization(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	req.applyTo(organization)
+	if err := organization.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := organization.Update(); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organization)
+}
+
+func AdminDeleteOrganization(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	if err := organization.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// AdminAddOrganizationQuota tops up the quota pool of an organization; a
+// negative quota takes from it.
+func AdminAddOrganizationQuota(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	var req OrganizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Quota == 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := model.AddOrganizationQuota(organization.Id, req.Quota); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	recordManageAudit(c, "organization.quota_add", map[string]interface{}{
+		"id":    organization.Id,
+		"name":  organization.Name,
+		"quota": logger.LogQuota(req.Quota),
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func AdminListOrganizationMembers(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	listOrganizationMembers(c, organization)
+}
+
+func AdminAddOrganizationMember(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	addOrganizationMember(c, organization)
+}
+
+func AdminUpdateOrganizationMember(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	updateOrganizationMember(c, organization)
+}
+
+func AdminRemoveOrganizationMember(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	removeOrganizationMember(c, organization)
+}
+
+func AdminListOrganizationSubscriptions(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	subs, err := model.GetOrganizationSubscriptions(organization.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subs)
+}
+
+func AdminCreateOrganizationSubscription(c *gin.Context) {
+	if !requirePaymentCompliance(c) {
+		return
+	}
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	var req OrganizationSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	sub, err := model.AdminBindOrganizationSubscription(organization.Id, req.PlanId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sub)
+}
+
+func AdminGetOrganizationUsage(c *gin.Context) {
+	organization, ok := getAdminOrganization(c)
+	if !ok {
+		return
+	}
+	getOrganizationUsage(c, organization)
+}
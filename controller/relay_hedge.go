@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeChannelPickAttempts bounds the draws spent looking for a hedge
+// channel other than the one already in use.
+const hedgeChannelPickAttempts = 3
+
+// relayWithHedge relays the request on channel and, when no response byte
+// arrived within the hedge delay, sends it to a second channel as well. The
+// attempt that streams first is connected to the client and the other one
+// is canceled. It returns the channel of the attempt whose result is
+// returned, so the retry loop records the outcome against it.
+func relayWithHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, channel *model.Channel) (*model.Channel, *types.NewAPIError) {
+	race := service.NewHedgeRace(c)
+	primary, err := race.NewAttempt(c, relayInfo, false)
+	if err != nil {
+		logger.LogWarn(c, "failed to prepare hedged request: "+err.Error())
+		return channel, relayHandler(c, relayInfo)
+	}
+	primary.ChannelId = channel.Id
+	primary.Run(relayHandler)
+
+	timer := time.NewTimer(service.GetHedgeDelay())
+	defer timer.Stop()
+	select {
+	case <-primary.Won():
+		<-primary.Done()
+		return adoptHedgeAttempt(c, relayInfo, primary, channel)
+	case <-primary.Done():
+		return adoptHedgeAttempt(c, relayInfo, primary, channel)
+	case <-timer.C:
+	}
+
+	secondary, hedgeChannel := startHedgeAttempt(c, relayInfo, retryParam, race, channel.Id)
+	if secondary == nil {
+		<-primary.Done()
+		return adoptHedgeAttempt(c, relayInfo, primary, channel)
+	}
+	addUsedChannel(c, hedgeChannel.Id)
+	logger.LogInfo(c, fmt.Sprintf("hedging request: channel #%d has not responded, also sent to channel #%d", channel.Id, hedgeChannel.Id))
+
+	primaryDone, secondaryDone := primary.Done(), secondary.Done()
+	for race.Winner() == nil && (primaryDone != nil || secondaryDone != nil) {
+		select {
+		case <-primary.Won():
+		case <-secondary.Won():
+		case <-primaryDone:
+			primaryDone = nil
+		case <-secondaryDone:
+			secondaryDone = nil
+		}
+	}
+
+	winner := race.Winner()
+	if winner == nil {
+		// both failed: the primary's error goes back to the retry loop
+		reportHedgeAttemptError(secondary, hedgeChannel)
+		return adoptHedgeAttempt(c, relayInfo, primary, channel)
+	}
+	winnerChannel, loser, loserChannel := channel, secondary, hedgeChannel
+	if winner == secondary {
+		winnerChannel, loser, loserChannel = hedgeChannel, primary, channel
+	}
+	select {
+	case <-loser.Done():
+		reportHedgeAttemptError(loser, loserChannel)
+	default:
+		loser.Cancel()
+	}
+	<-winner.Done()
+	<-loser.Done()
+	return adoptHedgeAttempt(c, relayInfo, winner, winnerChannel)
+}
+
+// startHedgeAttempt starts the hedged attempt on a channel other than
+// primaryChannelId. It returns nil when no such channel is available.
+func startHedgeAttempt(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, race *service.HedgeRace, primaryChannelId int) (*service.HedgeAttempt, *model.Channel) {
+	attempt, err := race.NewAttempt(c, relayInfo, true)
+	if err != nil {
+		logger.LogWarn(c, "failed to prepare hedged request: "+err.Error())
+		return nil, nil
+	}
+	param := *retryParam
+	param.Ctx = attempt.Ctx
+	for i := 0; i < hedgeChannelPickAttempts; i++ {
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(&param)
+		if err != nil || channel == nil {
+			break
+		}
+		if channel.Id == primaryChannelId {
+			continue
+		}
+		attempt.Info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(attempt.Ctx, attempt.Info)
+		if setupErr := middleware.SetupContextForSelectedChannel(attempt.Ctx, channel, attempt.Info.OriginModelName); setupErr != nil {
+			break
+		}
+		attempt.ChannelId = channel.Id
+		attempt.Run(relayHandler)
+		return attempt, channel
+	}
+	attempt.Discard()
+	return nil, nil
+}
+
+// adoptHedgeAttempt makes the state of a finished attempt the state of the
+// request, so the retry loop continues from where that attempt left off.
+func adoptHedgeAttempt(c *gin.Context, relayInfo *relaycommon.RelayInfo, attempt *service.HedgeAttempt, channel *model.Channel) (*model.Channel, *types.NewAPIError) {
+	for key, value := range attempt.Ctx.Keys {
+		switch key {
+		case common.KeyBodyStorage, string(constant.ContextKeyHedgeAttempt), "use_channel":
+			continue
+		}
+		c.Set(key, value)
+	}
+	disablePing := relayInfo.DisablePing
+	*relayInfo = *attempt.Info
+	relayInfo.DisablePing = disablePing
+	return channel, attempt.Err
+}
+
+// reportHedgeAttemptError records the failure of an attempt whose error is
+// not returned to the retry loop. Attempts canceled after losing the race
+// are not failures of their channel.
+func reportHedgeAttemptError(attempt *service.HedgeAttempt, channel *model.Channel) {
+	if attempt.Err == nil || attempt.Canceled() {
+		return
+	}
+	newAPIError := service.NormalizeViolationFeeError(attempt.Err)
+	processChannelError(attempt.Ctx, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(attempt.Ctx, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+	service.RecordChannelRelayFailure(channel.Id, newAPIError)
+	service.RecordChannelCircuitResult(attempt.Ctx, channel.Id, newAPIError)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -31,6 +32,29 @@ func buildMaskedTokenResponses(tokens []*model.Token) []*model.Token {
 	return maskedTokens
 }
 
+// normalizeTokenScope validates the scope JSON submitted with a token and
+// returns it re-encoded, or "" when the token is unrestricted.
+func normalizeTokenScope(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	var scope dto.TokenScope
+	if err := common.UnmarshalJsonStr(raw, &scope); err != nil {
+		return "", fmt.Errorf("invalid token scope: %w", err)
+	}
+	if err := scope.Validate(); err != nil {
+		return "", err
+	}
+	normalized, err := common.Marshal(scope)
+	if err != nil {
+		return "", err
+	}
+	if string(normalized) == "{}" {
+		return "", nil
+	}
+	return string(normalized), nil
+}
+
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
 	pageInfo := common.GetPageQuery(c)
@@ -187,6 +211,11 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	scope, err := normalizeTokenScope(token.Scope)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -221,6 +250,8 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ResponseCache:      token.ResponseCache,
+		Scope:              scope,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -271,11 +302,20 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	scope, err := normalizeTokenScope(token.Scope)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if cleanToken.IsDerived() && (statusOnly == "" || token.Status == common.TokenStatusEnabled) {
+		common.ApiErrorMsg(c, "派生令牌只能禁用或删除")
+		return
+	}
 	if token.Status == common.TokenStatusEnabled {
 		if cleanToken.Status == common.TokenStatusExpired && cleanToken.ExpiredTime <= common.GetTimestamp() && cleanToken.ExpiredTime != -1 {
 			common.ApiErrorI18n(c, i18n.MsgTokenExpiredCannotEnable)
@@ -299,6 +339,8 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.Scope = scope
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -357,3 +399,73 @@ func GetTokenKeysBatch(c *gin.Context) {
 	}
 	common.ApiSuccess(c, gin.H{"keys": keysMap})
 }
+
+// AdminGetUserTokens lists the tokens of the user given by the id path
+// parameter, with masked keys.
+func AdminGetUserTokens(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	tokens, err := model.GetAllUserTokens(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	total, _ := model.CountUserTokens(userId)
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(buildMaskedTokenResponses(tokens))
+	common.ApiSuccess(c, pageInfo)
+}
+
+type AdminTokenStatusRequest struct {
+	Status int `json:"status"`
+}
+
+// AdminUpdateTokenStatus enables or disables a token of any user, e.g. to
+// stop a leaked key without touching the rest of the account.
+func AdminUpdateTokenStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	var req AdminTokenStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil ||
+		(req.Status != common.TokenStatusEnabled && req.Status != common.TokenStatusDisabled) {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	token, err := model.GetTokenById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status == common.TokenStatusEnabled {
+		if token.IsDerived() {
+			common.ApiErrorMsg(c, "派生令牌只能禁用或删除")
+			return
+		}
+		if token.Status == common.TokenStatusExpired && token.ExpiredTime <= common.GetTimestamp() && token.ExpiredTime != -1 {
+			common.ApiErrorI18n(c, i18n.MsgTokenExpiredCannotEnable)
+			return
+		}
+		if token.Status == common.TokenStatusExhausted && token.RemainQuota <= 0 && !token.UnlimitedQuota {
+			common.ApiErrorI18n(c, i18n.MsgTokenExhaustedCannotEable)
+			return
+		}
+	}
+	token.Status = req.Status
+	if err := token.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, token.UserId, "token.status_update", map[string]interface{}{
+		"id":     token.Id,
+		"name":   token.Name,
+		"status": token.Status,
+	})
+	common.ApiSuccess(c, buildMaskedTokenResponse(token))
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxDerivedTokenExpiryMinutes = 24 * 60
+	maxTokenRotationGraceMinutes = 7 * 24 * 60
+)
+
+type DeriveTokenRequest struct {
+	Name             string         `json:"name"`
+	ExpiresInMinutes int            `json:"expires_in_minutes"`
+	SpendCap         int            `json:"spend_cap"`    // 额度上限，用量同时计入父令牌
+	ModelLimits      string         `json:"model_limits"` // 逗号分隔，父令牌限制了模型时只能取其子集
+	Scope            dto.TokenScope `json:"scope"`
+}
+
+type RotateTokenRequest struct {
+	GraceMinutes int `json:"grace_minutes"` // 旧 key 继续可用的分钟数，0 表示立即失效
+}
+
+// getSelfToken loads the token given by the id path parameter, which has to
+// belong to the current user.
+func getSelfToken(c *gin.Context) (*model.Token, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return nil, false
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return token, true
+}
+
+// deriveModelLimits returns the model limits of a token derived from parent.
+// Without requested limits the child inherits those of the parent.
+func deriveModelLimits(parent *model.Token, requested string) (bool, string, error) {
+	models := make([]string, 0)
+	for _, name := range strings.Split(requested, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			models = append(models, name)
+		}
+	}
+	if len(models) == 0 {
+		return parent.ModelLimitsEnabled, parent.ModelLimits, nil
+	}
+	if parent.ModelLimitsEnabled {
+		allowed := parent.GetModelLimitsMap()
+		for _, name := range models {
+			if !allowed[name] {
+				return false, "", fmt.Errorf("父令牌不允许使用模型 %s", name)
+			}
+		}
+	}
+	return true, strings.Join(models, ","), nil
+}
+
+// DeriveToken mints a short-lived child of a token, e.g. to hand out to a
+// browser or a job instead of the long-lived key. The child can only narrow
+// what the parent allows, and its usage is also charged to the parent.
+func DeriveToken(c *gin.Context) {
+	parent, ok := getSelfToken(c)
+	if !ok {
+		return
+	}
+	if parent.IsDerived() {
+		common.ApiErrorMsg(c, "派生令牌不能再派生")
+		return
+	}
+	now := common.GetTimestamp()
+	if parent.Status != common.TokenStatusEnabled || (parent.ExpiredTime != -1 && parent.ExpiredTime < now) {
+		common.ApiErrorMsg(c, "父令牌已禁用或已过期")
+		return
+	}
+	var req DeriveTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.ExpiresInMinutes <= 0 || req.ExpiresInMinutes > maxDerivedTokenExpiryMinutes {
+		common.ApiErrorMsg(c, fmt.Sprintf("有效期需在 1 到 %d 分钟之间", maxDerivedTokenExpiryMinutes))
+		return
+	}
+	if req.SpendCap <= 0 {
+		common.ApiErrorMsg(c, "派生令牌必须设置额度上限")
+		return
+	}
+	if !parent.UnlimitedQuota && req.SpendCap > parent.RemainQuota {
+		common.ApiErrorMsg(c, "额度上限不能超过父令牌的剩余额度")
+		return
+	}
+	name := req.Name
+	if name == "" {
+		name = parent.Name
+	}
+	if len(name) > 50 {
+		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
+		return
+	}
+	scope, err := parent.GetScope().Narrow(req.Scope)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rawScope, err := common.Marshal(scope)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	normalizedScope, err := normalizeTokenScope(string(rawScope))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	modelLimitsEnabled, modelLimits, err := deriveModelLimits(parent, req.ModelLimits)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	expiredTime := now + int64(req.ExpiresInMinutes)*60
+	if parent.ExpiredTime != -1 && parent.ExpiredTime < expiredTime {
+		expiredTime = parent.ExpiredTime
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
+		common.SysLog("failed to generate token key: " + err.Error())
+		return
+	}
+	token := &model.Token{
+		Name:               name,
+		Key:                key,
+		CreatedTime:        now,
+		AccessedTime:       now,
+		ExpiredTime:        expiredTime,
+		RemainQuota:        req.SpendCap,
+		ModelLimitsEnabled: modelLimitsEnabled,
+		ModelLimits:        modelLimits,
+		AllowIps:           parent.AllowIps,
+		Group:              parent.Group,
+		CrossGroupRetry:    parent.CrossGroupRetry,
+		ResponseCache:      parent.ResponseCache,
+		Scope:              normalizedScope,
+	}
+	if err := model.InsertDerivedToken(parent, token); err != nil {
+		if errors.Is(err, model.ErrDerivedTokenLimitReached) {
+			common.ApiErrorMsg(c, fmt.Sprintf("每个令牌最多同时存在 %d 个有效的派生令牌", model.MaxActiveDerivedTokens))
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"token": buildMaskedTokenResponse(token),
+		"key":   token.GetFullKey(),
+	})
+}
+
+func GetDerivedTokens(c *gin.Context) {
+	parent, ok := getSelfToken(c)
+	if !ok {
+		return
+	}
+	tokens, err := model.GetDerivedTokens(parent.Id, parent.UserId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, buildMaskedTokenResponses(tokens))
+}
+
+// RotateToken gives a token a new key. The old key keeps working during the
+// requested grace period so integrations can roll over without downtime.
+func RotateToken(c *gin.Context) {
+	token, ok := getSelfToken(c)
+	if !ok {
+		return
+	}
+	if token.IsDerived() {
+		common.ApiErrorMsg(c, "派生令牌不支持轮换，请重新派生")
+		return
+	}
+	var req RotateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.GraceMinutes < 0 || req.GraceMinutes > maxTokenRotationGraceMinutes {
+		common.ApiErrorMsg(c, fmt.Sprintf("宽限期需在 0 到 %d 分钟之间", maxTokenRotationGraceMinutes))
+		return
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
+		common.SysLog("failed to generate token key: " + err.Error())
+		return
+	}
+	if err := token.RotateKey(key, int64(req.GraceMinutes)*60); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"token": buildMaskedTokenResponse(token),
+		"key":   token.GetFullKey(),
+	})
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+)
+
+type derivedTokenResponse struct {
+	Token model.Token `json:"token"`
+	Key   string      `json:"key"`
+}
+
+func callDeriveToken(t *testing.T, parentId int, userId int, body map[string]any) tokenAPIResponse {
+	t.Helper()
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/"+strconv.Itoa(parentId)+"/derive", body, userId)
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(parentId)}}
+	DeriveToken(ctx)
+	return decodeAPIResponse(t, recorder)
+}
+
+func TestDeriveTokenNarrowsParent(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+	parent := seedToken(t, db, 1, "parent-token", "parent1234token5678")
+	parentScope, _ := common.Marshal(dto.TokenScope{Endpoints: []string{dto.TokenScopeChat, dto.TokenScopeEmbeddings}})
+	if err := db.Model(parent).Updates(map[string]any{
+		"unlimited_quota":      false,
+		"remain_quota":         1000,
+		"model_limits_enabled": true,
+		"model_limits":         "gpt-4o,gpt-4o-mini",
+		"scope":                string(parentScope),
+	}).Error; err != nil {
+		t.Fatalf("failed to update parent token: %v", err)
+	}
+
+	response := callDeriveToken(t, parent.Id, 1, map[string]any{
+		"expires_in_minutes": 15,
+		"spend_cap":          200,
+		"model_limits":       "gpt-4o-mini",
+		"scope":              map[string]any{"endpoints": []string{dto.TokenScopeChat}},
+	})
+	if !response.Success {
+		t.Fatalf("expected derive to succeed, got message: %s", response.Message)
+	}
+	var derived derivedTokenResponse
+	if err := common.Unmarshal(response.Data, &derived); err != nil {
+		t.Fatalf("failed to decode derive response: %v", err)
+	}
+	child, err := model.GetTokenById(derived.Token.Id)
+	if err != nil {
+		t.Fatalf("failed to load derived token: %v", err)
+	}
+	if child.Key != derived.Key || strings.Contains(derived.Token.Key, child.Key) {
+		t.Fatalf("expected full key only in the key field, got token key %q", derived.Token.Key)
+	}
+	if child.ParentId != parent.Id || child.RemainQuota != 200 || child.UnlimitedQuota {
+		t.Fatalf("unexpected derived token quota fields: %+v", child)
+	}
+	if child.ExpiredTime <= common.GetTimestamp() || child.ExpiredTime > common.GetTimestamp()+15*60 {
+		t.Fatalf("expected expiry within 15 minutes, got %d", child.ExpiredTime)
+	}
+	if !child.ModelLimitsEnabled || child.ModelLimits != "gpt-4o-mini" {
+		t.Fatalf("unexpected derived model limits: %q", child.ModelLimits)
+	}
+	if scope := child.GetScope(); len(scope.Endpoints) != 1 || scope.Endpoints[0] != dto.TokenScopeChat {
+		t.Fatalf("unexpected derived scope: %+v", scope)
+	}
+
+	for name, body := range map[string]map[string]any{
+		"cap above parent":    {"expires_in_minutes": 15, "spend_cap": 5000},
+		"no cap":              {"expires_in_minutes": 15},
+		"expiry too long":     {"expires_in_minutes": maxDerivedTokenExpiryMinutes + 1, "spend_cap": 10},
+		"model outside":       {"expires_in_minutes": 15, "spend_cap": 10, "model_limits": "o3"},
+		"endpoint outside":    {"expires_in_minutes": 15, "spend_cap": 10, "scope": map[string]any{"endpoints": []string{dto.TokenScopeImages}}},
+		"protected overrides": {"expires_in_minutes": 15, "spend_cap": 10, "scope": map[string]any{"param_override": map[string]any{"model": "o3"}}},
+	} {
+		if response := callDeriveToken(t, parent.Id, 1, body); response.Success {
+			t.Fatalf("expected derive with %s to fail", name)
+		}
+	}
+	if response := callDeriveToken(t, parent.Id, 2, map[string]any{"expires_in_minutes": 15, "spend_cap": 10}); response.Success {
+		t.Fatalf("expected derive from a token of another user to fail")
+	}
+	if response := callDeriveToken(t, child.Id, 1, map[string]any{"expires_in_minutes": 5, "spend_cap": 10}); response.Success {
+		t.Fatalf("expected derive from a derived token to fail")
+	}
+
+	body := map[string]any{"id": child.Id, "name": "renamed", "expired_time": -1, "unlimited_quota": true}
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPut, "/api/token/", body, 1)
+	UpdateToken(ctx)
+	if response := decodeAPIResponse(t, recorder); response.Success {
+		t.Fatalf("expected editing a derived token to fail")
+	}
+}
+
+func TestRotateTokenKeepsOldKeyDuringGracePeriod(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+	token := seedToken(t, db, 1, "rotated-token", "rotate1234token5678")
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/"+strconv.Itoa(token.Id)+"/rotate", map[string]any{"grace_minutes": 30}, 1)
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(token.Id)}}
+	RotateToken(ctx)
+	response := decodeAPIResponse(t, recorder)
+	if !response.Success {
+		t.Fatalf("expected rotation to succeed, got message: %s", response.Message)
+	}
+	var rotated derivedTokenResponse
+	if err := common.Unmarshal(response.Data, &rotated); err != nil {
+		t.Fatalf("failed to decode rotate response: %v", err)
+	}
+	if rotated.Key == "" || rotated.Key == token.Key {
+		t.Fatalf("expected a new key, got %q", rotated.Key)
+	}
+	if strings.Contains(recorder.Body.String(), `"prev_key"`) || rotated.Token.PrevKeyExpiredTime <= common.GetTimestamp() {
+		t.Fatalf("unexpected rotation response: %s", recorder.Body.String())
+	}
+
+	stored, err := model.GetTokenById(token.Id)
+	if err != nil {
+		t.Fatalf("failed to load rotated token: %v", err)
+	}
+	if stored.Key != rotated.Key || stored.PrevKey != token.Key {
+		t.Fatalf("expected new key with the old key kept for the grace period, got %+v", stored)
+	}
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/token/"+strconv.Itoa(token.Id)+"/rotate", map[string]any{"grace_minutes": maxTokenRotationGraceMinutes + 1}, 1)
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(token.Id)}}
+	RotateToken(ctx)
+	if response := decodeAPIResponse(t, recorder); response.Success {
+		t.Fatalf("expected rotation with a too long grace period to fail")
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
 	"io"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -223,6 +225,8 @@ type CreemWebhookEvent struct {
 		Status   string            `json:"status"`
 		Metadata map[string]string `json:"metadata"`
 		Mode     string            `json:"mode"`
+		// 退款事件的退款金额（分）
+		RefundAmount int `json:"refund_amount"`
 	} `json:"object"`
 }
 
@@ -276,6 +280,8 @@ func CreemWebhook(c *gin.Context) {
 	switch webhookEvent.EventType {
 	case "checkout.completed":
 		handleCheckoutCompleted(c, &webhookEvent)
+	case "refund.created":
+		handleRefundCreated(c, &webhookEvent)
 	default:
 		logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem webhook 忽略事件 event_type=%s event_id=%s", webhookEvent.EventType, webhookEvent.Id))
 		c.Status(http.StatusOK)
@@ -304,6 +310,7 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 	defer UnlockOrder(referenceId)
 	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(event), model.PaymentProviderCreem, ""); err == nil {
 		logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem 订阅订单处理成功 trade_no=%s creem_order_id=%s", referenceId, event.Object.Order.Id))
+		recordCreemOrderId(c.Request.Context(), referenceId, event.Object.Order.Id)
 		c.Status(http.StatusOK)
 		return
 	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
@@ -354,10 +361,53 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 		return
 	}
 
+	recordCreemOrderId(c.Request.Context(), referenceId, event.Object.Order.Id)
 	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem 充值成功 trade_no=%s creem_order_id=%s quota=%d money=%.2f client_ip=%s", referenceId, event.Object.Order.Id, topUp.Amount, topUp.Money, c.ClientIP()))
 	c.Status(http.StatusOK)
 }
 
+// 记录 Creem 订单号，退款时使用
+func recordCreemOrderId(ctx context.Context, tradeNo string, orderId string) {
+	if err := model.SetTopUpProviderOrderId(tradeNo, orderId); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Creem 记录订单号失败 trade_no=%s creem_order_id=%s error=%q", tradeNo, orderId, err.Error()))
+	}
+}
+
+// 处理退款事件，包括在 Creem 后台发起的退款
+func handleRefundCreated(c *gin.Context, event *CreemWebhookEvent) {
+	refundId := event.Object.Id
+	orderId := event.Object.Order.Id
+	if event.Object.Status != "succeeded" {
+		logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem 退款未成功，忽略处理 refund_id=%s creem_order_id=%s status=%s", refundId, orderId, event.Object.Status))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	topUp := model.GetTopUpByProviderOrderId(model.PaymentProviderCreem, orderId)
+	if topUp == nil {
+		logger.LogWarn(c.Request.Context(), fmt.Sprintf("Creem 退款对应的本地订单不存在 refund_id=%s creem_order_id=%s", refundId, orderId))
+		c.Status(http.StatusOK)
+		return
+	}
+	LockOrder(topUp.TradeNo)
+	defer UnlockOrder(topUp.TradeNo)
+
+	err := model.RecordProviderRefund(&model.ProviderRefund{
+		PaymentProvider:  model.PaymentProviderCreem,
+		ProviderRefundId: refundId,
+		TradeNo:          topUp.TradeNo,
+		Money:            float64(event.Object.RefundAmount) / 100,
+	})
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Creem 退款处理失败 trade_no=%s refund_id=%s creem_order_id=%s client_ip=%s error=%q", topUp.TradeNo, refundId, orderId, c.ClientIP(), err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem 退款处理成功 trade_no=%s refund_id=%s creem_order_id=%s refund_amount=%d client_ip=%s", topUp.TradeNo, refundId, orderId, event.Object.RefundAmount, c.ClientIP()))
+	c.Status(http.StatusOK)
+}
+
 type CreemCheckoutRequest struct {
 	ProductId string `json:"product_id"`
 	RequestId string `json:"request_id"`
@@ -377,10 +427,8 @@ func genCreemLink(ctx context.Context, referenceId string, product *CreemProduct
 		return "", fmt.Errorf("未配置Creem API密钥")
 	}
 
-	// 根据测试模式选择 API 端点
-	apiUrl := "https://api.creem.io/v1/checkouts"
+	apiUrl := creemApiBaseURL() + "/v1/checkouts"
 	if setting.CreemTestMode {
-		apiUrl = "https://test-api.creem.io/v1/checkouts"
 		logger.LogInfo(ctx, fmt.Sprintf("Creem 使用测试环境 api_url=%s", apiUrl))
 	}
 
@@ -455,3 +503,85 @@ func genCreemLink(ctx context.Context, referenceId string, product *CreemProduct
 	logger.LogInfo(ctx, fmt.Sprintf("Creem 支付链接创建成功 trade_no=%s response_id=%s checkout_url=%q", referenceId, checkoutResp.Id, checkoutResp.CheckoutUrl))
 	return checkoutResp.CheckoutUrl, nil
 }
+
+// creemApiBaseURL 根据测试模式选择 API 端点，CREEM_API_BASE_URL 可指向替身服务
+func creemApiBaseURL() string {
+	baseURL := "https://api.creem.io"
+	if setting.CreemTestMode {
+		baseURL = "https://test-api.creem.io"
+	}
+	return strings.TrimRight(common.GetEnvOrDefaultString("CREEM_API_BASE_URL", baseURL), "/")
+}
+
+type CreemRefundRequest struct {
+	OrderId   string `json:"order_id"`
+	Amount    int64  `json:"amount,omitempty"` // 分，不填则全额退款
+	Reason    string `json:"reason,omitempty"`
+	RequestId string `json:"request_id"`
+}
+
+type CreemRefundResponse struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// requestCreemRefund 对 Creem 订单发起退款，request_id 为本地退款单号
+func requestCreemRefund(ctx context.Context, topUp *model.TopUp, refund *model.PaymentRefund, fullRefund bool) (*providerRefundResult, error) {
+	if setting.CreemApiKey == "" {
+		return nil, rejectProviderRefund(fmt.Errorf("未配置Creem API密钥"))
+	}
+	requestData := CreemRefundRequest{
+		OrderId:   topUp.ProviderOrderId,
+		Reason:    refund.Reason,
+		RequestId: refund.RefundNo,
+	}
+	if !fullRefund {
+		requestData.Amount = int64(math.Round(refund.Money * 100))
+	}
+	jsonData, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, rejectProviderRefund(fmt.Errorf("序列化请求数据失败: %v", err))
+	}
+
+	apiUrl := creemApiBaseURL() + "/v1/refunds"
+	req, err := http.NewRequestWithContext(ctx, "POST", apiUrl, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, rejectProviderRefund(fmt.Errorf("创建HTTP请求失败: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("Creem 退款 API 响应已收到 trade_no=%s refund_no=%s status_code=%d body=%q", refund.TradeNo, refund.RefundNo, resp.StatusCode, string(body)))
+	if resp.StatusCode/100 == 4 {
+		return nil, rejectProviderRefund(fmt.Errorf("Creem API http status %d ", resp.StatusCode))
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("Creem API http status %d ", resp.StatusCode)
+	}
+
+	var refundResp CreemRefundResponse
+	if err := json.Unmarshal(body, &refundResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	switch refundResp.Status {
+	case "succeeded":
+		return &providerRefundResult{ProviderRefundId: refundResp.Id, Settled: true}, nil
+	case "pending":
+		return &providerRefundResult{ProviderRefundId: refundResp.Id}, nil
+	default:
+		return nil, rejectProviderRefund(fmt.Errorf("Creem 退款状态为 %s", refundResp.Status))
+	}
+}
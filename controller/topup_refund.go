@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRefundTopUpRequest struct {
+	TradeNo string  `json:"trade_no"`
+	Money   float64 `json:"money"` // 退款金额，单位同订单支付金额；不填则退还剩余全部金额
+	Reason  string  `json:"reason"`
+}
+
+// providerRefundResult is what the refund API of a provider answered.
+type providerRefundResult struct {
+	ProviderRefundId string
+	// Settled is false while the provider still processes the refund, which
+	// its refund webhook settles later.
+	Settled bool
+}
+
+// providerRefundRejectedError is an error after which the provider surely
+// did not refund: the request was refused or never sent. With any other
+// error, such as a timeout, the refund may have happened.
+type providerRefundRejectedError struct {
+	err error
+}
+
+func (e *providerRefundRejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *providerRefundRejectedError) Unwrap() error {
+	return e.err
+}
+
+func rejectProviderRefund(err error) error {
+	return &providerRefundRejectedError{err: err}
+}
+
+// requestProviderRefund asks the provider of topUp to pay refund back.
+// fullRefund tells that the refund takes what is left of the order, which
+// the providers refund without an explicit amount.
+func requestProviderRefund(ctx context.Context, topUp *model.TopUp, refund *model.PaymentRefund) (*providerRefundResult, error) {
+	fullRefund := topUp.RefundableMoney() <= 0
+	switch topUp.PaymentProvider {
+	case model.PaymentProviderStripe:
+		return requestStripeRefund(topUp, refund, fullRefund)
+	case model.PaymentProviderCreem:
+		return requestCreemRefund(ctx, topUp, refund, fullRefund)
+	case model.PaymentProviderWaffo:
+		return requestWaffoRefund(ctx, topUp, refund)
+	default:
+		return nil, rejectProviderRefund(model.ErrPaymentRefundUnsupported)
+	}
+}
+
+// AdminRefundTopUp refunds a completed top-up or subscription order through
+// the provider it was paid with. The quota or subscription it granted is
+// reversed once the provider confirmed the refund.
+//
+// Orders paid before the provider order id was recorded have no
+// provider_order_id. They cannot be refunded through the provider, and a
+// refund issued for them in the provider dashboard does not match them in the
+// refund webhooks either, so the quota has to be adjusted by hand.
+func AdminRefundTopUp(c *gin.Context) {
+	var req AdminRefundTopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" || req.Money < 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	LockOrder(req.TradeNo)
+	defer UnlockOrder(req.TradeNo)
+
+	ctx := c.Request.Context()
+	refund, topUp, err := model.CreatePaymentRefund(req.TradeNo, req.Money, strings.TrimSpace(req.Reason), c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	result, err := requestProviderRefund(ctx, topUp, refund)
+	if err != nil {
+		var rejected *providerRefundRejectedError
+		if !errors.As(err, &rejected) {
+			// 支付平台可能已退款，保留待处理状态，由退款回调结算
+			logger.LogError(ctx, fmt.Sprintf("订单退款结果未知 trade_no=%s refund_no=%s payment_provider=%s money=%.2f error=%q", refund.TradeNo, refund.RefundNo, refund.PaymentProvider, refund.Money, err.Error()))
+			common.ApiErrorMsg(c, "退款结果未知，退款单保持处理中，请等待支付平台回调或在支付平台后台核实："+err.Error())
+			return
+		}
+		logger.LogError(ctx, fmt.Sprintf("订单退款请求失败 trade_no=%s refund_no=%s payment_provider=%s money=%.2f error=%q", refund.TradeNo, refund.RefundNo, refund.PaymentProvider, refund.Money, err.Error()))
+		if err := model.FailPaymentRefund(refund.RefundNo, err.Error()); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("订单退款标记失败状态失败 refund_no=%s error=%q", refund.RefundNo, err.Error()))
+		}
+		common.ApiErrorMsg(c, "退款失败："+err.Error())
+		return
+	}
+	if result.Settled {
+		if err := model.CompletePaymentRefund(refund.RefundNo, result.ProviderRefundId); err != nil {
+			// 支付平台已退款，退款回调会再次尝试结算
+			logger.LogError(ctx, fmt.Sprintf("订单退款结算失败 trade_no=%s refund_no=%s provider_refund_id=%s error=%q", refund.TradeNo, refund.RefundNo, result.ProviderRefundId, err.Error()))
+			common.ApiError(c, err)
+			return
+		}
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("订单退款已提交 trade_no=%s refund_no=%s payment_provider=%s provider_refund_id=%s money=%.2f settled=%t operator_id=%d", refund.TradeNo, refund.RefundNo, refund.PaymentProvider, result.ProviderRefundId, refund.Money, result.Settled, c.GetInt("id")))
+
+	refunds, err := model.GetPaymentRefundsByTradeNo(refund.TradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, refunds)
+}
+
+// GetTopUpRefunds lists the refund ledger of an order.
+func GetTopUpRefunds(c *gin.Context) {
+	tradeNo := c.Query("trade_no")
+	if tradeNo == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	refunds, err := model.GetPaymentRefundsByTradeNo(tradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, refunds)
+}
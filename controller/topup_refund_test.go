@@ -0,0 +1,341 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/waffo-com/waffo-go/types/order"
+	"github.com/waffo-com/waffo-go/utils"
+)
+
+func setupTopUpRefundTest(t *testing.T, provider string, money float64) *model.TopUp {
+	t.Helper()
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.TopUp{}, &model.SubscriptionOrder{}, &model.PaymentRefund{}, &model.Log{}))
+	require.NoError(t, db.Create(&model.User{
+		Id: 1, Username: "refund-user", Password: "unused", Role: common.RoleCommonUser,
+		Status: common.UserStatusEnabled, Group: "default", Quota: 0,
+	}).Error)
+	topUp := &model.TopUp{
+		UserId:          1,
+		Amount:          int64(money * 100),
+		Money:           money,
+		TradeNo:         "refund-" + provider,
+		PaymentMethod:   provider,
+		PaymentProvider: provider,
+		CreateTime:      time.Now().Unix(),
+		CompleteTime:    time.Now().Unix(),
+		Status:          common.TopUpStatusSuccess,
+		ProviderOrderId: "provider-order-" + provider,
+	}
+	require.NoError(t, topUp.Insert())
+	return topUp
+}
+
+func getTopUpRefundsForTest(t *testing.T, tradeNo string) []*model.PaymentRefund {
+	t.Helper()
+	refunds, err := model.GetPaymentRefundsByTradeNo(tradeNo)
+	require.NoError(t, err)
+	return refunds
+}
+
+func TestAdminRefundTopUpRefundsStripePaymentIntent(t *testing.T) {
+	topUp := setupTopUpRefundTest(t, model.PaymentProviderStripe, 10)
+	originalSecret := setting.StripeApiSecret
+	t.Cleanup(func() { setting.StripeApiSecret = originalSecret })
+	setting.StripeApiSecret = "sk_test_refund"
+
+	var refundForm url.Values
+	stripeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/payment_intents/"+topUp.ProviderOrderId:
+			_, _ = io.WriteString(w, `{"id":"provider-order-stripe","object":"payment_intent","amount_received":7000,"currency":"cny"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/refunds":
+			body, _ := io.ReadAll(r.Body)
+			refundForm, _ = url.ParseQuery(string(body))
+			_, _ = io.WriteString(w, `{"id":"re_1","object":"refund","status":"succeeded","amount":2800}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer stripeServer.Close()
+	t.Setenv("STRIPE_API_BASE_URL", stripeServer.URL)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/user/topup/refund", AdminRefundTopUpRequest{TradeNo: topUp.TradeNo, Money: 4, Reason: "duplicate"}, 99)
+	AdminRefundTopUp(ctx)
+
+	response := decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	assert.Equal(t, "provider-order-stripe", refundForm.Get("payment_intent"))
+	assert.Equal(t, "2800", refundForm.Get("amount"), "partial refunds are converted to the amount received")
+
+	refunds := getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, common.TopUpStatusSuccess, refunds[0].Status)
+	assert.Equal(t, "re_1", refunds[0].ProviderRefundId)
+	assert.Equal(t, refunds[0].RefundNo, refundForm.Get("metadata[refund_no]"))
+	assert.Equal(t, 99, refunds[0].OperatorId)
+
+	quota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, -int(4*common.QuotaPerUnit), quota, "the clawback may leave a negative balance")
+	var refundLogs int64
+	require.NoError(t, model.LOG_DB.Model(&model.Log{}).Where("user_id = ? AND type = ?", 1, model.LogTypeRefund).Count(&refundLogs).Error)
+	assert.EqualValues(t, 1, refundLogs)
+}
+
+func TestAdminRefundTopUpReleasesMoneyWhenCreemRejects(t *testing.T) {
+	topUp := setupTopUpRefundTest(t, model.PaymentProviderCreem, 10)
+	originalAPIKey := setting.CreemApiKey
+	t.Cleanup(func() { setting.CreemApiKey = originalAPIKey })
+	setting.CreemApiKey = "creem_api_key"
+
+	var request CreemRefundRequest
+	reject := true
+	creemServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/refunds" || r.Header.Get("x-api-key") != "creem_api_key" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = common.Unmarshal(body, &request)
+		if reject {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"ref_1","status":"succeeded"}`)
+	}))
+	defer creemServer.Close()
+	t.Setenv("CREEM_API_BASE_URL", creemServer.URL)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/user/topup/refund", AdminRefundTopUpRequest{TradeNo: topUp.TradeNo}, 99)
+	AdminRefundTopUp(ctx)
+	response := decodeAPIResponse(t, recorder)
+	require.False(t, response.Success)
+	refunds := getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, common.TopUpStatusFailed, refunds[0].Status)
+	assert.InDelta(t, 10, model.GetTopUpByTradeNo(topUp.TradeNo).RefundableMoney(), 0.001)
+
+	reject = false
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/user/topup/refund", AdminRefundTopUpRequest{TradeNo: topUp.TradeNo}, 99)
+	AdminRefundTopUp(ctx)
+	response = decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	assert.Equal(t, topUp.ProviderOrderId, request.OrderId)
+	assert.Zero(t, request.Amount, "a full refund leaves the amount to Creem")
+	assert.Equal(t, common.TopUpStatusRefunded, model.GetTopUpByTradeNo(topUp.TradeNo).Status)
+}
+
+func TestCreemWebhookRecordsDashboardRefund(t *testing.T) {
+	topUp := setupTopUpRefundTest(t, model.PaymentProviderCreem, 10)
+	confirmPaymentComplianceForTest(t)
+	originalAPIKey := setting.CreemApiKey
+	originalProducts := setting.CreemProducts
+	originalWebhookSecret := setting.CreemWebhookSecret
+	t.Cleanup(func() {
+		setting.CreemApiKey = originalAPIKey
+		setting.CreemProducts = originalProducts
+		setting.CreemWebhookSecret = originalWebhookSecret
+	})
+	setting.CreemApiKey = "creem_api_key"
+	setting.CreemProducts = `[{"productId":"prod_123"}]`
+	setting.CreemWebhookSecret = "creem_secret"
+
+	payload := `{"id":"evt_1","eventType":"refund.created","object":{"id":"ref_dashboard","object":"refund","status":"succeeded","refund_amount":250,"order":{"id":"provider-order-creem"}}}`
+	for i := 0; i < 2; i++ {
+		ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/creem/webhook", nil, 0)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/api/creem/webhook", strings.NewReader(payload))
+		ctx.Request.Header.Set(CreemSignatureHeader, generateCreemSignature(payload, setting.CreemWebhookSecret))
+		CreemWebhook(ctx)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	refunds := getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1, "webhook retries are deduplicated")
+	assert.InDelta(t, 2.5, refunds[0].Money, 0.001)
+	assert.Equal(t, common.TopUpStatusSuccess, refunds[0].Status)
+	quota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, -250, quota)
+}
+
+func TestAdminRefundTopUpKeepsRefundPendingWhenCreemOutcomeUnknown(t *testing.T) {
+	topUp := setupTopUpRefundTest(t, model.PaymentProviderCreem, 10)
+	originalAPIKey := setting.CreemApiKey
+	t.Cleanup(func() { setting.CreemApiKey = originalAPIKey })
+	setting.CreemApiKey = "creem_api_key"
+
+	creemServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer creemServer.Close()
+	t.Setenv("CREEM_API_BASE_URL", creemServer.URL)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/user/topup/refund", AdminRefundTopUpRequest{TradeNo: topUp.TradeNo, Money: 4}, 99)
+	AdminRefundTopUp(ctx)
+	response := decodeAPIResponse(t, recorder)
+	require.False(t, response.Success)
+	refunds := getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, common.TopUpStatusPending, refunds[0].Status, "the provider may have refunded, so the refund waits for its webhook")
+	assert.InDelta(t, 6, model.GetTopUpByTradeNo(topUp.TradeNo).RefundableMoney(), 0.001, "a retry can not refund the money again")
+}
+
+// useWaffoForTest configures Waffo sandbox credentials with fresh key pairs
+// and points the SDK at server. It returns the key pair standing in for
+// Waffo, which signs its webhooks.
+func useWaffoForTest(t *testing.T, serverURL string) (merchant *utils.KeyPair, waffoKeys *utils.KeyPair) {
+	t.Helper()
+	merchant, err := utils.GenerateKeyPair()
+	require.NoError(t, err)
+	waffoKeys, err = utils.GenerateKeyPair()
+	require.NoError(t, err)
+
+	originalEnabled := setting.WaffoEnabled
+	originalSandbox := setting.WaffoSandbox
+	originalAPIKey := setting.WaffoSandboxApiKey
+	originalPrivateKey := setting.WaffoSandboxPrivateKey
+	originalPublicCert := setting.WaffoSandboxPublicCert
+	originalMerchantId := setting.WaffoMerchantId
+	originalCurrency := setting.WaffoCurrency
+	t.Cleanup(func() {
+		setting.WaffoEnabled = originalEnabled
+		setting.WaffoSandbox = originalSandbox
+		setting.WaffoSandboxApiKey = originalAPIKey
+		setting.WaffoSandboxPrivateKey = originalPrivateKey
+		setting.WaffoSandboxPublicCert = originalPublicCert
+		setting.WaffoMerchantId = originalMerchantId
+		setting.WaffoCurrency = originalCurrency
+	})
+	setting.WaffoEnabled = true
+	setting.WaffoSandbox = true
+	setting.WaffoSandboxApiKey = "waffo_api_key"
+	setting.WaffoSandboxPrivateKey = merchant.PrivateKey
+	setting.WaffoSandboxPublicCert = waffoKeys.PublicKey
+	setting.WaffoMerchantId = "merchant-1"
+	setting.WaffoCurrency = "USD"
+	confirmPaymentComplianceForTest(t)
+	t.Setenv("WAFFO_API_BASE_URL", serverURL)
+	return merchant, waffoKeys
+}
+
+func TestAdminRefundTopUpRefundsWaffoOrderAndSettlesByWebhook(t *testing.T) {
+	topUp := setupTopUpRefundTest(t, model.PaymentProviderWaffo, 10)
+
+	var (
+		refundPath   string
+		refundParams order.RefundOrderParams
+		signedByUs   bool
+	)
+	var merchant *utils.KeyPair
+	waffoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		refundPath = r.URL.Path
+		signedByUs = utils.Verify(string(body), r.Header.Get("X-SIGNATURE"), merchant.PublicKey)
+		_ = common.Unmarshal(body, &refundParams)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"code":"0","data":{"acquiringRefundOrderId":"waffo-refund-1","refundStatus":"REFUND_IN_PROGRESS"}}`)
+	}))
+	defer waffoServer.Close()
+	merchant, waffoKeys := useWaffoForTest(t, waffoServer.URL)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/user/topup/refund", AdminRefundTopUpRequest{TradeNo: topUp.TradeNo, Money: 4}, 99)
+	AdminRefundTopUp(ctx)
+	response := decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	assert.True(t, strings.HasSuffix(refundPath, "/order/refund"), "the SDK request is sent to the stand-in server, got %q", refundPath)
+	assert.True(t, signedByUs, "the refund request is signed with the merchant key")
+	assert.Equal(t, topUp.ProviderOrderId, refundParams.AcquiringOrderID)
+	assert.Equal(t, "4.00", refundParams.RefundAmount)
+
+	refunds := getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, refunds[0].RefundNo, refundParams.RefundRequestID)
+	assert.Equal(t, common.TopUpStatusPending, refunds[0].Status, "an in progress refund waits for the webhook")
+
+	payload := `{"eventType":"REFUND_NOTIFICATION","result":{"refundRequestId":"` + refunds[0].RefundNo +
+		`","acquiringOrderId":"` + topUp.ProviderOrderId + `","acquiringRefundOrderId":"waffo-refund-1","refundAmount":"4.00","refundStatus":"ORDER_PARTIALLY_REFUNDED"}}`
+	signature, err := utils.Sign(payload, waffoKeys.PrivateKey)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/waffo/webhook", nil, 0)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/api/waffo/webhook", strings.NewReader(payload))
+		ctx.Request.Header.Set("X-SIGNATURE", signature)
+		WaffoWebhook(ctx)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "FAILED")
+	}
+
+	refunds = getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1, "webhook retries are deduplicated")
+	assert.Equal(t, common.TopUpStatusSuccess, refunds[0].Status)
+	assert.Equal(t, "waffo-refund-1", refunds[0].ProviderRefundId)
+	quota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, -int(float64(topUp.Amount)*common.QuotaPerUnit*4/10), quota, "the share of the credited quota is clawed back")
+}
+
+// newStripeRefundEvent builds a refund.updated event for object.
+func newStripeRefundEvent(t *testing.T, object string) stripe.Event {
+	t.Helper()
+	var event stripe.Event
+	require.NoError(t, common.Unmarshal([]byte(`{"id":"evt_refund","type":"refund.updated","data":{"object":`+object+`}}`), &event))
+	return event
+}
+
+func TestStripeRefundUpdatedSettlesRefunds(t *testing.T) {
+	topUp := setupTopUpRefundTest(t, model.PaymentProviderStripe, 10)
+	originalSecret := setting.StripeApiSecret
+	t.Cleanup(func() { setting.StripeApiSecret = originalSecret })
+	setting.StripeApiSecret = "sk_test_refund"
+
+	stripeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/payment_intents/"+topUp.ProviderOrderId {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"provider-order-stripe","object":"payment_intent","amount_received":7000,"currency":"cny"}`)
+	}))
+	defer stripeServer.Close()
+	t.Setenv("STRIPE_API_BASE_URL", stripeServer.URL)
+
+	// a refund issued from the Stripe dashboard is converted back from the
+	// amount received
+	stripeRefundUpdated(context.Background(), newStripeRefundEvent(t,
+		`{"id":"re_dashboard","object":"refund","status":"succeeded","amount":2100,"payment_intent":"provider-order-stripe","metadata":{}}`), "127.0.0.1")
+	refunds := getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 1)
+	assert.InDelta(t, 3, refunds[0].Money, 0.001)
+	assert.Equal(t, common.TopUpStatusSuccess, refunds[0].Status)
+	assert.Equal(t, "re_dashboard", refunds[0].ProviderRefundId)
+
+	// a refund the admin requested settles once Stripe reports it succeeded
+	pending, _, err := model.CreatePaymentRefund(topUp.TradeNo, 2, "duplicate", 99)
+	require.NoError(t, err)
+	stripeRefundUpdated(context.Background(), newStripeRefundEvent(t,
+		`{"id":"re_admin","object":"refund","status":"succeeded","amount":1400,"payment_intent":"provider-order-stripe","metadata":{"refund_no":"`+pending.RefundNo+`"}}`), "127.0.0.1")
+	refunds = getTopUpRefundsForTest(t, topUp.TradeNo)
+	require.Len(t, refunds, 2)
+	for _, refund := range refunds {
+		assert.Equal(t, common.TopUpStatusSuccess, refund.Status, refund.RefundNo)
+	}
+	assert.InDelta(t, 5, model.GetTopUpByTradeNo(topUp.TradeNo).RefundableMoney(), 0.001)
+	quota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, -int(5*common.QuotaPerUnit), quota)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,6 +20,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/paymentintent"
+	stripeRefund "github.com/stripe/stripe-go/v81/refund"
 	"github.com/stripe/stripe-go/v81/webhook"
 	"github.com/thanhpk/randstr"
 )
@@ -182,6 +185,8 @@ func StripeWebhook(c *gin.Context) {
 		sessionAsyncPaymentSucceeded(ctx, event, callerIp)
 	case stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
 		sessionAsyncPaymentFailed(ctx, event, callerIp)
+	case stripe.EventTypeRefundCreated, stripe.EventTypeRefundUpdated, stripe.EventTypeRefundFailed:
+		stripeRefundUpdated(ctx, event, callerIp)
 	default:
 		logger.LogInfo(ctx, fmt.Sprintf("Stripe webhook 忽略事件 event_type=%s client_ip=%s", string(event.Type), callerIp))
 	}
@@ -272,6 +277,7 @@ func fulfillOrder(ctx context.Context, event stripe.Event, referenceId string, c
 	}
 	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(payload), model.PaymentProviderStripe, ""); err == nil {
 		logger.LogInfo(ctx, fmt.Sprintf("Stripe 订阅订单处理成功 trade_no=%s event_type=%s client_ip=%s", referenceId, string(event.Type), callerIp))
+		recordStripePaymentIntent(ctx, event, referenceId)
 		return
 	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
 		logger.LogError(ctx, fmt.Sprintf("Stripe 订阅订单处理失败 trade_no=%s event_type=%s client_ip=%s error=%q", referenceId, string(event.Type), callerIp, err.Error()))
@@ -284,11 +290,22 @@ func fulfillOrder(ctx context.Context, event stripe.Event, referenceId string, c
 		return
 	}
 
+	recordStripePaymentIntent(ctx, event, referenceId)
+
 	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
 	currency := strings.ToUpper(event.GetObjectValue("currency"))
 	logger.LogInfo(ctx, fmt.Sprintf("Stripe 充值成功 trade_no=%s amount_total=%.2f currency=%s event_type=%s client_ip=%s", referenceId, total/100, currency, string(event.Type), callerIp))
 }
 
+// recordStripePaymentIntent keeps the payment intent of a paid checkout
+// session, which refunds are issued against.
+func recordStripePaymentIntent(ctx context.Context, event stripe.Event, referenceId string) {
+	paymentIntent := event.GetObjectValue("payment_intent")
+	if err := model.SetTopUpProviderOrderId(referenceId, paymentIntent); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Stripe 记录支付单号失败 trade_no=%s payment_intent=%s error=%q", referenceId, paymentIntent, err.Error()))
+	}
+}
+
 func sessionExpired(ctx context.Context, event stripe.Event) {
 	referenceId := event.GetObjectValue("client_reference_id")
 	status := event.GetObjectValue("status")
@@ -385,6 +402,110 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 	return result.URL, nil
 }
 
+// stripeBackend is the Stripe API backend, which STRIPE_API_BASE_URL points
+// at a stand-in server.
+func stripeBackend() stripe.Backend {
+	baseURL := common.GetEnvOrDefaultString("STRIPE_API_BASE_URL", "")
+	if baseURL == "" {
+		return stripe.GetBackend(stripe.APIBackend)
+	}
+	return stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{URL: stripe.String(baseURL)})
+}
+
+// requestStripeRefund refunds the payment intent of topUp. Partial refunds
+// are converted to the currency the customer actually paid in.
+func requestStripeRefund(topUp *model.TopUp, refund *model.PaymentRefund, fullRefund bool) (*providerRefundResult, error) {
+	backend := stripeBackend()
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(topUp.ProviderOrderId),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	params.AddMetadata("refund_no", refund.RefundNo)
+	params.AddMetadata("trade_no", refund.TradeNo)
+	params.SetIdempotencyKey(refund.RefundNo)
+	if !fullRefund {
+		intent, err := (&paymentintent.Client{B: backend, Key: setting.StripeApiSecret}).Get(topUp.ProviderOrderId, nil)
+		if err != nil {
+			return nil, rejectProviderRefund(err)
+		}
+		amount := int64(math.Round(float64(intent.AmountReceived) * refund.Money / topUp.Money))
+		if amount <= 0 {
+			return nil, rejectProviderRefund(model.ErrPaymentRefundAmountInvalid)
+		}
+		params.Amount = stripe.Int64(amount)
+	}
+	result, err := (&stripeRefund.Client{B: backend, Key: setting.StripeApiSecret}).New(params)
+	if err != nil {
+		// 4xx 表示 Stripe 拒绝了退款请求，其余错误无法确定是否已退款
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode >= 400 && stripeErr.HTTPStatusCode < 500 {
+			return nil, rejectProviderRefund(err)
+		}
+		return nil, err
+	}
+	switch result.Status {
+	case stripe.RefundStatusSucceeded:
+		return &providerRefundResult{ProviderRefundId: result.ID, Settled: true}, nil
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+		return nil, rejectProviderRefund(fmt.Errorf("Stripe 退款状态为 %s", result.Status))
+	default:
+		return &providerRefundResult{ProviderRefundId: result.ID}, nil
+	}
+}
+
+// stripeRefundUpdated settles or releases refunds from the refund events,
+// including refunds issued from the Stripe dashboard.
+func stripeRefundUpdated(ctx context.Context, event stripe.Event, callerIp string) {
+	refundId := event.GetObjectValue("id")
+	status := event.GetObjectValue("status")
+	refundNo := event.GetObjectValue("metadata", "refund_no")
+	paymentIntent := event.GetObjectValue("payment_intent")
+	switch stripe.RefundStatus(status) {
+	case stripe.RefundStatusSucceeded:
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+		if refundNo == "" {
+			return
+		}
+		err := model.FailPaymentRefund(refundNo, "Stripe 退款状态为 "+status)
+		if err != nil && !errors.Is(err, model.ErrPaymentRefundNotFound) {
+			logger.LogError(ctx, fmt.Sprintf("Stripe 退款失败处理失败 refund_no=%s refund_id=%s client_ip=%s error=%q", refundNo, refundId, callerIp, err.Error()))
+		}
+		return
+	default:
+		logger.LogInfo(ctx, fmt.Sprintf("Stripe 退款处理中 refund_no=%s refund_id=%s status=%s client_ip=%s", refundNo, refundId, status, callerIp))
+		return
+	}
+
+	topUp := model.GetTopUpByProviderOrderId(model.PaymentProviderStripe, paymentIntent)
+	if topUp == nil {
+		logger.LogWarn(ctx, fmt.Sprintf("Stripe 退款对应的本地订单不存在 refund_id=%s payment_intent=%s client_ip=%s", refundId, paymentIntent, callerIp))
+		return
+	}
+	LockOrder(topUp.TradeNo)
+	defer UnlockOrder(topUp.TradeNo)
+
+	notice := &model.ProviderRefund{
+		PaymentProvider:  model.PaymentProviderStripe,
+		ProviderRefundId: refundId,
+		RefundNo:         refundNo,
+		TradeNo:          topUp.TradeNo,
+	}
+	if refundNo == "" {
+		intent, err := (&paymentintent.Client{B: stripeBackend(), Key: setting.StripeApiSecret}).Get(paymentIntent, nil)
+		if err != nil || intent.AmountReceived <= 0 {
+			logger.LogError(ctx, fmt.Sprintf("Stripe 退款查询支付单失败 refund_id=%s payment_intent=%s client_ip=%s error=%v", refundId, paymentIntent, callerIp, err))
+			return
+		}
+		amount, _ := strconv.ParseFloat(event.GetObjectValue("amount"), 64)
+		notice.Money = topUp.Money * amount / float64(intent.AmountReceived)
+	}
+	if err := model.RecordProviderRefund(notice); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Stripe 退款处理失败 trade_no=%s refund_no=%s refund_id=%s client_ip=%s error=%q", topUp.TradeNo, refundNo, refundId, callerIp, err.Error()))
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("Stripe 退款处理成功 trade_no=%s refund_no=%s refund_id=%s client_ip=%s", topUp.TradeNo, refundNo, refundId, callerIp))
+}
+
 func GetChargedAmount(count float64, user model.User) float64 {
 	topUpGroupRatio := common.GetTopupGroupRatio(user.Group)
 	if topUpGroupRatio == 0 {
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ import (
 	waffo "github.com/waffo-com/waffo-go"
 	"github.com/waffo-com/waffo-go/config"
 	"github.com/waffo-com/waffo-go/core"
+	waffonet "github.com/waffo-com/waffo-go/net"
 	"github.com/waffo-com/waffo-go/types/order"
 )
 
@@ -42,6 +44,14 @@ func getWaffoSDK() (*waffo.Waffo, error) {
 	if setting.WaffoMerchantId != "" {
 		builder = builder.MerchantID(setting.WaffoMerchantId)
 	}
+	// WAFFO_API_BASE_URL 可将请求转发到替身服务
+	if baseURL := common.GetEnvOrDefaultString("WAFFO_API_BASE_URL", ""); baseURL != "" {
+		builder = builder.CustomTransport(&waffoBaseURLTransport{
+			HttpTransport: waffonet.NewDefaultHttpTransport(),
+			from:          env.BaseURL(),
+			to:            strings.TrimRight(baseURL, "/"),
+		})
+	}
 	cfg, err := builder.Build()
 	if err != nil {
 		return nil, err
@@ -49,6 +59,25 @@ func getWaffoSDK() (*waffo.Waffo, error) {
 	return waffo.New(cfg), nil
 }
 
+// waffoBaseURLTransport 将 SDK 请求的环境地址替换为指定地址
+type waffoBaseURLTransport struct {
+	waffonet.HttpTransport
+	from string
+	to   string
+}
+
+func (t *waffoBaseURLTransport) Send(ctx context.Context, req *waffonet.HttpRequest) (*waffonet.HttpResponse, error) {
+	req.URL = t.to + strings.TrimPrefix(req.URL, t.from)
+	return t.HttpTransport.Send(ctx, req)
+}
+
+func getWaffoNotifyURL() string {
+	if setting.WaffoNotifyUrl != "" {
+		return setting.WaffoNotifyUrl
+	}
+	return service.GetCallbackAddress() + "/api/waffo/webhook"
+}
+
 func getWaffoUserEmail(user *model.User) string {
 	return fmt.Sprintf("%d@examples.com", user.Id)
 }
@@ -243,11 +272,7 @@ func RequestWaffoPay(c *gin.Context) {
 		return
 	}
 
-	callbackAddr := service.GetCallbackAddress()
-	notifyUrl := callbackAddr + "/api/waffo/webhook"
-	if setting.WaffoNotifyUrl != "" {
-		notifyUrl = setting.WaffoNotifyUrl
-	}
+	notifyUrl := getWaffoNotifyURL()
 	returnUrl := paymentReturnPath("/wallet?show_history=true")
 	if setting.WaffoReturnUrl != "" {
 		returnUrl = setting.WaffoReturnUrl
@@ -381,6 +406,14 @@ func WaffoWebhook(c *gin.Context) {
 		}
 		logger.LogInfo(c.Request.Context(), fmt.Sprintf("Waffo webhook 验签并解析成功 event_type=%s merchant_order_id=%s order_status=%s client_ip=%s", event.EventType, payload.Result.MerchantOrderID, payload.Result.OrderStatus, c.ClientIP()))
 		handleWaffoPayment(c, wh, &payload.Result.PaymentNotificationResult)
+	case core.EventRefund:
+		var notification core.RefundNotification
+		if err := common.Unmarshal(bodyBytes, &notification); err != nil || notification.Result == nil {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo 退款回调载荷解析失败 event_type=%s client_ip=%s error=%v body=%q", event.EventType, c.ClientIP(), err, bodyStr))
+			sendWaffoWebhookResponse(c, wh, false, "invalid refund payload")
+			return
+		}
+		handleWaffoRefund(c, wh, notification.Result)
 	default:
 		logger.LogInfo(c.Request.Context(), fmt.Sprintf("Waffo webhook 忽略事件 event_type=%s client_ip=%s", event.EventType, c.ClientIP()))
 		sendWaffoWebhookResponse(c, wh, true, "")
@@ -414,10 +447,102 @@ func handleWaffoPayment(c *gin.Context, wh *core.WebhookHandler, result *core.Pa
 		return
 	}
 
+	if err := model.SetTopUpProviderOrderId(merchantOrderId, result.AcquiringOrderID); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo 记录支付单号失败 trade_no=%s acquiring_order_id=%s error=%q", merchantOrderId, result.AcquiringOrderID, err.Error()))
+	}
+
 	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Waffo 充值成功 trade_no=%s client_ip=%s", merchantOrderId, c.ClientIP()))
 	sendWaffoWebhookResponse(c, wh, true, "")
 }
 
+// handleWaffoRefund 处理退款结果通知，包括在 Waffo 后台发起的退款
+func handleWaffoRefund(c *gin.Context, wh *core.WebhookHandler, result *core.RefundNotificationResult) {
+	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Waffo 退款回调 refund_request_id=%s acquiring_order_id=%s acquiring_refund_order_id=%s refund_amount=%s refund_status=%s client_ip=%s", result.RefundRequestID, result.AcquiringOrderID, result.AcquiringRefundOrderID, result.RefundAmount, result.RefundStatus, c.ClientIP()))
+	switch result.RefundStatus {
+	case core.RefundStatusPartiallyRefunded, core.RefundStatusFullyRefunded:
+	case core.RefundStatusFailed:
+		err := model.FailPaymentRefund(result.RefundRequestID, "Waffo 退款失败: "+result.RefundFailedReason.String())
+		if err != nil && !errors.Is(err, model.ErrPaymentRefundNotFound) {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo 退款失败处理失败 refund_request_id=%s error=%q", result.RefundRequestID, err.Error()))
+			sendWaffoWebhookResponse(c, wh, false, err.Error())
+			return
+		}
+		sendWaffoWebhookResponse(c, wh, true, "")
+		return
+	default:
+		sendWaffoWebhookResponse(c, wh, true, "")
+		return
+	}
+
+	topUp := model.GetTopUpByProviderOrderId(model.PaymentProviderWaffo, result.AcquiringOrderID)
+	if topUp == nil {
+		logger.LogWarn(c.Request.Context(), fmt.Sprintf("Waffo 退款对应的本地订单不存在 refund_request_id=%s acquiring_order_id=%s", result.RefundRequestID, result.AcquiringOrderID))
+		sendWaffoWebhookResponse(c, wh, true, "")
+		return
+	}
+	LockOrder(topUp.TradeNo)
+	defer UnlockOrder(topUp.TradeNo)
+
+	money, err := strconv.ParseFloat(result.RefundAmount, 64)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo 退款金额解析失败 trade_no=%s refund_amount=%q error=%q", topUp.TradeNo, result.RefundAmount, err.Error()))
+		sendWaffoWebhookResponse(c, wh, false, "invalid refund amount")
+		return
+	}
+	err = model.RecordProviderRefund(&model.ProviderRefund{
+		PaymentProvider:  model.PaymentProviderWaffo,
+		ProviderRefundId: result.AcquiringRefundOrderID,
+		RefundNo:         result.RefundRequestID,
+		TradeNo:          topUp.TradeNo,
+		Money:            money,
+	})
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo 退款处理失败 trade_no=%s refund_request_id=%s client_ip=%s error=%q", topUp.TradeNo, result.RefundRequestID, c.ClientIP(), err.Error()))
+		sendWaffoWebhookResponse(c, wh, false, err.Error())
+		return
+	}
+
+	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Waffo 退款处理成功 trade_no=%s refund_request_id=%s client_ip=%s", topUp.TradeNo, result.RefundRequestID, c.ClientIP()))
+	sendWaffoWebhookResponse(c, wh, true, "")
+}
+
+// requestWaffoRefund 对 Waffo 支付单发起退款，退款请求号为本地退款单号
+func requestWaffoRefund(ctx context.Context, topUp *model.TopUp, refund *model.PaymentRefund) (*providerRefundResult, error) {
+	sdk, err := getWaffoSDK()
+	if err != nil {
+		return nil, rejectProviderRefund(err)
+	}
+	params := &order.RefundOrderParams{
+		RefundRequestID:       refund.RefundNo,
+		AcquiringOrderID:      topUp.ProviderOrderId,
+		MerchantRefundOrderID: refund.RefundNo,
+		MerchantID:            setting.WaffoMerchantId,
+		RequestedAt:           time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		RefundAmount:          formatWaffoAmount(refund.Money, getWaffoCurrency()),
+		RefundReason:          refund.Reason,
+		NotifyURL:             getWaffoNotifyURL(),
+	}
+	resp, err := sdk.Order().Refund(ctx, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsSuccess() {
+		return nil, rejectProviderRefund(fmt.Errorf("Waffo 退款失败 code=%s message=%s", resp.GetCode(), resp.GetMessage()))
+	}
+	data := resp.GetData()
+	if data == nil {
+		return &providerRefundResult{}, nil
+	}
+	switch data.RefundStatus {
+	case core.RefundStatusPartiallyRefunded, core.RefundStatusFullyRefunded:
+		return &providerRefundResult{ProviderRefundId: data.AcquiringRefundOrderID, Settled: true}, nil
+	case core.RefundStatusFailed:
+		return nil, rejectProviderRefund(fmt.Errorf("Waffo 退款状态为 %s", data.RefundStatus))
+	default:
+		return &providerRefundResult{ProviderRefundId: data.AcquiringRefundOrderID}, nil
+	}
+}
+
 // sendWaffoWebhookResponse 发送签名响应
 func sendWaffoWebhookResponse(c *gin.Context, wh *core.WebhookHandler, success bool, msg string) {
 	var body, sig string
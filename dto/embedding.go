@@ -1,6 +1,9 @@
 package dto
 
 import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
 	"strings"
 
 	"github.com/QuantumNous/new-api/types"
@@ -30,6 +33,9 @@ type EmbeddingRequest struct {
 	TopP             *float64 `json:"top_p,omitempty"`
 	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
 	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	// InputType tells retrieval embedding models such as Cohere embed v3 what
+	// the input is used for, e.g. search_document or search_query.
+	InputType string `json:"input_type,omitempty"`
 }
 
 func (r *EmbeddingRequest) GetTokenCountMeta() *types.TokenCountMeta {
@@ -86,3 +92,17 @@ type EmbeddingResponse struct {
 	Model  string                  `json:"model"`
 	Usage  `json:"usage"`
 }
+
+// EncodeEmbedding returns embedding in the form encoding_format asks for: the
+// list of floats, or for base64 the little-endian float32 values encoded as
+// base64, the way OpenAI returns them.
+func EncodeEmbedding(embedding []float64, encodingFormat string) any {
+	if encodingFormat != "base64" {
+		return embedding
+	}
+	buf := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,25 @@
+package dto
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeEmbedding(t *testing.T) {
+	embedding := []float64{1, -0.5, 0.25}
+	require.Equal(t, embedding, EncodeEmbedding(embedding, ""))
+	require.Equal(t, embedding, EncodeEmbedding(embedding, "float"))
+
+	encoded, ok := EncodeEmbedding(embedding, "base64").(string)
+	require.True(t, ok)
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	require.Len(t, raw, 12)
+	for i, value := range embedding {
+		require.Equal(t, float32(value), math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:])))
+	}
+}
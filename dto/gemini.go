@@ -522,7 +522,8 @@ type GeminiImageRequest struct {
 }
 
 type GeminiImageInstance struct {
-	Prompt string `json:"prompt"`
+	Prompt          string                 `json:"prompt"`
+	ReferenceImages []ImagenReferenceImage `json:"referenceImages,omitempty"`
 }
 
 type GeminiImageParameters struct {
@@ -530,6 +531,24 @@ type GeminiImageParameters struct {
 	AspectRatio      string `json:"aspectRatio,omitempty"`
 	PersonGeneration string `json:"personGeneration,omitempty"`
 	ImageSize        string `json:"imageSize,omitempty"`
+	EditMode         string `json:"editMode,omitempty"`
+}
+
+// ImagenReferenceImage is an input image of an Imagen edit request on Vertex AI.
+type ImagenReferenceImage struct {
+	ReferenceType   string                 `json:"referenceType"`
+	ReferenceId     int                    `json:"referenceId"`
+	ReferenceImage  ImagenImage            `json:"referenceImage"`
+	MaskImageConfig *ImagenMaskImageConfig `json:"maskImageConfig,omitempty"`
+}
+
+type ImagenImage struct {
+	BytesBase64Encoded string `json:"bytesBase64Encoded"`
+}
+
+type ImagenMaskImageConfig struct {
+	MaskMode string  `json:"maskMode"`
+	Dilation float64 `json:"dilation,omitempty"`
 }
 
 type GeminiImageResponse struct {
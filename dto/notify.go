@@ -13,6 +13,9 @@ const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
+
+	NotifyTypeBudgetWarning  = "budget_warning"
+	NotifyTypeBudgetExceeded = "budget_exceeded"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
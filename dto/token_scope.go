@@ -0,0 +1,220 @@
+package dto
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Endpoint scopes a token can be restricted to. Model listing is not scoped
+// and stays available to every token.
+const (
+	TokenScopeChat       = "chat"       // chat/completions, completions, responses, Claude messages, Gemini generateContent, moderations
+	TokenScopeEmbeddings = "embeddings" // OpenAI and Gemini embeddings
+	TokenScopeImages     = "images"     // image generations and edits, Imagen predict
+	TokenScopeAudio      = "audio"      // speech, transcriptions, translations
+	TokenScopeRerank     = "rerank"
+	TokenScopeRealtime   = "realtime"
+	TokenScopeVideo      = "video" // video tasks, Kling and Jimeng
+	TokenScopeMidjourney = "midjourney"
+	TokenScopeSuno       = "suno"
+	TokenScopeFiles      = "files" // files, batches and fine-tuning jobs
+)
+
+var tokenEndpointScopes = []string{
+	TokenScopeChat,
+	TokenScopeEmbeddings,
+	TokenScopeImages,
+	TokenScopeAudio,
+	TokenScopeRerank,
+	TokenScopeRealtime,
+	TokenScopeVideo,
+	TokenScopeMidjourney,
+	TokenScopeSuno,
+	TokenScopeFiles,
+}
+
+const (
+	TokenStreamModeAny       = ""
+	TokenStreamModeStream    = "stream"     // only streaming requests
+	TokenStreamModeNonStream = "non_stream" // only non-streaming requests
+)
+
+// tokenOverridableParams are the request fields a token may force. Only
+// sampling and length parameters qualify: content fields would skip the
+// sensitive word check and moderation, which run before overrides apply,
+// and the model and stream decide channel selection and billing.
+var tokenOverridableParams = []string{
+	"temperature",
+	"top_p",
+	"top_k",
+	"min_p",
+	"max_tokens",
+	"max_completion_tokens",
+	"max_output_tokens",
+	"presence_penalty",
+	"frequency_penalty",
+	"repetition_penalty",
+	"seed",
+	"stop",
+	"reasoning_effort",
+	"user",
+}
+
+// tokenLengthParams are the overridable fields that set the output length,
+// which must stay within the max output tokens of the scope.
+var tokenLengthParams = []string{
+	"max_tokens",
+	"max_completion_tokens",
+	"max_output_tokens",
+}
+
+// TokenScope restricts what a token may call. The zero value restricts nothing.
+type TokenScope struct {
+	Endpoints       []string       `json:"endpoints,omitempty"`         // allowed endpoint scopes, empty allows all
+	MaxRequestBytes int64          `json:"max_request_bytes,omitempty"` // 0 means the global body limit only
+	MaxOutputTokens int            `json:"max_output_tokens,omitempty"` // upper bound of the requested output tokens
+	StreamMode      string         `json:"stream_mode,omitempty"`       // TokenStreamMode*, applies to chat requests
+	ParamOverride   map[string]any `json:"param_override,omitempty"`    // sampling parameters forced on every request, see tokenOverridableParams
+}
+
+func (s TokenScope) AllowsEndpoint(scope string) bool {
+	return scope == "" || len(s.Endpoints) == 0 || slices.Contains(s.Endpoints, scope)
+}
+
+// NeedsRequestBody reports whether enforcing the scope requires reading the
+// request body beyond its length.
+func (s TokenScope) NeedsRequestBody() bool {
+	return s.MaxOutputTokens > 0 || s.StreamMode != TokenStreamModeAny
+}
+
+func (s TokenScope) Validate() error {
+	for _, endpoint := range s.Endpoints {
+		if !slices.Contains(tokenEndpointScopes, endpoint) {
+			return fmt.Errorf("unknown endpoint scope %q", endpoint)
+		}
+	}
+	if s.MaxRequestBytes < 0 || s.MaxOutputTokens < 0 {
+		return fmt.Errorf("token limits must not be negative")
+	}
+	switch s.StreamMode {
+	case TokenStreamModeAny, TokenStreamModeStream, TokenStreamModeNonStream:
+	default:
+		return fmt.Errorf("unknown stream mode %q", s.StreamMode)
+	}
+	for key, value := range s.ParamOverride {
+		if !slices.Contains(tokenOverridableParams, key) {
+			return fmt.Errorf("param override of %q is not allowed on tokens, allowed: %s", key, strings.Join(tokenOverridableParams, ", "))
+		}
+		if err := s.checkLengthOverride(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLengthOverride rejects a forced output length that is not a positive
+// integer or exceeds the max output tokens of the scope.
+func (s TokenScope) checkLengthOverride(key string, value any) error {
+	if !slices.Contains(tokenLengthParams, key) {
+		return nil
+	}
+	tokens, ok := overrideInt(value)
+	if !ok || tokens <= 0 {
+		return fmt.Errorf("param override of %q must be a positive integer", key)
+	}
+	if s.MaxOutputTokens > 0 && tokens > s.MaxOutputTokens {
+		return fmt.Errorf("param override of %q is %d, above the max output tokens %d", key, tokens, s.MaxOutputTokens)
+	}
+	return nil
+}
+
+// overrideInt returns value as an integer, accepting the float64 JSON
+// decoding produces.
+func overrideInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// AllowedParamOverride returns the param overrides of the scope a token may
+// force, dropping any other field or output length beyond the limit a scope
+// saved before the allow-list had.
+func (s TokenScope) AllowedParamOverride() map[string]any {
+	var allowed map[string]any
+	for key, value := range s.ParamOverride {
+		if !slices.Contains(tokenOverridableParams, key) || s.checkLengthOverride(key, value) != nil {
+			continue
+		}
+		if allowed == nil {
+			allowed = make(map[string]any, len(s.ParamOverride))
+		}
+		allowed[key] = value
+	}
+	return allowed
+}
+
+// Narrow returns the scope of a token derived from a token with scope s.
+// Fields left empty in child inherit the limits of s, and child may only
+// tighten them: endpoints must be a subset, byte and token limits take the
+// lower value, and the param overrides of s win over those of child. The
+// result is validated again so no forced length exceeds its max output tokens.
+func (s TokenScope) Narrow(child TokenScope) (TokenScope, error) {
+	if err := child.Validate(); err != nil {
+		return TokenScope{}, err
+	}
+	narrowed := child
+	if len(s.Endpoints) > 0 {
+		if len(child.Endpoints) == 0 {
+			narrowed.Endpoints = slices.Clone(s.Endpoints)
+		}
+		for _, endpoint := range narrowed.Endpoints {
+			if !slices.Contains(s.Endpoints, endpoint) {
+				return TokenScope{}, fmt.Errorf("endpoint scope %q is not allowed on the parent token", endpoint)
+			}
+		}
+	}
+	narrowed.MaxRequestBytes = minPositive(s.MaxRequestBytes, child.MaxRequestBytes)
+	narrowed.MaxOutputTokens = minPositive(s.MaxOutputTokens, child.MaxOutputTokens)
+	if s.StreamMode != TokenStreamModeAny {
+		if child.StreamMode != TokenStreamModeAny && child.StreamMode != s.StreamMode {
+			return TokenScope{}, fmt.Errorf("stream mode %q conflicts with the parent token", child.StreamMode)
+		}
+		narrowed.StreamMode = s.StreamMode
+	}
+	if len(s.ParamOverride) > 0 {
+		narrowed.ParamOverride = make(map[string]any, len(s.ParamOverride)+len(child.ParamOverride))
+		for key, value := range child.ParamOverride {
+			narrowed.ParamOverride[key] = value
+		}
+		for key, value := range s.ParamOverride {
+			narrowed.ParamOverride[key] = value
+		}
+	}
+	// forced output lengths must also fit the narrowed limit
+	if err := narrowed.Validate(); err != nil {
+		return TokenScope{}, err
+	}
+	return narrowed, nil
+}
+
+// minPositive returns the lower of two limits where 0 means unlimited.
+func minPositive[T int | int64](a T, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenScopeNarrow(t *testing.T) {
+	parent := TokenScope{
+		Endpoints:       []string{TokenScopeChat, TokenScopeEmbeddings},
+		MaxOutputTokens: 2000,
+		StreamMode:      TokenStreamModeStream,
+		ParamOverride:   map[string]any{"temperature": 0.2},
+	}
+
+	inherited, err := parent.Narrow(TokenScope{})
+	require.NoError(t, err)
+	require.Equal(t, parent, inherited)
+
+	narrowed, err := parent.Narrow(TokenScope{
+		Endpoints:       []string{TokenScopeChat},
+		MaxRequestBytes: 4096,
+		MaxOutputTokens: 5000,
+		ParamOverride:   map[string]any{"temperature": 1.0, "user": "job-42"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{TokenScopeChat}, narrowed.Endpoints)
+	require.EqualValues(t, 4096, narrowed.MaxRequestBytes)
+	require.Equal(t, 2000, narrowed.MaxOutputTokens)
+	require.Equal(t, TokenStreamModeStream, narrowed.StreamMode)
+	require.Equal(t, map[string]any{"temperature": 0.2, "user": "job-42"}, narrowed.ParamOverride)
+
+	_, err = parent.Narrow(TokenScope{Endpoints: []string{TokenScopeImages}})
+	require.Error(t, err)
+	_, err = parent.Narrow(TokenScope{StreamMode: TokenStreamModeNonStream})
+	require.Error(t, err)
+	_, err = TokenScope{}.Narrow(TokenScope{ParamOverride: map[string]any{"stream": false}})
+	require.Error(t, err)
+	_, err = parent.Narrow(TokenScope{ParamOverride: map[string]any{"max_tokens": 100000.0}})
+	require.Error(t, err, "a child must not force a length above the parent limit")
+	_, err = TokenScope{ParamOverride: map[string]any{"max_tokens": 1500.0}}.Narrow(TokenScope{MaxOutputTokens: 1000})
+	require.Error(t, err, "a forced parent length must fit the narrowed limit")
+}
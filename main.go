@@ -24,6 +24,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
@@ -163,6 +164,22 @@ func main() {
 		common.SysError(fmt.Sprintf("start pyroscope error : %v", err))
 	}
 
+	shutdownTracing := func(context.Context) error { return nil }
+	if constant.TracingEnabled {
+		shutdown, err := tracing.Init(tracing.Config{
+			Endpoint:       constant.TracingEndpoint,
+			SampleRatio:    constant.TracingSampleRatio,
+			ServiceName:    constant.TracingServiceName,
+			ServiceVersion: common.Version,
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("start tracing error : %v", err))
+		} else {
+			shutdownTracing = shutdown
+			common.SysLog(fmt.Sprintf("tracing enabled, sample ratio %g", constant.TracingSampleRatio))
+		}
+	}
+
 	// Initialize HTTP server
 	server := gin.New()
 	if err := configureTrustedProxies(server); err != nil {
@@ -224,6 +241,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		common.SysError(fmt.Sprintf("server forced to shutdown: %v", err))
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		common.SysError(fmt.Sprintf("flush traces error: %v", err))
+	}
 	// 内存中的看板数据保存入库，避免重启丢失未落库数据 (issue #5679)
 	if common.DataExportEnabled {
 		model.SaveQuotaDataCache()
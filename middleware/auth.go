@@ -12,12 +12,14 @@ import (
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/service/authz"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
@@ -351,6 +353,8 @@ func TokenAuthReadOnly() func(c *gin.Context) {
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span := tracing.StartSpan(c, "token_auth")
+		defer span.End()
 		// 先检测是否为ws
 		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
 			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
@@ -478,6 +482,22 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		message, err := checkTokenScope(c, token.GetScope())
+		if err != nil {
+			if common.IsRequestBodyTooLargeError(err) {
+				abortWithOpenAiMessage(c, http.StatusRequestEntityTooLarge, err.Error())
+			} else {
+				abortWithOpenAiMessage(c, http.StatusBadRequest, "无法解析请求体: "+err.Error())
+			}
+			return
+		}
+		if message != "" {
+			abortWithTokenScopeMessage(c, message)
+			return
+		}
+		span.SetAttributes(attribute.Int("user_id", token.UserId), attribute.Int("token_id", token.Id))
+		// 后续中间件与转发不计入鉴权耗时
+		span.End()
 		c.Next()
 	}
 }
@@ -490,6 +510,9 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	c.Set("token_id", token.Id)
 	c.Set("token_key", token.Key)
 	c.Set("token_name", token.Name)
+	if token.IsDerived() {
+		common.SetContextKey(c, constant.ContextKeyTokenParentId, token.ParentId)
+	}
 	c.Set("token_unlimited_quota", token.UnlimitedQuota)
 	if !token.UnlimitedQuota {
 		c.Set("token_quota", token.RemainQuota)
@@ -502,6 +525,10 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCache, token.ResponseCache)
+	if paramOverride := token.GetScope().AllowedParamOverride(); len(paramOverride) > 0 {
+		common.SetContextKey(c, constant.ContextKeyTokenParamOverride, paramOverride)
+	}
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyCapture stores the request and response bodies of relay requests opted
+// in to body capture.
+func BodyCapture() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		finish := service.StartBodyCapture(c)
+		c.Next()
+		finish()
+	}
+}
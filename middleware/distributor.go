@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -31,7 +33,10 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span := tracing.StartSpan(c, "distribute")
+		defer span.End()
 		var channel *model.Channel
+		pinnedKeyIndex := -1
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
@@ -101,7 +106,11 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				if pinned, keyIndex, found := getPinnedFineTunedChannel(c, modelRequest.Model); found {
+					// fine-tuned models only exist on the upstream account that trained them
+					channel = pinned
+					pinnedKeyIndex = keyIndex
+				} else if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					affinityUsable := false
 					preferred, err := model.CacheGetChannel(preferredChannelID)
 					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled &&
@@ -162,6 +171,17 @@ func Distribute() func(c *gin.Context) {
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		if pinnedKeyIndex >= 0 && channel.ChannelInfo.IsMultiKey {
+			if keys := channel.GetKeys(); pinnedKeyIndex < len(keys) {
+				common.SetContextKey(c, constant.ContextKeyChannelKey, keys[pinnedKeyIndex])
+				common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, pinnedKeyIndex)
+			}
+		}
+		if channel != nil {
+			span.SetAttributes(attribute.Int("channel_id", channel.Id), attribute.String("model", modelRequest.Model))
+		}
+		// 后续中间件与转发不计入选路耗时
+		span.End()
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
@@ -169,6 +189,43 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// getPinnedFineTunedChannel returns the channel and key index a fine-tuned
+// model was pinned to when its training job finished. Only the user who
+// trained the model is routed there.
+func getPinnedFineTunedChannel(c *gin.Context, modelName string) (*model.Channel, int, bool) {
+	if !model.IsFineTunedModelName(modelName) {
+		return nil, -1, false
+	}
+	pinned, err := model.GetFineTunedModel(modelName)
+	if err != nil || pinned.UserId != common.GetContextKeyInt(c, constant.ContextKeyUserId) {
+		return nil, -1, false
+	}
+	channel, err := model.CacheGetChannel(pinned.ChannelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled {
+		return nil, -1, false
+	}
+	return channel, pinned.ChannelKeyIndex, true
+}
+
+// DistributeFileUpload runs the normal distributor for a /v1/files upload only
+// when the multipart form names a model, so the file can be forwarded to the
+// selected channel. Uploads without a model are stored by the gateway alone.
+func DistributeFileUpload() func(c *gin.Context) {
+	distribute := Distribute()
+	return func(c *gin.Context) {
+		modelRequest, err := getModelFromRequest(c)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if modelRequest.Model == "" {
+			c.Next()
+			return
+		}
+		distribute(c)
+	}
+}
+
 // channelSupportsRequestPath reports whether a channel can serve the request path.
 // Only Advanced Custom (type 58) channels are path-checked; all other channel types
 // always pass. A type-58 channel is usable only when one of its routes matches.
@@ -335,6 +392,21 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		if _, ok := c.Get("relay_mode"); !ok {
 			c.Set("relay_mode", relayMode)
 		}
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/fine_tuning/jobs") || strings.HasPrefix(c.Request.URL.Path, "/v1/fine-tunes") {
+		// only job creation selects a channel, the rest is served from the task
+		req, err := getModelFromRequest(c)
+		if err != nil {
+			return nil, false, err
+		}
+		modelRequest.Model = req.Model
+		c.Set("platform", string(constant.TaskPlatformFineTune))
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/files") {
+		// only reached through DistributeFileUpload, which requires a model
+		req, err := getModelFromRequest(c)
+		if err != nil {
+			return nil, false, err
+		}
+		modelRequest.Model = req.Model
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") || strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 		// Gemini API 路径处理: /v1beta/models/gemini-2.0-flash:generateContent
 		relayMode := relayconstant.RelayModeGemini
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth guards the Prometheus endpoint. A scrape is allowed when it
+// carries METRICS_TOKEN as a bearer token or comes from an address listed in
+// METRICS_ALLOWED_IPS; with neither configured every scrape is refused.
+func MetricsAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if constant.MetricsToken != "" {
+			token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+			if subtle.ConstantTimeCompare([]byte(token), []byte(constant.MetricsToken)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		if len(constant.MetricsAllowedIPs) > 0 {
+			if ip := net.ParseIP(c.ClientIP()); ip != nil && common.IsIpInCIDRList(ip, constant.MetricsAllowedIPs) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func runMetricsAuthRequest(t *testing.T, remoteAddr string, authorization string) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/metrics", MetricsAuth(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.RemoteAddr = remoteAddr
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response.Code
+}
+
+func TestMetricsAuth(t *testing.T) {
+	previousToken := constant.MetricsToken
+	previousIPs := constant.MetricsAllowedIPs
+	t.Cleanup(func() {
+		constant.MetricsToken = previousToken
+		constant.MetricsAllowedIPs = previousIPs
+	})
+
+	constant.MetricsToken = ""
+	constant.MetricsAllowedIPs = nil
+	assert.Equal(t, http.StatusForbidden, runMetricsAuthRequest(t, "127.0.0.1:1234", ""))
+
+	constant.MetricsToken = "scrape-secret"
+	constant.MetricsAllowedIPs = []string{"10.0.0.0/8"}
+	assert.Equal(t, http.StatusOK, runMetricsAuthRequest(t, "192.168.1.2:1234", "Bearer scrape-secret"))
+	assert.Equal(t, http.StatusForbidden, runMetricsAuthRequest(t, "192.168.1.2:1234", "Bearer wrong"))
+	assert.Equal(t, http.StatusOK, runMetricsAuthRequest(t, "10.1.2.3:1234", ""))
+}
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// tokenScopeRequest holds the request fields a token scope limits, across
+// the OpenAI, Claude and Gemini request formats.
+type tokenScopeRequest struct {
+	Stream              bool `json:"stream"`
+	MaxTokens           int  `json:"max_tokens"`
+	MaxCompletionTokens int  `json:"max_completion_tokens"`
+	MaxOutputTokens     int  `json:"max_output_tokens"`
+	GenerationConfig    struct {
+		MaxOutputTokens int `json:"maxOutputTokens"`
+	} `json:"generationConfig"`
+}
+
+func (r tokenScopeRequest) requestedOutputTokens() int {
+	return max(r.MaxTokens, r.MaxCompletionTokens, r.MaxOutputTokens, r.GenerationConfig.MaxOutputTokens)
+}
+
+// tokenEndpointScope maps a relay path to the dto.TokenScope* endpoint scope
+// it belongs to, or "" for paths every token may call such as model listing.
+func tokenEndpointScope(method string, path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/realtime"):
+		return dto.TokenScopeRealtime
+	case strings.HasPrefix(path, "/suno/"):
+		return dto.TokenScopeSuno
+	case strings.Contains(path, "/mj/"):
+		return dto.TokenScopeMidjourney
+	case strings.HasPrefix(path, "/v1/video"), strings.HasPrefix(path, "/kling/"), strings.HasPrefix(path, "/jimeng"):
+		return dto.TokenScopeVideo
+	case strings.HasPrefix(path, "/v1/files"), strings.HasPrefix(path, "/v1/batches"),
+		strings.HasPrefix(path, "/v1/fine_tuning"), strings.HasPrefix(path, "/v1/fine-tunes"):
+		return dto.TokenScopeFiles
+	case strings.HasPrefix(path, "/v1/images/"), strings.HasPrefix(path, "/v1/edits"):
+		return dto.TokenScopeImages
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return dto.TokenScopeAudio
+	case strings.HasPrefix(path, "/v1/rerank"):
+		return dto.TokenScopeRerank
+	case strings.HasSuffix(path, "/embeddings"):
+		return dto.TokenScopeEmbeddings
+	case strings.HasPrefix(path, "/v1beta/models/"), strings.HasPrefix(path, "/v1/models/"):
+		if method == http.MethodGet {
+			return ""
+		}
+		if strings.HasSuffix(path, ":embedContent") || strings.HasSuffix(path, ":batchEmbedContents") {
+			return dto.TokenScopeEmbeddings
+		}
+		if strings.HasSuffix(path, ":predict") {
+			return dto.TokenScopeImages
+		}
+		return dto.TokenScopeChat
+	case strings.HasPrefix(path, "/v1/chat/"), strings.HasPrefix(path, "/v1/completions"),
+		strings.HasPrefix(path, "/v1/responses"), strings.HasPrefix(path, "/v1/messages"),
+		strings.HasPrefix(path, "/v1/moderations"):
+		return dto.TokenScopeChat
+	default:
+		return ""
+	}
+}
+
+// checkTokenScope returns why the request is outside scope, or "" when the
+// token may make it.
+func checkTokenScope(c *gin.Context, scope dto.TokenScope) (string, error) {
+	path := c.Request.URL.Path
+	endpoint := tokenEndpointScope(c.Request.Method, path)
+	if !scope.AllowsEndpoint(endpoint) {
+		return fmt.Sprintf("该令牌无权调用 %s 类接口", endpoint), nil
+	}
+	if c.Request.Method == http.MethodGet {
+		return "", nil
+	}
+	if scope.MaxRequestBytes > 0 {
+		size := c.Request.ContentLength
+		if size < 0 {
+			storage, err := common.GetBodyStorage(c)
+			if err != nil {
+				return "", err
+			}
+			size = storage.Size()
+		}
+		if size > scope.MaxRequestBytes {
+			return fmt.Sprintf("请求体大小 %d 字节超过令牌上限 %d 字节", size, scope.MaxRequestBytes), nil
+		}
+	}
+	if !scope.NeedsRequestBody() {
+		return "", nil
+	}
+	request, isJSON, err := readTokenScopeRequest(c)
+	if errors.Is(err, errTokenScopeBodyUnreadable) {
+		return fmt.Sprintf("该令牌限制了请求参数，无法读取 Content-Type 为 %q 的请求体", c.ContentType()), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if scope.MaxOutputTokens > 0 && request.requestedOutputTokens() > scope.MaxOutputTokens {
+		return fmt.Sprintf("请求的最大输出 token 数 %d 超过令牌上限 %d", request.requestedOutputTokens(), scope.MaxOutputTokens), nil
+	}
+	if endpoint == dto.TokenScopeChat {
+		stream := request.Stream || strings.HasSuffix(path, ":streamGenerateContent")
+		switch {
+		case scope.StreamMode == dto.TokenStreamModeStream && !stream:
+			return "该令牌仅允许流式请求", nil
+		case scope.StreamMode == dto.TokenStreamModeNonStream && stream:
+			return "该令牌仅允许非流式请求", nil
+		}
+		if scope.MaxOutputTokens > 0 && request.requestedOutputTokens() <= 0 {
+			if !isJSON {
+				return "该令牌限制了最大输出 token 数，请在请求中设置", nil
+			}
+			if err := setRequestOutputTokens(c, path, scope.MaxOutputTokens); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "", nil
+}
+
+// errTokenScopeBodyUnreadable marks a request body checkTokenScope cannot
+// parse, so the limits of the scope cannot be checked.
+var errTokenScopeBodyUnreadable = errors.New("request body is not readable")
+
+// readTokenScopeRequest parses the request body whatever its Content-Type.
+// Form bodies are read the way the relay reads them, and any other body as
+// JSON, since that is what the relay forwards upstream. isJSON reports
+// whether the body is JSON and can take fields set by the scope.
+func readTokenScopeRequest(c *gin.Context) (request tokenScopeRequest, isJSON bool, err error) {
+	switch contentType := c.ContentType(); {
+	case contentType == gin.MIMEPOSTForm, contentType == gin.MIMEMultipartPOSTForm:
+		return request, false, common.UnmarshalBodyReusable(c, &request)
+	case strings.HasPrefix(contentType, "application/json"):
+		return request, true, common.UnmarshalBodyReusable(c, &request)
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return request, false, err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return request, false, err
+	}
+	if _, err := storage.Seek(0, io.SeekStart); err != nil {
+		return request, false, err
+	}
+	c.Request.Body = io.NopCloser(storage)
+	if len(bytes.TrimSpace(body)) == 0 {
+		return request, true, nil
+	}
+	if err := common.Unmarshal(body, &request); err != nil {
+		return request, false, errTokenScopeBodyUnreadable
+	}
+	return request, true, nil
+}
+
+// setRequestOutputTokens writes the max output tokens of the token scope into
+// a chat request that sets none, so it cannot run unbounded.
+func setRequestOutputTokens(c *gin.Context, path string, tokens int) error {
+	field := "max_tokens"
+	switch {
+	case strings.HasPrefix(path, "/v1/moderations"):
+		return nil
+	case strings.HasPrefix(path, "/v1/responses"):
+		field = "max_output_tokens"
+	case strings.HasPrefix(path, "/v1beta/models/"), strings.HasPrefix(path, "/v1/models/"):
+		field = "generationConfig.maxOutputTokens"
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return err
+	}
+	body, err = sjson.SetBytes(body, field, tokens)
+	if err != nil {
+		return err
+	}
+	storage, err = common.CreateBodyStorage(body)
+	if err != nil {
+		return err
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyBodyStorage, storage)
+	c.Request.Body = io.NopCloser(storage)
+	c.Request.ContentLength = int64(len(body))
+	return nil
+}
+
+// abortWithTokenScopeMessage answers a request outside the token scope with a
+// 403 in the error format of the relay endpoint that was called.
+func abortWithTokenScopeMessage(c *gin.Context, message string) {
+	path := c.Request.URL.Path
+	detail := common.MessageWithRequestId(message, c.GetString(common.RequestIdKey))
+	switch tokenEndpointScope(c.Request.Method, path) {
+	case dto.TokenScopeMidjourney:
+		abortWithMidjourneyMessage(c, http.StatusForbidden, constant.MjRequestError, detail)
+		return
+	case dto.TokenScopeSuno, dto.TokenScopeVideo:
+		c.JSON(http.StatusForbidden, &dto.TaskError{
+			Code:    string(types.ErrorCodeAccessDenied),
+			Message: detail,
+		})
+		c.Abort()
+		return
+	}
+	switch {
+	case strings.HasPrefix(path, "/v1/messages"):
+		c.JSON(http.StatusForbidden, gin.H{
+			"type": "error",
+			"error": types.ClaudeError{
+				Type:    "permission_error",
+				Message: detail,
+			},
+		})
+		c.Abort()
+	case strings.HasPrefix(path, "/v1beta/"):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    http.StatusForbidden,
+				"message": detail,
+				"status":  "PERMISSION_DENIED",
+			},
+		})
+		c.Abort()
+	default:
+		abortWithOpenAiMessage(c, http.StatusForbidden, message, types.ErrorCodeAccessDenied)
+	}
+}
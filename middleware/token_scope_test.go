@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newTokenScopeContext(method string, path string, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c, recorder
+}
+
+func TestTokenEndpointScope(t *testing.T) {
+	cases := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodPost, "/v1/chat/completions", dto.TokenScopeChat},
+		{http.MethodPost, "/v1/messages", dto.TokenScopeChat},
+		{http.MethodPost, "/v1/responses", dto.TokenScopeChat},
+		{http.MethodPost, "/v1/embeddings", dto.TokenScopeEmbeddings},
+		{http.MethodPost, "/v1/engines/text-embedding-3-small/embeddings", dto.TokenScopeEmbeddings},
+		{http.MethodPost, "/v1beta/models/gemini-2.5-pro:streamGenerateContent", dto.TokenScopeChat},
+		{http.MethodPost, "/v1beta/models/text-embedding-004:batchEmbedContents", dto.TokenScopeEmbeddings},
+		{http.MethodPost, "/v1beta/models/imagen-4.0-generate-001:predict", dto.TokenScopeImages},
+		{http.MethodGet, "/v1beta/models/gemini-2.5-pro", ""},
+		{http.MethodPost, "/v1/images/generations", dto.TokenScopeImages},
+		{http.MethodPost, "/v1/audio/transcriptions", dto.TokenScopeAudio},
+		{http.MethodPost, "/v1/rerank", dto.TokenScopeRerank},
+		{http.MethodGet, "/v1/realtime", dto.TokenScopeRealtime},
+		{http.MethodPost, "/v1/video/generations", dto.TokenScopeVideo},
+		{http.MethodPost, "/mj/submit/imagine", dto.TokenScopeMidjourney},
+		{http.MethodPost, "/fast/mj/submit/imagine", dto.TokenScopeMidjourney},
+		{http.MethodPost, "/suno/submit/music", dto.TokenScopeSuno},
+		{http.MethodGet, "/v1/models", ""},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, tokenEndpointScope(tc.method, tc.path), tc.path)
+	}
+}
+
+func TestCheckTokenScopeRejectsRequestsOutsideScope(t *testing.T) {
+	scope := dto.TokenScope{
+		Endpoints:       []string{dto.TokenScopeChat},
+		MaxRequestBytes: 64,
+		MaxOutputTokens: 1000,
+		StreamMode:      dto.TokenStreamModeNonStream,
+	}
+	cases := []struct {
+		name    string
+		path    string
+		body    string
+		allowed bool
+	}{
+		{"allowed chat", "/v1/chat/completions", `{"model":"gpt-4o","max_tokens":500}`, true},
+		{"endpoint", "/v1/embeddings", `{"model":"text-embedding-3-small"}`, false},
+		{"size", "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("a", 64) + `"}]}`, false},
+		{"max tokens", "/v1/chat/completions", `{"model":"gpt-4o","max_completion_tokens":2000}`, false},
+		{"gemini max tokens", "/v1beta/models/gemini-2.5-pro:generateContent", `{"generationConfig":{"maxOutputTokens":4096}}`, false},
+		{"stream", "/v1/chat/completions", `{"model":"gpt-4o","stream":true}`, false},
+		{"gemini stream", "/v1beta/models/gemini-2.5-pro:streamGenerateContent", `{}`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := newTokenScopeContext(http.MethodPost, tc.path, tc.body)
+			message, err := checkTokenScope(c, scope)
+			require.NoError(t, err)
+			if tc.allowed {
+				assert.Empty(t, message)
+			} else {
+				assert.NotEmpty(t, message)
+			}
+		})
+	}
+}
+
+func TestCheckTokenScopeReadsBodyOfAnyContentType(t *testing.T) {
+	scope := dto.TokenScope{MaxOutputTokens: 1000, StreamMode: dto.TokenStreamModeNonStream}
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		allowed     bool
+	}{
+		{"json as text", "text/plain", `{"model":"gpt-4o","max_tokens":500}`, true},
+		{"stream as text", "text/plain", `{"model":"gpt-4o","stream":true,"max_tokens":500}`, false},
+		{"max tokens without content type", "", `{"model":"gpt-4o","max_tokens":2000}`, false},
+		{"unreadable", "application/octet-stream", "\x00\x01", false},
+		{"form without max tokens", "application/x-www-form-urlencoded", "model=gpt-4o", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := newTokenScopeContext(http.MethodPost, "/v1/chat/completions", tc.body)
+			c.Request.Header.Set("Content-Type", tc.contentType)
+			message, err := checkTokenScope(c, scope)
+			require.NoError(t, err)
+			if tc.allowed {
+				assert.Empty(t, message)
+			} else {
+				assert.NotEmpty(t, message)
+			}
+		})
+	}
+}
+
+func TestCheckTokenScopeKeepsBodyForRelay(t *testing.T) {
+	body := `{"model":"gpt-4o","max_tokens":10}`
+	c, _ := newTokenScopeContext(http.MethodPost, "/v1/chat/completions", body)
+	message, err := checkTokenScope(c, dto.TokenScope{MaxOutputTokens: 100})
+	require.NoError(t, err)
+	require.Empty(t, message)
+
+	var request dto.GeneralOpenAIRequest
+	require.NoError(t, common.UnmarshalBodyReusable(c, &request))
+	assert.Equal(t, "gpt-4o", request.Model)
+}
+
+func TestCheckTokenScopeSetsMissingOutputTokens(t *testing.T) {
+	cases := []struct {
+		path  string
+		body  string
+		field string
+	}{
+		{"/v1/chat/completions", `{"model":"gpt-4o"}`, "max_tokens"},
+		{"/v1/responses", `{"model":"gpt-4o"}`, "max_output_tokens"},
+		{"/v1beta/models/gemini-2.5-pro:generateContent", `{"contents":[]}`, "generationConfig.maxOutputTokens"},
+	}
+	for _, tc := range cases {
+		c, _ := newTokenScopeContext(http.MethodPost, tc.path, tc.body)
+		message, err := checkTokenScope(c, dto.TokenScope{MaxOutputTokens: 1000})
+		require.NoError(t, err, tc.path)
+		require.Empty(t, message, tc.path)
+
+		storage, err := common.GetBodyStorage(c)
+		require.NoError(t, err, tc.path)
+		body, err := storage.Bytes()
+		require.NoError(t, err, tc.path)
+		assert.EqualValues(t, 1000, gjson.GetBytes(body, tc.field).Int(), tc.path)
+	}
+}
+
+func TestAbortWithTokenScopeMessageUsesEndpointErrorFormat(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/v1/chat/completions", `"code":"access_denied"`},
+		{"/v1/messages", `"type":"permission_error"`},
+		{"/v1beta/models/gemini-2.5-pro:generateContent", `"status":"PERMISSION_DENIED"`},
+		{"/mj/submit/imagine", `"description":`},
+		{"/suno/submit/music", `"code":"access_denied"`},
+	}
+	for _, tc := range cases {
+		c, recorder := newTokenScopeContext(http.MethodPost, tc.path, `{}`)
+		abortWithTokenScopeMessage(c, "denied")
+		assert.Equal(t, http.StatusForbidden, recorder.Code, tc.path)
+		assert.Contains(t, recorder.Body.String(), tc.want, tc.path)
+		assert.True(t, c.IsAborted(), tc.path)
+	}
+}
+
+func TestTokenScopeValidate(t *testing.T) {
+	assert.NoError(t, dto.TokenScope{}.Validate())
+	assert.NoError(t, dto.TokenScope{
+		Endpoints:     []string{dto.TokenScopeChat, dto.TokenScopeEmbeddings},
+		StreamMode:    dto.TokenStreamModeStream,
+		ParamOverride: map[string]any{"temperature": 0.2},
+	}.Validate())
+	assert.Error(t, dto.TokenScope{Endpoints: []string{"unknown"}}.Validate())
+	assert.Error(t, dto.TokenScope{MaxOutputTokens: -1}.Validate())
+	assert.Error(t, dto.TokenScope{StreamMode: "sometimes"}.Validate())
+	assert.Error(t, dto.TokenScope{ParamOverride: map[string]any{"Model": "gpt-4o"}}.Validate())
+	assert.Error(t, dto.TokenScope{ParamOverride: map[string]any{"operations": []any{}}}.Validate())
+	assert.Error(t, dto.TokenScope{ParamOverride: map[string]any{"messages": []any{}}}.Validate(), "content fields would skip moderation")
+	assert.Equal(t, map[string]any{"top_p": 0.5}, dto.TokenScope{ParamOverride: map[string]any{"top_p": 0.5, "prompt": "x"}}.AllowedParamOverride())
+
+	assert.NoError(t, dto.TokenScope{MaxOutputTokens: 1000, ParamOverride: map[string]any{"max_tokens": 800.0}}.Validate())
+	assert.Error(t, dto.TokenScope{MaxOutputTokens: 1000, ParamOverride: map[string]any{"max_tokens": 100000.0}}.Validate(), "forced length above the scope limit")
+	assert.Error(t, dto.TokenScope{ParamOverride: map[string]any{"max_output_tokens": "many"}}.Validate())
+	assert.Empty(t, dto.TokenScope{MaxOutputTokens: 1000, ParamOverride: map[string]any{"max_completion_tokens": 100000.0}}.AllowedParamOverride())
+}
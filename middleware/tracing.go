@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tracing starts the root span of a relay request. The later stages, from
+// token auth to billing, record their spans under it.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := tracing.StartRequest(c, c.Request.Method+" "+c.FullPath(),
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("url.path", c.Request.URL.Path),
+			attribute.String("request_id", c.GetString(common.RequestIdKey)),
+		)
+		if span == nil {
+			c.Next()
+			return
+		}
+		defer span.End()
+		if traceId := tracing.TraceID(span.Context()); traceId != "" {
+			common.SetContextKey(c, constant.ContextKeyTraceId, traceId)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.Int("user_id", c.GetInt("id")),
+			attribute.Int("channel_id", common.GetContextKeyInt(c, constant.ContextKeyChannelId)),
+			attribute.String("model", common.GetContextKeyString(c, constant.ContextKeyOriginalModel)),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("response status %d", status))
+		}
+	}
+}
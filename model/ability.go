@@ -122,26 +122,18 @@ func GetChannel(group string, model string, retry int, requestPath string) (*Cha
 		return nil, err
 	}
 	abilities = filterAbilitiesByRequestPathAndModel(abilities, requestPath, model)
-	channel := Channel{}
-	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
-		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
-		}
-		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
-			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
-				channel.Id = ability_.ChannelId
-				break
-			}
-		}
-	} else {
+	abilities = filterAbilitiesByCircuitBreaker(abilities)
+	if len(abilities) == 0 {
 		return nil, nil
 	}
+	channelIds := make([]int, len(abilities))
+	weights := make([]int, len(abilities))
+	for i, ability_ := range abilities {
+		channelIds[i] = ability_.ChannelId
+		weights[i] = int(ability_.Weight) + 10
+	}
+	channel := Channel{}
+	channel.Id = channelIds[pickAvailableChannelIndex(channelIds, weights)]
 	err = DB.First(&channel, "id = ?", channel.Id).Error
 	return &channel, err
 }
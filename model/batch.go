@@ -0,0 +1,229 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// runnableBatchStatuses are the states the batch runner still has work for.
+var runnableBatchStatuses = []string{
+	BatchStatusValidating,
+	BatchStatusInProgress,
+	BatchStatusFinalizing,
+	BatchStatusCancelling,
+}
+
+// Batch is an OpenAI-compatible batch executed by the gateway itself: every
+// line of InputFileId is replayed through the relay pipeline with the owning
+// token, and the collected responses are written to OutputFileId/ErrorFileId.
+type Batch struct {
+	Id               int    `json:"id"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(32);index"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	ClientIp         string `json:"client_ip" gorm:"type:varchar(64)"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint;default:0"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint;default:0"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint;default:0"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint;default:0"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint;default:0"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint;default:0"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint;default:0"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint;default:0"`
+}
+
+// BatchRequestResult is the output line of one executed batch request. Rows
+// are written as lines finish so an interrupted run can resume, and are
+// removed once the batch output/error files have been generated.
+type BatchRequestResult struct {
+	Id        int    `json:"id"`
+	BatchId   string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex:idx_batch_line"`
+	LineIndex int    `json:"line_index" gorm:"uniqueIndex:idx_batch_line"`
+	CustomId  string `json:"custom_id" gorm:"type:varchar(255)"`
+	Success   bool   `json:"success"`
+	Body      string `json:"body" gorm:"type:text"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (batch *Batch) BeforeCreate(_ *gorm.DB) error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	if batch.Status == "" {
+		batch.Status = BatchStatusValidating
+	}
+	return nil
+}
+
+func (result *BatchRequestResult) BeforeCreate(_ *gorm.DB) error {
+	if result.CreatedAt == 0 {
+		result.CreatedAt = common.GetTimestamp()
+	}
+	return nil
+}
+
+// IsTerminal reports whether the batch reached a final state.
+func (batch *Batch) IsTerminal() bool {
+	switch batch.Status {
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func GenerateBatchId() (string, error) {
+	key, err := common.GenerateRandomCharsKey(24)
+	if err != nil {
+		return "", err
+	}
+	return "batch_" + key, nil
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+// GetTokenBatch returns a batch owned by the given user and token.
+func GetTokenBatch(userId int, tokenId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch Batch
+	err := DB.Where("batch_id = ? AND user_id = ? AND token_id = ?", batchId, userId, tokenId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetBatchByBatchId(batchId string) (*Batch, error) {
+	var batch Batch
+	if err := DB.Where("batch_id = ?", batchId).First(&batch).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// ListTokenBatches lists batches owned by a token, newest first. after is an
+// optional batch id cursor.
+func ListTokenBatches(userId int, tokenId int, after string, limit int) ([]*Batch, error) {
+	query := DB.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if after != "" {
+		var cursor Batch
+		if err := DB.Select("id").Where("batch_id = ? AND user_id = ? AND token_id = ?", after, userId, tokenId).First(&cursor).Error; err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	var batches []*Batch
+	err := query.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// HasRunnableBatches reports whether any batch still needs the runner, so the
+// scheduler creates no task row while the system is idle.
+func HasRunnableBatches() bool {
+	var exists int
+	err := DB.Model(&Batch{}).Select("1").Where("status IN ?", runnableBatchStatuses).Limit(1).Scan(&exists).Error
+	return err == nil && exists == 1
+}
+
+// GetRunnableBatches returns the oldest batches that still need the runner.
+func GetRunnableBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", runnableBatchStatuses).Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// UpdateBatchStatus moves a batch from one status to another and applies the
+// extra column updates in the same statement. It returns false when the batch
+// was no longer in fromStatus (e.g. the user cancelled it concurrently).
+func UpdateBatchStatus(batchId string, fromStatus string, toStatus string, updates map[string]any) (bool, error) {
+	values := map[string]any{"status": toStatus}
+	for k, v := range updates {
+		values[k] = v
+	}
+	result := DB.Model(&Batch{}).Where("batch_id = ? AND status = ?", batchId, fromStatus).Updates(values)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetBatchStatus reads only the status column, used by the runner to notice
+// cancellation between lines.
+func GetBatchStatus(batchId string) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("batch_id = ?", batchId).Select("status").Scan(&status).Error
+	return status, err
+}
+
+// SaveBatchRequestResult stores the result of one line and bumps the batch
+// counters. A line that already has a result (a resumed run replaying it) is
+// ignored so counters are never incremented twice.
+func SaveBatchRequestResult(result *BatchRequestResult) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(result)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			return nil
+		}
+		column := "completed_count"
+		if !result.Success {
+			column = "failed_count"
+		}
+		return tx.Model(&Batch{}).Where("batch_id = ?", result.BatchId).
+			UpdateColumn(column, gorm.Expr(column+" + ?", 1)).Error
+	})
+}
+
+// GetBatchDoneLineIndexes returns the line indexes that already have a result.
+func GetBatchDoneLineIndexes(batchId string) (map[int]bool, error) {
+	var indexes []int
+	err := DB.Model(&BatchRequestResult{}).Where("batch_id = ?", batchId).Pluck("line_index", &indexes).Error
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool, len(indexes))
+	for _, index := range indexes {
+		done[index] = true
+	}
+	return done, nil
+}
+
+// GetBatchRequestResults returns a page of results in input line order.
+func GetBatchRequestResults(batchId string, afterLineIndex int, limit int) ([]*BatchRequestResult, error) {
+	var results []*BatchRequestResult
+	err := DB.Where("batch_id = ? AND line_index > ?", batchId, afterLineIndex).
+		Order("line_index asc").Limit(limit).Find(&results).Error
+	return results, err
+}
+
+func DeleteBatchRequestResults(batchId string) error {
+	return DB.Where("batch_id = ?", batchId).Delete(&BatchRequestResult{}).Error
+}
@@ -0,0 +1,629 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/go-redis/redis/v8"
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+// Budget periods. Windows follow the server time zone: a day starts at
+// 00:00, a week on Monday 00:00 and a month on its first day 00:00.
+const (
+	BudgetPeriodDay   = "day"
+	BudgetPeriodWeek  = "week"
+	BudgetPeriodMonth = "month"
+)
+
+var ErrBudgetNotFound = errors.New("budget not found")
+
+const (
+	budgetCacheNamespace   = "new-api:budget_rules:v1"
+	budgetCounterKeyPrefix = "new-api:budget_spend:v1"
+	// budgetCounterGrace keeps a counter a little past its window so nodes
+	// with a slightly late clock still find it.
+	budgetCounterGrace = time.Hour
+)
+
+// Budget caps the quota a user, or one of its tokens, may spend within each
+// window of Period. Relay requests reserve their pre-consumed quota in a
+// counter shared by every node through Redis and settle it to the actual
+// spend; other consumption is counted as its consume log is recorded.
+//
+// A counter missing from Redis, e.g. after a flush or for a budget created
+// mid-window, is seeded from the consume and refund logs of the window. With
+// consume logging disabled or the logs of the window cleaned up, a lost
+// counter restarts from the spend the remaining logs show.
+type Budget struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_budget_subject_period,priority:1"`
+	TokenId        int    `json:"token_id" gorm:"default:0;uniqueIndex:idx_budget_subject_period,priority:2"` // 0 表示用户级预算
+	Period         string `json:"period" gorm:"type:varchar(16);uniqueIndex:idx_budget_subject_period,priority:3"`
+	QuotaLimit     int64  `json:"quota_limit" gorm:"type:bigint;not null"`
+	WarningPercent int    `json:"warning_percent"` // 达到该百分比时发送预警，0 表示不预警
+	Enabled        bool   `json:"enabled"`
+	AdminManaged   bool   `json:"admin_managed"` // 管理员设置的预算，用户不可修改或删除
+	CreatedAt      int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// budgetRules is the cached list of a user's budgets, including the ones of
+// its tokens.
+type budgetRules struct {
+	Budgets []Budget `json:"budgets"`
+}
+
+// BudgetUsage is a budget with the spend of its current window.
+type BudgetUsage struct {
+	Budget
+	Spent       int64 `json:"spent"`
+	WindowStart int64 `json:"window_start"`
+	ResetAt     int64 `json:"reset_at"`
+}
+
+// BudgetCrossing reports a spend that crossed the warning threshold or the
+// limit of a budget.
+type BudgetCrossing struct {
+	Budget   Budget
+	Spent    int64
+	ResetAt  int64
+	Exceeded bool
+}
+
+func IsValidBudgetPeriod(period string) bool {
+	switch period {
+	case BudgetPeriodDay, BudgetPeriodWeek, BudgetPeriodMonth:
+		return true
+	}
+	return false
+}
+
+func (b *Budget) Validate() error {
+	if !IsValidBudgetPeriod(b.Period) {
+		return fmt.Errorf("invalid budget period: %s", b.Period)
+	}
+	if b.QuotaLimit <= 0 {
+		return errors.New("budget quota limit must be positive")
+	}
+	if b.WarningPercent < 0 || b.WarningPercent >= 100 {
+		return errors.New("budget warning percent must be between 0 and 99")
+	}
+	return nil
+}
+
+// AppliesTo reports whether spend of tokenId counts against the budget.
+func (b *Budget) AppliesTo(tokenId int) bool {
+	return b.TokenId == 0 || b.TokenId == tokenId
+}
+
+func (b *Budget) warningQuota() int64 {
+	if b.WarningPercent <= 0 {
+		return 0
+	}
+	return b.QuotaLimit * int64(b.WarningPercent) / 100
+}
+
+// BudgetWindow returns the window of period that contains now.
+func BudgetWindow(period string, now time.Time) (start time.Time, end time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case BudgetPeriodWeek:
+		weekday := int(day.Weekday()) // Sunday=0
+		if weekday == 0 {
+			weekday = 7
+		}
+		start = day.AddDate(0, 0, 1-weekday)
+		return start, start.AddDate(0, 0, 7)
+	case BudgetPeriodMonth:
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return day, day.AddDate(0, 0, 1)
+	}
+}
+
+var (
+	budgetCacheOnce sync.Once
+	budgetCache     *cachex.HybridCache[budgetRules]
+)
+
+func budgetCacheTTL() time.Duration {
+	ttlSeconds := common.GetEnvOrDefault("BUDGET_CACHE_TTL", 300)
+	if ttlSeconds <= 0 {
+		ttlSeconds = 300
+	}
+	return time.Duration(ttlSeconds) * time.Second
+}
+
+func getBudgetCache() *cachex.HybridCache[budgetRules] {
+	budgetCacheOnce.Do(func() {
+		ttl := budgetCacheTTL()
+		budgetCache = cachex.NewHybridCache[budgetRules](cachex.HybridCacheConfig[budgetRules]{
+			Namespace: cachex.Namespace(budgetCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[budgetRules]{},
+			Memory: func() *hot.HotCache[string, budgetRules] {
+				return hot.NewHotCache[string, budgetRules](hot.LRU, 10000).
+					WithTTL(ttl).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return budgetCache
+}
+
+func invalidateBudgetCache(userId int) {
+	_, _ = getBudgetCache().DeleteMany([]string{strconv.Itoa(userId)})
+}
+
+// getEnabledBudgets returns the enabled budgets of a user and its tokens.
+// Users without budgets are cached too, so the relay path costs a single
+// cache lookup for them.
+func getEnabledBudgets(userId int) ([]Budget, error) {
+	key := strconv.Itoa(userId)
+	cache := getBudgetCache()
+	if rules, found, err := cache.Get(key); err == nil && found {
+		return rules.Budgets, nil
+	}
+	var budgets []Budget
+	if err := DB.Where("user_id = ? AND enabled = ?", userId, true).Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	_ = cache.SetWithTTL(key, budgetRules{Budgets: budgets}, budgetCacheTTL())
+	return budgets, nil
+}
+
+func GetUserBudgets(userId int) ([]*Budget, error) {
+	var budgets []*Budget
+	err := DB.Where("user_id = ?", userId).Order("token_id asc, id asc").Find(&budgets).Error
+	return budgets, err
+}
+
+func GetBudgetById(id int) (*Budget, error) {
+	var budget Budget
+	err := DB.First(&budget, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func GetUserBudgetById(id int, userId int) (*Budget, error) {
+	budget, err := GetBudgetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if budget.UserId != userId {
+		return nil, ErrBudgetNotFound
+	}
+	return budget, nil
+}
+
+func (b *Budget) Insert() error {
+	now := common.GetTimestamp()
+	b.CreatedAt = now
+	b.UpdatedAt = now
+	if err := DB.Create(b).Error; err != nil {
+		return err
+	}
+	invalidateBudgetCache(b.UserId)
+	return nil
+}
+
+// Update saves the limit, warning and switch of the budget. The subject and
+// period are fixed once created.
+func (b *Budget) Update() error {
+	b.UpdatedAt = common.GetTimestamp()
+	err := DB.Model(b).Select("quota_limit", "warning_percent", "enabled", "updated_at").Updates(b).Error
+	if err != nil {
+		return err
+	}
+	invalidateBudgetCache(b.UserId)
+	return nil
+}
+
+func (b *Budget) Delete() error {
+	if err := DB.Delete(b).Error; err != nil {
+		return err
+	}
+	invalidateBudgetCache(b.UserId)
+	return nil
+}
+
+func budgetCounterKey(budget *Budget, windowStart time.Time) string {
+	return fmt.Sprintf("%s:%d:%d", budgetCounterKeyPrefix, budget.Id, windowStart.Unix())
+}
+
+// sumBudgetSpend adds up the consume logs of the budget since windowStart,
+// minus refunds. It fills counters that are missing, e.g. for a budget
+// created mid-window or after Redis lost its data.
+func sumBudgetSpend(budget *Budget, windowStart time.Time) (int64, error) {
+	if !common.LogConsumeEnabled {
+		common.SysLog(fmt.Sprintf("budget %d: consume logging is disabled, its counter restarts from the logs that remain", budget.Id))
+	}
+	var rows []struct {
+		Type  int
+		Total int64
+	}
+	query := LOG_DB.Model(&Log{}).
+		Select("type, COALESCE(SUM(quota), 0) AS total").
+		Where("user_id = ? AND created_at >= ? AND type IN ?", budget.UserId, windowStart.Unix(), []int{LogTypeConsume, LogTypeRefund})
+	if budget.TokenId != 0 {
+		query = query.Where("token_id = ?", budget.TokenId)
+	}
+	if err := query.Group("type").Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+	var spent int64
+	for _, row := range rows {
+		if row.Type == LogTypeRefund {
+			spent -= row.Total
+		} else {
+			spent += row.Total
+		}
+	}
+	return max(spent, 0), nil
+}
+
+// budgetIncrScript adds ARGV[1] to the counter. A missing counter is created
+// from ARGV[3] when given, otherwise nil is returned so the caller can load
+// the seed and retry.
+var budgetIncrScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	if ARGV[3] == '' then
+		return false
+	end
+	redis.call('SET', KEYS[1], ARGV[3])
+end
+local spent = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('EXPIREAT', KEYS[1], ARGV[2])
+return spent
+`)
+
+// budgetReserveScript adds ARGV[1] to the counter only while the total stays
+// within the limit ARGV[4], so concurrent reservations cannot overshoot it
+// together. A missing counter is seeded like in budgetIncrScript. It returns
+// {1, spent} when reserved, {0, spent} when the limit refused the amount and
+// nil when the counter is missing and no seed was given.
+var budgetReserveScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	if ARGV[3] == '' then
+		return false
+	end
+	redis.call('SET', KEYS[1], ARGV[3])
+	redis.call('EXPIREAT', KEYS[1], ARGV[2])
+end
+local spent = tonumber(redis.call('GET', KEYS[1]))
+local amount = tonumber(ARGV[1])
+local limit = tonumber(ARGV[4])
+if spent >= limit or spent + amount > limit then
+	return {0, spent}
+end
+spent = redis.call('INCRBY', KEYS[1], amount)
+redis.call('EXPIREAT', KEYS[1], ARGV[2])
+return {1, spent}
+`)
+
+type budgetMemoryCounter struct {
+	spent    int64
+	expireAt int64
+}
+
+var (
+	budgetMemoryMu       sync.Mutex
+	budgetMemoryCounters = make(map[string]*budgetMemoryCounter)
+)
+
+func addBudgetSpendMemory(key string, delta int64, expireAt int64, seed func() (int64, error)) (int64, error) {
+	budgetMemoryMu.Lock()
+	defer budgetMemoryMu.Unlock()
+	counter, err := getBudgetMemoryCounterLocked(key, expireAt, seed)
+	if err != nil {
+		return 0, err
+	}
+	counter.spent += delta
+	return counter.spent, nil
+}
+
+func reserveBudgetSpendMemory(key string, amount int64, limit int64, expireAt int64, seed func() (int64, error)) (bool, int64, error) {
+	budgetMemoryMu.Lock()
+	defer budgetMemoryMu.Unlock()
+	counter, err := getBudgetMemoryCounterLocked(key, expireAt, seed)
+	if err != nil {
+		return false, 0, err
+	}
+	if counter.spent >= limit || counter.spent+amount > limit {
+		return false, counter.spent, nil
+	}
+	counter.spent += amount
+	return true, counter.spent, nil
+}
+
+func getBudgetMemoryCounterLocked(key string, expireAt int64, seed func() (int64, error)) (*budgetMemoryCounter, error) {
+	now := time.Now().Unix()
+	counter, ok := budgetMemoryCounters[key]
+	if !ok || counter.expireAt <= now {
+		spent, err := seed()
+		if err != nil {
+			return nil, err
+		}
+		for k, c := range budgetMemoryCounters {
+			if c.expireAt <= now {
+				delete(budgetMemoryCounters, k)
+			}
+		}
+		counter = &budgetMemoryCounter{spent: spent, expireAt: expireAt}
+		budgetMemoryCounters[key] = counter
+	}
+	return counter, nil
+}
+
+func reserveBudgetSpendRedis(key string, amount int64, limit int64, expireAt int64, seed func() (int64, error)) (bool, int64, error) {
+	ctx := context.Background()
+	result, err := budgetReserveScript.Run(ctx, common.RDB, []string{key}, amount, expireAt, "", limit).Int64Slice()
+	if errors.Is(err, redis.Nil) {
+		var initial int64
+		initial, err = seed()
+		if err != nil {
+			return false, 0, err
+		}
+		result, err = budgetReserveScript.Run(ctx, common.RDB, []string{key}, amount, expireAt, strconv.FormatInt(initial, 10), limit).Int64Slice()
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected budget reserve result: %v", result)
+	}
+	return result[0] == 1, result[1], nil
+}
+
+func addBudgetSpendRedis(key string, delta int64, expireAt int64, seed func() (int64, error)) (int64, error) {
+	ctx := context.Background()
+	spent, err := budgetIncrScript.Run(ctx, common.RDB, []string{key}, delta, expireAt, "").Int64()
+	if err == nil {
+		return spent, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	initial, err := seed()
+	if err != nil {
+		return 0, err
+	}
+	return budgetIncrScript.Run(ctx, common.RDB, []string{key}, delta, expireAt, strconv.FormatInt(initial, 10)).Int64()
+}
+
+// AddBudgetSpend adds quota, negative for refunds, to the current window of
+// every enabled budget covering the user and token, and returns the budgets
+// whose warning threshold or limit the spend crossed.
+func AddBudgetSpend(userId int, tokenId int, quota int) ([]BudgetCrossing, error) {
+	return addBudgetSpend(userId, tokenId, quota, quota, 0, time.Now())
+}
+
+// addBudgetSpend adds delta to the counters and reports the thresholds that a
+// spend of counted crossed, which differ when delta settles a reservation.
+// A counter lost meanwhile is seeded with the reserved quota on top of the
+// logs, which do not show the request yet.
+func addBudgetSpend(userId int, tokenId int, delta int, counted int, reserved int, now time.Time) ([]BudgetCrossing, error) {
+	if (delta == 0 && counted <= 0) || userId <= 0 {
+		return nil, nil
+	}
+	budgets, err := getEnabledBudgets(userId)
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+	var crossings []BudgetCrossing
+	for i := range budgets {
+		budget := &budgets[i]
+		if !budget.AppliesTo(tokenId) {
+			continue
+		}
+		start, end := BudgetWindow(budget.Period, now)
+		key := budgetCounterKey(budget, start)
+		expireAt := end.Add(budgetCounterGrace).Unix()
+		seed := func() (int64, error) {
+			spent, err := sumBudgetSpend(budget, start)
+			return spent + int64(reserved), err
+		}
+		var spent int64
+		if common.RedisEnabled && common.RDB != nil {
+			spent, err = addBudgetSpendRedis(key, int64(delta), expireAt, seed)
+		} else {
+			spent, err = addBudgetSpendMemory(key, int64(delta), expireAt, seed)
+		}
+		if err != nil {
+			return crossings, fmt.Errorf("budget %d: %w", budget.Id, err)
+		}
+		if counted <= 0 {
+			continue
+		}
+		previous := spent - int64(counted)
+		if previous < budget.QuotaLimit && spent >= budget.QuotaLimit {
+			crossings = append(crossings, BudgetCrossing{Budget: *budget, Spent: spent, ResetAt: end.Unix(), Exceeded: true})
+		} else if warning := budget.warningQuota(); warning > 0 && previous < warning && spent >= warning {
+			crossings = append(crossings, BudgetCrossing{Budget: *budget, Spent: spent, ResetAt: end.Unix()})
+		}
+	}
+	return crossings, nil
+}
+
+func getBudgetSpent(budget *Budget, windowStart time.Time, windowEnd time.Time) (int64, error) {
+	// Adding zero reads the counter and creates it when missing, so the logs
+	// are summed at most once per window.
+	key := budgetCounterKey(budget, windowStart)
+	expireAt := windowEnd.Add(budgetCounterGrace).Unix()
+	seed := func() (int64, error) { return sumBudgetSpend(budget, windowStart) }
+	if common.RedisEnabled && common.RDB != nil {
+		return addBudgetSpendRedis(key, 0, expireAt, seed)
+	}
+	return addBudgetSpendMemory(key, 0, expireAt, seed)
+}
+
+// GetBudgetUsages returns the current window and spend of budgets.
+func GetBudgetUsages(budgets []*Budget) ([]BudgetUsage, error) {
+	now := time.Now()
+	usages := make([]BudgetUsage, 0, len(budgets))
+	for _, budget := range budgets {
+		start, end := BudgetWindow(budget.Period, now)
+		spent, err := getBudgetSpent(budget, start, end)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, BudgetUsage{
+			Budget:      *budget,
+			Spent:       spent,
+			WindowStart: start.Unix(),
+			ResetAt:     end.Unix(),
+		})
+	}
+	return usages, nil
+}
+
+// ReserveBudgets reserves quota in the current window of every enabled
+// budget of the user or token, each with one atomic check-and-add, so that
+// concurrent requests on any node cannot overshoot a limit together. When a
+// budget has no room left it returns the usage of that budget and keeps
+// nothing reserved. A reservation ends with SettleBudgetReservation or
+// ReleaseBudgetReservation.
+func ReserveBudgets(userId int, tokenId int, quota int) (*BudgetUsage, error) {
+	budgets, err := getEnabledBudgets(userId)
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+	amount := int64(max(quota, 0))
+	now := time.Now()
+	type reservation struct {
+		key      string
+		expireAt int64
+		seed     func() (int64, error)
+	}
+	var reserved []reservation
+	release := func() {
+		for _, r := range reserved {
+			var err error
+			if common.RedisEnabled && common.RDB != nil {
+				_, err = addBudgetSpendRedis(r.key, -amount, r.expireAt, r.seed)
+			} else {
+				_, err = addBudgetSpendMemory(r.key, -amount, r.expireAt, r.seed)
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to release budget reservation of user %d: %s", userId, err.Error()))
+			}
+		}
+	}
+	for i := range budgets {
+		budget := &budgets[i]
+		if !budget.AppliesTo(tokenId) {
+			continue
+		}
+		start, end := BudgetWindow(budget.Period, now)
+		key := budgetCounterKey(budget, start)
+		expireAt := end.Add(budgetCounterGrace).Unix()
+		seed := func() (int64, error) { return sumBudgetSpend(budget, start) }
+		var ok bool
+		var spent int64
+		if common.RedisEnabled && common.RDB != nil {
+			ok, spent, err = reserveBudgetSpendRedis(key, amount, budget.QuotaLimit, expireAt, seed)
+		} else {
+			ok, spent, err = reserveBudgetSpendMemory(key, amount, budget.QuotaLimit, expireAt, seed)
+		}
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("budget %d: %w", budget.Id, err)
+		}
+		if !ok {
+			release()
+			return &BudgetUsage{Budget: *budget, Spent: spent, WindowStart: start.Unix(), ResetAt: end.Unix()}, nil
+		}
+		reserved = append(reserved, reservation{key: key, expireAt: expireAt, seed: func() (int64, error) {
+			spent, err := seed()
+			return spent + amount, err
+		}})
+	}
+	return nil, nil
+}
+
+// SettleBudgetReservation replaces a reservation of reserved quota made at
+// reservedAt by the actual spend of the request and notifies the thresholds
+// it crossed. A reservation from an earlier day is returned to the windows it
+// was taken from and the spend counts in the current ones.
+func SettleBudgetReservation(userId int, tokenId int, reserved int, actual int, reservedAt time.Time) {
+	reserved = max(reserved, 0)
+	now := time.Now()
+	var crossings []BudgetCrossing
+	var err error
+	if dayStart, _ := BudgetWindow(BudgetPeriodDay, now); reservedAt.Before(dayStart) {
+		ReleaseBudgetReservation(userId, tokenId, reserved, reservedAt)
+		crossings, err = addBudgetSpend(userId, tokenId, actual, actual, 0, now)
+	} else {
+		crossings, err = addBudgetSpend(userId, tokenId, actual-reserved, actual, reserved, now)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to settle budget reservation of user %d: %s", userId, err.Error()))
+	}
+	notifyBudgetCrossings(userId, crossings)
+}
+
+// ReleaseBudgetReservation returns a reservation made at reservedAt by a
+// request that spent nothing.
+func ReleaseBudgetReservation(userId int, tokenId int, reserved int, reservedAt time.Time) {
+	if reserved <= 0 {
+		return
+	}
+	if _, err := addBudgetSpend(userId, tokenId, -reserved, 0, reserved, reservedAt); err != nil {
+		common.SysError(fmt.Sprintf("failed to release budget reservation of user %d: %s", userId, err.Error()))
+	}
+}
+
+var (
+	budgetNotifierMu sync.RWMutex
+	budgetNotifier   func(userId int, crossing BudgetCrossing)
+)
+
+// SetBudgetNotifier sets the function told about budget crossings.
+func SetBudgetNotifier(notifier func(userId int, crossing BudgetCrossing)) {
+	budgetNotifierMu.Lock()
+	budgetNotifier = notifier
+	budgetNotifierMu.Unlock()
+}
+
+// recordBudgetSpend counts a consume or refund against the budgets. Errors
+// only leave the counters behind, so they are logged and not returned.
+func recordBudgetSpend(userId int, tokenId int, quota int) {
+	crossings, err := AddBudgetSpend(userId, tokenId, quota)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to record budget spend of user %d: %s", userId, err.Error()))
+	}
+	notifyBudgetCrossings(userId, crossings)
+}
+
+func notifyBudgetCrossings(userId int, crossings []BudgetCrossing) {
+	if len(crossings) == 0 {
+		return
+	}
+	budgetNotifierMu.RLock()
+	notifier := budgetNotifier
+	budgetNotifierMu.RUnlock()
+	if notifier == nil {
+		return
+	}
+	for _, crossing := range crossings {
+		notifier(userId, crossing)
+	}
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resetBudgetMemoryCounters(t *testing.T) {
+	t.Helper()
+	budgetMemoryMu.Lock()
+	budgetMemoryCounters = make(map[string]*budgetMemoryCounter)
+	budgetMemoryMu.Unlock()
+}
+
+func insertBudget(t *testing.T, budget *Budget) *Budget {
+	t.Helper()
+	budget.Enabled = true
+	require.NoError(t, budget.Insert())
+	return budget
+}
+
+func TestBudgetWindow(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2026, 3, 1, 15, 30, 0, 0, loc) // Sunday
+
+	start, end := BudgetWindow(BudgetPeriodDay, now)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, loc), end)
+
+	start, end = BudgetWindow(BudgetPeriodWeek, now)
+	assert.Equal(t, time.Date(2026, 2, 23, 0, 0, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, loc), end)
+
+	start, end = BudgetWindow(BudgetPeriodMonth, now)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, loc), end)
+}
+
+func TestBudgetSpendIsSharedThroughRedis(t *testing.T) {
+	truncateTables(t)
+	useUserCacheMiniRedis(t)
+
+	userBudget := insertBudget(t, &Budget{UserId: 7, Period: BudgetPeriodDay, QuotaLimit: 1000, WarningPercent: 80})
+	tokenBudget := insertBudget(t, &Budget{UserId: 7, TokenId: 3, Period: BudgetPeriodMonth, QuotaLimit: 5000})
+
+	// Spend logged before the budget was first used counts toward the window.
+	require.NoError(t, LOG_DB.Create(&Log{UserId: 7, TokenId: 3, Type: LogTypeConsume, Quota: 500, CreatedAt: time.Now().Unix()}).Error)
+	require.NoError(t, LOG_DB.Create(&Log{UserId: 7, TokenId: 3, Type: LogTypeRefund, Quota: 100, CreatedAt: time.Now().Unix()}).Error)
+
+	crossings, err := AddBudgetSpend(7, 4, 400)
+	require.NoError(t, err)
+	require.Len(t, crossings, 1)
+	assert.Equal(t, userBudget.Id, crossings[0].Budget.Id)
+	assert.False(t, crossings[0].Exceeded)
+	assert.EqualValues(t, 800, crossings[0].Spent)
+
+	crossings, err = AddBudgetSpend(7, 3, 300)
+	require.NoError(t, err)
+	require.Len(t, crossings, 1)
+	assert.True(t, crossings[0].Exceeded)
+	assert.EqualValues(t, 1100, crossings[0].Spent)
+
+	blocked, err := ReserveBudgets(7, 3, 0)
+	require.NoError(t, err)
+	require.NotNil(t, blocked)
+	assert.Equal(t, userBudget.Id, blocked.Id)
+
+	// A refund reopens the window.
+	crossings, err = AddBudgetSpend(7, 3, -200)
+	require.NoError(t, err)
+	assert.Empty(t, crossings)
+	blocked, err = ReserveBudgets(7, 3, 100)
+	require.NoError(t, err)
+	assert.Nil(t, blocked)
+	blocked, err = ReserveBudgets(7, 3, 300)
+	require.NoError(t, err)
+	assert.NotNil(t, blocked, "the pre-consumed quota has to fit too")
+	ReleaseBudgetReservation(7, 3, 100, time.Now())
+
+	usages, err := GetBudgetUsages([]*Budget{userBudget, tokenBudget})
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+	assert.EqualValues(t, 900, usages[0].Spent)
+	assert.EqualValues(t, 500, usages[1].Spent, "the token budget only counts its own token")
+	_, end := BudgetWindow(BudgetPeriodMonth, time.Now())
+	assert.Equal(t, end.Unix(), usages[1].ResetAt)
+}
+
+func TestBudgetSpendWithoutRedis(t *testing.T) {
+	truncateTables(t)
+	resetBudgetMemoryCounters(t)
+
+	budget := insertBudget(t, &Budget{UserId: 8, Period: BudgetPeriodWeek, QuotaLimit: 100})
+	crossings, err := AddBudgetSpend(8, 1, 150)
+	require.NoError(t, err)
+	require.Len(t, crossings, 1)
+	assert.True(t, crossings[0].Exceeded)
+
+	budget.Enabled = false
+	require.NoError(t, budget.Update())
+	blocked, err := ReserveBudgets(8, 1, 0)
+	require.NoError(t, err)
+	assert.Nil(t, blocked, "disabled budgets do not block")
+}
+
+func TestBudgetReservationsDoNotOvershoot(t *testing.T) {
+	truncateTables(t)
+	useUserCacheMiniRedis(t)
+
+	budget := insertBudget(t, &Budget{UserId: 9, Period: BudgetPeriodDay, QuotaLimit: 1000})
+
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocked, err := ReserveBudgets(9, 1, 100)
+			assert.NoError(t, err)
+			if blocked == nil {
+				reserved.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 10, reserved.Load(), "concurrent requests share the limit")
+
+	usages, err := GetBudgetUsages([]*Budget{budget})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1000, usages[0].Spent)
+
+	// Settling replaces the reservation by the actual spend, a release drops it.
+	SettleBudgetReservation(9, 1, 100, 40, time.Now())
+	ReleaseBudgetReservation(9, 1, 100, time.Now())
+	usages, err = GetBudgetUsages([]*Budget{budget})
+	require.NoError(t, err)
+	assert.EqualValues(t, 840, usages[0].Spent)
+
+	blocked, err := ReserveBudgets(9, 1, 100)
+	require.NoError(t, err)
+	assert.Nil(t, blocked)
+}
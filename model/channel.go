@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/samber/lo"
@@ -239,8 +240,18 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// keys with an open circuit breaker are skipped while other keys remain
+	admittedIdx := filterKeysByCircuitBreaker(channel.Id, enabledIdx)
+
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
+		for len(admittedIdx) > 0 {
+			i := rand.Intn(len(admittedIdx))
+			if selectedIdx := admittedIdx[i]; circuitbreaker.Acquire(circuitbreaker.KeyTarget(channel.Id, selectedIdx)) {
+				return keys[selectedIdx], selectedIdx, nil
+			}
+			admittedIdx = append(admittedIdx[:i], admittedIdx[i+1:]...)
+		}
 		// Randomly pick one enabled key
 		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
 		return keys[selectedIdx], selectedIdx, nil
@@ -266,6 +277,17 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		if start < 0 || start >= len(keys) {
 			start = 0
 		}
+		admitted := make(map[int]bool, len(admittedIdx))
+		for _, idx := range admittedIdx {
+			admitted[idx] = true
+		}
+		for i := 0; i < len(keys); i++ {
+			idx := (start + i) % len(keys)
+			if admitted[idx] && circuitbreaker.Acquire(circuitbreaker.KeyTarget(channel.Id, idx)) {
+				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
+				return keys[idx], idx, nil
+			}
+		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
 			if getStatus(idx) == common.ChannelStatusEnabled {
@@ -278,6 +300,11 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return keys[enabledIdx[0]], enabledIdx[0], nil
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
+		for _, idx := range admittedIdx {
+			if circuitbreaker.Acquire(circuitbreaker.KeyTarget(channel.Id, idx)) {
+				return keys[idx], idx, nil
+			}
+		}
 		return keys[enabledIdx[0]], enabledIdx[0], nil
 	}
 }
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"math/rand"
+	"sort"
+
+	channelscore "github.com/QuantumNous/new-api/pkg/channel_score"
+)
+
+// pickWeightedChannelIndex draws a channel index by weight, scaling the
+// weights by live channel scores when adaptive routing is enabled.
+func pickWeightedChannelIndex(channelIds []int, weights []int) int {
+	if channelscore.Enabled() {
+		return adaptiveWeightedPick(channelIds, weights)
+	}
+	totalWeight := 0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if totalWeight <= 0 {
+		return rand.Intn(len(weights))
+	}
+	randomWeight := rand.Intn(totalWeight)
+	for i, weight := range weights {
+		randomWeight -= weight
+		if randomWeight < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// adaptiveWeightedPick returns the index chosen by a weighted random draw in
+// which each weight is scaled by the channel's adaptive routing factor.
+func adaptiveWeightedPick(channelIds []int, weights []int) int {
+	factors := channelscore.Factors(channelIds)
+	scaled := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		scaled[i] = float64(weight) * factors[i]
+		total += scaled[i]
+	}
+	if total <= 0 {
+		return rand.Intn(len(weights))
+	}
+	randomWeight := rand.Float64() * total
+	for i := range scaled {
+		randomWeight -= scaled[i]
+		if randomWeight < 0 {
+			return i
+		}
+	}
+	return len(scaled) - 1
+}
+
+// AdaptiveChannelScoreTier is the adaptive routing scores of the channels
+// sharing one priority for a group and model.
+type AdaptiveChannelScoreTier struct {
+	Priority int64                `json:"priority"`
+	Scores   []channelscore.Score `json:"scores"`
+}
+
+// GetAdaptiveChannelScores returns the scores of the enabled channels serving
+// group and model, tier by tier from the highest priority, with factors
+// computed the same way channel selection does.
+func GetAdaptiveChannelScores(group string, modelName string) ([]AdaptiveChannelScoreTier, error) {
+	var abilities []Ability
+	err := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, modelName, true).Find(&abilities).Error
+	if err != nil {
+		return nil, err
+	}
+	tierChannels := make(map[int64][]int)
+	for _, ability := range abilities {
+		priority := int64(0)
+		if ability.Priority != nil {
+			priority = *ability.Priority
+		}
+		tierChannels[priority] = append(tierChannels[priority], ability.ChannelId)
+	}
+	tiers := make([]AdaptiveChannelScoreTier, 0, len(tierChannels))
+	for priority, channelIds := range tierChannels {
+		sort.Ints(channelIds)
+		tiers = append(tiers, AdaptiveChannelScoreTier{
+			Priority: priority,
+			Scores:   channelscore.Scores(channelIds),
+		})
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Priority > tiers[j].Priority
+	})
+	return tiers, nil
+}
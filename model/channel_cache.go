@@ -3,7 +3,6 @@ package model
 import (
 	"errors"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strings"
 	"sync"
@@ -133,6 +132,8 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, requestPat
 		return nil, nil
 	}
 
+	channels = filterChannelsByCircuitBreaker(channels)
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
@@ -182,30 +183,21 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, requestPat
 	smoothingAdjustment := 0
 
 	if sumWeight == 0 {
-		// when all channels have weight 0, set sumWeight to the number of channels and set smoothing adjustment to 100
+		// when all channels have weight 0, set smoothing adjustment to 100
 		// each channel's effective weight = 100
-		sumWeight = len(targetChannels) * 100
 		smoothingAdjustment = 100
 	} else if sumWeight/len(targetChannels) < 10 {
 		// when the average weight is less than 10, set smoothing factor to 100
 		smoothingFactor = 100
 	}
 
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := sumWeight * smoothingFactor
-
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
-		if randomWeight < 0 {
-			return channel, nil
-		}
+	channelIds := make([]int, len(targetChannels))
+	weights := make([]int, len(targetChannels))
+	for i, channel := range targetChannels {
+		channelIds[i] = channel.Id
+		weights[i] = channel.GetWeight()*smoothingFactor + smoothingAdjustment
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return targetChannels[pickAvailableChannelIndex(channelIds, weights)], nil
 }
 
 // filterChannelsByRequestPathAndModel restricts candidates by request path and
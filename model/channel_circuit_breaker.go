@@ -0,0 +1,77 @@
+package model
+
+import (
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+)
+
+// filterChannelsByCircuitBreaker drops channels whose circuit breaker is
+// open. When every channel is open the list is returned unchanged, so an
+// outage of all channels degrades to the behavior without breakers.
+// The cached slice is never mutated.
+func filterChannelsByCircuitBreaker(channels []int) []int {
+	filtered := make([]int, 0, len(channels))
+	for _, channelId := range channels {
+		if circuitbreaker.Allow(circuitbreaker.ChannelTarget(channelId)) {
+			filtered = append(filtered, channelId)
+		}
+	}
+	if len(filtered) == 0 {
+		return channels
+	}
+	return filtered
+}
+
+func filterAbilitiesByCircuitBreaker(abilities []Ability) []Ability {
+	filtered := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if circuitbreaker.Allow(circuitbreaker.ChannelTarget(ability.ChannelId)) {
+			filtered = append(filtered, ability)
+		}
+	}
+	if len(filtered) == 0 {
+		return abilities
+	}
+	return filtered
+}
+
+// pickAvailableChannelIndex draws channels by weight until one is admitted by
+// its circuit breaker; a half-open breaker only admits a few probe requests.
+// If none is admitted the first drawn channel is used.
+func pickAvailableChannelIndex(channelIds []int, weights []int) int {
+	indexes := make([]int, len(channelIds))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	ids := append([]int(nil), channelIds...)
+	ws := append([]int(nil), weights...)
+	first := -1
+	for len(ids) > 0 {
+		picked := pickWeightedChannelIndex(ids, ws)
+		if first < 0 {
+			first = indexes[picked]
+		}
+		if circuitbreaker.Acquire(circuitbreaker.ChannelTarget(ids[picked])) {
+			return indexes[picked]
+		}
+		indexes = append(indexes[:picked], indexes[picked+1:]...)
+		ids = append(ids[:picked], ids[picked+1:]...)
+		ws = append(ws[:picked], ws[picked+1:]...)
+	}
+	return first
+}
+
+// filterKeysByCircuitBreaker returns the key indexes of a multi-key channel
+// whose circuit breaker is not open, or a copy of all of them when every key
+// is open.
+func filterKeysByCircuitBreaker(channelId int, keyIndexes []int) []int {
+	filtered := make([]int, 0, len(keyIndexes))
+	for _, idx := range keyIndexes {
+		if circuitbreaker.Allow(circuitbreaker.KeyTarget(channelId, idx)) {
+			filtered = append(filtered, idx)
+		}
+	}
+	if len(filtered) == 0 {
+		return append(filtered, keyIndexes...)
+	}
+	return filtered
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// File is a file uploaded through the OpenAI-compatible /v1/files API. The
+// file body lives in a FileStorage backend under StorageKey; when the upload
+// was forwarded to an upstream channel, ChannelId/UpstreamFileId map the
+// gateway file id back to the channel that owns the upstream copy.
+type File struct {
+	Id              int    `json:"id"`
+	FileId          string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	TokenId         int    `json:"token_id" gorm:"index"`
+	Filename        string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose         string `json:"purpose" gorm:"type:varchar(64);index"`
+	Bytes           int64  `json:"bytes" gorm:"bigint"`
+	Status          string `json:"status" gorm:"type:varchar(32)"`
+	StorageBackend  string `json:"storage_backend" gorm:"type:varchar(32)"`
+	StorageKey      string `json:"-" gorm:"type:varchar(255)"`
+	ChannelId       int    `json:"channel_id" gorm:"index"`
+	ChannelKeyIndex int    `json:"channel_key_index" gorm:"default:0"`
+	UpstreamFileId  string `json:"upstream_file_id" gorm:"type:varchar(128);index"`
+	CreatedAt       int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt       int64  `json:"expires_at" gorm:"bigint;default:0"`
+}
+
+func (file *File) BeforeCreate(_ *gorm.DB) error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	if file.Status == "" {
+		file.Status = FileStatusUploaded
+	}
+	return nil
+}
+
+// IsExpired reports whether the file has an expiry that already passed.
+func (file *File) IsExpired() bool {
+	return file.ExpiresAt > 0 && file.ExpiresAt < common.GetTimestamp()
+}
+
+func GenerateFileId() (string, error) {
+	key, err := common.GenerateRandomCharsKey(24)
+	if err != nil {
+		return "", err
+	}
+	return "file-" + key, nil
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+// UpdateUpstream records the upstream copy of a file after it was forwarded.
+func (file *File) UpdateUpstream(channelId int, keyIndex int, upstreamFileId string) error {
+	file.ChannelId = channelId
+	file.ChannelKeyIndex = keyIndex
+	file.UpstreamFileId = upstreamFileId
+	return DB.Model(file).Select("channel_id", "channel_key_index", "upstream_file_id").Updates(file).Error
+}
+
+// GetTokenFile returns a file owned by the given user and token. Files are
+// isolated per token so one key cannot read another key's uploads.
+func GetTokenFile(userId int, tokenId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file File
+	err := DB.Where("file_id = ? AND user_id = ? AND token_id = ?", fileId, userId, tokenId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetFileByFileId looks up a file regardless of owner; callers must enforce
+// ownership themselves (used by background jobs that already carry the owner).
+func GetFileByFileId(fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file File
+	if err := DB.Where("file_id = ?", fileId).First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ListTokenFiles lists files owned by a token, newest first. after is an
+// optional file id cursor; purpose filters when non-empty.
+func ListTokenFiles(userId int, tokenId int, purpose string, after string, limit int) ([]*File, error) {
+	query := DB.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var cursor File
+		if err := DB.Select("id").Where("file_id = ? AND user_id = ? AND token_id = ?", after, userId, tokenId).First(&cursor).Error; err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	var files []*File
+	err := query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// SumUserFileBytes returns the total stored bytes for a user, used to
+// enforce the per-user storage cap.
+func SumUserFileBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&File{}).Where("user_id = ?", userId).Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error
+	return total, err
+}
+
+func DeleteFile(file *File) error {
+	if file == nil || file.Id == 0 {
+		return errors.New("file is nil")
+	}
+	return DB.Delete(&File{}, file.Id).Error
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FineTunedModel pins a model produced by a fine-tuning job to the channel
+// (and multi-key slot) that trained it. Fine-tuned models only exist in the
+// upstream account that created them, so requests for them must be routed
+// back there instead of through the regular ability table.
+type FineTunedModel struct {
+	Id              int    `json:"id"`
+	ModelName       string `json:"model_name" gorm:"type:varchar(191);uniqueIndex"`
+	BaseModel       string `json:"base_model" gorm:"type:varchar(191)"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	ChannelId       int    `json:"channel_id" gorm:"index"`
+	ChannelKeyIndex int    `json:"channel_key_index" gorm:"default:0"`
+	TaskId          string `json:"task_id" gorm:"type:varchar(191)"`
+	CreatedAt       int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (m *FineTunedModel) BeforeCreate(_ *gorm.DB) error {
+	if m.CreatedAt == 0 {
+		m.CreatedAt = common.GetTimestamp()
+	}
+	return nil
+}
+
+// IsFineTunedModelName reports whether a model name looks like an OpenAI
+// ("ft:gpt-4o-mini:org::id") or Azure ("gpt-35-turbo.ft-xxx") fine-tuned model,
+// so only those names pay for the pin lookup.
+func IsFineTunedModelName(name string) bool {
+	return strings.HasPrefix(name, "ft:") || strings.Contains(name, ".ft-")
+}
+
+// PinFineTunedModel records (or moves) the channel of a fine-tuned model.
+func PinFineTunedModel(m *FineTunedModel) error {
+	if m == nil || m.ModelName == "" {
+		return errors.New("fine-tuned model name is empty")
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "model_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"base_model", "user_id", "channel_id", "channel_key_index", "task_id"}),
+	}).Create(m).Error
+}
+
+func GetFineTunedModel(modelName string) (*FineTunedModel, error) {
+	var m FineTunedModel
+	if err := DB.Where("model_name = ?", modelName).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -77,6 +79,7 @@ type Log struct {
 	Ip                string `json:"ip" gorm:"index;default:''"`
 	RequestId         string `json:"request_id,omitempty" gorm:"type:varchar(64);index:idx_logs_request_id;default:''"`
 	UpstreamRequestId string `json:"upstream_request_id,omitempty" gorm:"type:varchar(128);index:idx_logs_upstream_request_id;default:''"`
+	OrganizationId    int    `json:"organization_id,omitempty" gorm:"index;default:0"` // 支付请求的组织，个人支付时为 0
 	Other             string `json:"other"`
 }
 
@@ -285,7 +288,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	username := c.GetString("username")
 	requestId := c.GetString(common.RequestIdKey)
 	upstreamRequestId := c.GetString(common.UpstreamRequestIdKey)
-	otherStr := common.MapToJsonStr(other)
+	otherStr := common.MapToJsonStr(withTraceId(c, other))
 	// 判断是否需要记录 IP
 	needRecordIp := false
 	if settingMap, err := GetUserSetting(userId, false); err == nil {
@@ -325,6 +328,20 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	}
 }
 
+// withTraceId adds the trace ID of a traced relay request to the log's other
+// info, so a log row can be looked up in the tracing backend.
+func withTraceId(c *gin.Context, other map[string]interface{}) map[string]interface{} {
+	traceId := common.GetContextKeyString(c, constant.ContextKeyTraceId)
+	if traceId == "" {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	other["trace_id"] = traceId
+	return other
+}
+
 type RecordConsumeLogParams struct {
 	ChannelId        int                    `json:"channel_id"`
 	PromptTokens     int                    `json:"prompt_tokens"`
@@ -338,9 +355,17 @@ type RecordConsumeLogParams struct {
 	IsStream         bool                   `json:"is_stream"`
 	Group            string                 `json:"group"`
 	Other            map[string]interface{} `json:"other"`
+	OrganizationId   int                    `json:"organization_id,omitempty"`
+	// BudgetSettled marks spend the billing session already counted against
+	// the budgets when it settled the reservation of the request.
+	BudgetSettled bool `json:"-"`
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	prommetrics.RecordConsume(params.ModelName, params.Group, params.Quota, params.PromptTokens, params.CompletionTokens)
+	if !params.BudgetSettled {
+		recordBudgetSpend(userId, params.TokenId, params.Quota)
+	}
 	if !common.LogConsumeEnabled {
 		return
 	}
@@ -349,7 +374,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	requestId := c.GetString(common.RequestIdKey)
 	upstreamRequestId := c.GetString(common.UpstreamRequestIdKey)
 	createdAt := common.GetTimestamp()
-	otherStr := common.MapToJsonStr(params.Other)
+	otherStr := common.MapToJsonStr(withTraceId(c, params.Other))
 	// 判断是否需要记录 IP
 	needRecordIp := false
 	if settingMap, err := GetUserSetting(userId, false); err == nil {
@@ -381,6 +406,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		}(),
 		RequestId:         requestId,
 		UpstreamRequestId: upstreamRequestId,
+		OrganizationId:    params.OrganizationId,
 		Other:             otherStr,
 	}
 	err := createLog(log)
@@ -414,9 +440,17 @@ type RecordTaskBillingLogParams struct {
 	Group     string
 	Other     map[string]interface{}
 	NodeName  string // 任务发起节点；为空时回退当前节点
+	// OrganizationId 为支付该任务的组织，个人支付时为 0
+	OrganizationId int
 }
 
 func RecordTaskBillingLog(params RecordTaskBillingLogParams) {
+	switch params.LogType {
+	case LogTypeConsume:
+		recordBudgetSpend(params.UserId, params.TokenId, params.Quota)
+	case LogTypeRefund:
+		recordBudgetSpend(params.UserId, params.TokenId, -params.Quota)
+	}
 	if params.LogType == LogTypeConsume && !common.LogConsumeEnabled {
 		return
 	}
@@ -429,18 +463,19 @@ func RecordTaskBillingLog(params RecordTaskBillingLogParams) {
 	}
 	createdAt := common.GetTimestamp()
 	log := &Log{
-		UserId:    params.UserId,
-		Username:  username,
-		CreatedAt: createdAt,
-		Type:      params.LogType,
-		Content:   params.Content,
-		TokenName: tokenName,
-		ModelName: params.ModelName,
-		Quota:     params.Quota,
-		ChannelId: params.ChannelId,
-		TokenId:   params.TokenId,
-		Group:     params.Group,
-		Other:     common.MapToJsonStr(params.Other),
+		UserId:         params.UserId,
+		Username:       username,
+		CreatedAt:      createdAt,
+		Type:           params.LogType,
+		Content:        params.Content,
+		TokenName:      tokenName,
+		ModelName:      params.ModelName,
+		Quota:          params.Quota,
+		ChannelId:      params.ChannelId,
+		TokenId:        params.TokenId,
+		Group:          params.Group,
+		OrganizationId: params.OrganizationId,
+		Other:          common.MapToJsonStr(params.Other),
 	}
 	err := createLog(log)
 	if err != nil {
@@ -671,6 +706,68 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return stat, nil
 }
 
+// UserUsageStat is the consumption of one user within a time range.
+type UserUsageStat struct {
+	UserId    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Quota     int    `json:"quota"`
+	Count     int    `json:"count"`
+	TokenUsed int    `json:"token_used"`
+}
+
+// SumUsedQuotaByOrganization adds up the consume logs billed to an
+// organization per user, including users who have left it since.
+func SumUsedQuotaByOrganization(organizationId int, startTimestamp int64, endTimestamp int64) ([]UserUsageStat, error) {
+	var stats []UserUsageStat
+	tx := LOG_DB.Table("logs").
+		Select("user_id, max(username) username, COALESCE(sum(quota), 0) quota, count(*) count, COALESCE(sum(prompt_tokens), 0) + COALESCE(sum(completion_tokens), 0) token_used").
+		Where("type = ? AND organization_id = ?", LogTypeConsume, organizationId)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err := tx.Group("user_id").Order("user_id asc").Scan(&stats).Error; err != nil {
+		common.SysError("failed to query organization usage stat: " + err.Error())
+		return nil, errors.New("查询统计数据失败")
+	}
+	return stats, nil
+}
+
+// GetOrganizationQuotaData returns the hourly usage per model billed to an
+// organization, in the shape of the quota_data dashboard rows.
+func GetOrganizationQuotaData(organizationId int, startTimestamp int64, endTimestamp int64) ([]*QuotaData, error) {
+	// the hour is not aliased as created_at: ClickHouse would substitute the
+	// alias into the created_at conditions of the WHERE clause
+	var rows []struct {
+		ModelName string
+		Hour      int64
+		Count     int
+		Quota     int
+		TokenUsed int
+	}
+	err := LOG_DB.Table("logs").
+		Select("model_name, created_at - created_at % 3600 as hour, count(*) as count, COALESCE(sum(quota), 0) as quota, COALESCE(sum(prompt_tokens), 0) + COALESCE(sum(completion_tokens), 0) as token_used").
+		Where("type = ? AND organization_id = ? AND created_at >= ? AND created_at <= ?", LogTypeConsume, organizationId, startTimestamp, endTimestamp).
+		Group("model_name, created_at - created_at % 3600").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	quotaDatas := make([]*QuotaData, 0, len(rows))
+	for _, row := range rows {
+		quotaDatas = append(quotaDatas, &QuotaData{
+			ModelName: row.ModelName,
+			CreatedAt: row.Hour,
+			Count:     row.Count,
+			Quota:     row.Quota,
+			TokenUsed: row.TokenUsed,
+		})
+	}
+	return quotaDatas, nil
+}
+
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string) (token int) {
 	tx := LOG_DB.Table("logs").Select("COALESCE(sum(prompt_tokens), 0) + COALESCE(sum(completion_tokens), 0)")
 	if username != "" {
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+var ErrLogBodyNotFound = errors.New("log body not found")
+
+// LogBody holds the request and response bodies captured for one relay
+// request. It is stored in the log database and joined to the logs of the
+// request by RequestId.
+type LogBody struct {
+	Id             int    `json:"id"`
+	RequestId      string `json:"request_id" gorm:"type:varchar(64);index"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TokenId        int    `json:"token_id" gorm:"default:0"`
+	ChannelId      int    `json:"channel_id" gorm:"default:0"`
+	ModelName      string `json:"model_name" gorm:"default:''"`
+	Method         string `json:"method" gorm:"type:varchar(16);default:''"`
+	Path           string `json:"path" gorm:"default:''"`
+	StatusCode     int    `json:"status_code" gorm:"default:0"`
+	RequestHeaders string `json:"request_headers"`
+	RequestBody    string `json:"request_body"`
+	ResponseBody   string `json:"response_body"`
+	Truncated      bool   `json:"truncated"`
+}
+
+func clickHouseLogBodyCreateTableSQL() string {
+	return `
+CREATE TABLE IF NOT EXISTS log_bodies (
+	id Int64 DEFAULT 0,
+	request_id String DEFAULT '',
+	created_at Int64 DEFAULT 0,
+	user_id Int32 DEFAULT 0,
+	token_id Int32 DEFAULT 0,
+	channel_id Int32 DEFAULT 0,
+	model_name String DEFAULT '',
+	method String DEFAULT '',
+	path String DEFAULT '',
+	status_code Int32 DEFAULT 0,
+	request_headers String DEFAULT '',
+	request_body String DEFAULT '',
+	response_body String DEFAULT '',
+	truncated UInt8 DEFAULT 0
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(toDateTime(created_at))
+ORDER BY (created_at, request_id)`
+}
+
+func CreateLogBody(body *LogBody) error {
+	if body.CreatedAt == 0 {
+		body.CreatedAt = common.GetTimestamp()
+	}
+	return LOG_DB.Create(body).Error
+}
+
+func GetLogBodyByRequestId(requestId string) (*LogBody, error) {
+	var body LogBody
+	err := LOG_DB.Where("request_id = ?", requestId).Order("created_at desc").First(&body).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLogBodyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// DeleteOldLogBodies deletes the bodies captured before targetTimestamp and
+// returns how many were removed.
+func DeleteOldLogBodies(ctx context.Context, targetTimestamp int64) (int64, error) {
+	if common.UsingLogDatabase(common.DatabaseTypeClickHouse) {
+		var total int64
+		if err := LOG_DB.WithContext(ctx).Model(&LogBody{}).Where("created_at < ?", targetTimestamp).Count(&total).Error; err != nil {
+			return 0, err
+		}
+		if total == 0 {
+			return 0, nil
+		}
+		if err := LOG_DB.WithContext(ctx).Exec(
+			"ALTER TABLE log_bodies DELETE WHERE created_at < ? SETTINGS mutations_sync = 1",
+			targetTimestamp,
+		).Error; err != nil {
+			return 0, err
+		}
+		return total, nil
+	}
+
+	var deleted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		result := LOG_DB.WithContext(ctx).Where("created_at < ?", targetTimestamp).Limit(100).Delete(&LogBody{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if result.RowsAffected == 0 {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogBodyLookupAndRetention(t *testing.T) {
+	truncateTables(t)
+
+	require.NoError(t, CreateLogBody(&LogBody{RequestId: "req-old", CreatedAt: 100, ResponseBody: "old"}))
+	require.NoError(t, CreateLogBody(&LogBody{RequestId: "req-new", CreatedAt: 300, ResponseBody: "new"}))
+
+	body, err := GetLogBodyByRequestId("req-new")
+	require.NoError(t, err)
+	assert.Equal(t, "new", body.ResponseBody)
+
+	deleted, err := DeleteOldLogBodies(context.Background(), 200)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	_, err = GetLogBodyByRequestId("req-old")
+	assert.ErrorIs(t, err, ErrLogBodyNotFound)
+	_, err = GetLogBodyByRequestId("req-new")
+	assert.NoError(t, err)
+}
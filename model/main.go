@@ -282,6 +282,7 @@ func migrateDB() error {
 		&Log{},
 		&Midjourney{},
 		&TopUp{},
+		&PaymentRefund{},
 		&QuotaData{},
 		&Task{},
 		&Model{},
@@ -300,8 +301,18 @@ func migrateDB() error {
 		&SystemInstance{},
 		&SystemTask{},
 		&SystemTaskLock{},
+		&File{},
+		&Batch{},
+		&BatchRequestResult{},
+		&FineTunedModel{},
 		&CasbinRule{},
 		&AuthzRole{},
+		&Budget{},
+		&LogBody{},
+		&StoredResponse{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationInvitation{},
 	)
 	if err != nil {
 		return err
@@ -345,6 +356,7 @@ func migrateDBFast() error {
 		{&Log{}, "Log"},
 		{&Midjourney{}, "Midjourney"},
 		{&TopUp{}, "TopUp"},
+		{&PaymentRefund{}, "PaymentRefund"},
 		{&QuotaData{}, "QuotaData"},
 		{&Task{}, "Task"},
 		{&Model{}, "Model"},
@@ -363,6 +375,16 @@ func migrateDBFast() error {
 		{&SystemInstance{}, "SystemInstance"},
 		{&SystemTask{}, "SystemTask"},
 		{&SystemTaskLock{}, "SystemTaskLock"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&BatchRequestResult{}, "BatchRequestResult"},
+		{&FineTunedModel{}, "FineTunedModel"},
+		{&Budget{}, "Budget"},
+		{&LogBody{}, "LogBody"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&OrganizationInvitation{}, "OrganizationInvitation"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -410,7 +432,7 @@ func migrateLOGDB() error {
 	if common.UsingLogDatabase(common.DatabaseTypeClickHouse) {
 		return migrateClickHouseLogDB()
 	}
-	return LOG_DB.AutoMigrate(&Log{})
+	return LOG_DB.AutoMigrate(&Log{}, &LogBody{})
 }
 
 func migrateClickHouseLogDB() error {
@@ -418,6 +440,13 @@ func migrateClickHouseLogDB() error {
 	if err := LOG_DB.Exec(clickHouseLogCreateTableSQL(ttlDays)).Error; err != nil {
 		return err
 	}
+	// columns added after the table was first created
+	if err := LOG_DB.Exec("ALTER TABLE logs ADD COLUMN IF NOT EXISTS organization_id Int32 DEFAULT 0").Error; err != nil {
+		return err
+	}
+	if err := LOG_DB.Exec(clickHouseLogBodyCreateTableSQL()).Error; err != nil {
+		return err
+	}
 	return syncClickHouseLogTTL(ttlDays)
 }
 
@@ -466,6 +495,7 @@ CREATE TABLE IF NOT EXISTS logs (
 	ip String DEFAULT '',
 	request_id String DEFAULT '',
 	upstream_request_id String DEFAULT '',
+	organization_id Int32 DEFAULT 0,
 	other String DEFAULT ''
 )
 ENGINE = MergeTree()
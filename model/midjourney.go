@@ -23,6 +23,11 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	// BillingSource, SubscriptionId and OrganizationId record what paid for
+	// the task, so a failed task returns the quota to the same source.
+	BillingSource  string `json:"-" gorm:"type:varchar(16);default:''"`
+	SubscriptionId int    `json:"-" gorm:"default:0"`
+	OrganizationId int    `json:"-" gorm:"default:0"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -0,0 +1,722 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+// Organization member roles. An admin manages the members of its
+// organization and sees its usage; the quota pool, group and subscriptions
+// of an organization are managed by site admins.
+const (
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+var (
+	ErrOrganizationNotFound            = errors.New("organization not found")
+	ErrOrganizationMemberNotFound      = errors.New("organization member not found")
+	ErrOrganizationDisabled            = errors.New("organization is disabled")
+	ErrOrganizationQuotaInsufficient   = errors.New("organization quota insufficient")
+	ErrOrganizationMemberLimitExceeded = errors.New("organization member quota limit exceeded")
+	ErrUserAlreadyInOrganization       = errors.New("user already belongs to an organization")
+	ErrOrganizationInvitationNotFound  = errors.New("organization invitation not found")
+)
+
+const (
+	OrganizationInvitationStatusPending  = "pending"
+	OrganizationInvitationStatusAccepted = "accepted"
+	OrganizationInvitationStatusDeclined = "declined"
+)
+
+// Organization owns a quota pool and subscriptions shared by its members.
+// Requests of a member are billed to the organization instead of the wallet
+// of the member, whichever of the member's tokens they are made with.
+type Organization struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name" gorm:"type:varchar(128);uniqueIndex"`
+	Quota     int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota int    `json:"used_quota" gorm:"type:int;default:0"`
+	// Group, when set, is the group of every member while it belongs to the
+	// organization.
+	Group       string `json:"group" gorm:"type:varchar(64);default:''"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// OrganizationMember links a user to its organization. A user belongs to at
+// most one organization.
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"index"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	// QuotaLimit caps the total quota the member may spend from the
+	// organization, 0 means unlimited.
+	QuotaLimit int `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota  int `json:"used_quota" gorm:"type:int;default:0"`
+	// PrevGroup is the group of the user before the organization group was
+	// applied, restored when the user leaves.
+	PrevGroup   string `json:"-" gorm:"type:varchar(64);default:''"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"`
+}
+
+// OrganizationInvitation is an offer of an organization admin to a user to
+// join the organization. Joining changes the group and the billing of a
+// user, so the user has to accept it.
+type OrganizationInvitation struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"index"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"type:int;default:0"`
+	InviterId      int    `json:"inviter_id"`
+	Status         string `json:"status" gorm:"type:varchar(16);default:'pending';index"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime    int64  `json:"updated_time" gorm:"bigint"`
+	// OrganizationName is filled for the invited user.
+	OrganizationName string `json:"organization_name" gorm:"-:all"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	return role == OrganizationRoleAdmin || role == OrganizationRoleMember
+}
+
+func (o *Organization) Validate() error {
+	o.Name = strings.TrimSpace(o.Name)
+	o.Group = strings.TrimSpace(o.Group)
+	if o.Name == "" {
+		return errors.New("organization name is empty")
+	}
+	if o.Status != OrganizationStatusEnabled && o.Status != OrganizationStatusDisabled {
+		return fmt.Errorf("invalid organization status: %d", o.Status)
+	}
+	return nil
+}
+
+func (m *OrganizationMember) Validate() error {
+	if !IsValidOrganizationRole(m.Role) {
+		return fmt.Errorf("invalid organization role: %s", m.Role)
+	}
+	if m.QuotaLimit < 0 {
+		return errors.New("member quota limit must not be negative")
+	}
+	return nil
+}
+
+// LimitAllows reports whether the member may spend amount more. A member
+// that used up its limit is refused even a request that pre-consumes nothing.
+func (m *OrganizationMember) LimitAllows(amount int) bool {
+	return m.QuotaLimit <= 0 || (m.UsedQuota < m.QuotaLimit && m.UsedQuota+amount <= m.QuotaLimit)
+}
+
+func GetAllOrganizations(pageInfo *common.PageInfo, keyword string) (organizations []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&organizations).Error
+	return organizations, total, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	var organization Organization
+	result := DB.Where("id = ?", id).Limit(1).Find(&organization)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOrganizationNotFound
+	}
+	return &organization, nil
+}
+
+func (o *Organization) Insert() error {
+	now := common.GetTimestamp()
+	o.CreatedTime = now
+	o.UpdatedTime = now
+	return DB.Create(o).Error
+}
+
+// Update saves the name, status and group of the organization, moving its
+// members to the new group when it changed. The quota pool only changes
+// through AddOrganizationQuota and billing.
+func (o *Organization) Update() error {
+	var changedUsers []int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var current Organization
+		if err := lockForUpdate(tx).Where("id = ?", o.Id).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrganizationNotFound
+			}
+			return err
+		}
+		o.UpdatedTime = common.GetTimestamp()
+		if err := tx.Model(o).Select("name", "status", "group", "updated_time").Updates(o).Error; err != nil {
+			return err
+		}
+		if current.Group == o.Group {
+			return nil
+		}
+		var members []OrganizationMember
+		if err := tx.Where("organization_id = ?", o.Id).Find(&members).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			changed, err := applyOrganizationGroupTx(tx, &members[i], current.Group, o.Group)
+			if err != nil {
+				return err
+			}
+			if changed {
+				changedUsers = append(changedUsers, members[i].UserId)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	refreshOrganizationUserGroupCache(changedUsers, "organization group change")
+	return nil
+}
+
+// Delete removes the organization, releasing its members and cancelling its
+// subscriptions.
+func (o *Organization) Delete() error {
+	var changedUsers []int
+	var members []OrganizationMember
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", o.Id).Find(&members).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			if o.Group == "" {
+				break
+			}
+			changed, err := applyOrganizationGroupTx(tx, &members[i], o.Group, "")
+			if err != nil {
+				return err
+			}
+			if changed {
+				changedUsers = append(changedUsers, members[i].UserId)
+			}
+		}
+		if err := tx.Where("organization_id = ?", o.Id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&UserSubscription{}).
+			Where("organization_id = ? AND status = ?", o.Id, "active").
+			Updates(map[string]interface{}{
+				"status":     "cancelled",
+				"updated_at": common.GetTimestamp(),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(o).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		invalidateUserOrganizationCache(member.UserId)
+	}
+	refreshOrganizationUserGroupCache(changedUsers, "organization deletion")
+	return nil
+}
+
+// AddOrganizationQuota tops up (or, with a negative quota, takes from) the
+// quota pool of an organization.
+func AddOrganizationQuota(organizationId int, quota int) error {
+	result := DB.Model(&Organization{}).Where("id = ?", organizationId).
+		Update("quota", gorm.Expr("quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrganizationNotFound
+	}
+	return nil
+}
+
+// applyOrganizationGroupTx moves a member from the group oldGroup of its
+// organization to newGroup. An empty newGroup gives the user back the group
+// it had before joining; users whose group was changed by someone else in
+// the meantime keep it.
+func applyOrganizationGroupTx(tx *gorm.DB, member *OrganizationMember, oldGroup string, newGroup string) (bool, error) {
+	currentGroup, err := getUserGroupByIdTx(tx, member.UserId)
+	if err != nil {
+		return false, err
+	}
+	target := newGroup
+	prevGroup := member.PrevGroup
+	if oldGroup == "" {
+		prevGroup = currentGroup
+	} else if currentGroup != oldGroup {
+		// the group was changed after it was applied, leave it alone
+		return false, nil
+	}
+	if newGroup == "" {
+		target = prevGroup
+		prevGroup = ""
+	}
+	if prevGroup != member.PrevGroup {
+		member.PrevGroup = prevGroup
+		if err := tx.Model(member).Update("prev_group", prevGroup).Error; err != nil {
+			return false, err
+		}
+	}
+	if target == "" || target == currentGroup {
+		return false, nil
+	}
+	if err := tx.Model(&User{}).Where("id = ?", member.UserId).Update("group", target).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func refreshOrganizationUserGroupCache(userIds []int, operation string) {
+	for _, userId := range userIds {
+		if err := RefreshUserGroupCache(userId); err != nil {
+			common.SysError(fmt.Sprintf("failed to refresh user group cache after %s for user %d: %v", operation, userId, err))
+		}
+	}
+}
+
+// GetOrganizationMembers lists the members of an organization with their
+// usernames, admins first.
+func GetOrganizationMembers(organizationId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", organizationId).
+		Order("role asc, id asc").
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return members, nil
+	}
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []User
+	if err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	for _, member := range members {
+		member.Username = usernames[member.UserId]
+	}
+	return members, nil
+}
+
+// GetOrganizationMemberUserIds returns the ids of the current members of an
+// organization.
+func GetOrganizationMemberUserIds(organizationId int) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&OrganizationMember{}).Where("organization_id = ?", organizationId).
+		Order("user_id asc").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// GetOrganizationMemberByUserId returns the membership of a user, or
+// ErrOrganizationMemberNotFound when the user belongs to no organization.
+func GetOrganizationMemberByUserId(userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	result := DB.Where("user_id = ?", userId).Limit(1).Find(&member)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOrganizationMemberNotFound
+	}
+	return &member, nil
+}
+
+// GetUserOrganization returns the organization a user belongs to and its
+// membership, or ErrOrganizationMemberNotFound.
+func GetUserOrganization(userId int) (*Organization, *OrganizationMember, error) {
+	member, err := GetOrganizationMemberByUserId(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	organization, err := GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return organization, member, nil
+}
+
+// AddOrganizationMember adds a user to an organization, switching it to the
+// group of the organization.
+func AddOrganizationMember(member *OrganizationMember) error {
+	if err := member.Validate(); err != nil {
+		return err
+	}
+	changed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		changed, err = addOrganizationMemberTx(tx, member)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	onOrganizationMemberAdded(member, changed)
+	return nil
+}
+
+// addOrganizationMemberTx creates the membership and applies the group of
+// the organization to the user. It reports whether the group changed.
+func addOrganizationMemberTx(tx *gorm.DB, member *OrganizationMember) (bool, error) {
+	var organization Organization
+	if err := lockForUpdate(tx).Where("id = ?", member.OrganizationId).First(&organization).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrOrganizationNotFound
+		}
+		return false, err
+	}
+	var count int64
+	if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", member.UserId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, ErrUserAlreadyInOrganization
+	}
+	member.Id = 0
+	member.UsedQuota = 0
+	member.PrevGroup = ""
+	member.CreatedTime = common.GetTimestamp()
+	if err := tx.Create(member).Error; err != nil {
+		return false, err
+	}
+	if organization.Group == "" {
+		return false, nil
+	}
+	return applyOrganizationGroupTx(tx, member, "", organization.Group)
+}
+
+// onOrganizationMemberAdded refreshes the caches of a user who joined an
+// organization, once the membership is committed.
+func onOrganizationMemberAdded(member *OrganizationMember, groupChanged bool) {
+	invalidateUserOrganizationCache(member.UserId)
+	if groupChanged {
+		refreshOrganizationUserGroupCache([]int{member.UserId}, "joining organization")
+	}
+}
+
+// UpdateOrganizationMember saves the role and quota limit of a member.
+func UpdateOrganizationMember(member *OrganizationMember) error {
+	if err := member.Validate(); err != nil {
+		return err
+	}
+	return DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+}
+
+// RemoveOrganizationMember removes a user from its organization, giving it
+// back the group it had before joining.
+func RemoveOrganizationMember(member *OrganizationMember) error {
+	changed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var organization Organization
+		if err := tx.Where("id = ?", member.OrganizationId).First(&organization).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrganizationNotFound
+			}
+			return err
+		}
+		if organization.Group != "" {
+			var err error
+			if changed, err = applyOrganizationGroupTx(tx, member, organization.Group, ""); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(member).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateUserOrganizationCache(member.UserId)
+	if changed {
+		refreshOrganizationUserGroupCache([]int{member.UserId}, "leaving organization")
+	}
+	return nil
+}
+
+// ResetOrganizationMemberUsedQuota restarts the spend counted against the
+// quota limit of a member.
+func ResetOrganizationMemberUsedQuota(member *OrganizationMember) error {
+	member.UsedQuota = 0
+	return DB.Model(member).Update("used_quota", 0).Error
+}
+
+// InviteOrganizationMember offers a user to join an organization with the
+// given role and quota limit. A pending invitation of the same organization
+// is replaced, so inviting again only updates it.
+func InviteOrganizationMember(invitation *OrganizationInvitation) error {
+	member := OrganizationMember{Role: invitation.Role, QuotaLimit: invitation.QuotaLimit}
+	if err := member.Validate(); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing OrganizationInvitation
+		result := lockForUpdate(tx).Where("organization_id = ? AND user_id = ? AND status = ?",
+			invitation.OrganizationId, invitation.UserId, OrganizationInvitationStatusPending).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+		invitation.Status = OrganizationInvitationStatusPending
+		invitation.UpdatedTime = now
+		if result.RowsAffected > 0 {
+			invitation.Id = existing.Id
+			invitation.CreatedTime = existing.CreatedTime
+			return tx.Model(invitation).Select("role", "quota_limit", "inviter_id", "updated_time").Updates(invitation).Error
+		}
+		invitation.Id = 0
+		invitation.CreatedTime = now
+		return tx.Create(invitation).Error
+	})
+}
+
+// GetPendingOrganizationInvitations lists the invitations a user has not
+// answered yet, newest first.
+func GetPendingOrganizationInvitations(userId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	if err := DB.Where("user_id = ? AND status = ?", userId, OrganizationInvitationStatusPending).
+		Order("id desc").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		if organization, err := GetOrganizationById(invitation.OrganizationId); err == nil {
+			invitation.OrganizationName = organization.Name
+		}
+	}
+	return invitations, nil
+}
+
+func getPendingOrganizationInvitation(id int, userId int) (*OrganizationInvitation, error) {
+	var invitation OrganizationInvitation
+	result := DB.Where("id = ? AND user_id = ? AND status = ?", id, userId, OrganizationInvitationStatusPending).
+		Limit(1).Find(&invitation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOrganizationInvitationNotFound
+	}
+	return &invitation, nil
+}
+
+// AcceptOrganizationInvitation makes the invited user a member of the
+// organization and returns the membership.
+func AcceptOrganizationInvitation(id int, userId int) (*OrganizationMember, error) {
+	invitation, err := getPendingOrganizationInvitation(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	member := &OrganizationMember{
+		OrganizationId: invitation.OrganizationId,
+		UserId:         userId,
+		Role:           invitation.Role,
+		QuotaLimit:     invitation.QuotaLimit,
+	}
+	if err := member.Validate(); err != nil {
+		return nil, err
+	}
+	changed := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		// the status condition keeps a concurrent accept or decline from
+		// using the same invitation
+		result := tx.Model(&OrganizationInvitation{}).
+			Where("id = ? AND status = ?", invitation.Id, OrganizationInvitationStatusPending).
+			Updates(map[string]interface{}{
+				"status":       OrganizationInvitationStatusAccepted,
+				"updated_time": common.GetTimestamp(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationInvitationNotFound
+		}
+		var err error
+		changed, err = addOrganizationMemberTx(tx, member)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	onOrganizationMemberAdded(member, changed)
+	return member, nil
+}
+
+// DeclineOrganizationInvitation rejects a pending invitation of a user.
+func DeclineOrganizationInvitation(id int, userId int) error {
+	invitation, err := getPendingOrganizationInvitation(id, userId)
+	if err != nil {
+		return err
+	}
+	return DB.Model(invitation).Updates(map[string]interface{}{
+		"status":       OrganizationInvitationStatusDeclined,
+		"updated_time": common.GetTimestamp(),
+	}).Error
+}
+
+// PreConsumeOrganizationQuota charges amount spent by a member to its
+// organization after checking the quota limit of the member. With
+// fromBalance the amount is also taken from the quota pool, which has to
+// cover it; otherwise a subscription of the organization pays and only the
+// spend is counted.
+//
+// Every request of every member goes through here, so the checks are part
+// of conditional updates instead of a lock on the shared organization row.
+func PreConsumeOrganizationQuota(organizationId int, userId int, amount int, fromBalance bool) error {
+	if amount < 0 {
+		return errors.New("amount must not be negative")
+	}
+	if amount == 0 {
+		return CheckOrganizationQuota(organizationId, userId, amount, fromBalance)
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", organizationId, userId).
+			Where("(quota_limit <= 0 OR (used_quota < quota_limit AND used_quota + ? <= quota_limit))", amount).
+			Update("used_quota", gorm.Expr("used_quota + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrganizationQuotaRejected
+		}
+		updates := map[string]interface{}{
+			"used_quota": gorm.Expr("used_quota + ?", amount),
+		}
+		query := tx.Model(&Organization{}).Where("id = ? AND status = ?", organizationId, OrganizationStatusEnabled)
+		if fromBalance {
+			updates["quota"] = gorm.Expr("quota - ?", amount)
+			query = query.Where("quota > 0 AND quota >= ?", amount)
+		}
+		result = query.Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrganizationQuotaRejected
+		}
+		return nil
+	})
+	if !errors.Is(err, errOrganizationQuotaRejected) {
+		return err
+	}
+	// find out which check refused the amount
+	if err := CheckOrganizationQuota(organizationId, userId, amount, fromBalance); err != nil {
+		return err
+	}
+	return ErrOrganizationQuotaInsufficient
+}
+
+// errOrganizationQuotaRejected marks a conditional update that matched no
+// row; CheckOrganizationQuota tells the reason.
+var errOrganizationQuotaRejected = errors.New("organization quota rejected")
+
+// CheckOrganizationQuota reports whether the organization and the quota
+// limit of the member allow spending amount, without charging it.
+func CheckOrganizationQuota(organizationId int, userId int, amount int, fromBalance bool) error {
+	organization, err := GetOrganizationById(organizationId)
+	if err != nil {
+		return err
+	}
+	if organization.Status != OrganizationStatusEnabled {
+		return ErrOrganizationDisabled
+	}
+	var member OrganizationMember
+	result := DB.Where("organization_id = ? AND user_id = ?", organizationId, userId).Limit(1).Find(&member)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrganizationMemberNotFound
+	}
+	if !member.LimitAllows(amount) {
+		return ErrOrganizationMemberLimitExceeded
+	}
+	if fromBalance && (organization.Quota <= 0 || organization.Quota < amount) {
+		return ErrOrganizationQuotaInsufficient
+	}
+	return nil
+}
+
+// AdjustOrganizationQuota settles the spend of a member with delta (positive
+// charges more, negative returns quota) without checking any limit, the way
+// the usage of a request that already ran has to be billed.
+func AdjustOrganizationQuota(organizationId int, userId int, delta int, fromBalance bool) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return adjustOrganizationQuotaTx(tx, organizationId, userId, delta, fromBalance)
+	})
+}
+
+func adjustOrganizationQuotaTx(tx *gorm.DB, organizationId int, userId int, delta int, fromBalance bool) error {
+	updates := map[string]interface{}{
+		"used_quota": gorm.Expr("used_quota + ?", delta),
+	}
+	if fromBalance {
+		updates["quota"] = gorm.Expr("quota - ?", delta)
+	}
+	if err := tx.Model(&Organization{}).Where("id = ?", organizationId).Updates(updates).Error; err != nil {
+		return err
+	}
+	// the member may have left meanwhile, its spend still counts for the organization
+	return tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", organizationId, userId).
+		Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+}
+
+// OrganizationUsage is the usage billed to an organization within a time
+// range: the consume logs per user, former members included, and the hourly
+// usage per model.
+type OrganizationUsage struct {
+	Quota     int             `json:"quota"`
+	Count     int             `json:"count"`
+	TokenUsed int             `json:"token_used"`
+	Members   []UserUsageStat `json:"members"`
+	Data      []*QuotaData    `json:"data"`
+}
+
+func GetOrganizationUsage(organizationId int, startTimestamp int64, endTimestamp int64) (*OrganizationUsage, error) {
+	stats, err := SumUsedQuotaByOrganization(organizationId, startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	usage := &OrganizationUsage{Members: stats}
+	if usage.Members == nil {
+		usage.Members = []UserUsageStat{}
+	}
+	for _, stat := range stats {
+		usage.Quota += stat.Quota
+		usage.Count += stat.Count
+		usage.TokenUsed += stat.TokenUsed
+	}
+	if usage.Data, err = GetOrganizationQuotaData(organizationId, startTimestamp, endTimestamp); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// The organization a user belongs to is looked up by the billing of every
+// relay request, so it is cached like user and token data. Joining and
+// leaving an organization invalidate the cached value.
+
+func getUserOrganizationCacheKey(userId int) string {
+	return fmt.Sprintf("user_organization:%d", userId)
+}
+
+// GetUserOrganizationId returns the id of the organization a user belongs
+// to, 0 when the user belongs to none.
+func GetUserOrganizationId(userId int) (int, error) {
+	if common.RedisEnabled {
+		if value, err := common.RedisGet(getUserOrganizationCacheKey(userId)); err == nil {
+			if organizationId, err := strconv.Atoi(value); err == nil {
+				return organizationId, nil
+			}
+		}
+	}
+	var organizationIds []int
+	if err := DB.Model(&OrganizationMember{}).Where("user_id = ?", userId).
+		Limit(1).Pluck("organization_id", &organizationIds).Error; err != nil {
+		return 0, err
+	}
+	organizationId := 0
+	if len(organizationIds) > 0 {
+		organizationId = organizationIds[0]
+	}
+	if common.RedisEnabled {
+		err := common.RedisSet(getUserOrganizationCacheKey(userId), strconv.Itoa(organizationId),
+			time.Duration(userCacheTTLSeconds())*time.Second)
+		if err != nil {
+			common.SysLog("failed to cache user organization: " + err.Error())
+		}
+	}
+	return organizationId, nil
+}
+
+func invalidateUserOrganizationCache(userIds ...int) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, userId := range userIds {
+		if err := common.RedisDelKey(getUserOrganizationCacheKey(userId)); err != nil {
+			common.SysError(fmt.Sprintf("failed to invalidate organization cache of user %d: %v", userId, err))
+		}
+	}
+}
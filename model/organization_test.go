@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertOrganization(t *testing.T, name string, quota int, group string) *Organization {
+	t.Helper()
+	organization := &Organization{Name: name, Quota: quota, Group: group, Status: OrganizationStatusEnabled}
+	require.NoError(t, organization.Insert())
+	return organization
+}
+
+func insertOrganizationUser(t *testing.T, id int, group string) {
+	t.Helper()
+	require.NoError(t, DB.Create(&User{
+		Id:       id,
+		Username: fmt.Sprintf("org_user_%d", id),
+		AffCode:  fmt.Sprintf("org_aff_%d", id),
+		Group:    group,
+		Status:   common.UserStatusEnabled,
+	}).Error)
+}
+
+func userGroup(t *testing.T, userId int) string {
+	t.Helper()
+	var user User
+	require.NoError(t, DB.Select("id", commonGroupCol).Where("id = ?", userId).First(&user).Error)
+	return user.Group
+}
+
+func TestOrganizationMembersFollowOrganizationGroup(t *testing.T) {
+	truncateTables(t)
+	insertOrganizationUser(t, 1, "default")
+	insertOrganizationUser(t, 2, "vip")
+	organization := insertOrganization(t, "acme", 0, "")
+
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: organization.Id, UserId: 1, Role: OrganizationRoleAdmin}))
+	assert.Equal(t, "default", userGroup(t, 1), "an organization without group leaves the member group alone")
+
+	organization.Group = "team"
+	require.NoError(t, organization.Update())
+	assert.Equal(t, "team", userGroup(t, 1))
+
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: organization.Id, UserId: 2, Role: OrganizationRoleMember}))
+	assert.Equal(t, "team", userGroup(t, 2))
+	err := AddOrganizationMember(&OrganizationMember{OrganizationId: organization.Id, UserId: 2, Role: OrganizationRoleMember})
+	assert.ErrorIs(t, err, ErrUserAlreadyInOrganization)
+
+	member, err := GetOrganizationMemberByUserId(2)
+	require.NoError(t, err)
+	require.NoError(t, RemoveOrganizationMember(member))
+	assert.Equal(t, "vip", userGroup(t, 2))
+
+	require.NoError(t, organization.Delete())
+	assert.Equal(t, "default", userGroup(t, 1))
+	_, _, err = GetUserOrganization(1)
+	assert.ErrorIs(t, err, ErrOrganizationMemberNotFound)
+}
+
+func TestOrganizationInvitationNeedsAcceptance(t *testing.T) {
+	truncateTables(t)
+	insertOrganizationUser(t, 1, "default")
+	organization := insertOrganization(t, "acme", 0, "team")
+
+	invitation := &OrganizationInvitation{OrganizationId: organization.Id, UserId: 1, Role: OrganizationRoleMember, InviterId: 9}
+	require.NoError(t, InviteOrganizationMember(invitation))
+	require.NoError(t, InviteOrganizationMember(&OrganizationInvitation{OrganizationId: organization.Id, UserId: 1, Role: OrganizationRoleMember, QuotaLimit: 500, InviterId: 9}))
+	invitations, err := GetPendingOrganizationInvitations(1)
+	require.NoError(t, err)
+	require.Len(t, invitations, 1, "inviting again updates the pending invitation")
+	assert.Equal(t, 500, invitations[0].QuotaLimit)
+	assert.Equal(t, "acme", invitations[0].OrganizationName)
+	_, _, err = GetUserOrganization(1)
+	assert.ErrorIs(t, err, ErrOrganizationMemberNotFound, "an invitation alone changes nothing")
+	assert.Equal(t, "default", userGroup(t, 1))
+
+	_, err = AcceptOrganizationInvitation(invitation.Id, 2)
+	assert.ErrorIs(t, err, ErrOrganizationInvitationNotFound, "only the invited user may accept")
+	member, err := AcceptOrganizationInvitation(invitation.Id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 500, member.QuotaLimit)
+	assert.Equal(t, "team", userGroup(t, 1))
+	assert.ErrorIs(t, DeclineOrganizationInvitation(invitation.Id, 1), ErrOrganizationInvitationNotFound)
+}
+
+func TestAcceptOrganizationInvitationKeepsInvitationWhenJoinFails(t *testing.T) {
+	truncateTables(t)
+	insertOrganizationUser(t, 1, "default")
+	current := insertOrganization(t, "current", 0, "")
+	other := insertOrganization(t, "other", 0, "team")
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: current.Id, UserId: 1, Role: OrganizationRoleMember}))
+
+	invitation := &OrganizationInvitation{OrganizationId: other.Id, UserId: 1, Role: OrganizationRoleMember, InviterId: 9}
+	require.NoError(t, InviteOrganizationMember(invitation))
+	_, err := AcceptOrganizationInvitation(invitation.Id, 1)
+	assert.ErrorIs(t, err, ErrUserAlreadyInOrganization)
+
+	invitations, err := GetPendingOrganizationInvitations(1)
+	require.NoError(t, err)
+	require.Len(t, invitations, 1, "a failed accept leaves the invitation pending")
+	assert.Equal(t, "default", userGroup(t, 1))
+}
+
+func TestPreConsumeOrganizationQuotaChecksPoolAndMemberLimit(t *testing.T) {
+	truncateTables(t)
+	insertOrganizationUser(t, 1, "default")
+	organization := insertOrganization(t, "acme", 1000, "")
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: organization.Id, UserId: 1, Role: OrganizationRoleMember, QuotaLimit: 500}))
+
+	require.NoError(t, PreConsumeOrganizationQuota(organization.Id, 1, 400, true))
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(organization.Id, 1, 200, true), ErrOrganizationMemberLimitExceeded)
+
+	// Settling is never refused, even past the limit.
+	require.NoError(t, AdjustOrganizationQuota(organization.Id, 1, 100, true))
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(organization.Id, 1, 0, true), ErrOrganizationMemberLimitExceeded)
+
+	organization, err := GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 500, organization.Quota)
+	assert.Equal(t, 500, organization.UsedQuota)
+
+	member, err := GetOrganizationMemberByUserId(1)
+	require.NoError(t, err)
+	require.NoError(t, ResetOrganizationMemberUsedQuota(member))
+	member.QuotaLimit = 0
+	require.NoError(t, UpdateOrganizationMember(member))
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(organization.Id, 1, 501, true), ErrOrganizationQuotaInsufficient)
+
+	// Subscription spend counts toward the limit without touching the pool.
+	require.NoError(t, PreConsumeOrganizationQuota(organization.Id, 1, 300, false))
+	organization, err = GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 500, organization.Quota)
+	assert.Equal(t, 800, organization.UsedQuota)
+
+	organization.Status = OrganizationStatusDisabled
+	require.NoError(t, organization.Update())
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(organization.Id, 1, 1, true), ErrOrganizationDisabled)
+}
+
+func TestPreConsumeOrganizationSubscriptionUsesOrganizationSubscriptions(t *testing.T) {
+	truncateTables(t)
+	now := time.Now()
+	organization := insertOrganization(t, "acme", 0, "")
+	plan := &SubscriptionPlan{Title: "Team", DurationUnit: SubscriptionDurationMonth, DurationValue: 1, TotalAmount: 1000, UpgradeGroup: "vip"}
+	require.NoError(t, DB.Create(plan).Error)
+	require.NoError(t, DB.Create(&UserSubscription{Id: 1, UserId: 1, PlanId: plan.Id, AmountTotal: 1000, Status: "active", StartTime: now.Unix(), EndTime: now.Add(time.Hour).Unix()}).Error)
+	orgSub, err := AdminBindOrganizationSubscription(organization.Id, plan.Id)
+	require.NoError(t, err)
+	assert.Zero(t, orgSub.UserId)
+	assert.Empty(t, orgSub.UpgradeGroup, "organization subscriptions change no user group")
+
+	res, err := PreConsumeOrganizationSubscription("req-org-1", organization.Id, 1, 300)
+	require.NoError(t, err)
+	assert.Equal(t, orgSub.Id, res.UserSubscriptionId)
+
+	res, err = PreConsumeUserSubscription("req-user-1", 1, "gpt-4o", 0, 300)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.UserSubscriptionId)
+
+	hasSub, err := HasActiveOrganizationSubscription(organization.Id)
+	require.NoError(t, err)
+	assert.True(t, hasSub)
+
+	require.NoError(t, DB.Model(&UserSubscription{}).Where("id = ?", orgSub.Id).Update("end_time", now.Add(-time.Minute).Unix()).Error)
+	expired, err := ExpireDueSubscriptions(10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	hasSub, err = HasActiveOrganizationSubscription(organization.Id)
+	require.NoError(t, err)
+	assert.False(t, hasSub)
+}
+
+func TestGetOrganizationUsageCountsOnlyOrganizationBilledLogs(t *testing.T) {
+	truncateTables(t)
+	insertOrganizationUser(t, 1, "default")
+	insertOrganizationUser(t, 2, "default")
+	insertOrganizationUser(t, 3, "default")
+	organization := insertOrganization(t, "acme", 0, "")
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: organization.Id, UserId: 1, Role: OrganizationRoleAdmin}))
+
+	now := time.Now().Unix()
+	hour := now - now%3600
+	for _, log := range []*Log{
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, Quota: 100, PromptTokens: 10, CompletionTokens: 5, CreatedAt: now, OrganizationId: organization.Id, ModelName: "gpt-4o"},
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, Quota: 50, PromptTokens: 4, CreatedAt: now, OrganizationId: organization.Id, ModelName: "gpt-4o"},
+		// personal spend of a member, e.g. from before joining
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, Quota: 700, CreatedAt: now, ModelName: "gpt-4o"},
+		// spend of a member who has left since
+		{UserId: 2, Username: "bob", Type: LogTypeConsume, Quota: 30, CreatedAt: now, OrganizationId: organization.Id, ModelName: "gpt-4o"},
+		{UserId: 2, Type: LogTypeRefund, Quota: 1000, CreatedAt: now, OrganizationId: organization.Id},
+		{UserId: 3, Type: LogTypeConsume, Quota: 999, CreatedAt: now},
+	} {
+		require.NoError(t, LOG_DB.Create(log).Error)
+	}
+
+	usage, err := GetOrganizationUsage(organization.Id, hour, now+60)
+	require.NoError(t, err)
+	assert.Equal(t, 180, usage.Quota)
+	assert.Equal(t, 3, usage.Count)
+	assert.Equal(t, 19, usage.TokenUsed)
+	require.Len(t, usage.Members, 2)
+	assert.Equal(t, "alice", usage.Members[0].Username)
+	assert.Equal(t, 150, usage.Members[0].Quota)
+	assert.Equal(t, "bob", usage.Members[1].Username)
+	require.Len(t, usage.Data, 1)
+	assert.Equal(t, hour, usage.Data[0].CreatedAt)
+	assert.Equal(t, 180, usage.Data[0].Quota)
+	assert.Equal(t, 3, usage.Data[0].Count)
+}
@@ -0,0 +1,435 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// PaymentRefund is the ledger entry of a refund of a top-up or subscription
+// order. Refunds started by an admin stay pending until the provider confirms
+// them; refunds made in the provider dashboard arrive through its webhook and
+// are recorded as settled.
+type PaymentRefund struct {
+	Id                 int     `json:"id"`
+	UserId             int     `json:"user_id" gorm:"index"`
+	TradeNo            string  `json:"trade_no" gorm:"type:varchar(255);index"`
+	RefundNo           string  `json:"refund_no" gorm:"type:varchar(255);uniqueIndex"`
+	PaymentProvider    string  `json:"payment_provider" gorm:"type:varchar(50);default:''"`
+	ProviderRefundId   string  `json:"provider_refund_id" gorm:"type:varchar(255);index"`
+	Money              float64 `json:"money"`
+	Quota              int     `json:"quota"`
+	UserSubscriptionId int     `json:"user_subscription_id" gorm:"default:0"`
+	Reason             string  `json:"reason" gorm:"type:varchar(255)"`
+	OperatorId         int     `json:"operator_id" gorm:"default:0"`
+	Status             string  `json:"status" gorm:"type:varchar(32);index"`
+	Message            string  `json:"message" gorm:"type:text"`
+	CreateTime         int64   `json:"create_time"`
+	CompleteTime       int64   `json:"complete_time"`
+}
+
+var (
+	ErrPaymentRefundNotFound      = errors.New("payment refund not found")
+	ErrPaymentRefundUnsupported   = errors.New("该支付方式不支持原路退款")
+	ErrPaymentRefundAmountInvalid = errors.New("退款金额无效或超过可退金额")
+)
+
+// refundablePaymentProviders are the providers whose refund API is wired up.
+var refundablePaymentProviders = map[string]bool{
+	PaymentProviderStripe: true,
+	PaymentProviderCreem:  true,
+	PaymentProviderWaffo:  true,
+}
+
+func tradeNoCol() string {
+	if common.UsingMainDatabase(common.DatabaseTypePostgreSQL) {
+		return `"trade_no"`
+	}
+	return "`trade_no`"
+}
+
+func newRefundNo(tradeNo string) string {
+	reference := fmt.Sprintf("new-api-refund-%s-%d-%s", tradeNo, time.Now().UnixNano(), common.GetRandomString(4))
+	return "rfd_" + common.Sha1([]byte(reference))
+}
+
+func GetPaymentRefundsByTradeNo(tradeNo string) ([]*PaymentRefund, error) {
+	var refunds []*PaymentRefund
+	err := DB.Where("trade_no = ?", tradeNo).Order("id desc").Find(&refunds).Error
+	return refunds, err
+}
+
+// RefundableMoney returns how much of the order can still be refunded.
+// Pending refunds already count as refunded.
+func (topUp *TopUp) RefundableMoney() float64 {
+	remaining, _ := decimal.NewFromFloat(topUp.Money).Sub(decimal.NewFromFloat(topUp.RefundedMoney)).Float64()
+	return max(remaining, 0)
+}
+
+// topUpCreditedQuota mirrors the quota the recharge of each provider
+// credited for the order.
+func topUpCreditedQuota(topUp *TopUp) int {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentProvider {
+	case PaymentProviderStripe:
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case PaymentProviderCreem:
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+}
+
+// reserveRefundMoneyTx checks that money can be refunded from the locked
+// order and adds it to its refunded money. money <= 0 takes what is left.
+func reserveRefundMoneyTx(tx *gorm.DB, topUp *TopUp, money float64) (float64, error) {
+	remaining := decimal.NewFromFloat(topUp.RefundableMoney())
+	amount := decimal.NewFromFloat(money).Round(2)
+	if money <= 0 {
+		amount = remaining
+	}
+	if !amount.IsPositive() || amount.GreaterThan(remaining) {
+		return 0, ErrPaymentRefundAmountInvalid
+	}
+	refunded, _ := decimal.NewFromFloat(topUp.RefundedMoney).Add(amount).Float64()
+	if err := tx.Model(topUp).Update("refunded_money", refunded).Error; err != nil {
+		return 0, err
+	}
+	value, _ := amount.Float64()
+	return value, nil
+}
+
+// CreatePaymentRefund reserves money of the completed order tradeNo for a
+// refund started by an admin; money <= 0 refunds what is left. The refund is
+// returned pending: the caller asks the provider for it and then settles it
+// with CompletePaymentRefund or releases the money with FailPaymentRefund.
+func CreatePaymentRefund(tradeNo string, money float64, reason string, operatorId int) (*PaymentRefund, *TopUp, error) {
+	if tradeNo == "" {
+		return nil, nil, errors.New("未提供订单号")
+	}
+	topUp := &TopUp{}
+	refund := &PaymentRefund{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockForUpdate(tx).Where(tradeNoCol()+" = ?", tradeNo).First(topUp).Error; err != nil {
+			return ErrTopUpNotFound
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return ErrTopUpStatusInvalid
+		}
+		if !refundablePaymentProviders[topUp.PaymentProvider] {
+			return ErrPaymentRefundUnsupported
+		}
+		if topUp.ProviderOrderId == "" {
+			return errors.New("订单缺少支付平台交易号，请在支付平台后台退款")
+		}
+		amount, err := reserveRefundMoneyTx(tx, topUp, money)
+		if err != nil {
+			return err
+		}
+		*refund = PaymentRefund{
+			UserId:          topUp.UserId,
+			TradeNo:         topUp.TradeNo,
+			RefundNo:        newRefundNo(topUp.TradeNo),
+			PaymentProvider: topUp.PaymentProvider,
+			Money:           amount,
+			Reason:          reason,
+			OperatorId:      operatorId,
+			Status:          common.TopUpStatusPending,
+			CreateTime:      common.GetTimestamp(),
+		}
+		return tx.Create(refund).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return refund, topUp, nil
+}
+
+// paymentRefundResult carries what settling a refund changed outside the
+// database, to be applied after the transaction commits.
+type paymentRefundResult struct {
+	refund         PaymentRefund
+	downgradeGroup string
+}
+
+// settlePaymentRefundTx reverses what the locked order granted, in proportion
+// to the refunded money. A top-up gives back its credited quota, even when
+// the balance goes negative; a subscription order is cancelled once fully
+// refunded, which downgrades the user group like an expiry.
+func settlePaymentRefundTx(tx *gorm.DB, topUp *TopUp, refund *PaymentRefund) (*paymentRefundResult, error) {
+	var settled struct {
+		Money float64
+		Quota int64
+	}
+	if err := tx.Model(&PaymentRefund{}).
+		Select("COALESCE(SUM(money), 0) AS money, COALESCE(SUM(quota), 0) AS quota").
+		Where("trade_no = ? AND status = ? AND id <> ?", topUp.TradeNo, common.TopUpStatusSuccess, refund.Id).
+		Scan(&settled).Error; err != nil {
+		return nil, err
+	}
+	dMoney := decimal.NewFromFloat(topUp.Money)
+	fullyRefunded := decimal.NewFromFloat(settled.Money).Add(decimal.NewFromFloat(refund.Money)).GreaterThanOrEqual(dMoney)
+	now := common.GetTimestamp()
+	result := &paymentRefundResult{}
+
+	var order SubscriptionOrder
+	found := tx.Where(tradeNoCol()+" = ?", topUp.TradeNo).Limit(1).Find(&order)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	if found.RowsAffected > 0 {
+		if fullyRefunded {
+			if err := tx.Model(&order).Update("status", common.TopUpStatusRefunded).Error; err != nil {
+				return nil, err
+			}
+			if order.UserSubscriptionId > 0 {
+				var sub UserSubscription
+				if err := lockForUpdate(tx).Where("id = ?", order.UserSubscriptionId).First(&sub).Error; err == nil && sub.Status == "active" {
+					if err := tx.Model(&sub).Updates(map[string]interface{}{
+						"status":     "cancelled",
+						"end_time":   now,
+						"updated_at": now,
+					}).Error; err != nil {
+						return nil, err
+					}
+					target, err := downgradeUserGroupForSubscriptionTx(tx, &sub, now)
+					if err != nil {
+						return nil, err
+					}
+					result.downgradeGroup = target
+					refund.UserSubscriptionId = sub.Id
+				}
+			}
+		}
+	} else if dMoney.IsPositive() {
+		credited := topUpCreditedQuota(topUp)
+		quota := int(decimal.NewFromInt(int64(credited)).Mul(decimal.NewFromFloat(refund.Money)).Div(dMoney).IntPart())
+		if fullyRefunded {
+			quota = credited - int(settled.Quota)
+		}
+		if quota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", quota)).Error; err != nil {
+				return nil, err
+			}
+			refund.Quota = quota
+		}
+	}
+	if fullyRefunded {
+		if err := tx.Model(topUp).Update("status", common.TopUpStatusRefunded).Error; err != nil {
+			return nil, err
+		}
+	}
+	refund.Status = common.TopUpStatusSuccess
+	refund.CompleteTime = now
+	if err := tx.Save(refund).Error; err != nil {
+		return nil, err
+	}
+	result.refund = *refund
+	return result, nil
+}
+
+// afterPaymentRefund syncs the caches and writes the user log of a settled
+// refund.
+func afterPaymentRefund(result *paymentRefundResult) {
+	if result == nil {
+		return
+	}
+	refund := result.refund
+	if refund.Quota > 0 {
+		gopool.Go(func() {
+			if err := cacheDecrUserQuota(refund.UserId, int64(refund.Quota)); err != nil {
+				common.SysLog("failed to decrease user quota cache: " + err.Error())
+			}
+		})
+	}
+	if result.downgradeGroup != "" {
+		refreshSubscriptionUserGroupCache(refund.UserId, "payment refund")
+	}
+	content := fmt.Sprintf("订单 %s 退款成功，退款金额: %.2f，支付方式: %s", refund.TradeNo, refund.Money, refund.PaymentProvider)
+	if refund.Quota > 0 {
+		content += fmt.Sprintf("，扣回额度: %s", logger.FormatQuota(refund.Quota))
+	}
+	if refund.UserSubscriptionId > 0 {
+		content += "，对应订阅已取消"
+	}
+	if result.downgradeGroup != "" {
+		content += fmt.Sprintf("，用户分组回退到 %s", result.downgradeGroup)
+	}
+	RecordLog(refund.UserId, LogTypeRefund, content)
+}
+
+// CompletePaymentRefund settles a pending refund once the provider confirmed
+// it. It is idempotent, as the refund API response and the refund webhook
+// may both report the same refund. A refund marked failed is settled too:
+// the provider has the final word, so its money is reserved again.
+func CompletePaymentRefund(refundNo string, providerRefundId string) error {
+	var result *paymentRefundResult
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var refund PaymentRefund
+		if err := lockForUpdate(tx).Where("refund_no = ?", refundNo).First(&refund).Error; err != nil {
+			return ErrPaymentRefundNotFound
+		}
+		if refund.Status == common.TopUpStatusSuccess {
+			return nil
+		}
+		if refund.Status != common.TopUpStatusPending && refund.Status != common.TopUpStatusFailed {
+			return ErrTopUpStatusInvalid
+		}
+		topUp := &TopUp{}
+		if err := lockForUpdate(tx).Where(tradeNoCol()+" = ?", refund.TradeNo).First(topUp).Error; err != nil {
+			return ErrTopUpNotFound
+		}
+		if refund.Status == common.TopUpStatusFailed {
+			refunded, _ := decimal.NewFromFloat(topUp.RefundedMoney).Add(decimal.NewFromFloat(refund.Money)).Float64()
+			if err := tx.Model(topUp).Update("refunded_money", refunded).Error; err != nil {
+				return err
+			}
+			refund.Message = ""
+		}
+		if providerRefundId != "" {
+			refund.ProviderRefundId = providerRefundId
+		}
+		var err error
+		result, err = settlePaymentRefundTx(tx, topUp, &refund)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	afterPaymentRefund(result)
+	return nil
+}
+
+// FailPaymentRefund marks a pending refund failed and releases its money, so
+// it can be refunded again.
+func FailPaymentRefund(refundNo string, message string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var refund PaymentRefund
+		if err := lockForUpdate(tx).Where("refund_no = ?", refundNo).First(&refund).Error; err != nil {
+			return ErrPaymentRefundNotFound
+		}
+		if refund.Status != common.TopUpStatusPending {
+			return nil
+		}
+		topUp := &TopUp{}
+		if err := lockForUpdate(tx).Where(tradeNoCol()+" = ?", refund.TradeNo).First(topUp).Error; err != nil {
+			return ErrTopUpNotFound
+		}
+		refunded, _ := decimal.NewFromFloat(topUp.RefundedMoney).Sub(decimal.NewFromFloat(refund.Money)).Float64()
+		if err := tx.Model(topUp).Update("refunded_money", max(refunded, 0)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&refund).Updates(map[string]interface{}{
+			"status":        common.TopUpStatusFailed,
+			"message":       message,
+			"complete_time": common.GetTimestamp(),
+		}).Error
+	})
+}
+
+// ProviderRefund is a refund reported by the webhook of a provider.
+type ProviderRefund struct {
+	PaymentProvider  string
+	ProviderRefundId string
+	// RefundNo is set when the refund was started by CreatePaymentRefund.
+	RefundNo string
+	// TradeNo or ProviderOrderId locate the order of a refund made in the
+	// provider dashboard; Money is its amount in the currency of the order.
+	TradeNo         string
+	ProviderOrderId string
+	Money           float64
+}
+
+// RecordProviderRefund settles a refund reported by a provider webhook. A
+// refund of ours settles the pending ledger entry; a refund made in the
+// provider dashboard is added to the ledger and reversed the same way.
+// Webhook retries are harmless: refunds are deduplicated by provider refund id.
+func RecordProviderRefund(notice *ProviderRefund) error {
+	if notice.RefundNo != "" {
+		err := CompletePaymentRefund(notice.RefundNo, notice.ProviderRefundId)
+		if !errors.Is(err, ErrPaymentRefundNotFound) {
+			return err
+		}
+	}
+	if notice.ProviderRefundId == "" {
+		return errors.New("未提供支付平台退款单号")
+	}
+	var result *paymentRefundResult
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&PaymentRefund{}).
+			Where("payment_provider = ? AND provider_refund_id = ?", notice.PaymentProvider, notice.ProviderRefundId).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return nil
+		}
+		topUp := &TopUp{}
+		query := lockForUpdate(tx)
+		if notice.TradeNo != "" {
+			query = query.Where(tradeNoCol()+" = ?", notice.TradeNo)
+		} else {
+			query = query.Where("payment_provider = ? AND provider_order_id = ?", notice.PaymentProvider, notice.ProviderOrderId)
+		}
+		if err := query.First(topUp).Error; err != nil {
+			return ErrTopUpNotFound
+		}
+		if topUp.PaymentProvider != notice.PaymentProvider {
+			return ErrPaymentMethodMismatch
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return nil
+		}
+		// 退款接口返回前 webhook 先到时，按同金额匹配我方尚未结算的退款
+		var pendings []PaymentRefund
+		if err := lockForUpdate(tx).Where("trade_no = ? AND status = ? AND provider_refund_id = ''", topUp.TradeNo, common.TopUpStatusPending).
+			Order("id").Find(&pendings).Error; err != nil {
+			return err
+		}
+		for _, pending := range pendings {
+			if decimal.NewFromFloat(pending.Money).Equal(decimal.NewFromFloat(notice.Money).Round(2)) {
+				pending.ProviderRefundId = notice.ProviderRefundId
+				var err error
+				result, err = settlePaymentRefundTx(tx, topUp, &pending)
+				return err
+			}
+		}
+		money := min(decimal.NewFromFloat(notice.Money).Round(2).InexactFloat64(), topUp.RefundableMoney())
+		if money <= 0 {
+			return nil
+		}
+		amount, err := reserveRefundMoneyTx(tx, topUp, money)
+		if err != nil {
+			return err
+		}
+		refund := &PaymentRefund{
+			UserId:           topUp.UserId,
+			TradeNo:          topUp.TradeNo,
+			RefundNo:         newRefundNo(topUp.TradeNo),
+			PaymentProvider:  topUp.PaymentProvider,
+			ProviderRefundId: notice.ProviderRefundId,
+			Money:            amount,
+			Reason:           "支付平台退款",
+			Status:           common.TopUpStatusPending,
+			CreateTime:       common.GetTimestamp(),
+		}
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+		result, err = settlePaymentRefundTx(tx, topUp, refund)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	afterPaymentRefund(result)
+	return nil
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertPaidTopUpForRefundTest(t *testing.T, tradeNo string, userId int, provider string, amount int64, money float64) *TopUp {
+	t.Helper()
+	topUp := &TopUp{
+		UserId:          userId,
+		Amount:          amount,
+		Money:           money,
+		TradeNo:         tradeNo,
+		PaymentMethod:   provider,
+		PaymentProvider: provider,
+		CreateTime:      time.Now().Unix(),
+		CompleteTime:    time.Now().Unix(),
+		Status:          common.TopUpStatusSuccess,
+		ProviderOrderId: "provider-" + tradeNo,
+	}
+	require.NoError(t, topUp.Insert())
+	return topUp
+}
+
+func getUserQuotaForRefundTest(t *testing.T, userId int) int {
+	t.Helper()
+	quota, err := GetUserQuota(userId, true)
+	require.NoError(t, err)
+	return quota
+}
+
+func TestPaymentRefundClawsBackQuotaAllowingNegativeBalance(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 1, 100)
+	insertPaidTopUpForRefundTest(t, "refund-topup", 1, PaymentProviderWaffo, 2, 10)
+	credited := int(2 * common.QuotaPerUnit)
+
+	refund, topUp, err := CreatePaymentRefund("refund-topup", 4, "duplicate order", 99)
+	require.NoError(t, err)
+	assert.Equal(t, common.TopUpStatusPending, refund.Status)
+	assert.InDelta(t, 6, topUp.RefundableMoney(), 0.001)
+	_, _, err = CreatePaymentRefund("refund-topup", 7, "", 99)
+	assert.ErrorIs(t, err, ErrPaymentRefundAmountInvalid, "pending refunds count against the refundable money")
+
+	require.NoError(t, CompletePaymentRefund(refund.RefundNo, "re_1"))
+	require.NoError(t, CompletePaymentRefund(refund.RefundNo, "re_1"), "settling twice is a no-op")
+	assert.Equal(t, 100-credited*4/10, getUserQuotaForRefundTest(t, 1))
+
+	failed, _, err := CreatePaymentRefund("refund-topup", 1, "", 99)
+	require.NoError(t, err)
+	require.NoError(t, FailPaymentRefund(failed.RefundNo, "card expired"))
+	assert.InDelta(t, 6, GetTopUpByTradeNo("refund-topup").RefundableMoney(), 0.001, "a failed refund releases its money")
+
+	rest, _, err := CreatePaymentRefund("refund-topup", 0, "", 99)
+	require.NoError(t, err)
+	assert.InDelta(t, 6, rest.Money, 0.001)
+	require.NoError(t, CompletePaymentRefund(rest.RefundNo, "re_2"))
+
+	assert.Equal(t, 100-credited, getUserQuotaForRefundTest(t, 1), "the balance may go negative")
+	assert.Equal(t, common.TopUpStatusRefunded, GetTopUpByTradeNo("refund-topup").Status)
+	refunds, err := GetPaymentRefundsByTradeNo("refund-topup")
+	require.NoError(t, err)
+	require.Len(t, refunds, 3)
+	_, _, err = CreatePaymentRefund("refund-topup", 0, "", 99)
+	assert.ErrorIs(t, err, ErrTopUpStatusInvalid)
+}
+
+func TestCompletePaymentRefundSettlesRefundMarkedFailed(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 1, 0)
+	insertPaidTopUpForRefundTest(t, "failed-refund", 1, PaymentProviderWaffo, 2, 10)
+
+	refund, _, err := CreatePaymentRefund("failed-refund", 5, "", 99)
+	require.NoError(t, err)
+	require.NoError(t, FailPaymentRefund(refund.RefundNo, "timeout"))
+	assert.InDelta(t, 10, GetTopUpByTradeNo("failed-refund").RefundableMoney(), 0.001)
+
+	// the provider reports the refund succeeded after all
+	require.NoError(t, CompletePaymentRefund(refund.RefundNo, "wr_1"))
+	assert.InDelta(t, 5, GetTopUpByTradeNo("failed-refund").RefundableMoney(), 0.001)
+	assert.Equal(t, -int(common.QuotaPerUnit), getUserQuotaForRefundTest(t, 1))
+	refunds, err := GetPaymentRefundsByTradeNo("failed-refund")
+	require.NoError(t, err)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, common.TopUpStatusSuccess, refunds[0].Status)
+}
+
+func TestPaymentRefundRejectsOrdersWithoutRefundAPI(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 1, 100)
+	insertPaidTopUpForRefundTest(t, "epay-topup", 1, PaymentProviderEpay, 2, 10)
+	_, _, err := CreatePaymentRefund("epay-topup", 0, "", 99)
+	assert.ErrorIs(t, err, ErrPaymentRefundUnsupported)
+
+	insertTopUpForPaymentGuardTest(t, "pending-topup", 1, PaymentProviderStripe)
+	_, _, err = CreatePaymentRefund("pending-topup", 0, "", 99)
+	assert.ErrorIs(t, err, ErrTopUpStatusInvalid)
+}
+
+func TestPaymentRefundOfSubscriptionOrderCancelsSubscription(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "refund_sub_user", Status: common.UserStatusEnabled, Group: "default", Quota: 100}).Error)
+	plan := &SubscriptionPlan{Title: "Refund Plan", PriceAmount: 9.99, DurationUnit: SubscriptionDurationMonth, DurationValue: 1, Enabled: true, TotalAmount: 1000, UpgradeGroup: "vip"}
+	require.NoError(t, DB.Create(plan).Error)
+	// CompleteSubscriptionOrder reads outside its transaction, which the single
+	// connection of the test database can not serve, so build its result here
+	sub, err := CreateUserSubscriptionFromPlanTx(DB, 1, plan, "order")
+	require.NoError(t, err)
+	order := &SubscriptionOrder{
+		UserId:             1,
+		PlanId:             plan.Id,
+		Money:              9.99,
+		TradeNo:            "refund-sub",
+		PaymentMethod:      PaymentMethodCreem,
+		PaymentProvider:    PaymentProviderCreem,
+		Status:             common.TopUpStatusSuccess,
+		UserSubscriptionId: sub.Id,
+	}
+	require.NoError(t, order.Insert())
+	insertPaidTopUpForRefundTest(t, "refund-sub", 1, PaymentProviderCreem, 0, 9.99)
+	group, err := GetUserGroup(1, true)
+	require.NoError(t, err)
+	require.Equal(t, "vip", group)
+
+	partial, _, err := CreatePaymentRefund("refund-sub", 2, "", 99)
+	require.NoError(t, err)
+	require.NoError(t, CompletePaymentRefund(partial.RefundNo, "ref_1"))
+	require.NoError(t, DB.First(sub, sub.Id).Error)
+	assert.Equal(t, "active", sub.Status, "a partial refund keeps the subscription")
+
+	rest, _, err := CreatePaymentRefund("refund-sub", 0, "", 99)
+	require.NoError(t, err)
+	require.NoError(t, CompletePaymentRefund(rest.RefundNo, "ref_2"))
+	require.NoError(t, DB.First(sub, sub.Id).Error)
+	assert.Equal(t, "cancelled", sub.Status)
+	group, err = GetUserGroup(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, "default", group)
+	assert.Equal(t, common.TopUpStatusRefunded, GetSubscriptionOrderByTradeNo("refund-sub").Status)
+	assert.Equal(t, 100, getUserQuotaForRefundTest(t, 1), "subscription refunds claw back no wallet quota")
+}
+
+func TestRecordProviderRefundDeduplicatesWebhooks(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 1, 0)
+	topUp := insertPaidTopUpForRefundTest(t, "webhook-topup", 1, PaymentProviderCreem, 1000, 10)
+
+	dashboardRefund := &ProviderRefund{
+		PaymentProvider:  PaymentProviderCreem,
+		ProviderRefundId: "ref_dashboard",
+		ProviderOrderId:  topUp.ProviderOrderId,
+		Money:            2.5,
+	}
+	require.NoError(t, RecordProviderRefund(dashboardRefund))
+	require.NoError(t, RecordProviderRefund(dashboardRefund))
+	assert.Equal(t, -250, getUserQuotaForRefundTest(t, 1))
+
+	// the webhook of a refund of ours may arrive before the refund API answered
+	ours, _, err := CreatePaymentRefund("webhook-topup", 5, "", 99)
+	require.NoError(t, err)
+	require.NoError(t, RecordProviderRefund(&ProviderRefund{
+		PaymentProvider:  PaymentProviderCreem,
+		ProviderRefundId: "ref_ours",
+		ProviderOrderId:  topUp.ProviderOrderId,
+		Money:            5,
+	}))
+	require.NoError(t, CompletePaymentRefund(ours.RefundNo, "ref_ours"))
+
+	refunds, err := GetPaymentRefundsByTradeNo("webhook-topup")
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+	assert.Equal(t, -750, getUserQuotaForRefundTest(t, 1))
+
+	err = RecordProviderRefund(&ProviderRefund{
+		PaymentProvider:  PaymentProviderStripe,
+		ProviderRefundId: "re_other",
+		TradeNo:          "webhook-topup",
+		Money:            1,
+	})
+	assert.ErrorIs(t, err, ErrPaymentMethodMismatch)
+}
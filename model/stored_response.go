@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrStoredResponseNotFound = errors.New("stored response not found")
+
+// StoredResponse keeps the conversation behind one Responses API result so a
+// follow-up request can continue it with previous_response_id on any channel.
+// A response is only visible to the user and token that created it.
+type StoredResponse struct {
+	Id         int    `json:"id"`
+	UserId     int    `json:"user_id" gorm:"uniqueIndex:idx_stored_response_owner,priority:1"`
+	TokenId    int    `json:"token_id" gorm:"uniqueIndex:idx_stored_response_owner,priority:2"`
+	ResponseId string `json:"response_id" gorm:"type:varchar(128);uniqueIndex:idx_stored_response_owner,priority:3"`
+	ModelName  string `json:"model_name" gorm:"default:''"`
+	// Items is the JSON array of Responses input items that replays the
+	// conversation up to and including this response.
+	Items     string `json:"items"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+// SaveStoredResponse stores response, replacing an earlier copy with the same
+// owner and response id.
+func SaveStoredResponse(response *StoredResponse) error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "token_id"}, {Name: "response_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model_name", "items", "created_at", "expires_at"}),
+	}).Create(response).Error
+}
+
+// GetStoredResponse returns the unexpired response stored by the user and
+// token under responseId.
+func GetStoredResponse(userId int, tokenId int, responseId string) (*StoredResponse, error) {
+	var response StoredResponse
+	err := DB.Where("user_id = ? AND token_id = ? AND response_id = ? AND expires_at > ?",
+		userId, tokenId, responseId, common.GetTimestamp()).First(&response).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrStoredResponseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// DeleteExpiredStoredResponses deletes the responses that expired before
+// timestamp and returns how many were removed.
+func DeleteExpiredStoredResponses(ctx context.Context, timestamp int64) (int64, error) {
+	var deleted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		result := DB.WithContext(ctx).Where("expires_at <= ?", timestamp).Limit(100).Delete(&StoredResponse{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if result.RowsAffected == 0 {
+			return deleted, nil
+		}
+	}
+}
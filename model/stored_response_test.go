@@ -0,0 +1,37 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoredResponseOwnershipAndExpiry(t *testing.T) {
+	truncateTables(t)
+	now := common.GetTimestamp()
+
+	require.NoError(t, SaveStoredResponse(&StoredResponse{UserId: 1, TokenId: 10, ResponseId: "resp_1", Items: `[]`, ExpiresAt: now + 60}))
+	require.NoError(t, SaveStoredResponse(&StoredResponse{UserId: 1, TokenId: 10, ResponseId: "resp_1", Items: `[{"role":"user"}]`, ExpiresAt: now + 60}))
+	require.NoError(t, SaveStoredResponse(&StoredResponse{UserId: 1, TokenId: 10, ResponseId: "resp_old", Items: `[]`, ExpiresAt: now - 1}))
+
+	stored, err := GetStoredResponse(1, 10, "resp_1")
+	require.NoError(t, err)
+	assert.Equal(t, `[{"role":"user"}]`, stored.Items, "saving the same id again replaces the conversation")
+
+	_, err = GetStoredResponse(1, 11, "resp_1")
+	assert.ErrorIs(t, err, ErrStoredResponseNotFound, "another token of the same user cannot continue it")
+	_, err = GetStoredResponse(2, 10, "resp_1")
+	assert.ErrorIs(t, err, ErrStoredResponseNotFound)
+	_, err = GetStoredResponse(1, 10, "resp_old")
+	assert.ErrorIs(t, err, ErrStoredResponseNotFound, "expired responses are not returned")
+
+	deleted, err := DeleteExpiredStoredResponses(context.Background(), now)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+	_, err = GetStoredResponse(1, 10, "resp_1")
+	assert.NoError(t, err)
+}
@@ -225,6 +225,9 @@ type SubscriptionOrder struct {
 	CompleteTime    int64  `json:"complete_time"`
 
 	ProviderPayload string `json:"provider_payload" gorm:"type:text"`
+
+	// UserSubscriptionId is the subscription created when the order completed.
+	UserSubscriptionId int `json:"user_subscription_id" gorm:"index;default:0"`
 }
 
 func (o *SubscriptionOrder) Insert() error {
@@ -254,6 +257,9 @@ type UserSubscription struct {
 	Id     int `json:"id"`
 	UserId int `json:"user_id" gorm:"index;index:idx_user_sub_active,priority:1"`
 	PlanId int `json:"plan_id" gorm:"index"`
+	// OrganizationId is set on subscriptions owned by an organization, which
+	// have no UserId and are shared by its members.
+	OrganizationId int `json:"organization_id" gorm:"index;default:0"`
 
 	AmountTotal int64 `json:"amount_total" gorm:"type:bigint;not null;default:0"`
 	AmountUsed  int64 `json:"amount_used" gorm:"type:bigint;not null;default:0"`
@@ -607,6 +613,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string, expectedP
 		if subscription.PrevUserGroup != "" {
 			upgradeGroup = strings.TrimSpace(subscription.UpgradeGroup)
 		}
+		order.UserSubscriptionId = subscription.Id
 		if err := upsertSubscriptionTopUpTx(tx, &order); err != nil {
 			return err
 		}
@@ -649,14 +656,15 @@ func upsertSubscriptionTopUpTx(tx *gorm.DB, order *SubscriptionOrder) error {
 	if err := tx.Where("trade_no = ?", order.TradeNo).First(&topup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			topup = TopUp{
-				UserId:        order.UserId,
-				Amount:        0,
-				Money:         order.Money,
-				TradeNo:       order.TradeNo,
-				PaymentMethod: order.PaymentMethod,
-				CreateTime:    order.CreateTime,
-				CompleteTime:  now,
-				Status:        common.TopUpStatusSuccess,
+				UserId:          order.UserId,
+				Amount:          0,
+				Money:           order.Money,
+				TradeNo:         order.TradeNo,
+				PaymentMethod:   order.PaymentMethod,
+				PaymentProvider: order.PaymentProvider,
+				CreateTime:      order.CreateTime,
+				CompleteTime:    now,
+				Status:          common.TopUpStatusSuccess,
 			}
 			return tx.Create(&topup).Error
 		}
@@ -884,6 +892,99 @@ func UserActiveSubscriptionsAllowWalletOverflow(userId int) (bool, error) {
 	return strictCount == 0, nil
 }
 
+// HasActiveOrganizationSubscription returns whether the organization has any active subscription.
+func HasActiveOrganizationSubscription(organizationId int) (bool, error) {
+	if organizationId <= 0 {
+		return false, errors.New("invalid organizationId")
+	}
+	now := common.GetTimestamp()
+	var count int64
+	if err := DB.Model(&UserSubscription{}).
+		Where("organization_id = ? AND status = ? AND end_time > ?", organizationId, "active", now).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// OrganizationSubscriptionsAllowWalletOverflow returns whether the quota pool of the
+// organization may be used after its subscription quota is exhausted.
+func OrganizationSubscriptionsAllowWalletOverflow(organizationId int) (bool, error) {
+	if organizationId <= 0 {
+		return false, errors.New("invalid organizationId")
+	}
+	now := common.GetTimestamp()
+	var strictCount int64
+	if err := DB.Model(&UserSubscription{}).
+		Where("organization_id = ? AND status = ? AND end_time > ? AND allow_wallet_overflow = ?",
+			organizationId, "active", now, false).
+		Count(&strictCount).Error; err != nil {
+		return false, err
+	}
+	return strictCount == 0, nil
+}
+
+// GetOrganizationSubscriptions returns all subscriptions (active and expired) of an organization.
+func GetOrganizationSubscriptions(organizationId int) ([]SubscriptionSummary, error) {
+	if organizationId <= 0 {
+		return nil, errors.New("invalid organizationId")
+	}
+	var subs []UserSubscription
+	err := DB.Where("organization_id = ?", organizationId).
+		Order("end_time desc, id desc").
+		Find(&subs).Error
+	if err != nil {
+		return nil, err
+	}
+	return buildSubscriptionSummaries(subs), nil
+}
+
+// AdminBindOrganizationSubscription creates a subscription of an organization from a plan.
+// The group upgrade of the plan does not apply, members use the group of the organization.
+func AdminBindOrganizationSubscription(organizationId int, planId int) (*UserSubscription, error) {
+	if organizationId <= 0 || planId <= 0 {
+		return nil, errors.New("invalid organizationId or planId")
+	}
+	if _, err := GetOrganizationById(organizationId); err != nil {
+		return nil, err
+	}
+	plan, err := GetSubscriptionPlanById(planId)
+	if err != nil {
+		return nil, err
+	}
+	nowUnix := GetDBTimestamp()
+	now := time.Unix(nowUnix, 0)
+	endUnix, err := calcPlanEndTime(now, plan)
+	if err != nil {
+		return nil, err
+	}
+	nextReset := calcNextResetTime(now, plan, endUnix)
+	lastReset := int64(0)
+	if nextReset > 0 {
+		lastReset = now.Unix()
+	}
+	allowWalletOverflow := true
+	if plan.AllowWalletOverflow != nil {
+		allowWalletOverflow = *plan.AllowWalletOverflow
+	}
+	sub := &UserSubscription{
+		OrganizationId:      organizationId,
+		PlanId:              plan.Id,
+		AmountTotal:         plan.TotalAmount,
+		StartTime:           now.Unix(),
+		EndTime:             endUnix,
+		Status:              "active",
+		Source:              "admin",
+		LastResetTime:       lastReset,
+		NextResetTime:       nextReset,
+		AllowWalletOverflow: allowWalletOverflow,
+	}
+	if err := DB.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
 // GetAllUserSubscriptions returns all subscriptions (active and expired) for a user.
 func GetAllUserSubscriptions(userId int) ([]SubscriptionSummary, error) {
 	if userId <= 0 {
@@ -1144,10 +1245,27 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 	}
 	expiredCount := 0
 	userIds := make(map[int]struct{}, len(subs))
+	hasOrganizationSubs := false
 	for _, sub := range subs {
 		if sub.UserId > 0 {
 			userIds[sub.UserId] = struct{}{}
 		}
+		if sub.OrganizationId > 0 {
+			hasOrganizationSubs = true
+		}
+	}
+	// Organization subscriptions change no user group.
+	if hasOrganizationSubs {
+		res := DB.Model(&UserSubscription{}).
+			Where("organization_id > 0 AND status = ? AND end_time > 0 AND end_time <= ?", "active", now).
+			Updates(map[string]interface{}{
+				"status":     "expired",
+				"updated_at": common.GetTimestamp(),
+			})
+		if res.Error != nil {
+			return expiredCount, res.Error
+		}
+		expiredCount += int(res.RowsAffected)
 	}
 	for userId := range userIds {
 		cacheGroup := ""
@@ -1289,6 +1407,25 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 	if userId <= 0 {
 		return nil, errors.New("invalid userId")
 	}
+	return preConsumeSubscription(requestId, userId, amount, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ?", userId)
+	})
+}
+
+// PreConsumeOrganizationSubscription pre-consumes for a member from any active
+// subscription of its organization.
+func PreConsumeOrganizationSubscription(requestId string, organizationId int, userId int, amount int64) (*SubscriptionPreConsumeResult, error) {
+	if organizationId <= 0 || userId <= 0 {
+		return nil, errors.New("invalid organizationId or userId")
+	}
+	return preConsumeSubscription(requestId, userId, amount, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("organization_id = ?", organizationId)
+	})
+}
+
+// preConsumeSubscription pre-consumes for userId from the subscriptions
+// selected by owner.
+func preConsumeSubscription(requestId string, userId int, amount int64, owner func(tx *gorm.DB) *gorm.DB) (*SubscriptionPreConsumeResult, error) {
 	if strings.TrimSpace(requestId) == "" {
 		return nil, errors.New("requestId is empty")
 	}
@@ -1322,8 +1459,8 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 		}
 
 		var subs []UserSubscription
-		if err := lockForUpdate(tx).
-			Where("user_id = ? AND status = ? AND end_time > ?", userId, "active", now).
+		if err := owner(lockForUpdate(tx)).
+			Where("status = ? AND end_time > ?", "active", now).
 			Order("end_time asc, id asc").
 			Find(&subs).Error; err != nil {
 			return errors.New("no active subscription")
@@ -16,11 +16,14 @@ const (
 	SystemTaskStatusSucceeded SystemTaskStatus = "succeeded"
 	SystemTaskStatusFailed    SystemTaskStatus = "failed"
 
-	SystemTaskTypeLogCleanup     = "log_cleanup"
-	SystemTaskTypeChannelTest    = "channel_test"
-	SystemTaskTypeModelUpdate    = "model_update"
-	SystemTaskTypeMidjourneyPoll = "midjourney_poll"
-	SystemTaskTypeAsyncTaskPoll  = "async_task_poll"
+	SystemTaskTypeLogCleanup            = "log_cleanup"
+	SystemTaskTypeChannelTest           = "channel_test"
+	SystemTaskTypeModelUpdate           = "model_update"
+	SystemTaskTypeMidjourneyPoll        = "midjourney_poll"
+	SystemTaskTypeAsyncTaskPoll         = "async_task_poll"
+	SystemTaskTypeBatchProcess          = "batch_process"
+	SystemTaskTypeLogBodyCleanup        = "log_body_cleanup"
+	SystemTaskTypeStoredResponseCleanup = "stored_response_cleanup"
 )
 
 var ErrSystemTaskLockLost = errors.New("system task lock lost")
@@ -143,6 +146,25 @@ func GetActiveSystemTask(taskType string) (*SystemTask, error) {
 	return &task, nil
 }
 
+// SystemTaskStatusCount is the number of system tasks of a type in a status.
+type SystemTaskStatusCount struct {
+	Type   string           `json:"type"`
+	Status SystemTaskStatus `json:"status"`
+	Count  int64            `json:"count"`
+}
+
+// CountActiveSystemTasks returns the number of pending and running system
+// tasks grouped by type and status.
+func CountActiveSystemTasks() ([]SystemTaskStatusCount, error) {
+	var counts []SystemTaskStatusCount
+	err := DB.Model(&SystemTask{}).
+		Select("type, status, count(*) as count").
+		Where("status IN ?", activeSystemTaskStatuses()).
+		Group("type, status").
+		Scan(&counts).Error
+	return counts, err
+}
+
 func FindPendingSystemTasks(taskType string, limit int) ([]*SystemTask, error) {
 	var tasks []*SystemTask
 	if limit <= 0 {
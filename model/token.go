@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -27,12 +28,28 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`      // 跨分组重试，仅auto分组有效
+	ResponseCache      bool           `json:"response_cache"`         // 允许命中响应缓存，需同时开启全局响应缓存
+	Scope              string         `json:"scope" gorm:"type:text"` // dto.TokenScope 的 JSON，限制可调用的端点与请求参数
+	ParentId           int            `json:"parent_id" gorm:"index;default:0"`
+	PrevKey            string         `json:"-" gorm:"type:varchar(128);index"`
+	PrevKeyExpiredTime int64          `json:"prev_key_expired_time" gorm:"bigint;default:0"`
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
 	token.Key = ""
+	token.PrevKey = ""
+}
+
+func (token *Token) GetScope() dto.TokenScope {
+	scope := dto.TokenScope{}
+	if token.Scope != "" {
+		if err := common.Unmarshal([]byte(token.Scope), &scope); err != nil {
+			common.SysLog("failed to unmarshal token scope: " + err.Error())
+		}
+	}
+	return scope
 }
 
 func MaskTokenKey(key string) string {
@@ -81,7 +98,7 @@ func (token *Token) GetIpLimits() []string {
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	var tokens []*Token
 	var err error
-	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	err = DB.Where("user_id = ? AND parent_id = 0", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
 	return tokens, err
 }
 
@@ -158,7 +175,7 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		}
 	}
 
-	baseQuery := DB.Model(&Token{}).Where("user_id = ?", userId)
+	baseQuery := DB.Model(&Token{}).Where("user_id = ? AND parent_id = 0", userId)
 
 	// 非空才加 LIKE 条件，空则跳过（不过滤该字段）
 	if keyword != "" {
@@ -223,6 +240,9 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			}
 			return token, ErrTokenInvalid
 		}
+		if token.IsDerived() && !isParentTokenUsable(token.ParentId) {
+			return token, ErrTokenInvalid
+		}
 		return token, nil
 	}
 	common.SysLog("ValidateUserToken: failed to get token: " + err.Error())
@@ -280,6 +300,10 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	}
 	fromDB = true
 	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 轮换宽限期内的旧 key：返回的令牌带新 key，缓存只按新 key 写入
+		err = DB.Where("prev_key = ? AND prev_key_expired_time > ?", key, common.GetTimestamp()).First(&token).Error
+	}
 	return token, err
 }
 
@@ -302,8 +326,17 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
-	return err
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "response_cache", "scope").Updates(token).Error
+	if err != nil {
+		return err
+	}
+	if token.Status != common.TokenStatusEnabled {
+		// 父令牌的失效状态在鉴权时也会校验，这里失败只记录日志
+		if revokeErr := disableDerivedTokens(token.Id); revokeErr != nil {
+			common.SysLog("failed to disable derived tokens: " + revokeErr.Error())
+		}
+	}
+	return nil
 }
 
 func (token *Token) SelectUpdate() (err error) {
@@ -333,7 +366,13 @@ func (token *Token) Delete() (err error) {
 		}
 	}()
 	err = DB.Delete(token).Error
-	return err
+	if err != nil {
+		return err
+	}
+	if revokeErr := deleteDerivedTokens([]int{token.Id}); revokeErr != nil {
+		common.SysLog("failed to delete derived tokens: " + revokeErr.Error())
+	}
+	return nil
 }
 
 func (token *Token) IsModelLimitsEnabled() bool {
@@ -439,10 +478,11 @@ func decreaseTokenQuota(id int, quota int) (err error) {
 	return err
 }
 
-// CountUserTokens returns total number of tokens for the given user, used for pagination
+// CountUserTokens returns total number of tokens for the given user, used for pagination.
+// Derived tokens are listed under their parent and not counted.
 func CountUserTokens(userId int) (int64, error) {
 	var total int64
-	err := DB.Model(&Token{}).Where("user_id = ?", userId).Count(&total).Error
+	err := DB.Model(&Token{}).Where("user_id = ? AND parent_id = 0", userId).Count(&total).Error
 	return total, err
 }
 
@@ -476,6 +516,13 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 			}
 		})
 	}
+	parentIds := make([]int, 0, len(tokens))
+	for _, t := range tokens {
+		parentIds = append(parentIds, t.Id)
+	}
+	if err := deleteDerivedTokens(parentIds); err != nil {
+		common.SysLog("failed to delete derived tokens: " + err.Error())
+	}
 
 	return len(tokens), nil
 }
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -8,14 +9,64 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 )
 
+// cacheSetToken skips keys retired by a rotation: a request that read the
+// token before the rotation committed may fill the cache after it, and the
+// old key would otherwise keep working past its grace period.
 func cacheSetToken(token Token) error {
 	key := common.GenerateHMAC(token.Key)
 	token.Clean()
-	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+	_, err := common.RedisHSetObjUnlessFenced(fmt.Sprintf("token:%s", key), getRetiredTokenCacheKey(key), &token,
+		time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+	return err
+}
+
+func getRetiredTokenCacheKey(hmacKey string) string {
+	return fmt.Sprintf("token_retired:%s", hmacKey)
+}
+
+// cacheRetireToken drops the cached token of a key replaced by a rotation and
+// fences the key against cache fills still in flight. Requests with the old
+// key then always read the database, which checks its grace period.
+func cacheRetireToken(key string) error {
+	hmacKey := common.GenerateHMAC(key)
+	ttl := common.RedisKeyCacheSeconds()
+	if ttl < 60 {
+		ttl = 60
+	}
+	ctx := context.Background()
+	txn := common.RDB.TxPipeline()
+	txn.Set(ctx, getRetiredTokenCacheKey(hmacKey), "1", time.Duration(ttl)*time.Second)
+	txn.Del(ctx, fmt.Sprintf("token:%s", hmacKey))
+	_, err := txn.Exec(ctx)
+	return err
+}
+
+// A derived token only knows the id of its parent, so the hash of the parent
+// key is cached by id as well. Parent lookups then read the same cached token
+// the parent itself is validated against.
+func getTokenIdCacheKey(id int) string {
+	return fmt.Sprintf("token_id:%d", id)
+}
+
+func cacheSetTokenId(token Token) error {
+	return common.RedisSet(getTokenIdCacheKey(token.Id), common.GenerateHMAC(token.Key),
+		time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+}
+
+func cacheDeleteTokenId(id int) error {
+	return common.RedisDelKey(getTokenIdCacheKey(id))
+}
+
+func cacheGetTokenById(id int) (*Token, error) {
+	hmacKey, err := common.RedisGet(getTokenIdCacheKey(id))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	var token Token
+	if err := common.RedisHGetObj(fmt.Sprintf("token:%s", hmacKey), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
 }
 
 func cacheDeleteToken(key string) error {
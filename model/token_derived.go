@@ -0,0 +1,231 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// MaxActiveDerivedTokens caps the unexpired derived tokens of one parent.
+const MaxActiveDerivedTokens = 100
+
+var ErrDerivedTokenLimitReached = errors.New("derived token limit reached")
+
+// IsDerived reports whether the token was minted from a parent token. Derived
+// tokens are short-lived, never outlive their parent and roll their usage up
+// to it.
+func (token *Token) IsDerived() bool {
+	return token.ParentId != 0
+}
+
+// InsertDerivedToken stores token as a child of parent. Expired children of
+// the parent are removed first, so minting does not grow the table forever.
+func InsertDerivedToken(parent *Token, token *Token) error {
+	token.ParentId = parent.Id
+	token.UserId = parent.UserId
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parent_id = ? AND expired_time <= ?", parent.Id, now).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		var active int64
+		if err := tx.Model(&Token{}).Where("parent_id = ?", parent.Id).Count(&active).Error; err != nil {
+			return err
+		}
+		if active >= MaxActiveDerivedTokens {
+			return ErrDerivedTokenLimitReached
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func GetDerivedTokens(parentId int, userId int) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("parent_id = ? AND user_id = ?", parentId, userId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// GetParentToken returns the parent of a derived token. It is read on every
+// request of the child, from the token cache when Redis is enabled, so
+// revoking, expiring or exhausting the parent stops its children on every
+// node as soon as the cached parent changes.
+func GetParentToken(parentId int) (*Token, error) {
+	if common.RedisEnabled {
+		if parent, err := cacheGetTokenById(parentId); err == nil {
+			return parent, nil
+		}
+	}
+	var parent Token
+	if err := DB.Where("id = ?", parentId).First(&parent).Error; err != nil {
+		return nil, err
+	}
+	if common.RedisEnabled {
+		cached := parent
+		gopool.Go(func() {
+			if err := cacheSetToken(cached); err != nil {
+				common.SysLog("failed to update token cache: " + err.Error())
+				return
+			}
+			if err := cacheSetTokenId(cached); err != nil {
+				common.SysLog("failed to update token id cache: " + err.Error())
+			}
+		})
+	}
+	return &parent, nil
+}
+
+// CheckParentTokenQuota reports whether the parent of a derived token can
+// cover quota, so a child with a large spend cap cannot overdraw a nearly
+// exhausted parent. It is a no-op for tokens without parent.
+func CheckParentTokenQuota(parentId int, quota int) error {
+	if parentId <= 0 {
+		return nil
+	}
+	parent, err := GetParentToken(parentId)
+	if err != nil {
+		return err
+	}
+	if !parent.UnlimitedQuota && parent.RemainQuota < quota {
+		return fmt.Errorf("parent token quota is not enough, parent token remain quota: %s, need quota: %s",
+			logger.FormatQuota(parent.RemainQuota), logger.FormatQuota(quota))
+	}
+	return nil
+}
+
+func isParentTokenUsable(parentId int) bool {
+	parent, err := GetParentToken(parentId)
+	if err != nil {
+		return false
+	}
+	if parent.Status != common.TokenStatusEnabled {
+		return false
+	}
+	if parent.ExpiredTime != -1 && parent.ExpiredTime < common.GetTimestamp() {
+		return false
+	}
+	return parent.UnlimitedQuota || parent.RemainQuota > 0
+}
+
+// AdjustTokenQuota changes the quota of a token by delta (positive consumes,
+// negative refunds) and rolls the change up to parentId when the token is
+// derived. Child and parent change in one transaction, or in the same batch
+// when batch updates are enabled, so the parent never misses usage its
+// children were charged for.
+func AdjustTokenQuota(id int, key string, parentId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	if parentId <= 0 {
+		if delta > 0 {
+			return DecreaseTokenQuota(id, key, delta)
+		}
+		return IncreaseTokenQuota(id, key, -delta)
+	}
+	var parent Token
+	if err := DB.Select("id", commonKeyCol).Where("id = ?", parentId).First(&parent).Error; err != nil {
+		return err
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeTokenQuota, id, -delta)
+		addNewRecord(BatchUpdateTypeTokenQuota, parent.Id, -delta)
+	} else {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			for _, tokenId := range []int{id, parent.Id} {
+				err := tx.Model(&Token{}).Where("id = ?", tokenId).Updates(map[string]interface{}{
+					"remain_quota":  gorm.Expr("remain_quota - ?", delta),
+					"used_quota":    gorm.Expr("used_quota + ?", delta),
+					"accessed_time": common.GetTimestamp(),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			for _, tokenKey := range []string{key, parent.Key} {
+				if err := cacheDecrTokenQuota(tokenKey, int64(delta)); err != nil {
+					common.SysLog("failed to adjust token quota cache: " + err.Error())
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// RotateKey replaces the key of the token with newKey. The current key keeps
+// working for graceSeconds, or stops at once when graceSeconds is 0; a key
+// still in the grace period of an earlier rotation stops at once either way.
+func (token *Token) RotateKey(newKey string, graceSeconds int64) error {
+	oldKey := token.Key
+	token.Key = newKey
+	token.PrevKey = ""
+	token.PrevKeyExpiredTime = 0
+	if graceSeconds > 0 {
+		token.PrevKey = oldKey
+		token.PrevKeyExpiredTime = common.GetTimestamp() + graceSeconds
+	}
+	err := DB.Model(token).Select("key", "prev_key", "prev_key_expired_time").Updates(token).Error
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		// 数据库已提交后再失效旧 key 的缓存，并阻止在途请求回填；之后旧 key 的请求回源数据库，由宽限期决定是否放行
+		if err := cacheRetireToken(oldKey); err != nil {
+			common.SysLog("failed to delete rotated token cache: " + err.Error())
+		}
+		if err := cacheDeleteTokenId(token.Id); err != nil {
+			common.SysLog("failed to delete rotated token id cache: " + err.Error())
+		}
+		rotated := *token
+		gopool.Go(func() {
+			if err := cacheSetToken(rotated); err != nil {
+				common.SysLog("failed to update token cache: " + err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+// disableDerivedTokens disables the enabled children of a parent token and
+// drops them from the token cache, which is shared by all nodes through Redis.
+func disableDerivedTokens(parentId int) error {
+	var tokens []Token
+	if err := DB.Select("id", commonKeyCol).Where("parent_id = ? AND status = ?", parentId, common.TokenStatusEnabled).Find(&tokens).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	if err := DB.Model(&Token{}).Where("parent_id = ? AND status = ?", parentId, common.TokenStatusEnabled).
+		Update("status", common.TokenStatusDisabled).Error; err != nil {
+		return err
+	}
+	return invalidateTokensCache(tokens)
+}
+
+func deleteDerivedTokens(parentIds []int) error {
+	if len(parentIds) == 0 {
+		return nil
+	}
+	var tokens []Token
+	if err := DB.Select("id", commonKeyCol).Where("parent_id IN (?)", parentIds).Find(&tokens).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	if err := DB.Where("parent_id IN (?)", parentIds).Delete(&Token{}).Error; err != nil {
+		return err
+	}
+	return invalidateTokensCache(tokens)
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertDerivedTestToken(t *testing.T, key string, remainQuota int, unlimited bool) *Token {
+	t.Helper()
+	token := &Token{
+		UserId:         1,
+		Name:           key,
+		Key:            key,
+		Status:         common.TokenStatusEnabled,
+		ExpiredTime:    -1,
+		RemainQuota:    remainQuota,
+		UnlimitedQuota: unlimited,
+	}
+	require.NoError(t, token.Insert())
+	return token
+}
+
+func deriveTestToken(t *testing.T, parent *Token, key string, spendCap int) *Token {
+	t.Helper()
+	child := &Token{
+		Name:        key,
+		Key:         key,
+		Status:      common.TokenStatusEnabled,
+		ExpiredTime: common.GetTimestamp() + 600,
+		RemainQuota: spendCap,
+	}
+	require.NoError(t, InsertDerivedToken(parent, child))
+	return child
+}
+
+func TestDerivedTokenUsageRollsUpToParent(t *testing.T) {
+	truncateTables(t)
+	parent := insertDerivedTestToken(t, "parent-key", 1000, false)
+	child := deriveTestToken(t, parent, "child-key", 300)
+
+	require.NoError(t, AdjustTokenQuota(child.Id, child.Key, child.ParentId, 120))
+	require.NoError(t, AdjustTokenQuota(child.Id, child.Key, child.ParentId, -20))
+
+	child, err := GetTokenById(child.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 200, child.RemainQuota)
+	assert.Equal(t, 100, child.UsedQuota)
+	parent, err = GetTokenById(parent.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 900, parent.RemainQuota)
+	assert.Equal(t, 100, parent.UsedQuota)
+
+	tokens, err := GetAllUserTokens(1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1, "derived tokens are listed under their parent only")
+	derived, err := GetDerivedTokens(parent.Id, 1)
+	require.NoError(t, err)
+	require.Len(t, derived, 1)
+	assert.Equal(t, child.Id, derived[0].Id)
+}
+
+func TestDerivedTokenStopsWithParent(t *testing.T) {
+	truncateTables(t)
+	parent := insertDerivedTestToken(t, "parent-key", 0, true)
+	child := deriveTestToken(t, parent, "child-key", 300)
+
+	_, err := ValidateUserToken(child.Key)
+	require.NoError(t, err)
+
+	parent.Status = common.TokenStatusDisabled
+	require.NoError(t, parent.Update())
+	_, err = ValidateUserToken(child.Key)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	child, err = GetTokenById(child.Id)
+	require.NoError(t, err)
+	assert.Equal(t, common.TokenStatusDisabled, child.Status, "disabling the parent revokes its children")
+
+	other := deriveTestToken(t, insertDerivedTestToken(t, "other-parent-key", 0, true), "other-child-key", 100)
+	require.NoError(t, DeleteTokenById(other.ParentId, 1))
+	_, err = GetTokenById(other.Id)
+	assert.Error(t, err, "deleting the parent deletes its children")
+}
+
+func TestInsertDerivedTokenPurgesExpiredChildren(t *testing.T) {
+	truncateTables(t)
+	parent := insertDerivedTestToken(t, "parent-key", 0, true)
+	expired := deriveTestToken(t, parent, "expired-child-key", 100)
+	require.NoError(t, DB.Model(expired).Update("expired_time", common.GetTimestamp()-1).Error)
+
+	deriveTestToken(t, parent, "fresh-child-key", 100)
+	derived, err := GetDerivedTokens(parent.Id, 1)
+	require.NoError(t, err)
+	require.Len(t, derived, 1)
+	assert.Equal(t, "fresh-child-key", derived[0].Key)
+}
+
+func TestRotateKeyHonorsGracePeriod(t *testing.T) {
+	truncateTables(t)
+	token := insertDerivedTestToken(t, "old-key", 0, true)
+
+	require.NoError(t, token.RotateKey("new-key", 600))
+	for _, key := range []string{"old-key", "new-key"} {
+		validated, err := ValidateUserToken(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, token.Id, validated.Id)
+		assert.Equal(t, "new-key", validated.Key, "the old key resolves to the current key")
+	}
+
+	require.NoError(t, DB.Model(token).Update("prev_key_expired_time", common.GetTimestamp()-1).Error)
+	_, err := ValidateUserToken("old-key")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	require.NoError(t, token.RotateKey("newest-key", 0))
+	_, err = ValidateUserToken("new-key")
+	assert.ErrorIs(t, err, ErrTokenInvalid, "a rotation without grace period stops the old key at once")
+	_, err = ValidateUserToken("newest-key")
+	assert.NoError(t, err)
+}
+
+func TestParentTokenIsReadFromTokenCache(t *testing.T) {
+	truncateTables(t)
+	useUserCacheMiniRedis(t)
+	parent := insertDerivedTestToken(t, "parent-key", 1000, false)
+
+	_, err := GetParentToken(parent.Id)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := cacheGetTokenById(parent.Id)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// a change that reached the token cache stops the children on every node
+	parent.Status = common.TokenStatusDisabled
+	require.NoError(t, cacheSetToken(*parent))
+	assert.False(t, isParentTokenUsable(parent.Id))
+
+	require.NoError(t, parent.RotateKey("parent-key-2", 0))
+	_, err = cacheGetTokenById(parent.Id)
+	assert.Error(t, err, "rotation drops the parent from the id cache")
+}
+
+func TestCheckParentTokenQuotaCoversPreConsumedAmount(t *testing.T) {
+	truncateTables(t)
+	parent := insertDerivedTestToken(t, "parent-key", 100, false)
+	child := deriveTestToken(t, parent, "child-key", 1000)
+
+	assert.Error(t, CheckParentTokenQuota(child.ParentId, 500), "the spend cap of the child must not overdraw its parent")
+	assert.NoError(t, CheckParentTokenQuota(child.ParentId, 100))
+	assert.NoError(t, CheckParentTokenQuota(0, 500))
+}
+
+func TestAdjustTokenQuotaLeavesChildUnchargedWhenParentFails(t *testing.T) {
+	truncateTables(t)
+	child := insertDerivedTestToken(t, "orphan-key", 300, false)
+
+	assert.Error(t, AdjustTokenQuota(child.Id, child.Key, child.Id+1000, 120))
+	child, err := GetTokenById(child.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 300, child.RemainQuota)
+	assert.Equal(t, 0, child.UsedQuota)
+}
+
+func TestRotatedKeyIsNotRefilledIntoTokenCache(t *testing.T) {
+	truncateTables(t)
+	useUserCacheMiniRedis(t)
+	token := insertDerivedTestToken(t, "old-key", 0, true)
+	stale := *token
+
+	require.NoError(t, token.RotateKey("new-key", 600))
+	// a request that read the token before the rotation fills the cache late
+	require.NoError(t, cacheSetToken(stale))
+	_, err := cacheGetTokenByKey("old-key")
+	assert.Error(t, err, "the retired key stays out of the cache")
+
+	require.NoError(t, DB.Model(token).Update("prev_key_expired_time", common.GetTimestamp()-1).Error)
+	_, err = ValidateUserToken("old-key")
+	assert.ErrorIs(t, err, ErrTokenInvalid, "the old key does not outlive its grace period")
+}
@@ -22,6 +22,8 @@ type TopUp struct {
 	CreateTime      int64   `json:"create_time"`
 	CompleteTime    int64   `json:"complete_time"`
 	Status          string  `json:"status"`
+	ProviderOrderId string  `json:"provider_order_id" gorm:"type:varchar(255);index"`
+	RefundedMoney   float64 `json:"refunded_money" gorm:"default:0"`
 }
 
 const (
@@ -79,6 +81,26 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
+func GetTopUpByProviderOrderId(paymentProvider string, providerOrderId string) *TopUp {
+	if providerOrderId == "" {
+		return nil
+	}
+	var topUp TopUp
+	if err := DB.Where("payment_provider = ? AND provider_order_id = ?", paymentProvider, providerOrderId).First(&topUp).Error; err != nil {
+		return nil
+	}
+	return &topUp
+}
+
+// SetTopUpProviderOrderId records the id the provider gave the payment of
+// tradeNo, which its refund API asks for.
+func SetTopUpProviderOrderId(tradeNo string, providerOrderId string) error {
+	if tradeNo == "" || providerOrderId == "" {
+		return nil
+	}
+	return DB.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Update("provider_order_id", providerOrderId).Error
+}
+
 func UpdatePendingTopUpStatus(tradeNo string, expectedPaymentProvider string, targetStatus string) error {
 	if tradeNo == "" {
 		return errors.New("未提供支付单号")
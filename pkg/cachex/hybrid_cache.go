@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -40,16 +41,21 @@ type HybridCache[V any] struct {
 	memOnce sync.Once
 	memInit func() *hot.HotCache[string, V]
 	mem     *hot.HotCache[string, V]
+
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
 func NewHybridCache[V any](cfg HybridCacheConfig[V]) *HybridCache[V] {
-	return &HybridCache[V]{
+	c := &HybridCache[V]{
 		ns:           cfg.Namespace,
 		redis:        cfg.Redis,
 		redisCodec:   cfg.RedisCodec,
 		redisEnabled: cfg.RedisEnabled,
 		memInit:      cfg.Memory,
 	}
+	registerStatsSource(c)
+	return c
 }
 
 func (c *HybridCache[V]) FullKey(key string) string {
@@ -78,6 +84,14 @@ func (c *HybridCache[V]) memCache() *hot.HotCache[string, V] {
 }
 
 func (c *HybridCache[V]) Get(key string) (value V, found bool, err error) {
+	defer func() {
+		if found {
+			c.hits.Add(1)
+		} else if err == nil {
+			c.misses.Add(1)
+		}
+	}()
+
 	full := c.ns.FullKey(key)
 	if full == "" {
 		var zero V
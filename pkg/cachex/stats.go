@@ -0,0 +1,65 @@
+package cachex
+
+import (
+	"sort"
+	"sync"
+)
+
+// CacheStats is the lookup counters of the caches sharing a namespace since
+// the process started. Failed lookups are counted as neither.
+type CacheStats struct {
+	Namespace string
+	Hits      int64
+	Misses    int64
+}
+
+type statsSource interface {
+	stats() CacheStats
+}
+
+var (
+	statsMu      sync.Mutex
+	statsSources []statsSource
+)
+
+func registerStatsSource(source statsSource) {
+	statsMu.Lock()
+	statsSources = append(statsSources, source)
+	statsMu.Unlock()
+}
+
+func (c *HybridCache[V]) stats() CacheStats {
+	return CacheStats{
+		Namespace: string(c.ns),
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+	}
+}
+
+// Stats returns the lookup counters of every HybridCache, summed by
+// namespace and sorted by it.
+func Stats() []CacheStats {
+	statsMu.Lock()
+	sources := append([]statsSource(nil), statsSources...)
+	statsMu.Unlock()
+
+	byNamespace := make(map[string]*CacheStats, len(sources))
+	for _, source := range sources {
+		s := source.stats()
+		total, ok := byNamespace[s.Namespace]
+		if !ok {
+			total = &CacheStats{Namespace: s.Namespace}
+			byNamespace[s.Namespace] = total
+		}
+		total.Hits += s.Hits
+		total.Misses += s.Misses
+	}
+	result := make([]CacheStats, 0, len(byNamespace))
+	for _, s := range byNamespace {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
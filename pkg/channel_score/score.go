@@ -0,0 +1,193 @@
+package channelscore
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// entries maps a channel id to its *entry.
+var entries sync.Map
+
+// entry holds exponentially decayed counters of one channel. All counters are
+// decayed together, so averages derived from them weight recent requests more.
+type entry struct {
+	mu           sync.Mutex
+	success      float64
+	failure      float64
+	ttftSumMs    float64
+	ttftCount    float64
+	outputTokens float64
+	generationMs float64
+	updatedAt    time.Time
+}
+
+// Score is the live routing score of a channel.
+type Score struct {
+	ChannelId int `json:"channel_id"`
+	// Requests is the decayed number of recent requests.
+	Requests    float64 `json:"requests"`
+	SuccessRate float64 `json:"success_rate"`
+	AvgTtftMs   float64 `json:"avg_ttft_ms"`
+	AvgTps      float64 `json:"avg_tps"`
+	// Factor is the multiplier applied to the channel's weight, relative to
+	// the other channels it was scored with.
+	Factor    float64 `json:"factor"`
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+func Enabled() bool {
+	return operation_setting.GetAdaptiveRoutingSetting().Enabled
+}
+
+func halfLife() time.Duration {
+	return time.Duration(operation_setting.GetAdaptiveRoutingHalfLifeSeconds()) * time.Second
+}
+
+func getEntry(channelId int) *entry {
+	actual, _ := entries.LoadOrStore(channelId, &entry{})
+	return actual.(*entry)
+}
+
+// decayFactor returns how much of a value recorded at from is left at now.
+func decayFactor(from time.Time, now time.Time, halfLife time.Duration) float64 {
+	if from.IsZero() || !now.After(from) {
+		return 1
+	}
+	return math.Exp2(-now.Sub(from).Seconds() / halfLife.Seconds())
+}
+
+// decayTo ages the counters to now. Caller must hold e.mu.
+func (e *entry) decayTo(now time.Time) {
+	f := decayFactor(e.updatedAt, now, halfLife())
+	e.success *= f
+	e.failure *= f
+	e.ttftSumMs *= f
+	e.ttftCount *= f
+	e.outputTokens *= f
+	e.generationMs *= f
+	e.updatedAt = now
+}
+
+// RecordSuccess records a successful request served by the channel.
+func RecordSuccess(channelId int, ttftMs int64, hasTtft bool, outputTokens int64, generationMs int64) {
+	if channelId <= 0 {
+		return
+	}
+	e := getEntry(channelId)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.decayTo(time.Now())
+	e.success++
+	if hasTtft && ttftMs >= 0 {
+		e.ttftSumMs += float64(ttftMs)
+		e.ttftCount++
+	}
+	if outputTokens > 0 && generationMs > 0 {
+		e.outputTokens += float64(outputTokens)
+		e.generationMs += float64(generationMs)
+	}
+}
+
+// RecordFailure records a request attempt that failed because of the channel.
+func RecordFailure(channelId int) {
+	if channelId <= 0 {
+		return
+	}
+	e := getEntry(channelId)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.decayTo(time.Now())
+	e.failure++
+}
+
+func snapshot(channelId int, now time.Time) Score {
+	score := Score{ChannelId: channelId, Factor: 1}
+	value, ok := entries.Load(channelId)
+	if !ok {
+		return score
+	}
+	e := value.(*entry)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f := decayFactor(e.updatedAt, now, halfLife())
+	score.Requests = (e.success + e.failure) * f
+	if e.success+e.failure > 0 {
+		score.SuccessRate = e.success / (e.success + e.failure)
+	}
+	if e.ttftCount > 0 {
+		score.AvgTtftMs = e.ttftSumMs / e.ttftCount
+	}
+	if e.generationMs > 0 {
+		score.AvgTps = e.outputTokens / (e.generationMs / 1000)
+	}
+	score.UpdatedAt = e.updatedAt.Unix()
+	return score
+}
+
+// Scores returns the scores of the given channels, with factors computed
+// relative to each other. Time to first token and throughput are compared
+// with the best channel of the set, the success rate is absolute.
+func Scores(channelIds []int) []Score {
+	setting := operation_setting.GetAdaptiveRoutingSetting()
+	now := time.Now()
+	scores := make([]Score, len(channelIds))
+	bestTtft, bestTps := 0.0, 0.0
+	for i, channelId := range channelIds {
+		scores[i] = snapshot(channelId, now)
+		if scores[i].Requests < setting.MinSamples {
+			continue
+		}
+		if scores[i].AvgTtftMs > 0 && (bestTtft == 0 || scores[i].AvgTtftMs < bestTtft) {
+			bestTtft = scores[i].AvgTtftMs
+		}
+		if scores[i].AvgTps > bestTps {
+			bestTps = scores[i].AvgTps
+		}
+	}
+	for i := range scores {
+		scores[i].Factor = factor(&scores[i], bestTtft, bestTps, setting)
+	}
+	return scores
+}
+
+// Factors returns the weight multiplier of each channel, in order.
+func Factors(channelIds []int) []float64 {
+	scores := Scores(channelIds)
+	factors := make([]float64, len(scores))
+	for i, score := range scores {
+		factors[i] = score.Factor
+	}
+	return factors
+}
+
+func factor(score *Score, bestTtft float64, bestTps float64, setting *operation_setting.AdaptiveRoutingSetting) float64 {
+	if score.Requests == 0 || score.Requests < setting.MinSamples {
+		return 1
+	}
+	f := math.Pow(score.SuccessRate, max(setting.SuccessRateExponent, 0))
+	if score.AvgTtftMs > 0 && bestTtft > 0 {
+		f *= math.Pow(bestTtft/score.AvgTtftMs, max(setting.LatencyWeight, 0))
+	}
+	if score.AvgTps > 0 && bestTps > 0 {
+		f *= math.Pow(score.AvgTps/bestTps, max(setting.ThroughputWeight, 0))
+	}
+	return min(max(f, setting.MinFactor, 0.001), 1)
+}
+
+// TrackedChannelIds returns the ids of all channels that have a score.
+func TrackedChannelIds() []int {
+	ids := make([]int, 0)
+	entries.Range(func(key, _ any) bool {
+		ids = append(ids, key.(int))
+		return true
+	})
+	return ids
+}
+
+// Reset drops every score, so all channels fall back to their static weight.
+func Reset() {
+	entries.Clear()
+}
@@ -0,0 +1,104 @@
+package channelscore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func withAdaptiveRoutingSetting(t *testing.T, setting operation_setting.AdaptiveRoutingSetting) {
+	t.Helper()
+	current := operation_setting.GetAdaptiveRoutingSetting()
+	saved := *current
+	*current = setting
+	Reset()
+	t.Cleanup(func() {
+		*current = saved
+		Reset()
+	})
+}
+
+func defaultTestSetting() operation_setting.AdaptiveRoutingSetting {
+	return operation_setting.AdaptiveRoutingSetting{
+		Enabled:             true,
+		HalfLifeSeconds:     300,
+		MinSamples:          5,
+		MinFactor:           0.05,
+		SuccessRateExponent: 2,
+		LatencyWeight:       0.5,
+		ThroughputWeight:    0.5,
+	}
+}
+
+func TestFactorsKeepStaticWeightWithoutEnoughSamples(t *testing.T) {
+	withAdaptiveRoutingSetting(t, defaultTestSetting())
+
+	RecordFailure(1)
+	RecordFailure(1)
+
+	require.Equal(t, []float64{1, 1}, Factors([]int{1, 2}))
+}
+
+func TestFactorsPenalizeFlakyChannel(t *testing.T) {
+	withAdaptiveRoutingSetting(t, defaultTestSetting())
+
+	for i := 0; i < 10; i++ {
+		RecordSuccess(1, 0, false, 0, 0)
+		if i%2 == 0 {
+			RecordSuccess(2, 0, false, 0, 0)
+		} else {
+			RecordFailure(2)
+		}
+	}
+
+	factors := Factors([]int{1, 2})
+	require.Equal(t, 1.0, factors[0])
+	require.InDelta(t, 0.25, factors[1], 0.01)
+}
+
+func TestFactorsCompareLatencyAndThroughputWithinSet(t *testing.T) {
+	withAdaptiveRoutingSetting(t, defaultTestSetting())
+
+	for i := 0; i < 10; i++ {
+		RecordSuccess(1, 500, true, 100, 1000)
+		RecordSuccess(2, 2000, true, 25, 1000)
+	}
+
+	factors := Factors([]int{1, 2})
+	require.Equal(t, 1.0, factors[0])
+	// (500/2000)^0.5 * (25/100)^0.5
+	require.InDelta(t, 0.25, factors[1], 0.01)
+
+	// scored alone the slow channel is its own reference
+	require.Equal(t, []float64{1}, Factors([]int{2}))
+}
+
+func TestFactorsRespectMinFactor(t *testing.T) {
+	withAdaptiveRoutingSetting(t, defaultTestSetting())
+
+	for i := 0; i < 10; i++ {
+		RecordFailure(1)
+	}
+
+	require.Equal(t, []float64{0.05}, Factors([]int{1}))
+}
+
+func TestScoresDecayOverTime(t *testing.T) {
+	withAdaptiveRoutingSetting(t, defaultTestSetting())
+
+	for i := 0; i < 10; i++ {
+		RecordFailure(1)
+	}
+	value, _ := entries.Load(1)
+	e := value.(*entry)
+	e.mu.Lock()
+	e.updatedAt = e.updatedAt.Add(-10 * time.Minute)
+	e.mu.Unlock()
+
+	score := Scores([]int{1})[0]
+	require.InDelta(t, 2.5, score.Requests, 0.01)
+	// below MinSamples after two half-lives, the channel gets its weight back
+	require.Equal(t, 1.0, score.Factor)
+}
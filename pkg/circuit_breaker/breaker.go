@@ -0,0 +1,447 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	redisNamespace = "new-api:circuit_breaker:v1"
+	// redisOpenKey is a hash of target -> time the breaker opened (unix ms).
+	// A target missing from it is closed; an open target turns half-open once
+	// the open period has passed.
+	redisOpenKey = redisNamespace + ":open"
+	syncInterval = time.Second
+	// staleOpenAge drops open entries nobody probed for a long time, e.g.
+	// those of deleted channels.
+	staleOpenAge = 7 * 24 * time.Hour
+)
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// Target identifies a breaker: a whole channel, or one key of a multi-key
+// channel.
+type Target struct {
+	ChannelId int
+	KeyIndex  int
+}
+
+func ChannelTarget(channelId int) Target {
+	return Target{ChannelId: channelId, KeyIndex: -1}
+}
+
+func KeyTarget(channelId int, keyIndex int) Target {
+	return Target{ChannelId: channelId, KeyIndex: keyIndex}
+}
+
+func (t Target) String() string {
+	if t.KeyIndex < 0 {
+		return strconv.Itoa(t.ChannelId)
+	}
+	return fmt.Sprintf("%d:%d", t.ChannelId, t.KeyIndex)
+}
+
+func parseTarget(s string) (Target, bool) {
+	channelPart, keyPart, hasKey := strings.Cut(s, ":")
+	channelId, err := strconv.Atoi(channelPart)
+	if err != nil {
+		return Target{}, false
+	}
+	if !hasKey {
+		return ChannelTarget(channelId), true
+	}
+	keyIndex, err := strconv.Atoi(keyPart)
+	if err != nil {
+		return Target{}, false
+	}
+	return KeyTarget(channelId, keyIndex), true
+}
+
+// Status is the state of a breaker that is not closed.
+type Status struct {
+	ChannelId int   `json:"channel_id"`
+	KeyIndex  int   `json:"key_index"`
+	State     State `json:"state"`
+	OpenedAt  int64 `json:"opened_at"`
+}
+
+// counter tracks the results of a closed breaker on this node. Only state
+// changes are shared through Redis, so nodes trip independently but all of
+// them honor an open breaker.
+type counter struct {
+	mu          sync.Mutex
+	consecutive int
+	windowStart time.Time
+	total       int
+	failed      int
+}
+
+type halfOpenCounter struct {
+	values    map[string]int64
+	expiresAt time.Time
+}
+
+var (
+	counters sync.Map
+
+	openMu     sync.RWMutex
+	openStates = map[string]int64{}
+	lastSync   atomic.Int64
+	syncing    atomic.Bool
+
+	// half-open probe counters used when Redis is disabled
+	halfOpenMu       sync.Mutex
+	halfOpenCounters = map[string]*halfOpenCounter{}
+)
+
+func enabled() bool {
+	return operation_setting.GetCircuitBreakerSetting().Enabled
+}
+
+func redisEnabled() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+func openDuration() time.Duration {
+	seconds := operation_setting.GetCircuitBreakerSetting().OpenSeconds
+	if seconds <= 0 {
+		seconds = 30
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func probeTimeout() time.Duration {
+	seconds := operation_setting.GetCircuitBreakerSetting().ProbeTimeoutSeconds
+	if seconds <= 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func halfOpenRedisKey(key string) string {
+	return redisNamespace + ":half_open:" + key
+}
+
+func stateOf(key string, now time.Time) (State, int64) {
+	refreshOpenStates(now)
+	openMu.RLock()
+	openedAt, ok := openStates[key]
+	openMu.RUnlock()
+	if !ok {
+		return StateClosed, 0
+	}
+	if now.UnixMilli()-openedAt < openDuration().Milliseconds() {
+		return StateOpen, openedAt
+	}
+	return StateHalfOpen, openedAt
+}
+
+// refreshOpenStates reloads the shared open states in the background at most
+// once per syncInterval, so selection never waits on Redis.
+func refreshOpenStates(now time.Time) {
+	if !redisEnabled() || now.UnixMilli()-lastSync.Load() < syncInterval.Milliseconds() {
+		return
+	}
+	if !syncing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer syncing.Store(false)
+		syncOpenStates()
+	}()
+}
+
+func syncOpenStates() {
+	now := time.Now()
+	lastSync.Store(now.UnixMilli())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	values, err := common.RDB.HGetAll(ctx, redisOpenKey).Result()
+	if err != nil {
+		common.SysError("failed to sync circuit breaker states: " + err.Error())
+		return
+	}
+	cutoff := now.Add(-staleOpenAge).UnixMilli()
+	states := make(map[string]int64, len(values))
+	var stale []string
+	for key, raw := range values {
+		openedAt, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || openedAt < cutoff {
+			stale = append(stale, key)
+			continue
+		}
+		states[key] = openedAt
+	}
+	openMu.Lock()
+	openStates = states
+	openMu.Unlock()
+	if len(stale) > 0 {
+		_ = common.RDB.HDel(ctx, redisOpenKey, stale...).Err()
+	}
+}
+
+// Allow reports whether the target may be considered for a request. Open
+// breakers are skipped; half-open ones are allowed, Acquire limits how many
+// probes they actually receive.
+func Allow(t Target) bool {
+	if !enabled() {
+		return true
+	}
+	state, _ := stateOf(t.String(), time.Now())
+	return state != StateOpen
+}
+
+// Acquire is called for the target chosen to serve a request. It always
+// succeeds for a closed breaker and admits a limited number of probes for a
+// half-open one.
+func Acquire(t Target) bool {
+	if !enabled() {
+		return true
+	}
+	key := t.String()
+	switch state, _ := stateOf(key, time.Now()); state {
+	case StateClosed:
+		return true
+	case StateOpen:
+		return false
+	}
+	maxProbes := max(operation_setting.GetCircuitBreakerSetting().HalfOpenMaxProbes, 1)
+	return incrHalfOpen(key, "probes") <= int64(maxProbes)
+}
+
+// RecordSuccess records a request the target served successfully.
+func RecordSuccess(t Target) {
+	if !enabled() {
+		return
+	}
+	key := t.String()
+	now := time.Now()
+	switch state, _ := stateOf(key, now); state {
+	case StateHalfOpen:
+		required := max(operation_setting.GetCircuitBreakerSetting().HalfOpenSuccesses, 1)
+		if incrHalfOpen(key, "successes") >= int64(required) {
+			closeTarget(key)
+		}
+		return
+	case StateOpen:
+		return
+	}
+	c := getCounter(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roll(now)
+	c.consecutive = 0
+	c.total++
+}
+
+// RecordFailure records a request that failed because of the target.
+func RecordFailure(t Target) {
+	if !enabled() {
+		return
+	}
+	key := t.String()
+	now := time.Now()
+	switch state, _ := stateOf(key, now); state {
+	case StateHalfOpen:
+		openTarget(key, now)
+		return
+	case StateOpen:
+		return
+	}
+	c := getCounter(key)
+	c.mu.Lock()
+	c.roll(now)
+	c.consecutive++
+	c.total++
+	c.failed++
+	trip := c.shouldTrip(operation_setting.GetCircuitBreakerSetting())
+	if trip {
+		c.reset(now)
+	}
+	c.mu.Unlock()
+	if trip {
+		openTarget(key, now)
+	}
+}
+
+func getCounter(key string) *counter {
+	actual, _ := counters.LoadOrStore(key, &counter{})
+	return actual.(*counter)
+}
+
+// roll starts a new error rate window when the current one has ended.
+// Caller must hold c.mu.
+func (c *counter) roll(now time.Time) {
+	seconds := operation_setting.GetCircuitBreakerSetting().WindowSeconds
+	if seconds <= 0 {
+		seconds = 60
+	}
+	if now.Sub(c.windowStart) >= time.Duration(seconds)*time.Second {
+		c.windowStart = now
+		c.total = 0
+		c.failed = 0
+	}
+}
+
+func (c *counter) reset(now time.Time) {
+	c.consecutive = 0
+	c.windowStart = now
+	c.total = 0
+	c.failed = 0
+}
+
+func (c *counter) shouldTrip(setting *operation_setting.CircuitBreakerSetting) bool {
+	if setting.ConsecutiveFailures > 0 && c.consecutive >= setting.ConsecutiveFailures {
+		return true
+	}
+	if setting.ErrorRateThreshold <= 0 || c.total < max(setting.MinRequests, 1) {
+		return false
+	}
+	return float64(c.failed)/float64(c.total) >= setting.ErrorRateThreshold
+}
+
+func openTarget(key string, now time.Time) {
+	openedAt := now.UnixMilli()
+	openMu.Lock()
+	openStates[key] = openedAt
+	openMu.Unlock()
+	resetHalfOpen(key)
+	common.SysLog(fmt.Sprintf("circuit breaker opened: %s", key))
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pipe := common.RDB.TxPipeline()
+	pipe.HSet(ctx, redisOpenKey, key, openedAt)
+	pipe.Del(ctx, halfOpenRedisKey(key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError(fmt.Sprintf("failed to share circuit breaker state %s: %s", key, err.Error()))
+	}
+}
+
+func closeTarget(key string) {
+	openMu.Lock()
+	delete(openStates, key)
+	openMu.Unlock()
+	counters.Delete(key)
+	resetHalfOpen(key)
+	common.SysLog(fmt.Sprintf("circuit breaker closed: %s", key))
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pipe := common.RDB.TxPipeline()
+	pipe.HDel(ctx, redisOpenKey, key)
+	pipe.Del(ctx, halfOpenRedisKey(key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError(fmt.Sprintf("failed to share circuit breaker state %s: %s", key, err.Error()))
+	}
+}
+
+// incrHalfOpen increments a counter of the current half-open period. The
+// counters expire probeTimeout after their last update, which frees probe
+// slots of requests that never reported back.
+func incrHalfOpen(key string, field string) int64 {
+	timeout := probeTimeout()
+	if redisEnabled() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		pipe := common.RDB.TxPipeline()
+		incr := pipe.HIncrBy(ctx, halfOpenRedisKey(key), field, 1)
+		pipe.Expire(ctx, halfOpenRedisKey(key), timeout)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("failed to update circuit breaker probe %s: %s", key, err.Error()))
+			return 1
+		}
+		return incr.Val()
+	}
+	now := time.Now()
+	halfOpenMu.Lock()
+	defer halfOpenMu.Unlock()
+	c, ok := halfOpenCounters[key]
+	if !ok || now.After(c.expiresAt) {
+		c = &halfOpenCounter{values: map[string]int64{}}
+		halfOpenCounters[key] = c
+	}
+	c.expiresAt = now.Add(timeout)
+	c.values[field]++
+	return c.values[field]
+}
+
+func resetHalfOpen(key string) {
+	halfOpenMu.Lock()
+	delete(halfOpenCounters, key)
+	halfOpenMu.Unlock()
+}
+
+// Statuses returns every breaker that is open or half-open.
+func Statuses() []Status {
+	if redisEnabled() {
+		syncOpenStates()
+	}
+	now := time.Now()
+	openMu.RLock()
+	keys := make([]string, 0, len(openStates))
+	for key := range openStates {
+		keys = append(keys, key)
+	}
+	openMu.RUnlock()
+
+	statuses := make([]Status, 0, len(keys))
+	for _, key := range keys {
+		target, ok := parseTarget(key)
+		if !ok {
+			continue
+		}
+		state, openedAt := stateOf(key, now)
+		if state == StateClosed {
+			continue
+		}
+		statuses = append(statuses, Status{
+			ChannelId: target.ChannelId,
+			KeyIndex:  target.KeyIndex,
+			State:     state,
+			OpenedAt:  openedAt / 1000,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].ChannelId != statuses[j].ChannelId {
+			return statuses[i].ChannelId < statuses[j].ChannelId
+		}
+		return statuses[i].KeyIndex < statuses[j].KeyIndex
+	})
+	return statuses
+}
+
+// ResetChannel closes the breakers of a channel and all of its keys.
+func ResetChannel(channelId int) {
+	for _, status := range Statuses() {
+		if status.ChannelId == channelId {
+			closeTarget(Target{ChannelId: status.ChannelId, KeyIndex: status.KeyIndex}.String())
+		}
+	}
+}
+
+// ResetAll closes every breaker.
+func ResetAll() {
+	for _, status := range Statuses() {
+		closeTarget(Target{ChannelId: status.ChannelId, KeyIndex: status.KeyIndex}.String())
+	}
+}
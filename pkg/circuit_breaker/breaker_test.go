@@ -0,0 +1,142 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func withCircuitBreakerSetting(t *testing.T, setting operation_setting.CircuitBreakerSetting) {
+	t.Helper()
+	current := operation_setting.GetCircuitBreakerSetting()
+	saved := *current
+	*current = setting
+	ResetAll()
+	counters.Clear()
+	t.Cleanup(func() {
+		*current = saved
+		ResetAll()
+		counters.Clear()
+	})
+}
+
+func testSetting() operation_setting.CircuitBreakerSetting {
+	return operation_setting.CircuitBreakerSetting{
+		Enabled:             true,
+		ConsecutiveFailures: 3,
+		ErrorRateThreshold:  0.5,
+		MinRequests:         10,
+		WindowSeconds:       60,
+		OpenSeconds:         30,
+		HalfOpenMaxProbes:   2,
+		HalfOpenSuccesses:   2,
+		ProbeTimeoutSeconds: 60,
+	}
+}
+
+// expireOpenPeriod moves the opening of a breaker back so it is half-open.
+func expireOpenPeriod(t Target) {
+	openMu.Lock()
+	openStates[t.String()] -= time.Minute.Milliseconds()
+	openMu.Unlock()
+}
+
+func TestBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	withCircuitBreakerSetting(t, testSetting())
+	target := ChannelTarget(1001)
+
+	RecordFailure(target)
+	RecordFailure(target)
+	RecordSuccess(target)
+	RecordFailure(target)
+	RecordFailure(target)
+	require.True(t, Allow(target), "success resets the consecutive count")
+
+	RecordFailure(target)
+	require.False(t, Allow(target))
+	require.False(t, Acquire(target))
+}
+
+func TestBreakerTripsOnErrorRate(t *testing.T) {
+	setting := testSetting()
+	setting.ConsecutiveFailures = 0
+	withCircuitBreakerSetting(t, setting)
+	target := KeyTarget(1002, 3)
+
+	for i := 0; i < 4; i++ {
+		RecordSuccess(target)
+		RecordFailure(target)
+	}
+	require.True(t, Allow(target), "below MinRequests")
+
+	RecordSuccess(target)
+	RecordFailure(target)
+	require.False(t, Allow(target))
+	require.True(t, Allow(KeyTarget(1002, 4)), "other keys are unaffected")
+	require.True(t, Allow(ChannelTarget(1002)))
+}
+
+func TestBreakerHalfOpenLimitsProbesAndCloses(t *testing.T) {
+	withCircuitBreakerSetting(t, testSetting())
+	target := ChannelTarget(1003)
+	for i := 0; i < 3; i++ {
+		RecordFailure(target)
+	}
+	expireOpenPeriod(target)
+
+	require.True(t, Allow(target))
+	require.True(t, Acquire(target))
+	require.True(t, Acquire(target))
+	require.False(t, Acquire(target), "probe limit reached")
+
+	RecordSuccess(target)
+	require.Equal(t, StateHalfOpen, Statuses()[0].State)
+	RecordSuccess(target)
+	require.Empty(t, Statuses())
+	require.True(t, Acquire(target))
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	withCircuitBreakerSetting(t, testSetting())
+	target := ChannelTarget(1004)
+	for i := 0; i < 3; i++ {
+		RecordFailure(target)
+	}
+	expireOpenPeriod(target)
+	require.True(t, Acquire(target))
+
+	RecordFailure(target)
+
+	require.False(t, Allow(target))
+	ResetChannel(1004)
+	require.True(t, Allow(target))
+}
+
+func TestBreakerDisabledAllowsEverything(t *testing.T) {
+	setting := testSetting()
+	setting.Enabled = false
+	withCircuitBreakerSetting(t, setting)
+	target := ChannelTarget(1005)
+
+	for i := 0; i < 10; i++ {
+		RecordFailure(target)
+	}
+
+	require.True(t, Allow(target))
+	require.True(t, Acquire(target))
+}
+
+func TestParseTarget(t *testing.T) {
+	target, ok := parseTarget(KeyTarget(7, 2).String())
+	require.True(t, ok)
+	require.Equal(t, KeyTarget(7, 2), target)
+
+	target, ok = parseTarget(ChannelTarget(7).String())
+	require.True(t, ok)
+	require.Equal(t, ChannelTarget(7), target)
+
+	_, ok = parseTarget("x:1")
+	require.False(t, ok)
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"net/http"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	channelscore "github.com/QuantumNous/new-api/pkg/channel_score"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/perf_metrics_setting"
 )
@@ -42,6 +45,12 @@ func RecordRelaySample(info *relaycommon.RelayInfo, success bool, outputTokens i
 	if generationMs <= 0 {
 		generationMs = latencyMs
 	}
+	// failed attempts are scored per channel by the relay retry loop, this
+	// final sample only knows the last channel
+	if success && info.ChannelMeta != nil && !info.ResponseCacheHit {
+		channelscore.RecordSuccess(info.ChannelId, ttftMs, hasTtft, outputTokens, generationMs)
+	}
+	recordPrometheus(info, success, latencyMs, ttftMs, hasTtft, outputTokens, generationMs)
 	Record(Sample{
 		Model:        info.OriginModelName,
 		Group:        info.UsingGroup,
@@ -54,6 +63,33 @@ func RecordRelaySample(info *relaycommon.RelayInfo, success bool, outputTokens i
 	})
 }
 
+// recordPrometheus exports the sample regardless of the perf metrics
+// setting, labelled with the channel the request ended on.
+func recordPrometheus(info *relaycommon.RelayInfo, success bool, latencyMs, ttftMs int64, hasTtft bool, outputTokens, generationMs int64) {
+	statusCode := http.StatusOK
+	if !success {
+		statusCode = http.StatusInternalServerError
+		if info.LastError != nil && info.LastError.StatusCode > 0 {
+			statusCode = info.LastError.StatusCode
+		}
+	}
+	channelId := 0
+	if info.ChannelMeta != nil && !info.ResponseCacheHit {
+		channelId = info.ChannelId
+	}
+	prommetrics.RecordRelay(prommetrics.RelaySample{
+		Model:        info.OriginModelName,
+		Group:        info.UsingGroup,
+		ChannelId:    channelId,
+		StatusCode:   statusCode,
+		LatencyMs:    latencyMs,
+		TtftMs:       ttftMs,
+		HasTtft:      hasTtft,
+		OutputTokens: outputTokens,
+		GenerationMs: generationMs,
+	})
+}
+
 func Record(sample Sample) {
 	setting := perf_metrics_setting.GetSetting()
 	if !setting.Enabled || sample.Model == "" {
@@ -0,0 +1,230 @@
+package prommetrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "new_api"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Relay requests by model, group, final channel and response status code.",
+	}, []string{"model", "group", "channel", "status"})
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Time from receiving a relay request until the upstream response finished.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "group", "channel"})
+
+	relayTtft = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_time_to_first_token_seconds",
+		Help:      "Time until the first byte of a streaming response was sent to the client.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30},
+	}, []string{"model", "group", "channel"})
+
+	relayOutputTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_output_tokens_total",
+		Help:      "Output tokens generated by successful relay requests.",
+	}, []string{"model", "group", "channel"})
+
+	relayThroughput = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_output_tokens_per_second",
+		Help:      "Output token throughput of successful relay requests after the first token.",
+		Buckets:   []float64{5, 10, 20, 40, 60, 80, 100, 150, 200, 400},
+	}, []string{"model", "group", "channel"})
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_retries_total",
+		Help:      "Additional channel attempts made for relay requests.",
+	}, []string{"model", "group"})
+
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_consumed_total",
+		Help:      "Quota billed to users, in quota units.",
+	}, []string{"model", "group"})
+
+	tokensConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_consumed_total",
+		Help:      "Tokens billed to users by type.",
+	}, []string{"model", "group", "type"})
+
+	channelAutoDisabled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "channel_auto_disabled_total",
+		Help:      "Channels or multi-key channel keys disabled automatically after upstream errors.",
+	}, []string{"channel"})
+
+	cacheLookupsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "cache_lookups_total"),
+		"Lookups of hybrid caches by namespace and result.",
+		[]string{"cache", "result"}, nil,
+	)
+
+	systemTaskQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "system_task_queue_depth"),
+		"System tasks waiting or running, by type and status.",
+		[]string{"type", "status"}, nil,
+	)
+)
+
+// SystemTaskCount is the number of system tasks of a type in a status.
+type SystemTaskCount struct {
+	Type   string
+	Status string
+	Count  int64
+}
+
+var (
+	systemTaskSourceMu sync.RWMutex
+	systemTaskSource   func() ([]SystemTaskCount, error)
+)
+
+// SetSystemTaskSource sets the function queried for the system task queue
+// depth on every scrape.
+func SetSystemTaskSource(source func() ([]SystemTaskCount, error)) {
+	systemTaskSourceMu.Lock()
+	systemTaskSource = source
+	systemTaskSourceMu.Unlock()
+}
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayDuration,
+		relayTtft,
+		relayOutputTokens,
+		relayThroughput,
+		relayRetries,
+		quotaConsumed,
+		tokensConsumed,
+		channelAutoDisabled,
+		scrapeCollector{},
+	)
+}
+
+// Handler serves the metrics in the Prometheus text or OpenMetrics format,
+// depending on what the scraper accepts. A collector failing, e.g. the
+// system task query, drops its own metrics but not the rest of the scrape.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		ErrorHandling:     promhttp.ContinueOnError,
+	})
+}
+
+// RelaySample is the outcome of one relay request.
+type RelaySample struct {
+	Model        string
+	Group        string
+	ChannelId    int
+	StatusCode   int
+	LatencyMs    int64
+	TtftMs       int64
+	HasTtft      bool
+	OutputTokens int64
+	GenerationMs int64
+}
+
+func RecordRelay(sample RelaySample) {
+	if sample.Group == "" {
+		sample.Group = "default"
+	}
+	channel := channelLabel(sample.ChannelId)
+	relayRequests.WithLabelValues(sample.Model, sample.Group, channel, strconv.Itoa(sample.StatusCode)).Inc()
+	if sample.StatusCode != http.StatusOK {
+		return
+	}
+	relayDuration.WithLabelValues(sample.Model, sample.Group, channel).Observe(float64(sample.LatencyMs) / 1000)
+	if sample.HasTtft {
+		relayTtft.WithLabelValues(sample.Model, sample.Group, channel).Observe(float64(sample.TtftMs) / 1000)
+	}
+	if sample.OutputTokens > 0 {
+		relayOutputTokens.WithLabelValues(sample.Model, sample.Group, channel).Add(float64(sample.OutputTokens))
+		if sample.GenerationMs > 0 {
+			tps := float64(sample.OutputTokens) * 1000 / float64(sample.GenerationMs)
+			relayThroughput.WithLabelValues(sample.Model, sample.Group, channel).Observe(tps)
+		}
+	}
+}
+
+func RecordRetries(model string, group string, retries int) {
+	if retries <= 0 {
+		return
+	}
+	relayRetries.WithLabelValues(model, group).Add(float64(retries))
+}
+
+func RecordConsume(model string, group string, quota int, promptTokens int, completionTokens int) {
+	if quota > 0 {
+		quotaConsumed.WithLabelValues(model, group).Add(float64(quota))
+	}
+	if promptTokens > 0 {
+		tokensConsumed.WithLabelValues(model, group, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		tokensConsumed.WithLabelValues(model, group, "completion").Add(float64(completionTokens))
+	}
+}
+
+func RecordChannelAutoDisabled(channelId int) {
+	channelAutoDisabled.WithLabelValues(channelLabel(channelId)).Inc()
+}
+
+func channelLabel(channelId int) string {
+	if channelId <= 0 {
+		return ""
+	}
+	return strconv.Itoa(channelId)
+}
+
+// scrapeCollector reports the values read from elsewhere at scrape time.
+type scrapeCollector struct{}
+
+func (scrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheLookupsDesc
+	ch <- systemTaskQueueDesc
+}
+
+func (scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range cachex.Stats() {
+		ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stats.Hits), stats.Namespace, "hit")
+		ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stats.Misses), stats.Namespace, "miss")
+	}
+
+	systemTaskSourceMu.RLock()
+	source := systemTaskSource
+	systemTaskSourceMu.RUnlock()
+	if source == nil {
+		return
+	}
+	counts, err := source()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(systemTaskQueueDesc, err)
+		return
+	}
+	for _, count := range counts {
+		ch <- prometheus.MustNewConstMetric(systemTaskQueueDesc, prometheus.GaugeValue, float64(count.Count), count.Type, count.Status)
+	}
+}
@@ -0,0 +1,81 @@
+package prommetrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/samber/hot"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestRecordRelayExportsRequestsAndLatency(t *testing.T) {
+	RecordRelay(RelaySample{
+		Model:        "metrics-test-model",
+		ChannelId:    7,
+		StatusCode:   http.StatusOK,
+		LatencyMs:    1500,
+		TtftMs:       300,
+		HasTtft:      true,
+		OutputTokens: 120,
+		GenerationMs: 1200,
+	})
+	RecordRelay(RelaySample{
+		Model:      "metrics-test-model",
+		Group:      "vip",
+		StatusCode: http.StatusTooManyRequests,
+	})
+	RecordRetries("metrics-test-model", "vip", 2)
+
+	body := scrape(t)
+	require.Contains(t, body, `new_api_relay_requests_total{channel="7",group="default",model="metrics-test-model",status="200"} 1`)
+	require.Contains(t, body, `new_api_relay_requests_total{channel="",group="vip",model="metrics-test-model",status="429"} 1`)
+	require.Contains(t, body, `new_api_relay_output_tokens_total{channel="7",group="default",model="metrics-test-model"} 120`)
+	require.Contains(t, body, `new_api_relay_time_to_first_token_seconds_count{channel="7",group="default",model="metrics-test-model"} 1`)
+	require.Contains(t, body, `new_api_relay_output_tokens_per_second_sum{channel="7",group="default",model="metrics-test-model"} 100`)
+	require.Contains(t, body, `new_api_relay_retries_total{group="vip",model="metrics-test-model"} 2`)
+	require.NotContains(t, body, `new_api_relay_request_duration_seconds_count{channel="",group="vip"`, "failed requests have no latency sample")
+}
+
+func TestScrapeCollectsCacheAndSystemTaskGauges(t *testing.T) {
+	cache := cachex.NewHybridCache[int](cachex.HybridCacheConfig[int]{
+		Namespace: "metrics_test:v1",
+		Memory: func() *hot.HotCache[string, int] {
+			return hot.NewHotCache[string, int](hot.LRU, 10).Build()
+		},
+	})
+	require.NoError(t, cache.SetWithTTL("a", 1, 0))
+	_, _, _ = cache.Get("a")
+	_, _, _ = cache.Get("b")
+
+	SetSystemTaskSource(func() ([]SystemTaskCount, error) {
+		return []SystemTaskCount{{Type: "log_cleanup", Status: "pending", Count: 3}}, nil
+	})
+	t.Cleanup(func() { SetSystemTaskSource(nil) })
+
+	body := scrape(t)
+	require.Contains(t, body, `new_api_cache_lookups_total{cache="metrics_test:v1",result="hit"} 1`)
+	require.Contains(t, body, `new_api_cache_lookups_total{cache="metrics_test:v1",result="miss"} 1`)
+	require.Contains(t, body, `new_api_system_task_queue_depth{status="pending",type="log_cleanup"} 3`)
+
+	SetSystemTaskSource(func() ([]SystemTaskCount, error) {
+		return nil, errors.New("db down")
+	})
+	body = scrape(t)
+	require.NotContains(t, body, "new_api_system_task_queue_depth{")
+	require.Contains(t, body, `new_api_cache_lookups_total{cache="metrics_test:v1",result="hit"} 1`)
+}
@@ -0,0 +1,199 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+var (
+	active     atomic.Pointer[activeTracer]
+	propagator = propagation.TraceContext{}
+)
+
+type activeTracer struct {
+	trace.Tracer
+}
+
+// Config configures the OTLP trace export.
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces URL, e.g. http://collector:4318/v1/traces.
+	// Empty falls back to the OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string
+	// SampleRatio is the fraction of new traces recorded, between 0 and 1.
+	// Requests arriving with a sampled traceparent are always recorded.
+	SampleRatio    float64
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Init starts exporting spans and returns the function flushing the pending
+// ones on shutdown.
+func Init(config Config) (func(context.Context) error, error) {
+	exporterOptions := make([]otlptracehttp.Option, 0, 1)
+	if config.Endpoint != "" {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(config.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.ServiceName),
+		attribute.String("service.version", config.ServiceVersion),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	setTracerProvider(provider)
+	return func(ctx context.Context) error {
+		setTracerProvider(nil)
+		return provider.Shutdown(ctx)
+	}, nil
+}
+
+// setTracerProvider switches span creation to provider, or off when nil.
+func setTracerProvider(provider trace.TracerProvider) {
+	if provider == nil {
+		active.Store(nil)
+		return
+	}
+	active.Store(&activeTracer{Tracer: provider.Tracer(tracerName)})
+}
+
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// StartRequest starts the root span of a request, continuing the trace of
+// the client when it sent a traceparent header. The span context replaces
+// the request context, so stage spans started later become its children.
+func StartRequest(c *gin.Context, name string, attrs ...attribute.KeyValue) *Span {
+	tracer := active.Load()
+	if tracer == nil {
+		return nil
+	}
+	ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return &Span{ctx: ctx, span: span}
+}
+
+// StartSpan starts a span for a stage of the request in c. It returns nil
+// when tracing is disabled or the request has no root span, e.g. on routes
+// outside the relay; all methods of a nil *Span are no-ops.
+func StartSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) *Span {
+	if c == nil || c.Request == nil {
+		return nil
+	}
+	span := StartSpanContext(c.Request.Context(), name, attrs...)
+	if span != nil {
+		span.c = c
+	}
+	return span
+}
+
+// StartSpanContext is StartSpan for code that has no gin context but holds
+// the request context.
+func StartSpanContext(ctx context.Context, name string, attrs ...attribute.KeyValue) *Span {
+	tracer := active.Load()
+	if tracer == nil || ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return &Span{ctx: ctx, span: span}
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" when the trace
+// is not recorded.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsSampled() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// Span is a span of one request stage.
+type Span struct {
+	c        *gin.Context
+	ctx      context.Context
+	span     trace.Span
+	endOnce  sync.Once
+	errorSet bool
+}
+
+// Context returns the context holding the span.
+func (s *Span) Context() context.Context {
+	if s == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *Span) SetAttributes(attrs ...attribute.KeyValue) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.errorSet = true
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// Inject writes the traceparent of the span into header.
+func (s *Span) Inject(header http.Header) {
+	if s == nil {
+		return
+	}
+	propagator.Inject(s.ctx, propagation.HeaderCarrier(header))
+}
+
+// End ends the span. A span started from a gin context whose request was
+// aborted with an error status is marked as failed. Calling End again has
+// no effect, so a deferred End may follow an explicit one.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.endOnce.Do(func() {
+		if s.c != nil && !s.errorSet && s.c.IsAborted() && s.c.Writer.Status() >= http.StatusBadRequest {
+			s.span.SetStatus(codes.Error, http.StatusText(s.c.Writer.Status()))
+		}
+		s.span.End()
+	})
+}
+
+// EndWithError sets err, if any, and ends the span.
+func (s *Span) EndWithError(err error) {
+	s.SetError(err)
+	s.End()
+}
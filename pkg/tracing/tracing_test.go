@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	setTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { setTracerProvider(nil) })
+	return recorder
+}
+
+func newTestContext(header http.Header) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	for key, values := range header {
+		c.Request.Header[key] = values
+	}
+	return c
+}
+
+func TestSpansAreNoopWhenDisabled(t *testing.T) {
+	c := newTestContext(nil)
+	require.Nil(t, StartRequest(c, "root"))
+	span := StartSpan(c, "stage")
+	require.Nil(t, span)
+	span.SetError(errors.New("ignored"))
+	span.End()
+	require.Empty(t, TraceID(c.Request.Context()))
+}
+
+func TestStageSpansNeedRootSpan(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	c := newTestContext(nil)
+	require.Nil(t, StartSpan(c, "stage"), "requests outside the relay are not traced")
+
+	root := StartRequest(c, "root")
+	require.NotNil(t, root)
+	stage := StartSpan(c, "stage")
+	stage.EndWithError(errors.New("upstream failed"))
+	stage.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "stage", spans[0].Name())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Equal(t, spans[1].SpanContext().TraceID().String(), TraceID(c.Request.Context()))
+}
+
+func TestStartRequestContinuesClientTrace(t *testing.T) {
+	withSpanRecorder(t)
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	c := newTestContext(header)
+
+	root := StartRequest(c, "root")
+	defer root.End()
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(root.Context()))
+
+	upstream := StartSpan(c, "upstream")
+	defer upstream.End()
+	outgoing := http.Header{}
+	upstream.Inject(outgoing)
+	require.Regexp(t, `^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$`, outgoing.Get("traceparent"))
+	require.NotContains(t, outgoing.Get("traceparent"), "00f067aa0ba902b7")
+}
+
+func TestAbortedStageIsMarkedFailed(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	c := newTestContext(nil)
+	root := StartRequest(c, "root")
+	span := StartSpan(c, "token_auth")
+	c.AbortWithStatus(http.StatusUnauthorized)
+	span.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+}
@@ -13,6 +13,7 @@ import (
 
 	common2 "github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -23,6 +24,7 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // applyUpstreamContentLength populates req.ContentLength when the upstream
@@ -485,6 +487,10 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	} else {
 		client = service.GetHttpClient()
 	}
+	// 对冲请求的上游请求随落败的尝试一起取消
+	if service.IsHedgeAttempt(c) {
+		req = req.WithContext(c.Request.Context())
+	}
 
 	var stopPinger context.CancelFunc
 	var pingerDone <-chan struct{}
@@ -506,14 +512,30 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	span := tracing.StartSpan(c, "upstream_request",
+		attribute.Int("channel_id", info.ChannelId),
+		attribute.Int("channel_type", info.ChannelType),
+		attribute.String("upstream_model", info.UpstreamModelName),
+		attribute.String("server.address", req.URL.Host),
+	)
+	defer span.End()
+	if info.ChannelOtherSettings.PropagateTraceContext {
+		span.Inject(req.Header)
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
+		span.SetError(err)
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetError(fmt.Errorf("upstream status %d", resp.StatusCode))
+	}
 
 	if upID := resp.Header.Get(common2.RequestIdKey); upID != "" {
 		c.Set(common2.UpstreamRequestIdKey, upID)
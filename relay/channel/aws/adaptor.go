@@ -25,12 +25,25 @@ const (
 	ClientModeAKSK
 )
 
+// RequestMode is the Bedrock API a request is relayed through.
+type RequestMode int
+
+const (
+	// RequestModeClaude relays Anthropic Messages requests through InvokeModel.
+	RequestModeClaude RequestMode = iota
+	// RequestModeConverse relays chat for other model families through
+	// Converse and ConverseStream.
+	RequestModeConverse
+	RequestModeEmbedding
+	RequestModeImage
+)
+
 type Adaptor struct {
-	ClientMode ClientMode
-	AwsClient  *bedrockruntime.Client
-	AwsModelId string
-	AwsReq     any
-	IsNova     bool
+	ClientMode  ClientMode
+	RequestMode RequestMode
+	AwsClient   *bedrockruntime.Client
+	AwsModelId  string
+	AwsReq      any
 }
 
 func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
@@ -81,8 +94,8 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	a.RequestMode = RequestModeImage
+	return convertToImageRequests(getAwsModelID(info.UpstreamModelName), request)
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
@@ -115,11 +128,10 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
-		novaReq := convertToNovaRequest(request)
-		a.IsNova = true
-		return novaReq, nil
+	// Claude 以外的模型（Nova、Llama、Mistral 等）走 Converse API
+	if !isClaudeModel(request.Model) {
+		a.RequestMode = RequestModeConverse
+		return convertToConverseRequest(c, request)
 	}
 
 	// 原有的Claude模型处理逻辑
@@ -140,17 +152,30 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	a.RequestMode = RequestModeEmbedding
+	return convertToEmbeddingRequests(getAwsModelID(info.UpstreamModelName), request)
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	if !isClaudeModel(request.Model) {
+		return nil, fmt.Errorf("responses API is only supported for Anthropic models on Bedrock, got %s", request.Model)
+	}
+	result, err := service.ConvertRequest(c, info, types.RelayFormatClaude, &request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert responses request to claude request")
+	}
+	claudeReq, ok := result.Value.(*dto.ClaudeRequest)
+	if !ok {
+		return nil, fmt.Errorf("expected Anthropic Messages request, got %T", result.Value)
+	}
+	info.UpstreamModelName = claudeReq.Model
+	return claudeReq, nil
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
-	if a.ClientMode == ClientModeApiKey {
+	// Bedrock API keys also work with the SDK client, which is the only way
+	// to reach Converse, embeddings and image models.
+	if a.ClientMode == ClientModeApiKey && a.RequestMode == RequestModeClaude {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
 		return doAwsClientRequest(c, info, a, requestBody)
@@ -158,18 +183,25 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
-	if a.ClientMode == ClientModeApiKey {
+	switch {
+	case a.RequestMode == RequestModeConverse:
+		if info.IsStream {
+			err, usage = converseStreamHandler(c, info, a)
+		} else {
+			err, usage = converseHandler(c, info, a)
+		}
+	case a.RequestMode == RequestModeEmbedding:
+		err, usage = awsEmbeddingHandler(c, info, a)
+	case a.RequestMode == RequestModeImage:
+		err, usage = awsImageHandler(c, info, a)
+	case a.ClientMode == ClientModeApiKey:
 		claudeAdaptor := claude.Adaptor{}
 		usage, err = claudeAdaptor.DoResponse(c, resp, info)
-	} else {
-		if a.IsNova {
-			err, usage = handleNovaRequest(c, info, a)
+	default:
+		if info.IsStream {
+			err, usage = awsStreamHandler(c, info, a)
 		} else {
-			if info.IsStream {
-				err, usage = awsStreamHandler(c, info, a)
-			} else {
-				err, usage = awsHandler(c, info, a)
-			}
+			err, usage = awsHandler(c, info, a)
 		}
 	}
 	return
@@ -29,6 +29,20 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Converse models
+	"llama3-3-70b-instruct-v1:0":        "meta.llama3-3-70b-instruct-v1:0",
+	"llama4-maverick-17b-instruct-v1:0": "meta.llama4-maverick-17b-instruct-v1:0",
+	"mistral-large-2407-v1:0":           "mistral.mistral-large-2407-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2:0":        "amazon.titan-embed-text-v2:0",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
+	// Image generation models
+	"titan-image-generator-v2:0": "amazon.titan-image-generator-v2:0",
+	"stable-image-core-v1:1":     "stability.stable-image-core-v1:1",
+	"stable-image-ultra-v1:1":    "stability.stable-image-ultra-v1:1",
+	"sd3-5-large-v1:0":           "stability.sd3-5-large-v1:0",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -145,6 +159,12 @@ var awsModelCanCrossRegionMap = map[string]map[string]bool{
 		"eu":   true,
 		"apac": true,
 	},
+	"meta.llama3-3-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-maverick-17b-instruct-v1:0": {
+		"us": true,
+	},
 }
 
 var awsRegionCrossModelPrefixMap = map[string]string{
@@ -155,7 +175,8 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 
 var ChannelName = "aws"
 
-// 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
-	return strings.Contains(modelId, "nova-")
+// 判断是否为 Claude 模型，其余模型走 Converse API
+func isClaudeModel(model string) bool {
+	awsModelId := getAwsModelID(model)
+	return strings.Contains(awsModelId, "anthropic.") || strings.Contains(awsModelId, "claude")
 }
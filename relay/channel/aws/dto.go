@@ -56,91 +56,161 @@ func formatRequest(requestBody io.Reader, requestHeader http.Header) (*AwsClaude
 	return &awsClaudeRequest, nil
 }
 
-// NovaMessage Nova模型使用messages-v1格式
-type NovaMessage struct {
-	Role    string        `json:"role"`
-	Content []NovaContent `json:"content"`
+// ConverseRequest is the body of a Bedrock Converse request, in the JSON shape
+// of the Converse REST API. The model id and stream flag travel separately.
+type ConverseRequest struct {
+	Messages                     []ConverseMessage        `json:"messages"`
+	System                       []ConverseSystemBlock    `json:"system,omitempty"`
+	InferenceConfig              *ConverseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig                   *ConverseToolConfig      `json:"toolConfig,omitempty"`
+	AdditionalModelRequestFields map[string]any           `json:"additionalModelRequestFields,omitempty"`
 }
 
-type NovaContent struct {
+type ConverseMessage struct {
+	Role    string                 `json:"role"`
+	Content []ConverseContentBlock `json:"content"`
+}
+
+type ConverseSystemBlock struct {
 	Text string `json:"text"`
 }
 
-type NovaRequest struct {
-	SchemaVersion   string               `json:"schemaVersion"`             // 请求版本，例如 "1.0"
-	Messages        []NovaMessage        `json:"messages"`                  // 对话消息列表
-	InferenceConfig *NovaInferenceConfig `json:"inferenceConfig,omitempty"` // 推理配置，可选
+// ConverseContentBlock is a union: exactly one field is set.
+type ConverseContentBlock struct {
+	Text       *string                  `json:"text,omitempty"`
+	Image      *ConverseImageBlock      `json:"image,omitempty"`
+	ToolUse    *ConverseToolUseBlock    `json:"toolUse,omitempty"`
+	ToolResult *ConverseToolResultBlock `json:"toolResult,omitempty"`
 }
 
-type NovaInferenceConfig struct {
-	MaxTokens     int      `json:"maxTokens,omitempty"`     // 最大生成的 token 数
-	Temperature   float64  `json:"temperature,omitempty"`   // 随机性 (默认 0.7, 范围 0-1)
-	TopP          float64  `json:"topP,omitempty"`          // nucleus sampling (默认 0.9, 范围 0-1)
-	TopK          int      `json:"topK,omitempty"`          // 限制候选 token 数 (默认 50, 范围 0-128)
-	StopSequences []string `json:"stopSequences,omitempty"` // 停止生成的序列
+type ConverseImageBlock struct {
+	// Format is one of png, jpeg, gif and webp.
+	Format string              `json:"format"`
+	Source ConverseImageSource `json:"source"`
 }
 
-// 转换OpenAI请求为Nova格式
-func convertToNovaRequest(req *dto.GeneralOpenAIRequest) *NovaRequest {
-	novaMessages := make([]NovaMessage, len(req.Messages))
-	for i, msg := range req.Messages {
-		novaMessages[i] = NovaMessage{
-			Role:    msg.Role,
-			Content: []NovaContent{{Text: msg.StringContent()}},
-		}
-	}
+type ConverseImageSource struct {
+	Bytes []byte `json:"bytes"`
+}
 
-	novaReq := &NovaRequest{
-		SchemaVersion: "messages-v1",
-		Messages:      novaMessages,
-	}
+type ConverseToolUseBlock struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input"`
+}
 
-	// 设置推理配置
-	if (req.MaxTokens != nil && *req.MaxTokens != 0) || (req.Temperature != nil && *req.Temperature != 0) || (req.TopP != nil && *req.TopP != 0) || (req.TopK != nil && *req.TopK != 0) || req.Stop != nil {
-		novaReq.InferenceConfig = &NovaInferenceConfig{}
-		if req.MaxTokens != nil && *req.MaxTokens != 0 {
-			novaReq.InferenceConfig.MaxTokens = int(*req.MaxTokens)
-		}
-		if req.Temperature != nil && *req.Temperature != 0 {
-			novaReq.InferenceConfig.Temperature = *req.Temperature
-		}
-		if req.TopP != nil && *req.TopP != 0 {
-			novaReq.InferenceConfig.TopP = *req.TopP
-		}
-		if req.TopK != nil && *req.TopK != 0 {
-			novaReq.InferenceConfig.TopK = *req.TopK
-		}
-		if req.Stop != nil {
-			if stopSequences := parseStopSequences(req.Stop); len(stopSequences) > 0 {
-				novaReq.InferenceConfig.StopSequences = stopSequences
-			}
-		}
-	}
+type ConverseToolResultBlock struct {
+	ToolUseId string                      `json:"toolUseId"`
+	Content   []ConverseToolResultContent `json:"content"`
+}
 
-	return novaReq
+type ConverseToolResultContent struct {
+	Text string `json:"text"`
 }
 
-// parseStopSequences 解析停止序列，支持字符串或字符串数组
-func parseStopSequences(stop any) []string {
-	if stop == nil {
-		return nil
-	}
+type ConverseInferenceConfig struct {
+	MaxTokens     *int32   `json:"maxTokens,omitempty"`
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
 
-	switch v := stop.(type) {
-	case string:
-		if v != "" {
-			return []string{v}
-		}
-	case []string:
-		return v
-	case []interface{}:
-		var sequences []string
-		for _, item := range v {
-			if str, ok := item.(string); ok && str != "" {
-				sequences = append(sequences, str)
-			}
-		}
-		return sequences
-	}
-	return nil
+type ConverseToolConfig struct {
+	Tools      []ConverseTool      `json:"tools"`
+	ToolChoice *ConverseToolChoice `json:"toolChoice,omitempty"`
+}
+
+type ConverseTool struct {
+	ToolSpec ConverseToolSpec `json:"toolSpec"`
+}
+
+type ConverseToolSpec struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	InputSchema ConverseToolInputSchema `json:"inputSchema"`
+}
+
+type ConverseToolInputSchema struct {
+	Json any `json:"json"`
+}
+
+// ConverseToolChoice is a union: exactly one field is set.
+type ConverseToolChoice struct {
+	Auto *struct{}               `json:"auto,omitempty"`
+	Any  *struct{}               `json:"any,omitempty"`
+	Tool *ConverseToolChoiceTool `json:"tool,omitempty"`
+}
+
+type ConverseToolChoiceTool struct {
+	Name string `json:"name"`
+}
+
+// TitanEmbeddingRequest is the InvokeModel body of Amazon Titan text
+// embedding models, which embed one text per call.
+type TitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions *int   `json:"dimensions,omitempty"`
+	Normalize  *bool  `json:"normalize,omitempty"`
+}
+
+type TitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+// CohereEmbeddingRequest is the InvokeModel body of Cohere embedding models.
+type CohereEmbeddingRequest struct {
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	Truncate        string   `json:"truncate,omitempty"`
+	EmbeddingTypes  []string `json:"embedding_types,omitempty"`
+	OutputDimension *int     `json:"output_dimension,omitempty"`
+}
+
+// CohereEmbeddingResponse carries the embeddings either as a plain list or,
+// when embedding_types is set, keyed by type.
+type CohereEmbeddingResponse struct {
+	Embeddings json.RawMessage `json:"embeddings"`
+}
+
+// TitanImageRequest is the InvokeModel body of Amazon Titan Image Generator
+// and Nova Canvas text-to-image requests.
+type TitanImageRequest struct {
+	TaskType              string                 `json:"taskType"`
+	TextToImageParams     TitanTextToImageParams `json:"textToImageParams"`
+	ImageGenerationConfig TitanImageConfig       `json:"imageGenerationConfig"`
+}
+
+type TitanTextToImageParams struct {
+	Text         string `json:"text"`
+	NegativeText string `json:"negativeText,omitempty"`
+}
+
+type TitanImageConfig struct {
+	NumberOfImages int     `json:"numberOfImages"`
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	Quality        string  `json:"quality,omitempty"`
+	CfgScale       float64 `json:"cfgScale,omitempty"`
+	Seed           *int    `json:"seed,omitempty"`
+}
+
+type TitanImageResponse struct {
+	Images []string `json:"images"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// StabilityImageRequest is the InvokeModel body of Stability AI image models
+// on Bedrock, which generate one image per call.
+type StabilityImageRequest struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	OutputFormat   string `json:"output_format,omitempty"`
+	Seed           *int   `json:"seed,omitempty"`
+}
+
+type StabilityImageResponse struct {
+	Images        []string  `json:"images"`
+	FinishReasons []*string `json:"finish_reasons"`
 }
@@ -0,0 +1,540 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// convertToConverseRequest converts an OpenAI chat request into a Converse
+// request. Converse requires alternating user and assistant turns, so tool
+// results and consecutive messages of the same role are merged into one turn.
+func convertToConverseRequest(c *gin.Context, request *dto.GeneralOpenAIRequest) (*ConverseRequest, error) {
+	converseReq := &ConverseRequest{
+		Messages: make([]ConverseMessage, 0, len(request.Messages)),
+	}
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				converseReq.System = append(converseReq.System, ConverseSystemBlock{Text: text})
+			}
+		case "tool":
+			converseReq.Messages = appendConverseMessage(converseReq.Messages, "user", ConverseContentBlock{
+				ToolResult: &ConverseToolResultBlock{
+					ToolUseId: message.ToolCallId,
+					Content:   []ConverseToolResultContent{{Text: message.StringContent()}},
+				},
+			})
+		case "assistant":
+			blocks, err := converseContentBlocks(c, &message)
+			if err != nil {
+				return nil, err
+			}
+			for _, toolCall := range message.ParseToolCalls() {
+				var input any = map[string]any{}
+				if toolCall.Function.Arguments != "" {
+					if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &input); err != nil {
+						return nil, fmt.Errorf("invalid arguments of tool call %s: %w", toolCall.ID, err)
+					}
+				}
+				blocks = append(blocks, ConverseContentBlock{
+					ToolUse: &ConverseToolUseBlock{ToolUseId: toolCall.ID, Name: toolCall.Function.Name, Input: input},
+				})
+			}
+			converseReq.Messages = appendConverseMessage(converseReq.Messages, "assistant", blocks...)
+		default:
+			blocks, err := converseContentBlocks(c, &message)
+			if err != nil {
+				return nil, err
+			}
+			converseReq.Messages = appendConverseMessage(converseReq.Messages, "user", blocks...)
+		}
+	}
+
+	inferenceConfig := &ConverseInferenceConfig{}
+	maxTokens := request.GetMaxTokens()
+	if maxTokens > 0 {
+		inferenceConfig.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if request.Temperature != nil {
+		inferenceConfig.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != nil {
+		inferenceConfig.TopP = aws.Float32(float32(*request.TopP))
+	}
+	inferenceConfig.StopSequences = parseStopSequences(request.Stop)
+	if inferenceConfig.MaxTokens != nil || inferenceConfig.Temperature != nil || inferenceConfig.TopP != nil || len(inferenceConfig.StopSequences) > 0 {
+		converseReq.InferenceConfig = inferenceConfig
+	}
+
+	toolConfig, err := converseToolConfig(request.Tools, request.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+	converseReq.ToolConfig = toolConfig
+	return converseReq, nil
+}
+
+func converseContentBlocks(c *gin.Context, message *dto.Message) ([]ConverseContentBlock, error) {
+	if message.IsStringContent() {
+		text := message.StringContent()
+		if text == "" {
+			return nil, nil
+		}
+		return []ConverseContentBlock{{Text: &text}}, nil
+	}
+	blocks := make([]ConverseContentBlock, 0)
+	for _, part := range message.ParseContent() {
+		switch part.Type {
+		case dto.ContentTypeText:
+			if part.Text != "" {
+				text := part.Text
+				blocks = append(blocks, ConverseContentBlock{Text: &text})
+			}
+		case dto.ContentTypeImageURL:
+			source := part.ToFileSource()
+			if source == nil {
+				continue
+			}
+			base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting image for Bedrock Converse")
+			if err != nil {
+				return nil, fmt.Errorf("get file base64 from url failed: %s", err.Error())
+			}
+			data, err := base64.StdEncoding.DecodeString(base64Data)
+			if err != nil {
+				return nil, fmt.Errorf("decode image base64 failed: %s", err.Error())
+			}
+			blocks = append(blocks, ConverseContentBlock{
+				Image: &ConverseImageBlock{
+					Format: converseImageFormat(mimeType),
+					Source: ConverseImageSource{Bytes: data},
+				},
+			})
+		}
+	}
+	return blocks, nil
+}
+
+func converseImageFormat(mimeType string) string {
+	format := strings.TrimPrefix(strings.ToLower(mimeType), "image/")
+	if format == "jpg" {
+		return "jpeg"
+	}
+	return format
+}
+
+func appendConverseMessage(messages []ConverseMessage, role string, blocks ...ConverseContentBlock) []ConverseMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if len(messages) > 0 && messages[len(messages)-1].Role == role {
+		last := &messages[len(messages)-1]
+		last.Content = append(last.Content, blocks...)
+		return messages
+	}
+	return append(messages, ConverseMessage{Role: role, Content: blocks})
+}
+
+// converseToolConfig converts OpenAI tools and tool_choice. Converse has no
+// way to forbid tool use, so tool_choice none drops the tools instead.
+func converseToolConfig(tools []dto.ToolCallRequest, toolChoice any) (*ConverseToolConfig, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	toolConfig := &ConverseToolConfig{Tools: make([]ConverseTool, 0, len(tools))}
+	for _, tool := range tools {
+		if tool.Type != "" && tool.Type != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported by Bedrock Converse", tool.Type)
+		}
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		toolConfig.Tools = append(toolConfig.Tools, ConverseTool{
+			ToolSpec: ConverseToolSpec{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				InputSchema: ConverseToolInputSchema{Json: schema},
+			},
+		})
+	}
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "none":
+			return nil, nil
+		case "required":
+			toolConfig.ToolChoice = &ConverseToolChoice{Any: &struct{}{}}
+		case "auto":
+			toolConfig.ToolChoice = &ConverseToolChoice{Auto: &struct{}{}}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name := common.Interface2String(function["name"]); name != "" {
+				toolConfig.ToolChoice = &ConverseToolChoice{Tool: &ConverseToolChoiceTool{Name: name}}
+			}
+		}
+	}
+	return toolConfig, nil
+}
+
+func (r *ConverseRequest) sdkMessages() []bedrockruntimeTypes.Message {
+	messages := make([]bedrockruntimeTypes.Message, 0, len(r.Messages))
+	for _, message := range r.Messages {
+		content := make([]bedrockruntimeTypes.ContentBlock, 0, len(message.Content))
+		for _, block := range message.Content {
+			switch {
+			case block.Text != nil:
+				content = append(content, &bedrockruntimeTypes.ContentBlockMemberText{Value: *block.Text})
+			case block.Image != nil:
+				content = append(content, &bedrockruntimeTypes.ContentBlockMemberImage{Value: bedrockruntimeTypes.ImageBlock{
+					Format: bedrockruntimeTypes.ImageFormat(block.Image.Format),
+					Source: &bedrockruntimeTypes.ImageSourceMemberBytes{Value: block.Image.Source.Bytes},
+				}})
+			case block.ToolUse != nil:
+				content = append(content, &bedrockruntimeTypes.ContentBlockMemberToolUse{Value: bedrockruntimeTypes.ToolUseBlock{
+					ToolUseId: aws.String(block.ToolUse.ToolUseId),
+					Name:      aws.String(block.ToolUse.Name),
+					Input:     document.NewLazyDocument(block.ToolUse.Input),
+				}})
+			case block.ToolResult != nil:
+				results := make([]bedrockruntimeTypes.ToolResultContentBlock, 0, len(block.ToolResult.Content))
+				for _, result := range block.ToolResult.Content {
+					results = append(results, &bedrockruntimeTypes.ToolResultContentBlockMemberText{Value: result.Text})
+				}
+				content = append(content, &bedrockruntimeTypes.ContentBlockMemberToolResult{Value: bedrockruntimeTypes.ToolResultBlock{
+					ToolUseId: aws.String(block.ToolResult.ToolUseId),
+					Content:   results,
+				}})
+			}
+		}
+		messages = append(messages, bedrockruntimeTypes.Message{
+			Role:    bedrockruntimeTypes.ConversationRole(message.Role),
+			Content: content,
+		})
+	}
+	return messages
+}
+
+func (r *ConverseRequest) sdkSystem() []bedrockruntimeTypes.SystemContentBlock {
+	if len(r.System) == 0 {
+		return nil
+	}
+	system := make([]bedrockruntimeTypes.SystemContentBlock, 0, len(r.System))
+	for _, block := range r.System {
+		system = append(system, &bedrockruntimeTypes.SystemContentBlockMemberText{Value: block.Text})
+	}
+	return system
+}
+
+func (r *ConverseRequest) sdkInferenceConfig() *bedrockruntimeTypes.InferenceConfiguration {
+	if r.InferenceConfig == nil {
+		return nil
+	}
+	return &bedrockruntimeTypes.InferenceConfiguration{
+		MaxTokens:     r.InferenceConfig.MaxTokens,
+		Temperature:   r.InferenceConfig.Temperature,
+		TopP:          r.InferenceConfig.TopP,
+		StopSequences: r.InferenceConfig.StopSequences,
+	}
+}
+
+func (r *ConverseRequest) sdkToolConfig() *bedrockruntimeTypes.ToolConfiguration {
+	if r.ToolConfig == nil {
+		return nil
+	}
+	toolConfig := &bedrockruntimeTypes.ToolConfiguration{
+		Tools: make([]bedrockruntimeTypes.Tool, 0, len(r.ToolConfig.Tools)),
+	}
+	for _, tool := range r.ToolConfig.Tools {
+		spec := bedrockruntimeTypes.ToolSpecification{
+			Name:        aws.String(tool.ToolSpec.Name),
+			InputSchema: &bedrockruntimeTypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(tool.ToolSpec.InputSchema.Json)},
+		}
+		if tool.ToolSpec.Description != "" {
+			spec.Description = aws.String(tool.ToolSpec.Description)
+		}
+		toolConfig.Tools = append(toolConfig.Tools, &bedrockruntimeTypes.ToolMemberToolSpec{Value: spec})
+	}
+	if choice := r.ToolConfig.ToolChoice; choice != nil {
+		switch {
+		case choice.Tool != nil:
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberTool{Value: bedrockruntimeTypes.SpecificToolChoice{Name: aws.String(choice.Tool.Name)}}
+		case choice.Any != nil:
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAny{Value: bedrockruntimeTypes.AnyToolChoice{}}
+		case choice.Auto != nil:
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAuto{Value: bedrockruntimeTypes.AutoToolChoice{}}
+		}
+	}
+	return toolConfig
+}
+
+func (r *ConverseRequest) sdkAdditionalFields() document.Interface {
+	if len(r.AdditionalModelRequestFields) == 0 {
+		return nil
+	}
+	return document.NewLazyDocument(r.AdditionalModelRequestFields)
+}
+
+func (r *ConverseRequest) toConverseInput(modelId string) *bedrockruntime.ConverseInput {
+	return &bedrockruntime.ConverseInput{
+		ModelId:                      aws.String(modelId),
+		Messages:                     r.sdkMessages(),
+		System:                       r.sdkSystem(),
+		InferenceConfig:              r.sdkInferenceConfig(),
+		ToolConfig:                   r.sdkToolConfig(),
+		AdditionalModelRequestFields: r.sdkAdditionalFields(),
+	}
+}
+
+func (r *ConverseRequest) toConverseStreamInput(modelId string) *bedrockruntime.ConverseStreamInput {
+	return &bedrockruntime.ConverseStreamInput{
+		ModelId:                      aws.String(modelId),
+		Messages:                     r.sdkMessages(),
+		System:                       r.sdkSystem(),
+		InferenceConfig:              r.sdkInferenceConfig(),
+		ToolConfig:                   r.sdkToolConfig(),
+		AdditionalModelRequestFields: r.sdkAdditionalFields(),
+	}
+}
+
+func converseStopReasonToOpenAI(reason bedrockruntimeTypes.StopReason) string {
+	switch reason {
+	case bedrockruntimeTypes.StopReasonToolUse:
+		return constant.FinishReasonToolCalls
+	case bedrockruntimeTypes.StopReasonMaxTokens, bedrockruntimeTypes.StopReasonModelContextWindowExceeded:
+		return constant.FinishReasonLength
+	case bedrockruntimeTypes.StopReasonContentFiltered, bedrockruntimeTypes.StopReasonGuardrailIntervened:
+		return constant.FinishReasonContentFilter
+	default:
+		return constant.FinishReasonStop
+	}
+}
+
+// converseUsageToOpenAI converts Converse token usage. Converse counts cache
+// reads and writes apart from InputTokens, while OpenAI prompt tokens include
+// them.
+func converseUsageToOpenAI(tokenUsage *bedrockruntimeTypes.TokenUsage) *dto.Usage {
+	usage := &dto.Usage{}
+	if tokenUsage == nil {
+		return usage
+	}
+	cacheRead := int(aws.ToInt32(tokenUsage.CacheReadInputTokens))
+	cacheWrite := int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+	usage.PromptTokens = int(aws.ToInt32(tokenUsage.InputTokens)) + cacheRead + cacheWrite
+	usage.CompletionTokens = int(aws.ToInt32(tokenUsage.OutputTokens))
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.PromptTokensDetails.CachedTokens = cacheRead
+	usage.PromptTokensDetails.CachedCreationTokens = cacheWrite
+	return usage
+}
+
+func converseToolInputString(input document.Interface) string {
+	if input == nil {
+		return "{}"
+	}
+	data, err := input.MarshalSmithyDocument()
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+
+	awsResp, err := a.AwsClient.Converse(ctx, a.AwsReq.(*bedrockruntime.ConverseInput))
+	if err != nil {
+		statusCode := getAwsErrorStatusCode(err)
+		return types.NewOpenAIError(errors.Wrap(err, "Converse"), types.ErrorCodeAwsInvokeError, statusCode), nil
+	}
+
+	message := dto.Message{Role: "assistant"}
+	var text, reasoning strings.Builder
+	toolCalls := make([]dto.ToolCallResponse, 0)
+	if output, ok := awsResp.Output.(*bedrockruntimeTypes.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *bedrockruntimeTypes.ContentBlockMemberText:
+				text.WriteString(v.Value)
+			case *bedrockruntimeTypes.ContentBlockMemberReasoningContent:
+				if reasoningText, ok := v.Value.(*bedrockruntimeTypes.ReasoningContentBlockMemberReasoningText); ok {
+					reasoning.WriteString(aws.ToString(reasoningText.Value.Text))
+				}
+			case *bedrockruntimeTypes.ContentBlockMemberToolUse:
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: converseToolInputString(v.Value.Input),
+					},
+				})
+			}
+		}
+	}
+	message.SetStringContent(text.String())
+	if reasoning.Len() > 0 {
+		reasoningContent := reasoning.String()
+		message.ReasoningContent = &reasoningContent
+	}
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+
+	usage := converseUsageToOpenAI(awsResp.Usage)
+	response := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseStopReasonToOpenAI(awsResp.StopReason),
+		}},
+		Usage: *usage,
+	}
+	c.JSON(200, response)
+	return nil, usage
+}
+
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+
+	awsResp, err := a.AwsClient.ConverseStream(ctx, a.AwsReq.(*bedrockruntime.ConverseStreamInput))
+	if err != nil {
+		statusCode := getAwsErrorStatusCode(err)
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, statusCode), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+	id := helper.GetResponseID(c)
+	created := common.GetTimestamp()
+	model := info.UpstreamModelName
+	usage := &dto.Usage{}
+	finishReason := constant.FinishReasonStop
+	// Converse numbers every content block; OpenAI numbers tool calls only.
+	toolCallIndexes := make(map[int32]int)
+
+	sendDelta := func(delta dto.ChatCompletionsStreamResponseChoiceDelta) {
+		response := dto.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: 0, Delta: delta}},
+		}
+		if err := helper.ObjectData(c, response); err != nil {
+			common.SysLog("send converse stream chunk failed: " + err.Error())
+		}
+	}
+
+	for event := range stream.Events() {
+		info.SetFirstResponseTime()
+		switch v := event.(type) {
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStart:
+			sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"})
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStart:
+			toolUse, ok := v.Value.Start.(*bedrockruntimeTypes.ContentBlockStartMemberToolUse)
+			if !ok {
+				continue
+			}
+			index := len(toolCallIndexes)
+			toolCallIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = index
+			sendDelta(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{{
+				Index: &index,
+				ID:    aws.ToString(toolUse.Value.ToolUseId),
+				Type:  "function",
+				Function: dto.FunctionResponse{
+					Name: aws.ToString(toolUse.Value.Name),
+				},
+			}}})
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockDelta:
+			var delta dto.ChatCompletionsStreamResponseChoiceDelta
+			switch d := v.Value.Delta.(type) {
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberText:
+				delta.SetContentString(d.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberReasoningContent:
+				reasoningText, ok := d.Value.(*bedrockruntimeTypes.ReasoningContentBlockDeltaMemberText)
+				if !ok {
+					continue
+				}
+				delta.SetReasoningContent(reasoningText.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberToolUse:
+				index, ok := toolCallIndexes[aws.ToInt32(v.Value.ContentBlockIndex)]
+				if !ok {
+					continue
+				}
+				delta.ToolCalls = []dto.ToolCallResponse{{
+					Index:    &index,
+					Function: dto.FunctionResponse{Arguments: aws.ToString(d.Value.Input)},
+				}}
+			default:
+				continue
+			}
+			sendDelta(delta)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStop:
+			finishReason = converseStopReasonToOpenAI(v.Value.StopReason)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMetadata:
+			usage = converseUsageToOpenAI(v.Value.Usage)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, getAwsErrorStatusCode(err)), nil
+	}
+
+	if stop := helper.GenerateStopResponse(id, created, model, finishReason); stop != nil {
+		_ = helper.ObjectData(c, stop)
+	}
+	if final := helper.GenerateFinalUsageResponse(id, created, model, *usage); final != nil {
+		_ = helper.ObjectData(c, final)
+	}
+	helper.Done(c)
+	return nil, usage
+}
+
+// parseStopSequences 解析停止序列，支持字符串或字符串数组
+func parseStopSequences(stop any) []string {
+	if stop == nil {
+		return nil
+	}
+
+	switch v := stop.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []interface{}:
+		var sequences []string
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				sequences = append(sequences, str)
+			}
+		}
+		return sequences
+	}
+	return nil
+}
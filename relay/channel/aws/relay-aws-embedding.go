@@ -0,0 +1,145 @@
+package aws
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+func isTitanEmbeddingModel(awsModelId string) bool {
+	return strings.Contains(awsModelId, "amazon.titan-embed")
+}
+
+func isCohereEmbeddingModel(awsModelId string) bool {
+	return strings.Contains(awsModelId, "cohere.embed")
+}
+
+// convertToEmbeddingRequests returns the InvokeModel bodies that embed the
+// input: one per text for Titan, one for all texts for Cohere.
+func convertToEmbeddingRequests(awsModelId string, request dto.EmbeddingRequest) (any, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	switch {
+	case isTitanEmbeddingModel(awsModelId):
+		requests := make([]TitanEmbeddingRequest, 0, len(inputs))
+		for _, input := range inputs {
+			titanReq := TitanEmbeddingRequest{InputText: input}
+			// Titan v1 has a fixed output size
+			if !strings.Contains(awsModelId, "titan-embed-text-v1") {
+				titanReq.Dimensions = request.Dimensions
+			}
+			requests = append(requests, titanReq)
+		}
+		return requests, nil
+	case isCohereEmbeddingModel(awsModelId):
+		inputType := request.InputType
+		if inputType == "" {
+			inputType = "search_document"
+		}
+		cohereReq := CohereEmbeddingRequest{
+			Texts:          inputs,
+			InputType:      inputType,
+			EmbeddingTypes: []string{"float"},
+		}
+		if strings.Contains(awsModelId, "embed-v4") {
+			cohereReq.OutputDimension = request.Dimensions
+		}
+		return []CohereEmbeddingRequest{cohereReq}, nil
+	default:
+		return nil, errors.Errorf("embedding model %s is not supported on Bedrock, use a Titan or Cohere embedding model", awsModelId)
+	}
+}
+
+// invokeModelInputTokens reads the input token count Bedrock reports in a
+// response header of every InvokeModel call.
+func invokeModelInputTokens(output *bedrockruntime.InvokeModelOutput) int {
+	rawResp, ok := awsmiddleware.GetRawResponse(output.ResultMetadata).(*smithyhttp.Response)
+	if !ok || rawResp == nil {
+		return 0
+	}
+	tokens, _ := strconv.Atoi(rawResp.Header.Get("X-Amzn-Bedrock-Input-Token-Count"))
+	return tokens
+}
+
+func parseCohereEmbeddings(body []byte) ([][]float64, error) {
+	var cohereResp CohereEmbeddingResponse
+	if err := common.Unmarshal(body, &cohereResp); err != nil {
+		return nil, err
+	}
+	var byType struct {
+		Float [][]float64 `json:"float"`
+	}
+	if err := common.Unmarshal(cohereResp.Embeddings, &byType); err == nil {
+		return byType.Float, nil
+	}
+	var embeddings [][]float64
+	if err := common.Unmarshal(cohereResp.Embeddings, &embeddings); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+
+	response := dto.EmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.EmbeddingResponseItem, 0),
+		Model:  info.UpstreamModelName,
+	}
+	for _, awsReq := range a.AwsReq.([]*bedrockruntime.InvokeModelInput) {
+		awsResp, err := a.AwsClient.InvokeModel(ctx, awsReq)
+		if err != nil {
+			statusCode := getAwsErrorStatusCode(err)
+			return types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, statusCode), nil
+		}
+		info.SetFirstResponseTime()
+
+		var embeddings [][]float64
+		inputTokens := invokeModelInputTokens(awsResp)
+		if isTitanEmbeddingModel(a.AwsModelId) {
+			var titanResp TitanEmbeddingResponse
+			if err := common.Unmarshal(awsResp.Body, &titanResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal titan embedding response"), types.ErrorCodeBadResponseBody), nil
+			}
+			embeddings = [][]float64{titanResp.Embedding}
+			if titanResp.InputTextTokenCount > 0 {
+				inputTokens = titanResp.InputTextTokenCount
+			}
+		} else {
+			embeddings, err = parseCohereEmbeddings(awsResp.Body)
+			if err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal cohere embedding response"), types.ErrorCodeBadResponseBody), nil
+			}
+		}
+		for _, embedding := range embeddings {
+			response.Data = append(response.Data, dto.EmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     len(response.Data),
+				Embedding: embedding,
+			})
+		}
+		response.PromptTokens += inputTokens
+	}
+	if response.PromptTokens == 0 {
+		response.PromptTokens = info.GetEstimatePromptTokens()
+	}
+	response.TotalTokens = response.PromptTokens
+
+	c.JSON(http.StatusOK, response)
+	return nil, &response.Usage
+}
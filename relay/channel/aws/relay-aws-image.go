@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// stabilityAspectRatios are the aspect ratios Stability AI models on Bedrock
+// accept in place of a size.
+var stabilityAspectRatios = []string{"21:9", "16:9", "3:2", "5:4", "1:1", "4:5", "2:3", "9:16", "9:21"}
+
+func isTitanImageModel(awsModelId string) bool {
+	return strings.Contains(awsModelId, "amazon.titan-image") || strings.Contains(awsModelId, "amazon.nova-canvas")
+}
+
+func isStabilityImageModel(awsModelId string) bool {
+	return strings.Contains(awsModelId, "stability.")
+}
+
+// convertToImageRequests returns the InvokeModel bodies that generate the
+// requested images: one for all of them on Titan and Nova Canvas, one per
+// image on Stability AI models.
+func convertToImageRequests(awsModelId string, request dto.ImageRequest) (any, error) {
+	n := 1
+	if request.N != nil && *request.N > 0 {
+		n = int(*request.N)
+	}
+	switch {
+	case isTitanImageModel(awsModelId):
+		width, height, err := parseImageSize(request.Size)
+		if err != nil {
+			return nil, err
+		}
+		quality := "standard"
+		if request.Quality == "hd" || request.Quality == "high" {
+			quality = "premium"
+		}
+		return []TitanImageRequest{{
+			TaskType:          "TEXT_IMAGE",
+			TextToImageParams: TitanTextToImageParams{Text: request.Prompt},
+			ImageGenerationConfig: TitanImageConfig{
+				NumberOfImages: n,
+				Width:          width,
+				Height:         height,
+				Quality:        quality,
+			},
+		}}, nil
+	case isStabilityImageModel(awsModelId):
+		width, height, err := parseImageSize(request.Size)
+		if err != nil {
+			return nil, err
+		}
+		stabilityReq := StabilityImageRequest{
+			Prompt:       request.Prompt,
+			AspectRatio:  closestAspectRatio(width, height),
+			OutputFormat: "png",
+		}
+		requests := make([]StabilityImageRequest, n)
+		for i := range requests {
+			requests[i] = stabilityReq
+		}
+		return requests, nil
+	default:
+		return nil, errors.Errorf("image model %s is not supported on Bedrock, use a Titan, Nova Canvas or Stability AI model", awsModelId)
+	}
+}
+
+// parseImageSize parses an OpenAI size such as 1024x1024, defaulting to a
+// square image.
+func parseImageSize(size string) (int, int, error) {
+	if size == "" || size == "auto" {
+		return 1024, 1024, nil
+	}
+	widthText, heightText, ok := strings.Cut(size, "x")
+	width, widthErr := strconv.Atoi(widthText)
+	height, heightErr := strconv.Atoi(heightText)
+	if !ok || widthErr != nil || heightErr != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid image size %q, expected WIDTHxHEIGHT", size)
+	}
+	return width, height, nil
+}
+
+func closestAspectRatio(width int, height int) string {
+	target := math.Log(float64(width) / float64(height))
+	closest := "1:1"
+	closestDistance := math.Inf(1)
+	for _, ratio := range stabilityAspectRatios {
+		w, h, _ := strings.Cut(ratio, ":")
+		rw, _ := strconv.ParseFloat(w, 64)
+		rh, _ := strconv.ParseFloat(h, 64)
+		if distance := math.Abs(math.Log(rw/rh) - target); distance < closestDistance {
+			closest = ratio
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+func awsImageHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+
+	response := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    make([]dto.ImageData, 0),
+	}
+	for _, awsReq := range a.AwsReq.([]*bedrockruntime.InvokeModelInput) {
+		awsResp, err := a.AwsClient.InvokeModel(ctx, awsReq)
+		if err != nil {
+			statusCode := getAwsErrorStatusCode(err)
+			return types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, statusCode), nil
+		}
+		info.SetFirstResponseTime()
+
+		var images []string
+		if isStabilityImageModel(a.AwsModelId) {
+			var stabilityResp StabilityImageResponse
+			if err := common.Unmarshal(awsResp.Body, &stabilityResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal stability image response"), types.ErrorCodeBadResponseBody), nil
+			}
+			// 图片被过滤时 finish_reasons 给出原因
+			for _, reason := range stabilityResp.FinishReasons {
+				if reason != nil {
+					return types.NewOpenAIError(errors.New(*reason), types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest), nil
+				}
+			}
+			images = stabilityResp.Images
+		} else {
+			var titanResp TitanImageResponse
+			if err := common.Unmarshal(awsResp.Body, &titanResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal titan image response"), types.ErrorCodeBadResponseBody), nil
+			}
+			if titanResp.Error != "" {
+				return types.NewOpenAIError(errors.New(titanResp.Error), types.ErrorCodeBadResponse, http.StatusBadRequest), nil
+			}
+			images = titanResp.Images
+		}
+		for _, image := range images {
+			response.Data = append(response.Data, dto.ImageData{B64Json: image})
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+	return nil, &dto.Usage{}
+}
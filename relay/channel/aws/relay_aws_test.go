@@ -7,8 +7,11 @@ import (
 	"testing"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 )
@@ -53,3 +56,118 @@ func TestDoAwsClientRequest_AppliesRuntimeHeaderOverrideToAnthropicBeta(t *testi
 	require.True(t, ok)
 	require.Equal(t, []any{"computer-use-2025-01-24"}, values)
 }
+
+func TestConvertOpenAIRequest_UsesConverseForNonClaudeModels(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	assistant := dto.Message{Role: "assistant", Content: "checking"}
+	assistant.SetToolCalls([]dto.ToolCallRequest{{
+		ID:       "call_1",
+		Type:     "function",
+		Function: dto.FunctionRequest{Name: "lookup", Arguments: `{"q":"x"}`},
+	}})
+	request := &dto.GeneralOpenAIRequest{
+		Model: "llama3-3-70b-instruct-v1:0",
+		Messages: []dto.Message{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "hi"},
+			assistant,
+			{Role: "tool", ToolCallId: "call_1", Content: "found"},
+			{Role: "user", Content: "thanks"},
+		},
+		Tools: []dto.ToolCallRequest{{
+			Type:     "function",
+			Function: dto.FunctionRequest{Name: "lookup", Parameters: map[string]any{"type": "object"}},
+		}},
+		ToolChoice: "required",
+		Stop:       "END",
+	}
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertOpenAIRequest(ctx, &relaycommon.RelayInfo{}, request)
+	require.NoError(t, err)
+	require.Equal(t, RequestModeConverse, adaptor.RequestMode)
+
+	converseReq, ok := converted.(*ConverseRequest)
+	require.True(t, ok)
+	require.Equal(t, []ConverseSystemBlock{{Text: "be brief"}}, converseReq.System)
+	require.Len(t, converseReq.Messages, 3, "the tool result and the next user message share a turn")
+	require.Equal(t, "assistant", converseReq.Messages[1].Role)
+	require.Equal(t, "lookup", converseReq.Messages[1].Content[1].ToolUse.Name)
+	require.Equal(t, map[string]any{"q": "x"}, converseReq.Messages[1].Content[1].ToolUse.Input)
+	require.Equal(t, "call_1", converseReq.Messages[2].Content[0].ToolResult.ToolUseId)
+	require.Equal(t, "thanks", *converseReq.Messages[2].Content[1].Text)
+	require.NotNil(t, converseReq.ToolConfig.ToolChoice.Any)
+	require.Equal(t, []string{"END"}, converseReq.InferenceConfig.StopSequences)
+
+	body, err := common.Marshal(converseReq)
+	require.NoError(t, err)
+	info := &relaycommon.RelayInfo{
+		IsStream: true,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ApiKey:            "api-key|us-east-1",
+			UpstreamModelName: "llama3-3-70b-instruct-v1:0",
+		},
+	}
+	_, err = doAwsClientRequest(ctx, info, adaptor, bytes.NewReader(body))
+	require.NoError(t, err)
+	streamInput, ok := adaptor.AwsReq.(*bedrockruntime.ConverseStreamInput)
+	require.True(t, ok)
+	require.Equal(t, "us.meta.llama3-3-70b-instruct-v1:0", aws.ToString(streamInput.ModelId))
+	require.Len(t, streamInput.Messages, 3)
+	require.IsType(t, &bedrockruntimeTypes.ToolChoiceMemberAny{}, streamInput.ToolConfig.ToolChoice)
+}
+
+func TestConverseUsageToOpenAICountsCachedInputAsPrompt(t *testing.T) {
+	t.Parallel()
+
+	usage := converseUsageToOpenAI(&bedrockruntimeTypes.TokenUsage{
+		InputTokens:           aws.Int32(10),
+		OutputTokens:          aws.Int32(5),
+		CacheReadInputTokens:  aws.Int32(20),
+		CacheWriteInputTokens: aws.Int32(3),
+	})
+	require.Equal(t, 33, usage.PromptTokens)
+	require.Equal(t, 5, usage.CompletionTokens)
+	require.Equal(t, 38, usage.TotalTokens)
+	require.Equal(t, 20, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 3, usage.PromptTokensDetails.CachedCreationTokens)
+}
+
+func TestConvertEmbeddingAndImageRequests(t *testing.T) {
+	t.Parallel()
+
+	dimensions := 256
+	embedding := dto.EmbeddingRequest{Input: []any{"a", "b"}, Dimensions: &dimensions}
+	titan, err := convertToEmbeddingRequests("amazon.titan-embed-text-v2:0", embedding)
+	require.NoError(t, err)
+	require.Equal(t, []TitanEmbeddingRequest{
+		{InputText: "a", Dimensions: &dimensions},
+		{InputText: "b", Dimensions: &dimensions},
+	}, titan)
+	cohere, err := convertToEmbeddingRequests("cohere.embed-english-v3", embedding)
+	require.NoError(t, err)
+	require.Len(t, cohere, 1)
+	require.Equal(t, []string{"a", "b"}, cohere.([]CohereEmbeddingRequest)[0].Texts)
+	_, err = convertToEmbeddingRequests("meta.llama3-3-70b-instruct-v1:0", embedding)
+	require.Error(t, err)
+
+	embeddings, err := parseCohereEmbeddings([]byte(`{"embeddings":{"float":[[0.1],[0.2]]}}`))
+	require.NoError(t, err)
+	require.Equal(t, [][]float64{{0.1}, {0.2}}, embeddings)
+
+	n := uint(2)
+	stability, err := convertToImageRequests("stability.sd3-5-large-v1:0", dto.ImageRequest{Prompt: "cat", N: &n, Size: "1792x1024"})
+	require.NoError(t, err)
+	require.Len(t, stability, 2, "stability models generate one image per call")
+	require.Equal(t, "16:9", stability.([]StabilityImageRequest)[0].AspectRatio)
+	titanImage, err := convertToImageRequests("amazon.nova-canvas-v1:0", dto.ImageRequest{Prompt: "cat", N: &n, Quality: "hd"})
+	require.NoError(t, err)
+	require.Equal(t, TitanImageConfig{NumberOfImages: 2, Width: 1024, Height: 1024, Quality: "premium"}, titanImage.([]TitanImageRequest)[0].ImageGenerationConfig)
+	_, err = convertToImageRequests("amazon.titan-image-generator-v2:0", dto.ImageRequest{Prompt: "cat", Size: "big"})
+	require.Error(t, err)
+}
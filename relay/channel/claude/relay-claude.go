@@ -126,10 +126,30 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		if err != nil {
 			logger.LogError(c, "send_stream_response_failed: "+err.Error())
 		}
+	} else if info.RelayFormat == types.RelayFormatOpenAIResponses {
+		if claudeInfo.ResponsesStream == nil {
+			claudeInfo.ResponsesStream = relayconvert.NewClaudeToResponsesStreamState(claudeInfo.ResponseId, info.UpstreamModelName)
+			claudeInfo.ResponsesStream.Created = claudeInfo.Created
+		}
+		FormatClaudeResponseInfo(&claudeResponse, nil, claudeInfo)
+		for _, event := range relayconvert.ClaudeStreamEventToResponsesEvents(&claudeResponse, claudeInfo.ResponsesStream) {
+			sendResponsesStreamEvent(c, event)
+		}
 	}
 	return nil
 }
 
+func sendResponsesStreamEvent(c *gin.Context, event dto.ResponsesStreamResponse) {
+	data, err := common.Marshal(event)
+	if err != nil {
+		logger.LogError(c, "marshal_responses_stream_event_failed: "+err.Error())
+		return
+	}
+	if err = helper.ResponseChunkData(c, event, string(data)); err != nil {
+		logger.LogError(c, "send_stream_response_failed: "+err.Error())
+	}
+}
+
 func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo) {
 	if claudeInfo.Usage.PromptTokens == 0 {
 		//上游出错
@@ -168,6 +188,12 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 			}
 		}
 		helper.Done(c)
+	} else if info.RelayFormat == types.RelayFormatOpenAIResponses && claudeInfo.ResponsesStream != nil {
+		openAIUsage := buildOpenAIStyleUsageFromClaudeUsage(claudeInfo.Usage)
+		claudeInfo.ResponsesStream.Usage = relayconvert.UsageFromChatUsage(&openAIUsage)
+		for _, event := range relayconvert.FinalizeClaudeStreamToResponses(claudeInfo.ResponsesStream) {
+			sendResponsesStreamEvent(c, event)
+		}
 	}
 }
 
@@ -227,6 +253,17 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeBadResponseBody)
 		}
+	case types.RelayFormatOpenAIResponses:
+		responsesResponse, err := relayconvert.ClaudeMessagesResponseToResponsesResponse(&claudeResponse, claudeInfo.ResponseId)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
+		openAIUsage := buildOpenAIStyleUsageFromClaudeUsage(claudeInfo.Usage)
+		responsesResponse.Usage = relayconvert.UsageFromChatUsage(&openAIUsage)
+		responseData, err = common.Marshal(responsesResponse)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
 	case types.RelayFormatClaude:
 		responseData = data
 	}
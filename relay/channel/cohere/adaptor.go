@@ -45,6 +45,8 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	if info.RelayMode == constant.RelayModeRerank {
 		return fmt.Sprintf("%s/v1/rerank", info.ChannelBaseUrl), nil
+	} else if info.RelayMode == constant.RelayModeEmbeddings {
+		return fmt.Sprintf("%s/v2/embed", info.ChannelBaseUrl), nil
 	} else {
 		return fmt.Sprintf("%s/v1/chat", info.ChannelBaseUrl), nil
 	}
@@ -74,13 +76,14 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	return requestOpenAI2CohereEmbedding(request)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
 	if info.RelayMode == constant.RelayModeRerank {
 		usage, err = cohereRerankHandler(c, resp, info)
+	} else if info.RelayMode == constant.RelayModeEmbeddings {
+		usage, err = cohereEmbeddingHandler(c, info, resp)
 	} else {
 		if info.IsStream {
 			usage, err = cohereStreamHandler(c, info, resp) // TODO: fix this
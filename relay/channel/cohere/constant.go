@@ -7,6 +7,7 @@ var ModelList = []string{
 	"c4ai-aya-23-35b", "c4ai-aya-23-8b",
 	"command-light", "command-light-nightly", "command", "command-nightly",
 	"rerank-english-v3.0", "rerank-multilingual-v3.0", "rerank-english-v2.0", "rerank-multilingual-v2.0",
+	"embed-v4.0", "embed-english-v3.0", "embed-multilingual-v3.0", "embed-english-light-v3.0", "embed-multilingual-light-v3.0",
 }
 
 var ChannelName = "cohere"
@@ -0,0 +1,83 @@
+package cohere
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func requestOpenAI2CohereEmbedding(request dto.EmbeddingRequest) (*CohereEmbeddingRequest, error) {
+	texts := request.ParseInput()
+	if len(texts) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	// embed v3 and newer require input_type
+	inputType := request.InputType
+	if inputType == "" {
+		inputType = "search_document"
+	}
+	cohereReq := &CohereEmbeddingRequest{
+		Model:     request.Model,
+		Texts:     texts,
+		InputType: inputType,
+		// base64 is encoded from the floats by cohereEmbeddingHandler
+		EmbeddingTypes: []string{"float"},
+	}
+	// only embed v4 takes output_dimension, older models reject it
+	if strings.Contains(request.Model, "embed-v4") {
+		cohereReq.OutputDimension = request.Dimensions
+	}
+	return cohereReq, nil
+}
+
+func cohereEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.CloseResponseBodyGracefully(resp)
+	var cohereResp CohereEmbeddingResponse
+	if err := common.Unmarshal(responseBody, &cohereResp); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+
+	encodingFormat := ""
+	if request, ok := info.Request.(*dto.EmbeddingRequest); ok {
+		encodingFormat = request.EncodingFormat
+	}
+	usage := dto.Usage{PromptTokens: cohereResp.Meta.BilledUnits.InputTokens}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+	}
+	usage.TotalTokens = usage.PromptTokens
+	openAIResp := dto.FlexibleEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, len(cohereResp.Embeddings.Float)),
+		Model:  info.UpstreamModelName,
+		Usage:  usage,
+	}
+	for i, embedding := range cohereResp.Embeddings.Float {
+		openAIResp.Data = append(openAIResp.Data, dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: dto.EncodeEmbedding(embedding, encodingFormat),
+		})
+	}
+	jsonResponse, err := common.Marshal(openAIResp)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return &usage, nil
+}
@@ -0,0 +1,78 @@
+package cohere
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestOpenAI2CohereEmbedding(t *testing.T) {
+	t.Parallel()
+
+	dimensions := 512
+	cohereReq, err := requestOpenAI2CohereEmbedding(dto.EmbeddingRequest{
+		Model:      "embed-v4.0",
+		Input:      []any{"a", "b"},
+		Dimensions: &dimensions,
+		InputType:  "search_query",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, cohereReq.Texts)
+	require.Equal(t, "search_query", cohereReq.InputType)
+	require.Equal(t, []string{"float"}, cohereReq.EmbeddingTypes)
+	require.Equal(t, &dimensions, cohereReq.OutputDimension)
+
+	cohereReq, err = requestOpenAI2CohereEmbedding(dto.EmbeddingRequest{Model: "embed-english-v3.0", Input: "a", Dimensions: &dimensions})
+	require.NoError(t, err)
+	require.Equal(t, "search_document", cohereReq.InputType)
+	require.Nil(t, cohereReq.OutputDimension, "embed v3 models do not take output_dimension")
+	body, err := common.Marshal(cohereReq)
+	require.NoError(t, err)
+	require.NotContains(t, string(body), "output_dimension")
+
+	_, err = requestOpenAI2CohereEmbedding(dto.EmbeddingRequest{Model: "embed-v4.0"})
+	require.Error(t, err)
+}
+
+func TestCohereEmbeddingHandlerEncodesBase64AndReportsUsage(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+
+	info := &relaycommon.RelayInfo{
+		Request: &dto.EmbeddingRequest{EncodingFormat: "base64"},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "embed-v4.0",
+		},
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(`{"id":"e1","embeddings":{"float":[[1,0.5],[-2,0]]},` +
+			`"meta":{"billed_units":{"input_tokens":7}}}`)),
+	}
+
+	usage, newAPIError := cohereEmbeddingHandler(c, info, resp)
+	require.Nil(t, newAPIError)
+	require.Equal(t, 7, usage.PromptTokens)
+	require.Equal(t, 7, usage.TotalTokens)
+
+	var openAIResp dto.FlexibleEmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &openAIResp))
+	require.Equal(t, "list", openAIResp.Object)
+	require.Equal(t, "embed-v4.0", openAIResp.Model)
+	require.Len(t, openAIResp.Data, 2)
+	require.Equal(t, 1, openAIResp.Data[1].Index)
+	require.Equal(t, dto.EncodeEmbedding([]float64{1, 0.5}, "base64"), openAIResp.Data[0].Embedding)
+	require.Equal(t, 7, openAIResp.PromptTokens)
+}
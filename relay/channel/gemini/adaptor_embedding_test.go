@@ -0,0 +1,41 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRequestURLKeepsNativeEmbeddingAction(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		RelayMode:              constant.RelayModeGemini,
+		RequestURLPath:         "/v1beta/models/my-embedder:batchEmbedContents",
+		IsGeminiBatchEmbedding: true,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelBaseUrl:    "https://generativelanguage.googleapis.com",
+			UpstreamModelName: "my-embedder",
+		},
+	}
+	url, err := (&Adaptor{}).GetRequestURL(info)
+	require.NoError(t, err)
+	require.Contains(t, url, "/models/my-embedder:batchEmbedContents")
+}
+
+func TestConvertEmbeddingRequestMapsInputTypeToTaskType(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-embedding-001"},
+	}
+	converted, err := (&Adaptor{}).ConvertEmbeddingRequest(nil, info, dto.EmbeddingRequest{
+		Input:     "a",
+		InputType: "search_query",
+	})
+	require.NoError(t, err)
+	requests := converted.(map[string]interface{})["requests"].([]map[string]interface{})
+	require.Equal(t, "RETRIEVAL_QUERY", requests[0]["taskType"])
+
+	require.Equal(t, "SEMANTIC_SIMILARITY", InputTypeToEmbeddingTaskType("SEMANTIC_SIMILARITY"))
+	require.Equal(t, "search_document", EmbeddingTaskTypeToInputType("RETRIEVAL_DOCUMENT"))
+}
@@ -0,0 +1,368 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// geminiImageAspectRatios are the aspect ratios Gemini image models accept.
+var geminiImageAspectRatios = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+
+// IsGeminiImageModel reports whether model is a Gemini model that answers
+// generateContent with images, such as gemini-2.5-flash-image.
+func IsGeminiImageModel(model string) bool {
+	return strings.HasPrefix(model, "gemini") && strings.Contains(model, "-image")
+}
+
+// closestGeminiAspectRatio maps an OpenAI size such as 1536x1024 to the closest
+// supported aspect ratio. An aspect ratio given as the size is kept.
+func closestGeminiAspectRatio(size string) string {
+	size = strings.TrimSpace(size)
+	if strings.Contains(size, ":") {
+		return size
+	}
+	widthText, heightText, ok := strings.Cut(size, "x")
+	width, widthErr := strconv.Atoi(widthText)
+	height, heightErr := strconv.Atoi(heightText)
+	if !ok || widthErr != nil || heightErr != nil || width <= 0 || height <= 0 {
+		return "1:1"
+	}
+	target := math.Log(float64(width) / float64(height))
+	closest := "1:1"
+	closestDistance := math.Inf(1)
+	for _, ratio := range geminiImageAspectRatios {
+		w, h, _ := strings.Cut(ratio, ":")
+		rw, _ := strconv.ParseFloat(w, 64)
+		rh, _ := strconv.ParseFloat(h, 64)
+		if distance := math.Abs(math.Log(rw/rh) - target); distance < closestDistance {
+			closest = ratio
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+// convertImageRequestToGenerateContent builds the generateContent request that
+// makes a Gemini image model generate, or for edits change, images.
+func convertImageRequestToGenerateContent(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (*dto.GeminiChatRequest, error) {
+	if strings.TrimSpace(request.Prompt) == "" {
+		return nil, errors.New("prompt is required")
+	}
+	var parts []dto.GeminiPart
+	if info.RelayMode == constant.RelayModeImagesEdits {
+		images, mask, err := imageEditInputs(c, request)
+		if err != nil {
+			return nil, err
+		}
+		for i := range images {
+			parts = append(parts, dto.GeminiPart{InlineData: &images[i]})
+		}
+		if mask != nil {
+			converted, err := whiteAreaMask(*mask)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts,
+				dto.GeminiPart{Text: "The next image is a mask of the image to edit: change only the white area and keep the rest unchanged."},
+				dto.GeminiPart{InlineData: &converted},
+			)
+		}
+	}
+	parts = append(parts, dto.GeminiPart{Text: request.Prompt})
+
+	imageConfig := map[string]string{"aspectRatio": closestGeminiAspectRatio(request.Size)}
+	// only the pro image models take an output resolution
+	if strings.Contains(info.UpstreamModelName, "pro-image") {
+		switch request.Quality {
+		case "hd", "high":
+			imageConfig["imageSize"] = "2K"
+		case "1K", "2K", "4K":
+			imageConfig["imageSize"] = request.Quality
+		}
+	}
+	imageConfigJSON, err := common.Marshal(imageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	geminiRequest := &dto.GeminiChatRequest{
+		Contents: []dto.GeminiChatContent{{Role: "user", Parts: parts}},
+	}
+	geminiRequest.GenerationConfig.ResponseModalities = []string{"TEXT", "IMAGE"}
+	geminiRequest.GenerationConfig.ImageConfig = imageConfigJSON
+	if n := int(lo.FromPtrOr(request.N, uint(1))); n > 1 {
+		geminiRequest.GenerationConfig.CandidateCount = &n
+	}
+	return geminiRequest, nil
+}
+
+// ConvertImagenEditRequest builds the Imagen capability request that inpaints
+// the area of an image marked by the mask of an OpenAI edit request. Only
+// Vertex AI serves Imagen edits.
+func ConvertImagenEditRequest(c *gin.Context, request dto.ImageRequest) (*dto.GeminiImageRequest, error) {
+	images, mask, err := imageEditInputs(c, request)
+	if err != nil {
+		return nil, err
+	}
+	if mask == nil {
+		return nil, errors.New("mask is required to edit images with imagen models")
+	}
+	converted, err := whiteAreaMask(*mask)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GeminiImageRequest{
+		Instances: []dto.GeminiImageInstance{{
+			Prompt: request.Prompt,
+			ReferenceImages: []dto.ImagenReferenceImage{
+				{
+					ReferenceType:  "REFERENCE_TYPE_RAW",
+					ReferenceId:    1,
+					ReferenceImage: dto.ImagenImage{BytesBase64Encoded: images[0].Data},
+				},
+				{
+					ReferenceType:   "REFERENCE_TYPE_MASK",
+					ReferenceId:     2,
+					ReferenceImage:  dto.ImagenImage{BytesBase64Encoded: converted.Data},
+					MaskImageConfig: &dto.ImagenMaskImageConfig{MaskMode: "MASK_MODE_USER_PROVIDED", Dilation: 0.01},
+				},
+			},
+		}},
+		Parameters: dto.GeminiImageParameters{
+			SampleCount: int(lo.FromPtrOr(request.N, uint(1))),
+			EditMode:    "EDIT_MODE_INPAINT_INSERTION",
+		},
+	}, nil
+}
+
+// imageEditInputs returns the images and the optional mask of an OpenAI image
+// edit request, taken from the multipart form or from the image, images and
+// mask fields of a JSON body.
+func imageEditInputs(c *gin.Context, request dto.ImageRequest) ([]dto.GeminiInlineData, *dto.GeminiInlineData, error) {
+	var images []dto.GeminiInlineData
+	var mask *dto.GeminiInlineData
+	if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		mf := c.Request.MultipartForm
+		if mf == nil {
+			form, err := common.ParseMultipartFormReusable(c)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse multipart form: %w", err)
+			}
+			mf = form
+		}
+		fieldNames := lo.Keys(mf.File)
+		sort.Strings(fieldNames)
+		for _, fieldName := range fieldNames {
+			if fieldName != "image" && !strings.HasPrefix(fieldName, "image[") && fieldName != "mask" {
+				continue
+			}
+			for _, fileHeader := range mf.File[fieldName] {
+				file, err := fileHeader.Open()
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to open %s file: %w", fieldName, err)
+				}
+				data, err := io.ReadAll(file)
+				_ = file.Close()
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to read %s file: %w", fieldName, err)
+				}
+				inlineData := dto.GeminiInlineData{
+					MimeType: http.DetectContentType(data),
+					Data:     base64.StdEncoding.EncodeToString(data),
+				}
+				if fieldName == "mask" {
+					mask = &inlineData
+				} else {
+					images = append(images, inlineData)
+				}
+			}
+		}
+	} else {
+		var refs []string
+		for _, raw := range []json.RawMessage{request.Image, request.Images} {
+			refs = append(refs, imageReferences(raw)...)
+		}
+		for _, ref := range refs {
+			inlineData, err := loadImageReference(c, ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			images = append(images, inlineData)
+		}
+		if maskRefs := imageReferences(request.Mask); len(maskRefs) > 0 {
+			inlineData, err := loadImageReference(c, maskRefs[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			mask = &inlineData
+		}
+	}
+	if len(images) == 0 {
+		return nil, nil, errors.New("image is required")
+	}
+	return images, mask, nil
+}
+
+// imageReferences reads the image URLs of a JSON image field, which holds a
+// URL, an {"image_url": ...} object or a list of either.
+func imageReferences(raw json.RawMessage) []string {
+	switch common.GetJsonType(raw) {
+	case "string":
+		var ref string
+		if common.Unmarshal(raw, &ref) == nil && ref != "" {
+			return []string{ref}
+		}
+	case "object":
+		var object struct {
+			ImageURL string `json:"image_url"`
+		}
+		if common.Unmarshal(raw, &object) == nil && object.ImageURL != "" {
+			return []string{object.ImageURL}
+		}
+	case "array":
+		var items []json.RawMessage
+		if common.Unmarshal(raw, &items) != nil {
+			return nil
+		}
+		var refs []string
+		for _, item := range items {
+			refs = append(refs, imageReferences(item)...)
+		}
+		return refs
+	}
+	return nil
+}
+
+func loadImageReference(c *gin.Context, ref string) (dto.GeminiInlineData, error) {
+	data, mimeType, err := service.GetBase64Data(c, types.NewFileSourceFromData(ref, ""), "image_edit")
+	if err != nil {
+		return dto.GeminiInlineData{}, fmt.Errorf("failed to load edit image: %w", err)
+	}
+	return dto.GeminiInlineData{MimeType: mimeType, Data: data}, nil
+}
+
+// whiteAreaMask turns an OpenAI edit mask, whose transparent pixels mark the
+// area to edit, into the black and white mask Google models take, where white
+// marks it. A mask without transparency is taken to be black and white already.
+func whiteAreaMask(mask dto.GeminiInlineData) (dto.GeminiInlineData, error) {
+	raw, err := base64.StdEncoding.DecodeString(mask.Data)
+	if err != nil {
+		return mask, fmt.Errorf("invalid mask image: %w", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return mask, fmt.Errorf("invalid mask image: %w", err)
+	}
+	bounds := img.Bounds()
+	converted := image.NewGray(bounds)
+	transparent := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, alpha := img.At(x, y).RGBA(); alpha == 0 {
+				converted.SetGray(x, y, color.Gray{Y: 255})
+				transparent = true
+			}
+		}
+	}
+	if !transparent {
+		return mask, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, converted); err != nil {
+		return mask, err
+	}
+	return dto.GeminiInlineData{MimeType: "image/png", Data: base64.StdEncoding.EncodeToString(buf.Bytes())}, nil
+}
+
+// imageResponseData returns a generated image in the response_format of the
+// request; as the image is not hosted anywhere, url is a data URL.
+func imageResponseData(info *relaycommon.RelayInfo, mimeType string, data string) dto.ImageData {
+	if request, ok := info.Request.(*dto.ImageRequest); ok && request.ResponseFormat == "url" {
+		if mimeType == "" {
+			mimeType = "image/png"
+		}
+		return dto.ImageData{Url: "data:" + mimeType + ";base64," + data}
+	}
+	return dto.ImageData{B64Json: data}
+}
+
+// setGeneratedImageCount bills the images actually returned when the model is
+// priced per image.
+func setGeneratedImageCount(info *relaycommon.RelayInfo, count int) {
+	if !info.PriceData.UsePrice || count <= 0 || count > dto.MaxImageN {
+		return
+	}
+	info.PriceData.AddOtherRatio("n", float64(count))
+}
+
+// GeminiImageGenerateContentHandler converts the generateContent response of
+// a Gemini image model to an OpenAI image response.
+func GeminiImageGenerateContentHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	var geminiResponse dto.GeminiChatResponse
+	if err := common.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	openAIResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    make([]dto.ImageData, 0, len(geminiResponse.Candidates)),
+	}
+	var texts []string
+	for _, candidate := range geminiResponse.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "image/") {
+				openAIResponse.Data = append(openAIResponse.Data, imageResponseData(info, part.InlineData.MimeType, part.InlineData.Data))
+			} else if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	if len(openAIResponse.Data) == 0 {
+		reason := "no images generated"
+		if geminiResponse.PromptFeedback != nil && geminiResponse.PromptFeedback.BlockReason != nil {
+			reason += ", prompt blocked: " + *geminiResponse.PromptFeedback.BlockReason
+		} else if len(texts) > 0 {
+			// the model explains in text why it did not draw
+			reason += ": " + strings.Join(texts, " ")
+		}
+		return nil, types.NewOpenAIError(errors.New(reason), types.ErrorCodeBadResponse, http.StatusBadRequest)
+	}
+	setGeneratedImageCount(info, len(openAIResponse.Data))
+
+	jsonResponse, err := common.Marshal(openAIResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+
+	usage := buildUsageFromGeminiResponse(c, info, &geminiResponse)
+	return &usage, nil
+}
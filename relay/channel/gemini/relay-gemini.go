@@ -441,14 +441,19 @@ func GeminiImageHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.
 		Data:    make([]dto.ImageData, 0, len(geminiResponse.Predictions)),
 	}
 
+	filteredReason := ""
 	for _, prediction := range geminiResponse.Predictions {
 		if prediction.RaiFilteredReason != "" {
+			filteredReason = prediction.RaiFilteredReason
 			continue // skip filtered image
 		}
-		openAIResponse.Data = append(openAIResponse.Data, dto.ImageData{
-			B64Json: prediction.BytesBase64Encoded,
-		})
+		openAIResponse.Data = append(openAIResponse.Data, imageResponseData(info, prediction.MimeType, prediction.BytesBase64Encoded))
+	}
+	if len(openAIResponse.Data) == 0 {
+		// 全部被过滤时不返回空结果，避免按张计费
+		return nil, types.NewOpenAIError(errors.New("no images generated: "+filteredReason), types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest)
 	}
+	setGeneratedImageCount(info, len(openAIResponse.Data))
 
 	jsonResponse, jsonErr := common.Marshal(openAIResponse)
 	if jsonErr != nil {
@@ -545,3 +550,32 @@ func FetchGeminiModels(baseURL, apiKey, proxyURL string) ([]string, error) {
 
 	return allModels, nil
 }
+
+// embeddingTaskTypeInputTypes maps the Gemini embedding task types that have
+// an input_type counterpart in retrieval embedding APIs such as Cohere's.
+var embeddingTaskTypeInputTypes = map[string]string{
+	"RETRIEVAL_DOCUMENT": "search_document",
+	"RETRIEVAL_QUERY":    "search_query",
+	"CLASSIFICATION":     "classification",
+	"CLUSTERING":         "clustering",
+}
+
+// EmbeddingTaskTypeToInputType returns the input_type of a Gemini taskType.
+// Task types without a counterpart are returned unchanged.
+func EmbeddingTaskTypeToInputType(taskType string) string {
+	if inputType, ok := embeddingTaskTypeInputTypes[taskType]; ok {
+		return inputType
+	}
+	return taskType
+}
+
+// InputTypeToEmbeddingTaskType is the inverse of EmbeddingTaskTypeToInputType,
+// so both input_type values and Gemini task types are accepted.
+func InputTypeToEmbeddingTaskType(inputType string) string {
+	for taskType, mapped := range embeddingTaskTypeInputTypes {
+		if mapped == inputType {
+			return taskType
+		}
+	}
+	return inputType
+}
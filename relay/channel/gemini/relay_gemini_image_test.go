@@ -0,0 +1,147 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeTestPNG(t *testing.T, img image.Image) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestClosestGeminiAspectRatio(t *testing.T) {
+	require.Equal(t, "1:1", closestGeminiAspectRatio(""))
+	require.Equal(t, "1:1", closestGeminiAspectRatio("1024x1024"))
+	require.Equal(t, "3:2", closestGeminiAspectRatio("1536x1024"))
+	require.Equal(t, "9:16", closestGeminiAspectRatio("1024x1792"))
+	require.Equal(t, "4:3", closestGeminiAspectRatio("4:3"))
+}
+
+func TestWhiteAreaMaskMarksTransparentPixels(t *testing.T) {
+	mask := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	mask.Set(0, 0, color.NRGBA{A: 0})
+	mask.Set(1, 0, color.NRGBA{A: 255})
+
+	converted, err := whiteAreaMask(dto.GeminiInlineData{MimeType: "image/png", Data: encodeTestPNG(t, mask)})
+	require.NoError(t, err)
+	raw, err := base64.StdEncoding.DecodeString(converted.Data)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.Equal(t, color.Gray{Y: 255}, color.GrayModel.Convert(img.At(0, 0)))
+	require.Equal(t, color.Gray{Y: 0}, color.GrayModel.Convert(img.At(1, 0)))
+
+	// a mask without transparency is already black and white
+	opaque := dto.GeminiInlineData{MimeType: "image/png", Data: encodeTestPNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))}
+	unchanged, err := whiteAreaMask(opaque)
+	require.NoError(t, err)
+	require.Equal(t, opaque, unchanged)
+}
+
+func TestConvertImageEditRequestToGenerateContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", nil)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	imageData := encodeTestPNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	maskImage := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	request := dto.ImageRequest{
+		Prompt: "add a hat",
+		Size:   "1536x1024",
+		Images: []byte(`[{"image_url":"data:image/png;base64,` + imageData + `"}]`),
+		Mask:   []byte(`{"image_url":"data:image/png;base64,` + encodeTestPNG(t, maskImage) + `"}`),
+	}
+	info := &relaycommon.RelayInfo{
+		RelayMode:   constant.RelayModeImagesEdits,
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-2.5-flash-image"},
+	}
+
+	converted, err := (&Adaptor{}).ConvertImageRequest(c, info, request)
+	require.NoError(t, err)
+	geminiRequest := converted.(*dto.GeminiChatRequest)
+	parts := geminiRequest.Contents[0].Parts
+	require.Len(t, parts, 4)
+	require.Equal(t, imageData, parts[0].InlineData.Data)
+	require.NotNil(t, parts[2].InlineData)
+	require.Equal(t, "add a hat", parts[3].Text)
+	require.Equal(t, []string{"TEXT", "IMAGE"}, geminiRequest.GenerationConfig.ResponseModalities)
+	require.JSONEq(t, `{"aspectRatio":"3:2"}`, string(geminiRequest.GenerationConfig.ImageConfig))
+	require.Nil(t, geminiRequest.GenerationConfig.CandidateCount)
+
+	_, err = ConvertImagenEditRequest(c, dto.ImageRequest{Prompt: "add a hat", Images: request.Images})
+	require.ErrorContains(t, err, "mask is required")
+}
+
+func TestGeminiImageGenerateContentHandlerReturnsDataURLsAndBillsImages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+
+	info := &relaycommon.RelayInfo{
+		RelayMode:   constant.RelayModeImagesGenerations,
+		Request:     &dto.ImageRequest{ResponseFormat: "url"},
+		PriceData:   types.PriceData{UsePrice: true},
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-2.5-flash-image"},
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body: io.NopCloser(strings.NewReader(`{"candidates":[` +
+			`{"content":{"role":"model","parts":[{"text":"here"},{"inlineData":{"mimeType":"image/png","data":"AAAA"}}]}},` +
+			`{"content":{"role":"model","parts":[{"inlineData":{"mimeType":"image/jpeg","data":"BBBB"}}]}}],` +
+			`"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":2580,"totalTokenCount":2585}}`)),
+	}
+
+	usage, newAPIError := GeminiImageGenerateContentHandler(c, info, resp)
+	require.Nil(t, newAPIError)
+	require.Equal(t, 5, usage.PromptTokens)
+	require.Equal(t, 2.0, info.PriceData.OtherRatios()["n"])
+
+	var openAIResp dto.ImageResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &openAIResp))
+	require.Len(t, openAIResp.Data, 2)
+	require.Equal(t, "data:image/png;base64,AAAA", openAIResp.Data[0].Url)
+	require.Equal(t, "data:image/jpeg;base64,BBBB", openAIResp.Data[1].Url)
+	require.Empty(t, openAIResp.Data[0].B64Json)
+}
+
+func TestGeminiImageGenerateContentHandlerFailsWithoutImages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+
+	info := &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-2.5-flash-image"},
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(`{"candidates":[` +
+			`{"content":{"role":"model","parts":[{"text":"I can't draw that."}]}}]}`)),
+	}
+
+	_, newAPIError := GeminiImageGenerateContentHandler(c, info, resp)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, http.StatusBadRequest, newAPIError.StatusCode)
+	require.Contains(t, newAPIError.Error(), "I can't draw that.")
+}
@@ -0,0 +1,629 @@
+package gemini
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+// openaiRealtimeVoices are the voices of OpenAI realtime models. Gemini
+// rejects them, so sessions asking for one keep the default Gemini voice.
+var openaiRealtimeVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "sage", "shimmer", "verse", "marin", "cedar"}
+
+// geminiRealtimeBridge translates between the OpenAI Realtime event protocol
+// spoken by the client and the Gemini Live API. Gemini fixes the session
+// configuration in its setup message, so it is sent with the first
+// session.update of the client; later updates only change the audio formats,
+// which are converted here.
+type geminiRealtimeBridge struct {
+	mu             sync.Mutex
+	info           *relaycommon.RelayInfo
+	session        dto.RealtimeSession
+	manualActivity bool
+	setupSent      bool
+	activityOpen   bool
+	pendingTurns   []dto.GeminiChatContent
+	responseId     string
+	itemId         string
+	interrupted    bool
+	usage          *dto.GeminiLiveUsageMetadata
+	callNames      map[string]string
+}
+
+func newGeminiRealtimeBridge(info *relaycommon.RelayInfo) *geminiRealtimeBridge {
+	return &geminiRealtimeBridge{
+		info: info,
+		session: dto.RealtimeSession{
+			Modalities:        []string{"text", "audio"},
+			InputAudioFormat:  info.InputAudioFormat,
+			OutputAudioFormat: info.OutputAudioFormat,
+		},
+		callNames: make(map[string]string),
+	}
+}
+
+func newRealtimeId(prefix string) string {
+	return prefix + "_" + common.GetRandomString(20)
+}
+
+func (b *geminiRealtimeBridge) sessionEvent(eventType string) dto.RealtimeEvent {
+	session := b.session
+	return dto.RealtimeEvent{EventId: newRealtimeId("event"), Type: eventType, Session: &session}
+}
+
+// clientEvent translates an event of the client into the messages to send
+// upstream and the events to answer the client with directly.
+func (b *geminiRealtimeBridge) clientEvent(message []byte) ([]dto.GeminiLiveClientMessage, []dto.RealtimeEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := dto.RealtimeEvent{}
+	if err := common.Unmarshal(message, &event); err != nil {
+		return nil, nil, err
+	}
+	var upstream []dto.GeminiLiveClientMessage
+	var replies []dto.RealtimeEvent
+	if event.Type == dto.RealtimeEventTypeSessionUpdate {
+		b.updateSession(event.Session, message)
+		if !b.setupSent {
+			upstream = append(upstream, b.setupMessage())
+		}
+		return upstream, append(replies, b.sessionEvent(dto.RealtimeEventTypeSessionUpdated)), nil
+	}
+	if !b.setupSent {
+		upstream = append(upstream, b.setupMessage())
+	}
+
+	switch event.Type {
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid audio: %w", err)
+		}
+		upstream = append(upstream, b.flushTurns(false)...)
+		if b.manualActivity && !b.activityOpen {
+			upstream = append(upstream, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityStart: &struct{}{}}})
+			b.activityOpen = true
+		}
+		pcm, rate := service.RealtimeAudioToPCM16(audio, b.session.InputAudioFormat)
+		upstream = append(upstream, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{
+			Audio: &dto.GeminiInlineData{
+				MimeType: fmt.Sprintf("audio/pcm;rate=%d", rate),
+				Data:     base64.StdEncoding.EncodeToString(pcm),
+			},
+		}})
+	case dto.RealtimeEventInputAudioBufferCommit:
+		if b.activityOpen {
+			upstream = append(upstream, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}}})
+			b.activityOpen = false
+		}
+		replies = append(replies, dto.RealtimeEvent{EventId: newRealtimeId("event"), Type: dto.RealtimeEventInputAudioBufferCommitted, ItemId: newRealtimeId("item")})
+	case dto.RealtimeEventInputAudioBufferClear:
+		replies = append(replies, dto.RealtimeEvent{EventId: newRealtimeId("event"), Type: dto.RealtimeEventInputAudioBufferCleared})
+	case dto.RealtimeEventTypeConversationCreate:
+		if event.Item == nil {
+			break
+		}
+		switch event.Item.Type {
+		case "function_call_output":
+			upstream = append(upstream, b.flushTurns(false)...)
+			upstream = append(upstream, dto.GeminiLiveClientMessage{ToolResponse: &dto.GeminiLiveToolResponse{
+				FunctionResponses: []dto.GeminiLiveFunctionResponse{{
+					Id:       event.Item.CallId,
+					Name:     b.callNames[event.Item.CallId],
+					Response: map[string]any{"output": event.Item.Output},
+				}},
+			}})
+		case "message":
+			if turn, ok := geminiRealtimeTurn(event.Item); ok {
+				b.pendingTurns = append(b.pendingTurns, turn)
+			}
+		}
+		item := *event.Item
+		if item.Id == "" {
+			item.Id = newRealtimeId("item")
+		}
+		item.Status = "completed"
+		replies = append(replies, dto.RealtimeEvent{EventId: newRealtimeId("event"), Type: dto.RealtimeEventConversationItemCreated, Item: &item})
+	case dto.RealtimeEventTypeResponseCreate:
+		upstream = append(upstream, b.flushTurns(true)...)
+	}
+	return upstream, replies, nil
+}
+
+// updateSession merges the fields set by a session.update into the session.
+// turn_detection set to null switches to manual turns, which map to explicit
+// activity signals since Gemini detects activity by default.
+func (b *geminiRealtimeBridge) updateSession(session *dto.RealtimeSession, message []byte) {
+	if session == nil {
+		return
+	}
+	if len(session.Modalities) > 0 {
+		b.session.Modalities = session.Modalities
+	}
+	b.session.Instructions = common.GetStringIfEmpty(session.Instructions, b.session.Instructions)
+	b.session.Voice = common.GetStringIfEmpty(session.Voice, b.session.Voice)
+	b.session.InputAudioFormat = common.GetStringIfEmpty(session.InputAudioFormat, b.session.InputAudioFormat)
+	b.session.OutputAudioFormat = common.GetStringIfEmpty(session.OutputAudioFormat, b.session.OutputAudioFormat)
+	b.session.ToolChoice = common.GetStringIfEmpty(session.ToolChoice, b.session.ToolChoice)
+	if session.InputAudioTranscription.Model != "" {
+		b.session.InputAudioTranscription = session.InputAudioTranscription
+	}
+	if session.Tools != nil {
+		b.session.Tools = session.Tools
+		b.info.RealtimeTools = session.Tools
+	}
+	if session.Temperature > 0 {
+		b.session.Temperature = session.Temperature
+	}
+	if turnDetection := gjson.GetBytes(message, "session.turn_detection"); turnDetection.Exists() && !b.setupSent {
+		b.session.TurnDetection = session.TurnDetection
+		b.manualActivity = turnDetection.Type == gjson.Null
+	}
+	b.info.InputAudioFormat = b.session.InputAudioFormat
+	b.info.OutputAudioFormat = b.session.OutputAudioFormat
+}
+
+func (b *geminiRealtimeBridge) setupMessage() dto.GeminiLiveClientMessage {
+	b.setupSent = true
+	setup := &dto.GeminiLiveSetup{
+		Model:            "models/" + b.info.UpstreamModelName,
+		GenerationConfig: &dto.GeminiChatGenerationConfig{ResponseModalities: []string{"TEXT"}},
+	}
+	if slices.Contains(b.session.Modalities, "audio") {
+		setup.GenerationConfig.ResponseModalities = []string{"AUDIO"}
+		setup.OutputAudioTranscription = &struct{}{}
+		if b.session.Voice != "" && !slices.Contains(openaiRealtimeVoices, b.session.Voice) {
+			speechConfig, err := common.Marshal(map[string]any{
+				"voiceConfig": map[string]any{"prebuiltVoiceConfig": map[string]any{"voiceName": b.session.Voice}},
+			})
+			if err == nil {
+				setup.GenerationConfig.SpeechConfig = speechConfig
+			}
+		}
+	}
+	if b.session.Temperature > 0 {
+		setup.GenerationConfig.Temperature = common.GetPointer(b.session.Temperature)
+	}
+	if b.session.Instructions != "" {
+		setup.SystemInstruction = &dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: b.session.Instructions}}}
+	}
+	if len(b.session.Tools) > 0 && b.session.ToolChoice != "none" {
+		tool := dto.GeminiLiveTool{}
+		for _, t := range b.session.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, dto.GeminiLiveFunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			})
+		}
+		setup.Tools = []dto.GeminiLiveTool{tool}
+	}
+	if b.manualActivity {
+		setup.RealtimeInputConfig = &dto.GeminiLiveRealtimeInputConf{
+			AutomaticActivityDetection: &dto.GeminiLiveActivityDetection{Disabled: true},
+		}
+	}
+	if b.session.InputAudioTranscription.Model != "" {
+		setup.InputAudioTranscription = &struct{}{}
+	}
+	return dto.GeminiLiveClientMessage{Setup: setup}
+}
+
+// flushTurns sends the conversation items created since the last flush.
+// Gemini answers a clientContent message once its turn is complete.
+func (b *geminiRealtimeBridge) flushTurns(complete bool) []dto.GeminiLiveClientMessage {
+	if len(b.pendingTurns) == 0 {
+		return nil
+	}
+	turns := b.pendingTurns
+	b.pendingTurns = nil
+	return []dto.GeminiLiveClientMessage{{ClientContent: &dto.GeminiLiveClientContent{Turns: turns, TurnComplete: complete}}}
+}
+
+func geminiRealtimeTurn(item *dto.RealtimeItem) (dto.GeminiChatContent, bool) {
+	turn := dto.GeminiChatContent{Role: "user"}
+	if item.Role == "assistant" {
+		turn.Role = "model"
+	}
+	for _, content := range item.Content {
+		switch content.Type {
+		case "input_text", "text":
+			turn.Parts = append(turn.Parts, dto.GeminiPart{Text: content.Text})
+		case "input_audio", "audio":
+			audio, err := base64.StdEncoding.DecodeString(content.Audio)
+			if err != nil || len(audio) == 0 {
+				continue
+			}
+			// items carry pcm16 audio whatever the session format is
+			turn.Parts = append(turn.Parts, dto.GeminiPart{InlineData: &dto.GeminiInlineData{
+				MimeType: "audio/pcm;rate=24000",
+				Data:     content.Audio,
+			}})
+		}
+	}
+	return turn, len(turn.Parts) > 0
+}
+
+// upstreamMessage translates a Gemini Live server message into events of
+// the client.
+func (b *geminiRealtimeBridge) upstreamMessage(message []byte) ([]dto.RealtimeEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg := dto.GeminiLiveServerMessage{}
+	if err := common.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+	var events []dto.RealtimeEvent
+	if msg.Error != nil {
+		events = append(events, dto.RealtimeEvent{
+			EventId: newRealtimeId("event"),
+			Type:    dto.RealtimeEventTypeError,
+			Error: &types.OpenAIError{
+				Message: msg.Error.Message,
+				Type:    "upstream_error",
+				Code:    msg.Error.Status,
+			},
+		})
+	}
+	if msg.UsageMetadata != nil {
+		b.usage = msg.UsageMetadata
+	}
+	if content := msg.ServerContent; content != nil {
+		if content.InputTranscription != nil && content.InputTranscription.Text != "" {
+			events = append(events, dto.RealtimeEvent{
+				EventId: newRealtimeId("event"),
+				Type:    dto.RealtimeEventInputAudioTranscriptionDelta,
+				Delta:   content.InputTranscription.Text,
+			})
+		}
+		if content.Interrupted {
+			b.interrupted = true
+			events = append(events, dto.RealtimeEvent{EventId: newRealtimeId("event"), Type: dto.RealtimeEventInputAudioBufferSpeechStarted})
+		}
+		if content.ModelTurn != nil {
+			for _, part := range content.ModelTurn.Parts {
+				if part.Thought {
+					continue
+				}
+				if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/") {
+					pcm, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+					if err != nil {
+						return nil, fmt.Errorf("invalid audio from upstream: %w", err)
+					}
+					audio := service.PCM16ToRealtimeAudio(pcm, geminiAudioSampleRate(part.InlineData.MimeType), b.session.OutputAudioFormat)
+					events = append(events, b.responseEvent(dto.RealtimeEventResponseAudioDelta, base64.StdEncoding.EncodeToString(audio))...)
+				} else if part.Text != "" {
+					events = append(events, b.responseEvent(dto.RealtimeEventResponseTextDelta, part.Text)...)
+				}
+			}
+		}
+		if content.OutputTranscription != nil && content.OutputTranscription.Text != "" {
+			events = append(events, b.responseEvent(dto.RealtimeEventResponseAudioTranscriptionDelta, content.OutputTranscription.Text)...)
+		}
+		if content.TurnComplete {
+			events = append(events, b.finishResponse()...)
+		}
+	}
+	if msg.ToolCall != nil && len(msg.ToolCall.FunctionCalls) > 0 {
+		for _, call := range msg.ToolCall.FunctionCalls {
+			b.callNames[call.Id] = call.Name
+			arguments := string(call.Args)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			events = append(events, b.startResponse()...)
+			itemId := newRealtimeId("item")
+			events = append(events,
+				dto.RealtimeEvent{
+					EventId:    newRealtimeId("event"),
+					Type:       dto.RealtimeEventResponseFunctionCallArgumentsDelta,
+					ResponseId: b.responseId,
+					ItemId:     itemId,
+					CallId:     call.Id,
+					Delta:      arguments,
+				},
+				dto.RealtimeEvent{
+					EventId:    newRealtimeId("event"),
+					Type:       dto.RealtimeEventResponseFunctionCallArgumentsDone,
+					ResponseId: b.responseId,
+					ItemId:     itemId,
+					CallId:     call.Id,
+					Name:       call.Name,
+					Arguments:  arguments,
+				},
+			)
+		}
+		// Gemini waits for the tool response without completing the turn,
+		// while clients expect the response to be done before answering.
+		events = append(events, b.finishResponse()...)
+	}
+	return events, nil
+}
+
+func (b *geminiRealtimeBridge) startResponse() []dto.RealtimeEvent {
+	if b.responseId != "" {
+		return nil
+	}
+	b.responseId = newRealtimeId("resp")
+	b.itemId = newRealtimeId("item")
+	return []dto.RealtimeEvent{{
+		EventId:  newRealtimeId("event"),
+		Type:     dto.RealtimeEventTypeResponseCreated,
+		Response: &dto.RealtimeResponse{Id: b.responseId, Object: "realtime.response", Status: "in_progress"},
+	}}
+}
+
+func (b *geminiRealtimeBridge) responseEvent(eventType string, delta string) []dto.RealtimeEvent {
+	events := b.startResponse()
+	return append(events, dto.RealtimeEvent{
+		EventId:    newRealtimeId("event"),
+		Type:       eventType,
+		ResponseId: b.responseId,
+		ItemId:     b.itemId,
+		Delta:      delta,
+	})
+}
+
+// finishResponse ends the current response with the usage reported by
+// Gemini for the turn. A turn without output still ends with response.done
+// when it was billed.
+func (b *geminiRealtimeBridge) finishResponse() []dto.RealtimeEvent {
+	if b.responseId == "" && b.usage == nil {
+		return nil
+	}
+	events := b.startResponse()
+	status := "completed"
+	if b.interrupted {
+		status = "cancelled"
+	}
+	events = append(events, dto.RealtimeEvent{
+		EventId: newRealtimeId("event"),
+		Type:    dto.RealtimeEventTypeResponseDone,
+		Response: &dto.RealtimeResponse{
+			Id:     b.responseId,
+			Object: "realtime.response",
+			Status: status,
+			Usage:  geminiLiveRealtimeUsage(b.usage),
+		},
+	})
+	b.responseId = ""
+	b.itemId = ""
+	b.interrupted = false
+	b.usage = nil
+	return events
+}
+
+// geminiAudioSampleRate reads the rate of a mime type like
+// audio/pcm;rate=24000. Gemini Live answers at 24kHz.
+func geminiAudioSampleRate(mimeType string) int {
+	for _, param := range strings.Split(mimeType, ";") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(param), "rate="); ok {
+			if rate, err := strconv.Atoi(value); err == nil && rate > 0 {
+				return rate
+			}
+		}
+	}
+	return 24000
+}
+
+func geminiLiveRealtimeUsage(metadata *dto.GeminiLiveUsageMetadata) *dto.RealtimeUsage {
+	if metadata == nil {
+		return nil
+	}
+	usage := &dto.RealtimeUsage{
+		InputTokens:  metadata.PromptTokenCount + metadata.ToolUsePromptTokenCount,
+		OutputTokens: metadata.ResponseTokenCount + metadata.ThoughtsTokenCount,
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	for _, detail := range metadata.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.InputTokenDetails.AudioTokens += detail.TokenCount
+		}
+	}
+	for _, detail := range metadata.ResponseTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.OutputTokenDetails.AudioTokens += detail.TokenCount
+		}
+	}
+	usage.InputTokenDetails.TextTokens = usage.InputTokens - usage.InputTokenDetails.AudioTokens
+	usage.OutputTokenDetails.TextTokens = usage.OutputTokens - usage.OutputTokenDetails.AudioTokens
+	usage.InputTokenDetails.CachedTokens = metadata.CachedContentTokenCount
+	return usage
+}
+
+// GeminiRealtimeHandler bridges an OpenAI Realtime client to Gemini Live.
+// Usage reported by Gemini is billed at the end of each response; events
+// without it are counted locally like on OpenAI channels.
+func GeminiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.NewAPIError, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return types.NewError(fmt.Errorf("invalid websocket connection"), types.ErrorCodeBadResponse), nil
+	}
+
+	info.IsStream = true
+	clientConn := info.ClientWs
+	targetConn := info.TargetWs
+	bridge := newGeminiRealtimeBridge(info)
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+
+	// both readers write to the client and update the usage
+	var mu sync.Mutex
+	localUsage := &dto.RealtimeUsage{}
+	sumUsage := &dto.RealtimeUsage{}
+
+	countLocal := func(event dto.RealtimeEvent, input bool) error {
+		textToken, audioToken, err := service.CountTokenRealtime(info, event, info.UpstreamModelName)
+		if err != nil {
+			return fmt.Errorf("error counting text token: %v", err)
+		}
+		localUsage.TotalTokens += textToken + audioToken
+		if input {
+			localUsage.InputTokens += textToken + audioToken
+			localUsage.InputTokenDetails.TextTokens += textToken
+			localUsage.InputTokenDetails.AudioTokens += audioToken
+		} else {
+			localUsage.OutputTokens += textToken + audioToken
+			localUsage.OutputTokenDetails.TextTokens += textToken
+			localUsage.OutputTokenDetails.AudioTokens += audioToken
+		}
+		return nil
+	}
+
+	sendClient := func(event dto.RealtimeEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch event.Type {
+		case dto.RealtimeEventTypeResponseDone:
+			if event.Response.Usage != nil {
+				if err := openai.PreConsumeRealtimeUsage(c, info, event.Response.Usage, sumUsage); err != nil {
+					return fmt.Errorf("error consume usage: %v", err)
+				}
+				// Gemini's usage covers what was counted locally
+				localUsage = &dto.RealtimeUsage{}
+			} else {
+				if err := countLocal(event, true); err != nil {
+					return err
+				}
+				info.IsFirstRequest = false
+				if err := openai.PreConsumeRealtimeUsage(c, info, localUsage, sumUsage); err != nil {
+					return fmt.Errorf("error consume usage: %v", err)
+				}
+				localUsage = &dto.RealtimeUsage{}
+			}
+		case dto.RealtimeEventTypeSessionCreated, dto.RealtimeEventTypeSessionUpdated:
+		default:
+			if err := countLocal(event, false); err != nil {
+				return err
+			}
+		}
+		return helper.WssObject(c, clientConn, event)
+	}
+
+	if err := sendClient(bridge.sessionEvent(dto.RealtimeEventTypeSessionCreated)); err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+				_, message, err := clientConn.ReadMessage()
+				if err != nil {
+					if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+						errChan <- fmt.Errorf("error reading from client: %v", err)
+					}
+					close(clientClosed)
+					return
+				}
+
+				realtimeEvent := dto.RealtimeEvent{}
+				if err := common.Unmarshal(message, &realtimeEvent); err != nil {
+					errChan <- fmt.Errorf("error unmarshalling message: %v", err)
+					return
+				}
+				upstream, replies, err := bridge.clientEvent(message)
+				if err != nil {
+					errChan <- fmt.Errorf("error translating client event: %v", err)
+					return
+				}
+				mu.Lock()
+				err = countLocal(realtimeEvent, true)
+				mu.Unlock()
+				if err != nil {
+					errChan <- err
+					return
+				}
+				for _, msg := range upstream {
+					if err := helper.WssObject(c, targetConn, msg); err != nil {
+						errChan <- fmt.Errorf("error writing to target: %v", err)
+						return
+					}
+				}
+				for _, reply := range replies {
+					if err := sendClient(reply); err != nil {
+						errChan <- fmt.Errorf("error writing to client: %v", err)
+						return
+					}
+				}
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+				_, message, err := targetConn.ReadMessage()
+				if err != nil {
+					if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+						errChan <- fmt.Errorf("error reading from target: %v", err)
+					}
+					close(targetClosed)
+					return
+				}
+				info.SetFirstResponseTime()
+				events, err := bridge.upstreamMessage(message)
+				if err != nil {
+					errChan <- fmt.Errorf("error translating upstream message: %v", err)
+					return
+				}
+				for _, event := range events {
+					if err := sendClient(event); err != nil {
+						errChan <- fmt.Errorf("error writing to client: %v", err)
+						return
+					}
+				}
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		logger.LogError(c, "realtime error: "+err.Error())
+	case <-c.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if localUsage.TotalTokens != 0 {
+		_ = openai.PreConsumeRealtimeUsage(c, info, localUsage, sumUsage)
+	}
+	return nil, sumUsage
+}
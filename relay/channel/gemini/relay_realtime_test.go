@@ -0,0 +1,185 @@
+package gemini
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRealtimeBridge() *geminiRealtimeBridge {
+	return newGeminiRealtimeBridge(&relaycommon.RelayInfo{
+		ChannelMeta:       &relaycommon.ChannelMeta{UpstreamModelName: "gemini-live-test"},
+		InputAudioFormat:  "pcm16",
+		OutputAudioFormat: "pcm16",
+	})
+}
+
+func TestGeminiRealtimeSessionUpdateSendsSetup(t *testing.T) {
+	bridge := newTestRealtimeBridge()
+	upstream, replies, err := bridge.clientEvent([]byte(`{
+		"type": "session.update",
+		"session": {
+			"modalities": ["text", "audio"],
+			"instructions": "be brief",
+			"voice": "Puck",
+			"input_audio_format": "g711_ulaw",
+			"output_audio_format": "g711_alaw",
+			"turn_detection": null,
+			"tools": [{"type": "function", "name": "lookup", "description": "Lookup data", "parameters": {"type": "object"}}]
+		}
+	}`))
+	require.NoError(t, err)
+
+	require.Len(t, upstream, 1)
+	setup := upstream[0].Setup
+	require.NotNil(t, setup)
+	assert.Equal(t, "models/gemini-live-test", setup.Model)
+	assert.Equal(t, []string{"AUDIO"}, setup.GenerationConfig.ResponseModalities)
+	assert.JSONEq(t, `{"voiceConfig":{"prebuiltVoiceConfig":{"voiceName":"Puck"}}}`, string(setup.GenerationConfig.SpeechConfig))
+	assert.Equal(t, "be brief", setup.SystemInstruction.Parts[0].Text)
+	require.Len(t, setup.Tools, 1)
+	assert.Equal(t, "lookup", setup.Tools[0].FunctionDeclarations[0].Name)
+	require.NotNil(t, setup.RealtimeInputConfig)
+	assert.True(t, setup.RealtimeInputConfig.AutomaticActivityDetection.Disabled)
+	assert.NotNil(t, setup.OutputAudioTranscription)
+
+	require.Len(t, replies, 1)
+	assert.Equal(t, dto.RealtimeEventTypeSessionUpdated, replies[0].Type)
+	assert.Equal(t, "g711_ulaw", bridge.info.InputAudioFormat)
+	assert.Equal(t, "g711_alaw", bridge.info.OutputAudioFormat)
+
+	// manual turns are framed by activity signals around the audio
+	audio := base64.StdEncoding.EncodeToString([]byte{0xff, 0xff})
+	upstream, _, err = bridge.clientEvent([]byte(`{"type":"input_audio_buffer.append","audio":"` + audio + `"}`))
+	require.NoError(t, err)
+	require.Len(t, upstream, 2)
+	assert.NotNil(t, upstream[0].RealtimeInput.ActivityStart)
+	assert.Equal(t, "audio/pcm;rate=8000", upstream[1].RealtimeInput.Audio.MimeType)
+	pcm, err := base64.StdEncoding.DecodeString(upstream[1].RealtimeInput.Audio.Data)
+	require.NoError(t, err)
+	assert.Len(t, pcm, 4, "each g711 sample becomes 16-bit pcm")
+
+	upstream, replies, err = bridge.clientEvent([]byte(`{"type":"input_audio_buffer.commit"}`))
+	require.NoError(t, err)
+	require.Len(t, upstream, 1)
+	assert.NotNil(t, upstream[0].RealtimeInput.ActivityEnd)
+	assert.Equal(t, dto.RealtimeEventInputAudioBufferCommitted, replies[0].Type)
+}
+
+func TestGeminiRealtimeTextTurnWaitsForResponseCreate(t *testing.T) {
+	bridge := newTestRealtimeBridge()
+	upstream, replies, err := bridge.clientEvent([]byte(`{
+		"type": "conversation.item.create",
+		"item": {"type": "message", "role": "user", "content": [{"type": "input_text", "text": "hello"}]}
+	}`))
+	require.NoError(t, err)
+	require.Len(t, upstream, 1, "only the default setup is sent")
+	require.NotNil(t, upstream[0].Setup)
+	assert.Equal(t, []string{"AUDIO"}, upstream[0].Setup.GenerationConfig.ResponseModalities)
+	require.Len(t, replies, 1)
+	assert.Equal(t, dto.RealtimeEventConversationItemCreated, replies[0].Type)
+	assert.NotEmpty(t, replies[0].Item.Id)
+
+	upstream, _, err = bridge.clientEvent([]byte(`{"type":"response.create"}`))
+	require.NoError(t, err)
+	require.Len(t, upstream, 1)
+	content := upstream[0].ClientContent
+	require.NotNil(t, content)
+	assert.True(t, content.TurnComplete)
+	require.Len(t, content.Turns, 1)
+	assert.Equal(t, "user", content.Turns[0].Role)
+	assert.Equal(t, "hello", content.Turns[0].Parts[0].Text)
+}
+
+func TestGeminiRealtimeUpstreamAudioTurn(t *testing.T) {
+	bridge := newTestRealtimeBridge()
+	pcm := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	events, err := bridge.upstreamMessage([]byte(`{"serverContent":{"modelTurn":{"parts":[{"inlineData":{"mimeType":"audio/pcm;rate=24000","data":"` + pcm + `"}}]}}}`))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, dto.RealtimeEventTypeResponseCreated, events[0].Type)
+	assert.Equal(t, dto.RealtimeEventResponseAudioDelta, events[1].Type)
+	assert.Equal(t, pcm, events[1].Delta)
+	responseId := events[0].Response.Id
+	assert.Equal(t, responseId, events[1].ResponseId)
+
+	events, err = bridge.upstreamMessage([]byte(`{
+		"serverContent": {"outputTranscription": {"text": "hi"}, "turnComplete": true},
+		"usageMetadata": {
+			"promptTokenCount": 30, "responseTokenCount": 50, "totalTokenCount": 80,
+			"promptTokensDetails": [{"modality": "AUDIO", "tokenCount": 20}, {"modality": "TEXT", "tokenCount": 10}],
+			"responseTokensDetails": [{"modality": "AUDIO", "tokenCount": 45}]
+		}
+	}`))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, dto.RealtimeEventResponseAudioTranscriptionDelta, events[0].Type)
+	assert.Equal(t, "hi", events[0].Delta)
+	assert.Equal(t, dto.RealtimeEventTypeResponseDone, events[1].Type)
+	assert.Equal(t, responseId, events[1].Response.Id)
+	assert.Equal(t, "completed", events[1].Response.Status)
+
+	usage := events[1].Response.Usage
+	require.NotNil(t, usage)
+	assert.Equal(t, 80, usage.TotalTokens)
+	assert.Equal(t, 20, usage.InputTokenDetails.AudioTokens)
+	assert.Equal(t, 10, usage.InputTokenDetails.TextTokens)
+	assert.Equal(t, 45, usage.OutputTokenDetails.AudioTokens)
+	assert.Equal(t, 5, usage.OutputTokenDetails.TextTokens)
+}
+
+func TestGeminiRealtimeConvertsOutputAudio(t *testing.T) {
+	bridge := newTestRealtimeBridge()
+	bridge.session.OutputAudioFormat = "g711_ulaw"
+	pcm := base64.StdEncoding.EncodeToString(make([]byte, 48))
+	events, err := bridge.upstreamMessage([]byte(`{"serverContent":{"modelTurn":{"parts":[{"inlineData":{"mimeType":"audio/pcm;rate=24000","data":"` + pcm + `"}}]}}}`))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	audio, err := base64.StdEncoding.DecodeString(events[1].Delta)
+	require.NoError(t, err)
+	assert.Len(t, audio, 8, "24 samples at 24kHz become 8 samples at 8kHz")
+}
+
+func TestGeminiRealtimeToolCallRoundTrip(t *testing.T) {
+	bridge := newTestRealtimeBridge()
+	events, err := bridge.upstreamMessage([]byte(`{"toolCall":{"functionCalls":[{"id":"call_1","name":"lookup","args":{"q":"x"}}]}}`))
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, dto.RealtimeEventTypeResponseCreated, events[0].Type)
+	assert.Equal(t, dto.RealtimeEventResponseFunctionCallArgumentsDelta, events[1].Type)
+	assert.Equal(t, dto.RealtimeEventResponseFunctionCallArgumentsDone, events[2].Type)
+	assert.Equal(t, "call_1", events[2].CallId)
+	assert.Equal(t, "lookup", events[2].Name)
+	assert.JSONEq(t, `{"q":"x"}`, events[2].Arguments)
+	assert.Equal(t, dto.RealtimeEventTypeResponseDone, events[3].Type)
+
+	upstream, _, err := bridge.clientEvent([]byte(`{
+		"type": "conversation.item.create",
+		"item": {"type": "function_call_output", "call_id": "call_1", "output": "{\"ok\":true}"}
+	}`))
+	require.NoError(t, err)
+	require.Len(t, upstream, 2)
+	require.NotNil(t, upstream[1].ToolResponse)
+	response := upstream[1].ToolResponse.FunctionResponses[0]
+	assert.Equal(t, "call_1", response.Id)
+	assert.Equal(t, "lookup", response.Name)
+	assert.Equal(t, `{"ok":true}`, response.Response["output"])
+}
+
+func TestGeminiRealtimeRequestURL(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		RelayMode: constant.RelayModeRealtime,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelBaseUrl:    "https://generativelanguage.googleapis.com",
+			UpstreamModelName: "gemini-live-test",
+		},
+	}
+	url, err := (&Adaptor{}).GetRequestURL(info)
+	require.NoError(t, err)
+	assert.Equal(t, "wss://generativelanguage.googleapis.com/ws/google.ai.generativelanguage.v1beta.GenerativeService.BidiGenerateContent", url)
+}
@@ -7,6 +7,7 @@ var ModelList = []string{
 	"mistral-medium-latest",
 	"mistral-large-latest",
 	"mistral-embed",
+	"codestral-embed",
 }
 
 var ChannelName = "mistral"
@@ -0,0 +1,7 @@
+package mistral
+
+type MistralEmbeddingRequest struct {
+	Model           string `json:"model"`
+	Input           any    `json:"input"`
+	OutputDimension *int   `json:"output_dimension,omitempty"`
+}
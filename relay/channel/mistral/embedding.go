@@ -0,0 +1,66 @@
+package mistral
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func requestOpenAI2MistralEmbedding(request dto.EmbeddingRequest) *MistralEmbeddingRequest {
+	// Mistral always answers with floats, base64 is encoded by mistralEmbeddingHandler
+	return &MistralEmbeddingRequest{
+		Model:           request.Model,
+		Input:           request.Input,
+		OutputDimension: request.Dimensions,
+	}
+}
+
+func mistralEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.CloseResponseBodyGracefully(resp)
+	var mistralResp dto.EmbeddingResponse
+	if err := common.Unmarshal(responseBody, &mistralResp); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+
+	encodingFormat := ""
+	if request, ok := info.Request.(*dto.EmbeddingRequest); ok {
+		encodingFormat = request.EncodingFormat
+	}
+	usage := mistralResp.Usage
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+	}
+	usage.TotalTokens = usage.PromptTokens
+	openAIResp := dto.FlexibleEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, len(mistralResp.Data)),
+		Model:  info.UpstreamModelName,
+		Usage:  usage,
+	}
+	for _, item := range mistralResp.Data {
+		openAIResp.Data = append(openAIResp.Data, dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     item.Index,
+			Embedding: dto.EncodeEmbedding(item.Embedding, encodingFormat),
+		})
+	}
+	jsonResponse, err := common.Marshal(openAIResp)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return &usage, nil
+}
@@ -0,0 +1,61 @@
+package mistral
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestOpenAI2MistralEmbeddingMapsDimensions(t *testing.T) {
+	t.Parallel()
+
+	dimensions := 256
+	mistralReq := requestOpenAI2MistralEmbedding(dto.EmbeddingRequest{
+		Model:          "codestral-embed",
+		Input:          []any{"a"},
+		EncodingFormat: "base64",
+		Dimensions:     &dimensions,
+	})
+	body, err := common.Marshal(mistralReq)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"codestral-embed","input":["a"],"output_dimension":256}`, string(body))
+}
+
+func TestMistralEmbeddingHandler(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+
+	info := &relaycommon.RelayInfo{
+		Request: &dto.EmbeddingRequest{},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "mistral-embed",
+		},
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(`{"id":"e1","object":"list","model":"mistral-embed",` +
+			`"data":[{"object":"embedding","index":0,"embedding":[0.25,-1]}],` +
+			`"usage":{"prompt_tokens":3,"total_tokens":3}}`)),
+	}
+
+	usage, newAPIError := mistralEmbeddingHandler(c, info, resp)
+	require.Nil(t, newAPIError)
+	require.Equal(t, 3, usage.PromptTokens)
+	require.Equal(t, 3, usage.TotalTokens)
+
+	var openAIResp dto.EmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &openAIResp))
+	require.Equal(t, []float64{0.25, -1}, openAIResp.Data[0].Embedding)
+}
@@ -0,0 +1,35 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureRealtimeRequestURL(t *testing.T) {
+	newInfo := func(model string) *relaycommon.RelayInfo {
+		return &relaycommon.RelayInfo{
+			RelayMode:      relayconstant.RelayModeRealtime,
+			RequestURLPath: "/v1/realtime?model=" + model,
+			ChannelMeta: &relaycommon.ChannelMeta{
+				ChannelType:       constant.ChannelTypeAzure,
+				ChannelBaseUrl:    "https://example.openai.azure.com",
+				UpstreamModelName: model,
+				ApiVersion:        "2025-04-01-preview",
+				ChannelCreateTime: constant.AzureNoRemoveDotTime,
+			},
+		}
+	}
+
+	url, err := (&Adaptor{}).GetRequestURL(newInfo("gpt-realtime"))
+	require.NoError(t, err)
+	assert.Equal(t, "wss://example.openai.azure.com/openai/v1/realtime?model=gpt-realtime", url)
+
+	url, err = (&Adaptor{}).GetRequestURL(newInfo("gpt-4o-realtime-preview"))
+	require.NoError(t, err)
+	assert.Equal(t, "wss://example.openai.azure.com/openai/realtime?deployment=gpt-4o-realtime-preview&api-version=2025-04-01-preview", url)
+}
@@ -0,0 +1,254 @@
+package finetune
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
+	taskcommon "github.com/QuantumNous/new-api/relay/channel/task/taskcommon"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ============================
+// Request / Response structures
+// ============================
+
+// FineTuningJob is the subset of the OpenAI fine-tuning job object the
+// gateway needs; the raw upstream body is returned to clients as-is.
+// https://platform.openai.com/docs/api-reference/fine-tuning/object
+type FineTuningJob struct {
+	ID             string `json:"id"`
+	Object         string `json:"object"`
+	Model          string `json:"model"`
+	Status         string `json:"status"`
+	FineTunedModel string `json:"fine_tuned_model,omitempty"`
+	TrainedTokens  int    `json:"trained_tokens,omitempty"`
+	Error          *struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	} `json:"error,omitempty"`
+}
+
+// fileFields are the request fields that reference uploaded files.
+var fileFields = []string{"training_file", "validation_file"}
+
+// ============================
+// Adaptor implementation
+// ============================
+
+// TaskAdaptor submits and polls fine-tuning jobs on OpenAI and Azure OpenAI
+// channels. Jobs are billed per trained token once they succeed.
+type TaskAdaptor struct {
+	taskcommon.BaseBilling
+	ChannelType  int
+	apiKey       string
+	baseURL      string
+	apiVersion   string
+	organization string
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.RelayInfo) {
+	a.ChannelType = info.ChannelType
+	a.baseURL = info.ChannelBaseUrl
+	a.apiKey = info.ApiKey
+	a.apiVersion = info.ApiVersion
+	a.organization = info.Organization
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.RelayInfo) *dto.TaskError {
+	if !service.IsFileForwardableChannel(info.ChannelType) {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("channel type %d does not support fine-tuning", info.ChannelType), "invalid_channel", http.StatusBadRequest)
+	}
+	var req map[string]any
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	if trainingFile, _ := req["training_file"].(string); strings.TrimSpace(trainingFile) == "" {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("field training_file is required"), "invalid_request", http.StatusBadRequest)
+	}
+	info.Action = constant.TaskActionFineTune
+	return nil
+}
+
+// AdjustBillingOnComplete bills the tokens the upstream reports as trained,
+// using the ratios captured when the job was submitted.
+func (a *TaskAdaptor) AdjustBillingOnComplete(task *model.Task, taskResult *relaycommon.TaskInfo) int {
+	bc := task.PrivateData.BillingContext
+	if taskResult.Status != model.TaskStatusSuccess || taskResult.TotalTokens <= 0 || bc == nil || bc.ModelRatio <= 0 {
+		return 0
+	}
+	quota := float64(taskResult.TotalTokens) * bc.ModelRatio * bc.GroupRatio
+	for _, ratio := range bc.OtherRatios {
+		if ratio > 0 {
+			quota *= ratio
+		}
+	}
+	actualQuota, _ := common.QuotaFromFloatChecked(quota)
+	return actualQuota
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return service.OpenAIChannelAPIURL(a.ChannelType, a.baseURL, a.apiVersion, "/fine_tuning/jobs"), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	if a.ChannelType == constant.ChannelTypeAzure {
+		req.Header.Set("api-key", a.apiKey)
+		return nil
+	}
+	req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	if a.organization != "" {
+		req.Header.Set("OpenAI-Organization", a.organization)
+	}
+	return nil
+}
+
+// BuildRequestBody maps the upstream model and swaps gateway file ids for the
+// ids of the same files on the selected channel, uploading them when needed.
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayInfo) (io.Reader, error) {
+	var req map[string]any
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return nil, errors.Wrap(err, "unmarshal_request_body_failed")
+	}
+	req["model"] = info.UpstreamModelName
+	for _, field := range fileFields {
+		fileId, _ := req[field].(string)
+		if fileId == "" {
+			continue
+		}
+		file, err := model.GetTokenFile(info.UserId, info.TokenId, fileId)
+		if err != nil {
+			// not a gateway file, pass the id through for the upstream to resolve
+			continue
+		}
+		upstreamFileId, err := service.EnsureFileOnChannel(c.Request.Context(), file, info.ChannelId, info.ChannelMultiKeyIndex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "upload %s to channel failed", field)
+		}
+		req[field] = upstreamFileId
+	}
+	body, err := common.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal_request_body_failed")
+	}
+	return bytes.NewReader(body), nil
+}
+
+// DoRequest delegates to common helper.
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+// DoResponse returns the upstream job with the public task id as its id.
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	_ = resp.Body.Close()
+
+	var job FineTuningJob
+	if err := common.Unmarshal(responseBody, &job); err != nil {
+		taskErr = service.TaskErrorWrapper(errors.Wrapf(err, "body: %s", responseBody), "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if job.ID == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("job id is empty"), "invalid_response", http.StatusInternalServerError)
+		return
+	}
+
+	publicJob, err := PublicJobData(responseBody, info.PublicTaskID)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "build_response_failed", http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", publicJob)
+	return job.ID, responseBody, nil
+}
+
+// FetchTask fetch job status
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any, proxy string) (*http.Response, error) {
+	jobID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id")
+	}
+
+	uri := service.OpenAIChannelAPIURL(a.ChannelType, baseUrl, a.apiVersion, "/fine_tuning/jobs/"+jobID)
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if a.ChannelType == constant.ChannelTypeAzure {
+		req.Header.Set("api-key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	client, err := service.GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("new proxy http client failed: %w", err)
+	}
+	return client.Do(req)
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var job FineTuningJob
+	if err := common.Unmarshal(respBody, &job); err != nil {
+		return nil, errors.Wrap(err, "unmarshal task result failed")
+	}
+
+	taskResult := relaycommon.TaskInfo{
+		Code: 0,
+	}
+	switch job.Status {
+	case "validating_files", "queued", "pending":
+		taskResult.Status = model.TaskStatusQueued
+	case "running", "notRunning":
+		taskResult.Status = model.TaskStatusInProgress
+	case "succeeded":
+		taskResult.Status = model.TaskStatusSuccess
+		taskResult.TotalTokens = job.TrainedTokens
+		taskResult.FineTunedModel = job.FineTunedModel
+	case "failed", "cancelled":
+		taskResult.Status = model.TaskStatusFailure
+		if job.Error != nil && job.Error.Message != "" {
+			taskResult.Reason = job.Error.Message
+		} else {
+			taskResult.Reason = "fine-tuning job " + job.Status
+		}
+	default:
+	}
+	return &taskResult, nil
+}
+
+// PublicJobData replaces the upstream job id in a job object with the public
+// task id so clients never see (or depend on) upstream ids.
+func PublicJobData(data []byte, publicTaskID string) ([]byte, error) {
+	var job map[string]any
+	if err := common.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	job["id"] = publicTaskID
+	return common.Marshal(job)
+}
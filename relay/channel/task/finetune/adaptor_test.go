@@ -0,0 +1,92 @@
+package finetune
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTaskResultMapsJobStatuses(t *testing.T) {
+	adaptor := &TaskAdaptor{}
+
+	cases := map[string]string{
+		"validating_files": model.TaskStatusQueued,
+		"queued":           model.TaskStatusQueued,
+		"running":          model.TaskStatusInProgress,
+		"succeeded":        model.TaskStatusSuccess,
+		"failed":           model.TaskStatusFailure,
+		"cancelled":        model.TaskStatusFailure,
+	}
+	for status, expected := range cases {
+		result, err := adaptor.ParseTaskResult([]byte(`{"id":"ftjob-1","status":"` + status + `"}`))
+		require.NoError(t, err)
+		require.Equal(t, expected, result.Status, status)
+	}
+}
+
+func TestParseTaskResultSucceededCarriesModelAndTokens(t *testing.T) {
+	adaptor := &TaskAdaptor{}
+
+	result, err := adaptor.ParseTaskResult([]byte(`{"id":"ftjob-1","status":"succeeded","fine_tuned_model":"ft:gpt-4o-mini-2024-07-18:org::abc","trained_tokens":12000}`))
+
+	require.NoError(t, err)
+	require.Equal(t, "ft:gpt-4o-mini-2024-07-18:org::abc", result.FineTunedModel)
+	require.Equal(t, 12000, result.TotalTokens)
+}
+
+func TestParseTaskResultFailedUsesUpstreamMessage(t *testing.T) {
+	adaptor := &TaskAdaptor{}
+
+	result, err := adaptor.ParseTaskResult([]byte(`{"id":"ftjob-1","status":"failed","error":{"code":"invalid_training_file","message":"bad line 3"}}`))
+
+	require.NoError(t, err)
+	require.Equal(t, "bad line 3", result.Reason)
+}
+
+func TestAdjustBillingOnCompleteBillsTrainedTokens(t *testing.T) {
+	adaptor := &TaskAdaptor{}
+	task := &model.Task{}
+	task.PrivateData.BillingContext = &model.TaskBillingContext{
+		ModelRatio:  2,
+		GroupRatio:  0.5,
+		OtherRatios: map[string]float64{"discount": 0.8},
+	}
+
+	quota := adaptor.AdjustBillingOnComplete(task, &relaycommon.TaskInfo{
+		Status:      model.TaskStatusSuccess,
+		TotalTokens: 1000,
+	})
+
+	require.Equal(t, 800, quota)
+}
+
+func TestAdjustBillingOnCompleteSkipsWithoutTokens(t *testing.T) {
+	adaptor := &TaskAdaptor{}
+	task := &model.Task{}
+	task.PrivateData.BillingContext = &model.TaskBillingContext{ModelRatio: 2, GroupRatio: 1}
+
+	require.Zero(t, adaptor.AdjustBillingOnComplete(task, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess}))
+	require.Zero(t, adaptor.AdjustBillingOnComplete(&model.Task{}, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, TotalTokens: 10}))
+}
+
+func TestPublicJobDataReplacesId(t *testing.T) {
+	data, err := PublicJobData([]byte(`{"id":"ftjob-upstream","status":"queued"}`), "task_public")
+	require.NoError(t, err)
+
+	var job map[string]any
+	require.NoError(t, common.Unmarshal(data, &job))
+	require.Equal(t, "task_public", job["id"])
+	require.Equal(t, "queued", job["status"])
+}
+
+func TestFetchTaskRequiresTaskId(t *testing.T) {
+	adaptor := &TaskAdaptor{ChannelType: constant.ChannelTypeOpenAI}
+
+	_, err := adaptor.FetchTask("https://api.openai.com", "sk-test", map[string]any{}, "")
+
+	require.Error(t, err)
+}
@@ -0,0 +1,12 @@
+package finetune
+
+// ModelList lists the base models that OpenAI accepts for fine-tuning.
+var ModelList = []string{
+	"gpt-4o-mini-2024-07-18",
+	"gpt-4o-2024-08-06",
+	"gpt-4.1-2025-04-14",
+	"gpt-4.1-mini-2025-04-14",
+	"gpt-3.5-turbo",
+}
+
+var ChannelName = "fine-tuning"
@@ -40,3 +40,31 @@ func copyRequest(req *dto.ClaudeRequest, version string) *VertexAIClaudeRequest
 		OutputConfig:     req.OutputConfig,
 	}
 }
+
+type VertexEmbeddingRequest struct {
+	Instances  []VertexEmbeddingInstance  `json:"instances"`
+	Parameters *VertexEmbeddingParameters `json:"parameters,omitempty"`
+}
+
+type VertexEmbeddingInstance struct {
+	Content  string `json:"content"`
+	TaskType string `json:"task_type,omitempty"`
+}
+
+type VertexEmbeddingParameters struct {
+	OutputDimensionality *int `json:"outputDimensionality,omitempty"`
+}
+
+type VertexEmbeddingResponse struct {
+	Predictions []VertexEmbeddingPrediction `json:"predictions"`
+}
+
+type VertexEmbeddingPrediction struct {
+	Embeddings struct {
+		Values     []float64 `json:"values"`
+		Statistics struct {
+			TokenCount int  `json:"token_count"`
+			Truncated  bool `json:"truncated"`
+		} `json:"statistics"`
+	} `json:"embeddings"`
+}
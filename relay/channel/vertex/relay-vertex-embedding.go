@@ -0,0 +1,86 @@
+package vertex
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/gemini"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestOpenAI2VertexEmbedding converts an embedding request to the predict
+// payload of Vertex AI text embedding models, one instance per input.
+func requestOpenAI2VertexEmbedding(request dto.EmbeddingRequest) (*VertexEmbeddingRequest, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	taskType := ""
+	if request.InputType != "" {
+		taskType = gemini.InputTypeToEmbeddingTaskType(request.InputType)
+	}
+	vertexReq := &VertexEmbeddingRequest{
+		Instances: make([]VertexEmbeddingInstance, 0, len(inputs)),
+	}
+	for _, input := range inputs {
+		vertexReq.Instances = append(vertexReq.Instances, VertexEmbeddingInstance{
+			Content:  input,
+			TaskType: taskType,
+		})
+	}
+	if request.Dimensions != nil && *request.Dimensions > 0 {
+		vertexReq.Parameters = &VertexEmbeddingParameters{OutputDimensionality: request.Dimensions}
+	}
+	return vertexReq, nil
+}
+
+func vertexEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	var vertexResp VertexEmbeddingResponse
+	if err := common.Unmarshal(responseBody, &vertexResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	encodingFormat := ""
+	if request, ok := info.Request.(*dto.EmbeddingRequest); ok {
+		encodingFormat = request.EncodingFormat
+	}
+	usage := dto.Usage{}
+	openAIResp := dto.FlexibleEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, len(vertexResp.Predictions)),
+		Model:  info.UpstreamModelName,
+	}
+	for i, prediction := range vertexResp.Predictions {
+		openAIResp.Data = append(openAIResp.Data, dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: dto.EncodeEmbedding(prediction.Embeddings.Values, encodingFormat),
+		})
+		usage.PromptTokens += prediction.Embeddings.Statistics.TokenCount
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+	}
+	usage.TotalTokens = usage.PromptTokens
+	openAIResp.Usage = usage
+
+	jsonResponse, err := common.Marshal(openAIResp)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+	return &usage, nil
+}
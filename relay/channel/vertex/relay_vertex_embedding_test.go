@@ -0,0 +1,66 @@
+package vertex
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestOpenAI2VertexEmbedding(t *testing.T) {
+	dimensions := 128
+	vertexReq, err := requestOpenAI2VertexEmbedding(dto.EmbeddingRequest{
+		Input:      []any{"a", "b"},
+		Dimensions: &dimensions,
+		InputType:  "search_document",
+	})
+	require.NoError(t, err)
+	body, err := common.Marshal(vertexReq)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"instances":[
+			{"content":"a","task_type":"RETRIEVAL_DOCUMENT"},
+			{"content":"b","task_type":"RETRIEVAL_DOCUMENT"}
+		],
+		"parameters":{"outputDimensionality":128}
+	}`, string(body))
+
+	_, err = requestOpenAI2VertexEmbedding(dto.EmbeddingRequest{})
+	require.Error(t, err)
+}
+
+func TestVertexEmbeddingHandlerSumsTokenCounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+
+	info := &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "text-embedding-005"},
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body: io.NopCloser(strings.NewReader(`{"predictions":[` +
+			`{"embeddings":{"values":[0.1,0.2],"statistics":{"token_count":4,"truncated":false}}},` +
+			`{"embeddings":{"values":[0.3,0.4],"statistics":{"token_count":6,"truncated":false}}}]}`)),
+	}
+
+	usage, newAPIError := vertexEmbeddingHandler(c, info, resp)
+	require.Nil(t, newAPIError)
+	require.Equal(t, 10, usage.PromptTokens)
+	require.Equal(t, 10, usage.TotalTokens)
+
+	var openAIResp dto.EmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &openAIResp))
+	require.Len(t, openAIResp.Data, 2)
+	require.Equal(t, []float64{0.3, 0.4}, openAIResp.Data[1].Embedding)
+	require.Equal(t, 10, openAIResp.PromptTokens)
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/samber/lo"
 	"github.com/tidwall/gjson"
@@ -175,19 +176,27 @@ func buildLegacyParamOverride(paramOverride map[string]interface{}) map[string]i
 	return legacy
 }
 
-func ApplyParamOverrideWithRelayInfo(jsonData []byte, info *RelayInfo) ([]byte, error) {
+func ApplyParamOverrideWithRelayInfo(jsonData []byte, info *RelayInfo) (result []byte, err error) {
 	paramOverride := getParamOverrideMap(info)
-	if len(paramOverride) == 0 {
+	tokenParamOverride := getTokenParamOverrideMap(info)
+	if len(paramOverride) == 0 && len(tokenParamOverride) == 0 {
 		return jsonData, nil
 	}
+	span := tracing.StartSpanContext(info.traceContext, "param_override")
+	defer func() { span.EndWithError(err) }()
 
 	overrideCtx := BuildParamOverrideContext(info)
 	var recorder *paramOverrideAuditRecorder
-	if shouldEnableParamOverrideAudit(paramOverride) {
+	if shouldEnableParamOverrideAudit(paramOverride) || shouldEnableParamOverrideAudit(tokenParamOverride) {
 		recorder = &paramOverrideAuditRecorder{}
 		overrideCtx[paramOverrideContextAuditRecorder] = recorder
 	}
-	result, err := ApplyParamOverride(jsonData, paramOverride, overrideCtx)
+	// 令牌强制参数先应用，渠道参数覆盖的同名字段以管理员设置为准
+	result, err = ApplyParamOverride(jsonData, tokenParamOverride, overrideCtx)
+	if err != nil {
+		return nil, err
+	}
+	result, err = ApplyParamOverride(result, paramOverride, overrideCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -388,6 +397,13 @@ func getParamOverrideMap(info *RelayInfo) map[string]interface{} {
 	return info.ChannelMeta.ParamOverride
 }
 
+func getTokenParamOverrideMap(info *RelayInfo) map[string]interface{} {
+	if info == nil {
+		return nil
+	}
+	return info.TokenParamOverride
+}
+
 func getHeaderOverrideMap(info *RelayInfo) map[string]interface{} {
 	if info == nil || info.ChannelMeta == nil {
 		return nil
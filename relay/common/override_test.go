@@ -1902,6 +1902,34 @@ func TestApplyParamOverrideWithRelayInfoMixedLegacyAndOperations(t *testing.T) {
 	}
 }
 
+func TestApplyParamOverrideWithRelayInfoChannelOverrideWinsOverToken(t *testing.T) {
+	info := &RelayInfo{
+		TokenParamOverride: map[string]interface{}{
+			"temperature": 0.1,
+			"user":        "team-a",
+		},
+		ChannelMeta: &ChannelMeta{
+			ParamOverride: map[string]interface{}{
+				"temperature": 0.2,
+				"top_p":       0.9,
+			},
+		},
+	}
+
+	out, err := ApplyParamOverrideWithRelayInfo([]byte(`{"model":"gpt-5","temperature":0.7}`), info)
+	if err != nil {
+		t.Fatalf("ApplyParamOverrideWithRelayInfo returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-5","temperature":0.2,"top_p":0.9,"user":"team-a"}`, string(out))
+
+	info.ChannelMeta = nil
+	out, err = ApplyParamOverrideWithRelayInfo([]byte(`{"model":"gpt-5"}`), info)
+	if err != nil {
+		t.Fatalf("ApplyParamOverrideWithRelayInfo returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-5","temperature":0.1,"user":"team-a"}`, string(out))
+}
+
 func TestApplyParamOverrideWithRelayInfoMoveAndCopyHeaders(t *testing.T) {
 	info := &RelayInfo{
 		ChannelMeta: &ChannelMeta{
@@ -1,9 +1,11 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -88,6 +90,7 @@ type TokenCountMeta struct {
 type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
+	TokenParentId     int // 派生令牌的父令牌，用量同步汇总到父令牌
 	TokenGroup        string
 	UserId            int
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
@@ -96,6 +99,8 @@ type RelayInfo struct {
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
+	// traceContext 持有请求的链路追踪上下文，供没有 gin.Context 的阶段（如参数覆盖）创建子 span
+	traceContext context.Context
 	//SendLastReasoningResponse bool
 	IsStream               bool
 	IsGeminiBatchEmbedding bool
@@ -122,6 +127,8 @@ type RelayInfo struct {
 	SendResponseCount      int
 	ReceivedResponseCount  int
 	FinalPreConsumedQuota  int // 最终预消耗的配额
+	// ResponseCacheHit 为 true 时响应来自响应缓存，未请求上游渠道
+	ResponseCacheHit bool
 	// ForcePreConsume 为 true 时禁用 BillingSession 的信任额度旁路，
 	// 强制预扣全额。用于异步任务（视频/音乐生成等），因为请求返回后任务仍在运行，
 	// 必须在提交前锁定全额。
@@ -129,11 +136,17 @@ type RelayInfo struct {
 	// Billing 是计费会话，封装了预扣费/结算/退款的统一生命周期。
 	// 免费模型时为 nil。
 	Billing BillingSettler
-	// BillingSource indicates whether this request is billed from wallet quota or subscription.
-	// "" or "wallet" => wallet; "subscription" => subscription
+	// BudgetSettled is set once the billing session counted the actual spend
+	// against the budgets, so the consume log must not count it again.
+	BudgetSettled bool
+	// BillingSource indicates whether this request is billed from wallet quota, subscription or organization quota.
+	// "" or "wallet" => wallet; "subscription" => subscription; "organization" => organization quota pool
 	BillingSource string
 	// SubscriptionId is the user_subscriptions.id used when BillingSource == "subscription"
 	SubscriptionId int
+	// OrganizationId is the organization billed for the request of one of its members,
+	// from its quota pool ("organization") or one of its subscriptions ("subscription").
+	OrganizationId int
 	// SubscriptionPreConsumed is the amount pre-consumed on subscription item (quota units or 1)
 	SubscriptionPreConsumed int64
 	// SubscriptionPostDelta is the post-consume delta applied to amount_used (quota units; can be negative).
@@ -153,6 +166,9 @@ type RelayInfo struct {
 	RuntimeHeadersOverride                map[string]interface{}
 	UseRuntimeHeadersOverride             bool
 	ParamOverrideAudit                    []string
+	// TokenParamOverride holds the request fields forced by the token scope,
+	// applied before the channel param override so the admin values win.
+	TokenParamOverride map[string]interface{}
 
 	// UpstreamRequestBodySize is the byte size of the marshaled upstream request
 	// body. It is set when the body is wrapped in a BodyStorage (see
@@ -193,6 +209,12 @@ type RelayInfo struct {
 	*TaskRelayInfo
 }
 
+// HasParamOverride reports whether the channel or the token overrides
+// request parameters.
+func (info *RelayInfo) HasParamOverride() bool {
+	return len(info.TokenParamOverride) > 0 || (info.ChannelMeta != nil && len(info.ParamOverride) > 0)
+}
+
 func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 	channelType := common.GetContextKeyInt(c, constant.ContextKeyChannelType)
 	paramOverride := common.GetContextKeyStringMap(c, constant.ContextKeyChannelParamOverride)
@@ -480,13 +502,17 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
+		TokenParentId:  common.GetContextKeyInt(c, constant.ContextKeyTokenParentId),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
 
+		TokenParamOverride: common.GetContextKeyStringMap(c, constant.ContextKeyTokenParamOverride),
+
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
 		RequestURLPath:  c.Request.URL.String(),
 		RequestHeaders:  cloneRequestHeaders(c),
+		traceContext:    c.Request.Context(),
 		IsStream:        isStream,
 
 		StartTime:         startTime,
@@ -672,6 +698,26 @@ func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
 
+// CloneForAttempt returns a copy of info for a relay attempt that runs
+// concurrently with another attempt of the same request, such as a hedged
+// request. State mutated while relaying is copied rather than shared.
+func (info *RelayInfo) CloneForAttempt() *RelayInfo {
+	clone := *info
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		clone.ChannelMeta = &channelMeta
+	}
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	clone.PriceData.ReplaceOtherRatios(info.PriceData.OtherRatios())
+	clone.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+	clone.ParamOverrideAudit = slices.Clone(info.ParamOverrideAudit)
+	clone.StreamStatus = nil
+	return &clone
+}
+
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
@@ -779,6 +825,7 @@ type TaskInfo struct {
 	Progress         string `json:"progress,omitempty"`
 	CompletionTokens int    `json:"completion_tokens,omitempty"` // 用于按倍率计费
 	TotalTokens      int    `json:"total_tokens,omitempty"`      // 用于按倍率计费
+	FineTunedModel   string `json:"fine_tuned_model,omitempty"`  // 微调任务产出的模型名
 }
 
 func FailTaskInfo(reason string) *TaskInfo {
@@ -0,0 +1,186 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/relay/channel/gemini"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// embeddingInputTypeApiTypes are the channels whose embedding conversion
+// understands input_type. Other upstreams may reject it as an unknown field,
+// so a Gemini taskType is only passed on to these.
+var embeddingInputTypeApiTypes = map[int]bool{
+	constant.APITypeCohere:   true,
+	constant.APITypeAws:      true,
+	constant.APITypeVertexAi: true,
+}
+
+// geminiEmbeddingRequestToOpenAI converts Gemini embedContent requests to one
+// OpenAI embedding request with an input per Gemini request.
+func geminiEmbeddingRequestToOpenAI(info *relaycommon.RelayInfo, requests []*dto.GeminiEmbeddingRequest) (*dto.EmbeddingRequest, error) {
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("requests is empty")
+	}
+	inputs := make([]any, 0, len(requests))
+	request := &dto.EmbeddingRequest{Model: info.UpstreamModelName}
+	for _, r := range requests {
+		if r == nil {
+			return nil, fmt.Errorf("request is null")
+		}
+		texts := make([]string, 0, len(r.Content.Parts))
+		for _, part := range r.Content.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) == 0 {
+			return nil, fmt.Errorf("only text content can be embedded by this channel")
+		}
+		// parts of one content make a single embedding
+		inputs = append(inputs, strings.Join(texts, "\n"))
+		if r.OutputDimensionality > 0 && request.Dimensions == nil {
+			dimensions := r.OutputDimensionality
+			request.Dimensions = &dimensions
+		}
+		if r.TaskType != "" && request.InputType == "" && embeddingInputTypeApiTypes[info.ApiType] {
+			request.InputType = gemini.EmbeddingTaskTypeToInputType(r.TaskType)
+		}
+	}
+	request.Input = inputs
+	return request, nil
+}
+
+func openAIEmbeddingResponseToGemini(response *dto.EmbeddingResponse, batch bool) any {
+	data := response.Data
+	sort.SliceStable(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+	if !batch {
+		geminiResp := dto.GeminiEmbeddingResponse{}
+		if len(data) > 0 {
+			geminiResp.Embedding.Values = data[0].Embedding
+		}
+		return geminiResp
+	}
+	geminiResp := dto.GeminiBatchEmbeddingResponse{
+		Embeddings: make([]*dto.ContentEmbedding, 0, len(data)),
+	}
+	for _, item := range data {
+		geminiResp.Embeddings = append(geminiResp.Embeddings, &dto.ContentEmbedding{Values: item.Embedding})
+	}
+	return geminiResp
+}
+
+// embeddingCaptureWriter keeps what an adaptor writes for the client, so that
+// the OpenAI embedding response can be converted before it is sent.
+type embeddingCaptureWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *embeddingCaptureWriter) Header() http.Header { return w.header }
+
+func (w *embeddingCaptureWriter) WriteHeader(int) {}
+
+func (w *embeddingCaptureWriter) WriteHeaderNow() {}
+
+func (w *embeddingCaptureWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+func (w *embeddingCaptureWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+
+func (w *embeddingCaptureWriter) Flush() {}
+
+// geminiEmbeddingViaOpenAI serves a Gemini embedContent or batchEmbedContents
+// request from a channel that takes OpenAI embedding requests: it is relayed
+// as /v1/embeddings and the embeddings are returned in the Gemini format.
+func geminiEmbeddingViaOpenAI(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, requests []*dto.GeminiEmbeddingRequest) (*dto.Usage, *types.NewAPIError) {
+	request, err := geminiEmbeddingRequestToOpenAI(info, requests)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	savedRelayMode := info.RelayMode
+	savedRelayFormat := info.RelayFormat
+	savedRequestURLPath := info.RequestURLPath
+	defer func() {
+		info.RelayMode = savedRelayMode
+		info.RelayFormat = savedRelayFormat
+		info.RequestURLPath = savedRequestURLPath
+	}()
+
+	info.RelayMode = relayconstant.RelayModeEmbeddings
+	info.RelayFormat = types.RelayFormatEmbedding
+	info.RequestURLPath = "/v1/embeddings"
+
+	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, info, *request)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	if info.HasParamOverride() {
+		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+		if err != nil {
+			return nil, newAPIErrorFromParamOverride(err)
+		}
+	}
+
+	body, size, closer, err := relaycommon.NewOutboundJSONBody(jsonData)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	defer closer.Close()
+	jsonData = nil
+	info.UpstreamRequestBodySize = size
+	var requestBody io.Reader = body
+
+	resp, err := adaptor.DoRequest(c, info, requestBody)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+			service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+			return nil, newAPIError
+		}
+	}
+
+	writer := &embeddingCaptureWriter{ResponseWriter: c.Writer, header: http.Header{}}
+	c.Writer = writer
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	c.Writer = writer.ResponseWriter
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, newAPIError
+	}
+
+	var openAIResp dto.EmbeddingResponse
+	if err := common.Unmarshal(writer.body.Bytes(), &openAIResp); err != nil {
+		return nil, types.NewOpenAIError(fmt.Errorf("failed to parse embedding response: %w", err), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	c.JSON(http.StatusOK, openAIEmbeddingResponseToGemini(&openAIResp, info.IsGeminiBatchEmbedding))
+	return usage.(*dto.Usage), nil
+}
@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiEmbeddingRequestToOpenAI(t *testing.T) {
+	requests := []*dto.GeminiEmbeddingRequest{
+		{
+			Content:              dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: "a"}, {Text: "b"}}},
+			TaskType:             "RETRIEVAL_QUERY",
+			OutputDimensionality: 256,
+		},
+		{Content: dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: "c"}}}},
+	}
+
+	info := &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{ApiType: constant.APITypeCohere, UpstreamModelName: "embed-v4.0"},
+	}
+	request, err := geminiEmbeddingRequestToOpenAI(info, requests)
+	require.NoError(t, err)
+	assert.Equal(t, "embed-v4.0", request.Model)
+	assert.Equal(t, []any{"a\nb", "c"}, request.Input)
+	require.NotNil(t, request.Dimensions)
+	assert.Equal(t, 256, *request.Dimensions)
+	assert.Equal(t, "search_query", request.InputType)
+
+	// OpenAI rejects unknown fields, so the task type is not passed on
+	info.ApiType = constant.APITypeOpenAI
+	request, err = geminiEmbeddingRequestToOpenAI(info, requests)
+	require.NoError(t, err)
+	assert.Empty(t, request.InputType)
+
+	_, err = geminiEmbeddingRequestToOpenAI(info, []*dto.GeminiEmbeddingRequest{{}})
+	require.Error(t, err)
+}
+
+func TestOpenAIEmbeddingResponseToGemini(t *testing.T) {
+	response := &dto.EmbeddingResponse{
+		Data: []dto.EmbeddingResponseItem{
+			{Index: 1, Embedding: []float64{2}},
+			{Index: 0, Embedding: []float64{1}},
+		},
+	}
+
+	batch, err := common.Marshal(openAIEmbeddingResponseToGemini(response, true))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"embeddings":[{"values":[1]},{"values":[2]}]}`, string(batch))
+
+	single, err := common.Marshal(openAIEmbeddingResponseToGemini(response, false))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"embedding":{"values":[1]}}`, string(single))
+}
+
+func TestEmbeddingCaptureWriterKeepsResponseFromClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	writer := &embeddingCaptureWriter{ResponseWriter: c.Writer, header: http.Header{}}
+	c.Writer = writer
+	c.Header("Content-Length", "9")
+	c.Data(http.StatusCreated, "application/json", []byte(`{"a":1}`))
+	c.Writer = writer.ResponseWriter
+	c.JSON(http.StatusOK, gin.H{"b": 2})
+
+	assert.Equal(t, `{"a":1}`, writer.body.String())
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Content-Length"))
+	assert.JSONEq(t, `{"b":2}`, recorder.Body.String())
+}
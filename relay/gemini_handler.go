@@ -155,7 +155,7 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 
 		// apply param override
-		if len(info.ParamOverride) > 0 {
+		if info.HasParamOverride() {
 			jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
 			if err != nil {
 				return newAPIErrorFromParamOverride(err)
@@ -213,6 +213,7 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 	var req dto.Request
 	var err error
 	var inputTexts []string
+	var requests []*dto.GeminiEmbeddingRequest
 
 	if isBatch {
 		batchRequest := &dto.GeminiBatchEmbeddingRequest{}
@@ -221,6 +222,7 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 			return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 		}
 		req = batchRequest
+		requests = batchRequest.Requests
 		for _, r := range batchRequest.Requests {
 			for _, part := range r.Content.Parts {
 				if part.Text != "" {
@@ -235,6 +237,7 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 			return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 		}
 		req = singleRequest
+		requests = []*dto.GeminiEmbeddingRequest{singleRequest}
 		for _, part := range singleRequest.Content.Parts {
 			if part.Text != "" {
 				inputTexts = append(inputTexts, part.Text)
@@ -255,6 +258,15 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 	}
 	adaptor.Init(info)
 
+	if info.ApiType != constant.APITypeGemini {
+		usage, newAPIError := geminiEmbeddingViaOpenAI(c, info, adaptor, requests)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		service.PostTextConsumeQuota(c, info, usage, nil)
+		return nil
+	}
+
 	var requestBody io.Reader
 	jsonData, err := common.Marshal(req)
 	if err != nil {
@@ -262,7 +274,7 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 	}
 
 	// apply param override
-	if len(info.ParamOverride) > 0 {
+	if info.HasParamOverride() {
 		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
 		if err != nil {
 			return newAPIErrorFromParamOverride(err)
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
@@ -163,6 +164,13 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
 	}
+	// requests replayed by the batch runner are billed at the batch discount
+	if batchRatio, ok := common.GetContextKeyType[float64](c, constant.ContextKeyBatchRatio); ok && batchRatio != 1 {
+		priceData.AddOtherRatio("batch", batchRatio)
+		if !usePrice {
+			priceData.QuotaToPreConsume = int(priceData.ApplyOtherRatiosToFloat(float64(preConsumedQuota)))
+		}
+	}
 	if usePrice {
 		for name, ratio := range meta.BillingRatios {
 			priceData.AddOtherRatio(name, ratio)
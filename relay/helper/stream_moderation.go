@@ -0,0 +1,285 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var errCompletionSensitive = errors.New("sensitive words detected in completion")
+
+// completionText is a piece of generated text in a stream chunk, with the
+// sjson path it was read from. final is set when the chunk also finishes the
+// choice or candidate, so no more text follows on the path.
+type completionText struct {
+	path  string
+	text  string
+	final bool
+}
+
+// completionTexts returns the generated text carried by an upstream stream
+// chunk in the OpenAI chat or completions, Responses, Claude or Gemini
+// format. Reasoning and tool call deltas are not included.
+func completionTexts(data string) []completionText {
+	var texts []completionText
+	add := func(path string, value gjson.Result, final bool) {
+		if value.Type == gjson.String && value.Str != "" {
+			texts = append(texts, completionText{path: path, text: value.Str, final: final})
+		}
+	}
+	root := gjson.Parse(data)
+	switch root.Get("type").String() {
+	case "content_block_delta":
+		add("delta.text", root.Get("delta.text"), false)
+		return texts
+	case "response.output_text.delta":
+		add("delta", root.Get("delta"), false)
+		return texts
+	}
+	root.Get("choices").ForEach(func(key, choice gjson.Result) bool {
+		final := choice.Get("finish_reason").String() != ""
+		add(fmt.Sprintf("choices.%d.delta.content", key.Int()), choice.Get("delta.content"), final)
+		add(fmt.Sprintf("choices.%d.text", key.Int()), choice.Get("text"), final)
+		return true
+	})
+	root.Get("candidates").ForEach(func(key, candidate gjson.Result) bool {
+		final := candidate.Get("finishReason").String() != ""
+		candidate.Get("content.parts").ForEach(func(partKey, part gjson.Result) bool {
+			if !part.Get("thought").Bool() {
+				add(fmt.Sprintf("candidates.%d.content.parts.%d.text", key.Int(), partKey.Int()), part.Get("text"), final)
+			}
+			return true
+		})
+		return true
+	})
+	return texts
+}
+
+// moderationGateWriter drops every write once the stream was ended for a
+// sensitive word, so the closing events of the handler do not follow ours.
+type moderationGateWriter struct {
+	gin.ResponseWriter
+	closed bool
+}
+
+func (w *moderationGateWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *moderationGateWriter) WriteString(s string) (int, error) {
+	if w.closed {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// streamModerator checks the text generated in a stream for sensitive words.
+// It masks them in flight, or ends the stream in the format of the client
+// when StopOnSensitiveEnabled is set. The end of each text that could start a
+// word is held back and sent with the next chunk, so no part of a word split
+// across chunks reaches the client.
+type streamModerator struct {
+	c          *gin.Context
+	info       *relaycommon.RelayInfo
+	filter     *service.CompletionSensitiveFilter
+	gate       *moderationGateWriter
+	responseId string
+	stopped    bool
+	// heldPaths are the text paths with text held back, in the order they
+	// were first seen, and templates the last chunk that carried each one.
+	heldPaths []string
+	templates map[string]string
+}
+
+// newStreamModerator returns nil when completions are not checked.
+func newStreamModerator(c *gin.Context, info *relaycommon.RelayInfo) *streamModerator {
+	filter := service.NewCompletionSensitiveFilter()
+	if filter == nil {
+		return nil
+	}
+	gate := &moderationGateWriter{ResponseWriter: c.Writer}
+	c.Writer = gate
+	return &streamModerator{
+		c:         c,
+		info:      info,
+		filter:    filter,
+		gate:      gate,
+		templates: make(map[string]string),
+	}
+}
+
+// moderate checks the generated text of data and returns the chunks to pass
+// on and whether the stream has to stop. Text held back for a path data does
+// not continue is passed on first, in a copy of the chunk that carried it. A
+// stopping chunk is still passed on, with its text removed, so the handler
+// flushes what it held back.
+func (m *streamModerator) moderate(data string) ([]string, bool) {
+	texts := completionTexts(data)
+	var chunks []string
+	for _, path := range slices.Clone(m.heldPaths) {
+		if !slices.ContainsFunc(texts, func(text completionText) bool { return text.path == path }) {
+			chunks = append(chunks, m.releasePath(path)...)
+		}
+	}
+	if len(texts) == 0 {
+		return append(chunks, data), false
+	}
+	if id := gjson.Get(data, "id"); id.Type == gjson.String {
+		m.responseId = id.Str
+	}
+	stopOnSensitive := setting.StopOnSensitiveEnabled
+	template := data
+	found := false
+	for _, text := range texts {
+		words, safe := m.filter.Check(text.path, text.text, text.final)
+		if len(words) > 0 {
+			found = true
+		}
+		if updated, err := sjson.Set(data, text.path, safe); err == nil {
+			data = updated
+		}
+		if text.final {
+			m.forgetPath(text.path)
+		} else {
+			if _, ok := m.templates[text.path]; !ok {
+				m.heldPaths = append(m.heldPaths, text.path)
+			}
+			m.templates[text.path] = template
+		}
+	}
+	if !found {
+		return append(chunks, data), false
+	}
+	common.SetContextKey(m.c, constant.ContextKeyCompletionSensitiveWords, m.filter.Words())
+	if !stopOnSensitive {
+		return append(chunks, data), false
+	}
+	for _, text := range texts {
+		if updated, err := sjson.Set(data, text.path, ""); err == nil {
+			data = updated
+		}
+	}
+	return append(chunks, data), true
+}
+
+// release returns the chunks carrying the text still held back once the
+// upstream stream ended.
+func (m *streamModerator) release() []string {
+	var chunks []string
+	for _, path := range slices.Clone(m.heldPaths) {
+		chunks = append(chunks, m.releasePath(path)...)
+	}
+	return chunks
+}
+
+// releasePath returns a copy of the last chunk of path carrying only the text
+// held back for it, without usage or finish reason so the handler counts
+// neither twice.
+func (m *streamModerator) releasePath(path string) []string {
+	template := m.templates[path]
+	m.forgetPath(path)
+	text := m.filter.Release(path)
+	if text == "" {
+		return nil
+	}
+	chunk, err := sjson.Set(template, path, text)
+	if err != nil {
+		return nil
+	}
+	chunk, _ = sjson.Delete(chunk, "usage")
+	chunk, _ = sjson.Delete(chunk, "usageMetadata")
+	if parts := strings.SplitN(path, ".", 3); len(parts) == 3 {
+		switch parts[0] {
+		case "choices":
+			chunk, _ = sjson.Set(chunk, parts[0]+"."+parts[1]+".finish_reason", nil)
+		case "candidates":
+			chunk, _ = sjson.Delete(chunk, parts[0]+"."+parts[1]+".finishReason")
+		}
+	}
+	return []string{chunk}
+}
+
+func (m *streamModerator) forgetPath(path string) {
+	delete(m.templates, path)
+	m.heldPaths = slices.DeleteFunc(m.heldPaths, func(held string) bool { return held == path })
+}
+
+// stop ends the stream for the client with a content filter finish reason
+// and an error event, then closes the gate.
+func (m *streamModerator) stop() {
+	m.stopped = true
+	logger.LogWarn(m.c, fmt.Sprintf("completion sensitive words detected: %s", strings.Join(m.filter.Words(), ", ")))
+	common.SetContextKey(m.c, constant.ContextKeyCompletionSensitiveStopped, true)
+	common.SetContextKey(m.c, constant.ContextKeyAdminRejectReason, "completion_sensitive_words")
+
+	apiErr := types.NewErrorWithStatusCode(errCompletionSensitive, types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest)
+	switch m.info.RelayFormat {
+	case types.RelayFormatClaude:
+		stopReason := "refusal"
+		_ = ClaudeData(m.c, dto.ClaudeResponse{
+			Type:  "message_delta",
+			Delta: &dto.ClaudeMediaMessage{StopReason: &stopReason},
+			Usage: &dto.ClaudeUsage{},
+		})
+		_ = ClaudeData(m.c, dto.ClaudeResponse{Type: "error", Error: apiErr.ToClaudeError()})
+		_ = ClaudeData(m.c, dto.ClaudeResponse{Type: "message_stop"})
+	case types.RelayFormatGemini:
+		finishReason := "BLOCKLIST"
+		_ = ObjectData(m.c, dto.GeminiChatResponse{
+			Candidates: []dto.GeminiChatCandidate{{
+				Content:      dto.GeminiChatContent{Role: "model", Parts: []dto.GeminiPart{}},
+				FinishReason: &finishReason,
+			}},
+		})
+		_ = ObjectData(m.c, gin.H{"error": gin.H{
+			"code":    http.StatusBadRequest,
+			"message": errCompletionSensitive.Error(),
+			"status":  "INVALID_ARGUMENT",
+		}})
+	case types.RelayFormatOpenAIResponses:
+		oaiErr := apiErr.ToOpenAIError()
+		data, err := common.Marshal(gin.H{"type": "error", "code": oaiErr.Code, "message": oaiErr.Message})
+		if err == nil {
+			_ = ResponseChunkData(m.c, dto.ResponsesStreamResponse{Type: "error"}, string(data))
+		}
+	default:
+		responseId := m.responseId
+		if responseId == "" {
+			responseId = GetResponseID(m.c)
+		}
+		_ = ObjectData(m.c, GenerateStopResponse(responseId, time.Now().Unix(), m.info.UpstreamModelName, constant.FinishReasonContentFilter))
+		_ = ObjectData(m.c, gin.H{"error": apiErr.ToOpenAIError()})
+		Done(m.c)
+	}
+	m.gate.closed = true
+}
+
+// chargeViolationFee charges the sensitive completion fee once the stream
+// was stopped. A hedge attempt that lost the race sent nothing and is not
+// charged.
+func (m *streamModerator) chargeViolationFee() {
+	if !m.stopped || service.IsHedgeLoser(m.c) {
+		return
+	}
+	apiErr := types.NewErrorWithStatusCode(errCompletionSensitive, types.ErrorCodeViolationFeeSensitive, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	service.ChargeViolationFeeIfNeeded(m.c, m.info, apiErr)
+}
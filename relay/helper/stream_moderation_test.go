@@ -0,0 +1,168 @@
+package helper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func withCompletionSensitive(t *testing.T, stop bool, words ...string) {
+	t.Helper()
+	savedEnabled, savedCompletion, savedStop, savedWords := setting.CheckSensitiveEnabled, setting.CheckSensitiveOnCompletionEnabled, setting.StopOnSensitiveEnabled, setting.SensitiveWords
+	setting.CheckSensitiveEnabled = true
+	setting.CheckSensitiveOnCompletionEnabled = true
+	setting.StopOnSensitiveEnabled = stop
+	setting.SensitiveWords = words
+	t.Cleanup(func() {
+		setting.CheckSensitiveEnabled = savedEnabled
+		setting.CheckSensitiveOnCompletionEnabled = savedCompletion
+		setting.StopOnSensitiveEnabled = savedStop
+		setting.SensitiveWords = savedWords
+	})
+}
+
+func TestCompletionTexts(t *testing.T) {
+	texts := completionTexts(`{"choices":[{"index":0,"delta":{"content":"a"}},{"index":1,"delta":{"content":"b"}}]}`)
+	require.Len(t, texts, 2)
+	assert.Equal(t, "choices.1.delta.content", texts[1].path)
+
+	texts = completionTexts(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`)
+	require.Len(t, texts, 1)
+	assert.Equal(t, "delta.text", texts[0].path)
+
+	texts = completionTexts(`{"candidates":[{"content":{"parts":[{"text":"plan","thought":true},{"text":"answer"}]}}]}`)
+	require.Len(t, texts, 1)
+	assert.Equal(t, "candidates.0.content.parts.1.text", texts[0].path)
+
+	assert.Empty(t, completionTexts(`{"type":"content_block_delta","delta":{"type":"input_json_delta","partial_json":"{}"}}`))
+}
+
+func TestStreamScannerHandler_MasksSensitiveWordsAcrossChunks(t *testing.T) {
+	withCompletionSensitive(t, false, "forbidden")
+
+	body := "data: {\"choices\":[{\"delta\":{\"content\":\"this is forb\"}}]}\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"idden text\"}}]}\n" +
+		"data: [DONE]\n"
+	c, resp, info := setupStreamTest(t, strings.NewReader(body))
+
+	var got []string
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		got = append(got, data)
+	})
+
+	var text strings.Builder
+	for _, data := range got {
+		assert.NotContains(t, data, "forb", "no part of the word is sent before it can be masked")
+		text.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+	}
+	assert.Equal(t, "this is **###** text", text.String())
+	assert.Equal(t, []string{"forbidden"}, common.GetContextKeyStringSlice(c, constant.ContextKeyCompletionSensitiveWords))
+	assert.False(t, common.GetContextKeyBool(c, constant.ContextKeyCompletionSensitiveStopped))
+}
+
+func newModerationStreamTest(t *testing.T, body string, format types.RelayFormat) (*gin.Context, *httptest.ResponseRecorder, *http.Response, *relaycommon.RelayInfo) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	info := &relaycommon.RelayInfo{
+		RelayFormat: format,
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gpt-4o"},
+	}
+	return c, recorder, &http.Response{Body: io.NopCloser(strings.NewReader(body))}, info
+}
+
+func TestStreamScannerHandler_StopsOnSensitiveWords(t *testing.T) {
+	withCompletionSensitive(t, true, "forbidden")
+
+	body := "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"fine\"}}]}\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"a forbidden word\"}}]}\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"more\"}}]}\n" +
+		"data: [DONE]\n"
+	c, recorder, resp, info := newModerationStreamTest(t, body, types.RelayFormatOpenAI)
+
+	var got []string
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		got = append(got, data)
+		_ = StringData(c, data)
+	})
+	// the closing events of the handler are dropped
+	Done(c)
+
+	require.Len(t, got, 2)
+	assert.NotContains(t, got[1], "forbidden")
+	assert.True(t, common.GetContextKeyBool(c, constant.ContextKeyCompletionSensitiveStopped))
+
+	output := recorder.Body.String()
+	assert.NotContains(t, output, "forbidden")
+	assert.NotContains(t, output, "more")
+	assert.Contains(t, output, `"id":"chatcmpl-1"`)
+	assert.Contains(t, output, `"finish_reason":"content_filter"`)
+	assert.Contains(t, output, `"code":"sensitive_words_detected"`)
+	assert.Equal(t, 1, strings.Count(output, "[DONE]"))
+}
+
+func TestStreamScannerHandler_StopsClaudeStreamWithRefusal(t *testing.T) {
+	withCompletionSensitive(t, true, "forbidden")
+
+	body := "data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"forbidden\"}}\n"
+	c, recorder, resp, info := newModerationStreamTest(t, body, types.RelayFormatClaude)
+
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {})
+
+	output := recorder.Body.String()
+	assert.Contains(t, output, `"stop_reason":"refusal"`)
+	assert.Contains(t, output, "event: error")
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(output), `data: {"type":"message_stop"}`))
+}
+
+func TestStreamScannerHandler_StopsOnSensitiveWordsAcrossChunks(t *testing.T) {
+	withCompletionSensitive(t, true, "forbidden")
+
+	body := "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"this is forb\"}}]}\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"idden text\"}}]}\n" +
+		"data: [DONE]\n"
+	c, recorder, resp, info := newModerationStreamTest(t, body, types.RelayFormatOpenAI)
+
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		_ = StringData(c, data)
+	})
+	Done(c)
+
+	output := recorder.Body.String()
+	assert.Contains(t, output, `"content":"this"`)
+	assert.NotContains(t, output, "forb")
+	assert.NotContains(t, output, "text")
+	assert.Contains(t, output, `"finish_reason":"content_filter"`)
+	assert.True(t, common.GetContextKeyBool(c, constant.ContextKeyCompletionSensitiveStopped))
+}
+
+func TestStreamScannerHandler_ReleasesHeldTextAtTheEnd(t *testing.T) {
+	withCompletionSensitive(t, false, "forbidden")
+
+	body := "data: {\"choices\":[{\"delta\":{\"content\":\"all fine here\"}}],\"usage\":{\"total_tokens\":3}}\n"
+	c, resp, info := setupStreamTest(t, strings.NewReader(body))
+
+	var got []string
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		got = append(got, data)
+	})
+
+	require.Len(t, got, 2)
+	assert.Equal(t, "all f", gjson.Get(got[0], "choices.0.delta.content").String())
+	assert.Equal(t, "ine here", gjson.Get(got[1], "choices.0.delta.content").String())
+	assert.False(t, gjson.Get(got[1], "usage").Exists(), "the usage of the chunk is not counted twice")
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -20,6 +21,7 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -83,6 +85,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	// 无条件新建 StreamStatus
 	info.StreamStatus = relaycommon.NewStreamStatus()
 
+	span := tracing.StartSpan(c, "stream_scan")
+	defer span.End()
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
@@ -143,6 +148,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	scanner.Split(bufio.ScanLines)
 	copyCodexSSEHeaders(c, resp)
 	SetEventStreamHeaders(c)
+	moderator := newStreamModerator(c, info)
 
 	ctx = context.WithValue(ctx, "stop_chan", stopChan)
 
@@ -209,16 +215,38 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			wg.Done()
 		}()
 		sr := newStreamResult(info.StreamStatus)
-		for data := range dataChan {
+		handle := func(data string, moderationStop bool) bool {
 			sr.reset()
-			func() {
-				writeMutex.Lock()
-				defer writeMutex.Unlock()
-				ExtendWriteDeadline(c)
-				dataHandler(data, sr)
-			}()
-			if sr.IsStopped() {
-				return
+			writeMutex.Lock()
+			defer writeMutex.Unlock()
+			ExtendWriteDeadline(c)
+			dataHandler(data, sr)
+			if moderationStop {
+				moderator.stop()
+				sr.Stop(errCompletionSensitive)
+			}
+			return !sr.IsStopped()
+		}
+		for data := range dataChan {
+			if moderator == nil {
+				if !handle(data, false) {
+					return
+				}
+				continue
+			}
+			chunks, moderationStop := moderator.moderate(data)
+			for i, chunk := range chunks {
+				if !handle(chunk, moderationStop && i == len(chunks)-1) {
+					return
+				}
+			}
+		}
+		if moderator != nil {
+			// the text held back to check it against the next chunk
+			for _, chunk := range moderator.release() {
+				if !handle(chunk, false) {
+					return
+				}
 			}
 		}
 	})
@@ -302,6 +330,16 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	}
 
 	cleanup()
+	if moderator != nil {
+		moderator.chargeViolationFee()
+	}
+	span.SetAttributes(
+		attribute.String("end_reason", string(info.StreamStatus.EndReason)),
+		attribute.Int("received_chunks", info.ReceivedResponseCount),
+	)
+	if !info.StreamStatus.IsNormalEnd() {
+		span.SetError(fmt.Errorf("stream ended: %s", info.StreamStatus.EndReason))
+	}
 	if info.StreamStatus.IsNormalEnd() && !info.StreamStatus.HasErrors() {
 		logger.LogInfo(c, fmt.Sprintf("stream ended: %s", info.StreamStatus.Summary()))
 	} else {
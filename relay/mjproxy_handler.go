@@ -22,6 +22,7 @@ import (
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 )
@@ -211,46 +212,38 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		}
 	}
 
-	userQuota, err := model.GetUserQuota(info.UserId, false)
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: err.Error(),
-		}
-	}
-
-	if userQuota-priceData.Quota < 0 {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "quota_not_enough",
-		}
+	if mjErr := preConsumeMidjourneyQuota(c, info, priceData.Quota); mjErr != nil {
+		return mjErr
 	}
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	baseURL := c.GetString("base_url")
 	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
 	mjResp, _, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
+		info.Billing.Refund(c)
 		return &mjResp.Response
 	}
 	defer func() {
-		if mjResp.StatusCode == 200 && mjResp.Response.Code == 1 {
-			err := service.PostConsumeQuota(info, priceData.Quota, 0, true)
-			if err != nil {
-				common.SysLog("error consuming token remain quota: " + err.Error())
-			}
+		accepted := mjResp.StatusCode == 200 && mjResp.Response.Code == 1
+		if err := settleMidjourneyQuota(c, info, priceData.Quota, accepted); err != nil {
+			common.SysLog("error consuming midjourney quota: " + err.Error())
+		}
+		if accepted {
 
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, constant.MjActionSwapFace)
 			other := service.GenerateMjOtherInfo(info, priceData)
 			model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-				ChannelId: info.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   info.TokenId,
-				Group:     info.UsingGroup,
-				Other:     other,
+				ChannelId:      info.ChannelId,
+				ModelName:      modelName,
+				TokenName:      tokenName,
+				Quota:          priceData.Quota,
+				Content:        logContent,
+				TokenId:        info.TokenId,
+				Group:          info.UsingGroup,
+				Other:          other,
+				OrganizationId: info.OrganizationId,
+				BudgetSettled:  info.BudgetSettled,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(info.UserId, priceData.Quota)
 			model.UpdateChannelUsedQuota(info.ChannelId, priceData.Quota)
@@ -276,6 +269,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
 	}
+	recordMidjourneyBillingSource(midjourneyTask, info)
 	err = midjourneyTask.Insert()
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "insert_midjourney_task_failed")
@@ -518,45 +512,41 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		}
 	}
 
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: err.Error(),
-		}
-	}
-
-	if consumeQuota && userQuota-priceData.Quota < 0 {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "quota_not_enough",
+	if consumeQuota {
+		if mjErr := preConsumeMidjourneyQuota(c, relayInfo, priceData.Quota); mjErr != nil {
+			return mjErr
 		}
 	}
 
 	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
+		if relayInfo.Billing != nil {
+			relayInfo.Billing.Refund(c)
+		}
 		return &midjResponseWithStatus.Response
 	}
 	midjResponse := &midjResponseWithStatus.Response
 
 	defer func() {
-		if consumeQuota && midjResponseWithStatus.StatusCode == 200 {
-			err := service.PostConsumeQuota(relayInfo, priceData.Quota, 0, true)
-			if err != nil {
-				common.SysLog("error consuming token remain quota: " + err.Error())
-			}
+		accepted := consumeQuota && midjResponseWithStatus.StatusCode == 200
+		if err := settleMidjourneyQuota(c, relayInfo, priceData.Quota, accepted); err != nil {
+			common.SysLog("error consuming midjourney quota: " + err.Error())
+		}
+		if accepted {
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s，ID %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, midjRequest.Action, midjResponse.Result)
 			other := service.GenerateMjOtherInfo(relayInfo, priceData)
 			model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
-				ChannelId: relayInfo.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   relayInfo.TokenId,
-				Group:     relayInfo.UsingGroup,
-				Other:     other,
+				ChannelId:      relayInfo.ChannelId,
+				ModelName:      modelName,
+				TokenName:      tokenName,
+				Quota:          priceData.Quota,
+				Content:        logContent,
+				TokenId:        relayInfo.TokenId,
+				Group:          relayInfo.UsingGroup,
+				Other:          other,
+				OrganizationId: relayInfo.OrganizationId,
+				BudgetSettled:  relayInfo.BudgetSettled,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, priceData.Quota)
 			model.UpdateChannelUsedQuota(relayInfo.ChannelId, priceData.Quota)
@@ -632,6 +622,9 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		midjourneyTask.Progress = "100%"
 		midjourneyTask.Status = "SUCCESS"
 	}
+	if consumeQuota {
+		recordMidjourneyBillingSource(midjourneyTask, relayInfo)
+	}
 	err = midjourneyTask.Insert()
 	if err != nil {
 		return &dto.MidjourneyResponse{
@@ -670,6 +663,45 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 	return nil
 }
 
+// preConsumeMidjourneyQuota reserves the fixed price of a Midjourney action
+// through a billing session, so that it is paid by the same wallet,
+// subscription or organization quota pool as any other relay.
+func preConsumeMidjourneyQuota(c *gin.Context, info *relaycommon.RelayInfo, quota int) *dto.MidjourneyResponse {
+	info.ForcePreConsume = true
+	if apiErr := service.PreConsumeBilling(c, quota, info); apiErr != nil {
+		description := apiErr.Error()
+		if apiErr.GetErrorCode() == types.ErrorCodeInsufficientUserQuota {
+			description = "quota_not_enough"
+		}
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: description,
+		}
+	}
+	return nil
+}
+
+// settleMidjourneyQuota charges the reserved quota of an accepted action and
+// returns it otherwise.
+func settleMidjourneyQuota(c *gin.Context, info *relaycommon.RelayInfo, quota int, accepted bool) error {
+	if info.Billing == nil {
+		return nil
+	}
+	if !accepted {
+		info.Billing.Refund(c)
+		return nil
+	}
+	return service.SettleBilling(c, info, quota)
+}
+
+// recordMidjourneyBillingSource keeps the funding source of the request on
+// the task for refunding it when the task fails.
+func recordMidjourneyBillingSource(task *model.Midjourney, info *relaycommon.RelayInfo) {
+	task.BillingSource = info.BillingSource
+	task.SubscriptionId = info.SubscriptionId
+	task.OrganizationId = info.OrganizationId
+}
+
 type taskChangeParams struct {
 	ID     string
 	Action string
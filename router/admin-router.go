@@ -0,0 +1,149 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/service/authz"
+)
+
+// The tables below gate the admin APIs outside channel management on the
+// permissions registered in service/authz. Routes whose permission has no
+// admin baseline (settings, pricing, system tasks) stay root-only until a
+// per-user override grants them.
+
+var userPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.UserRead, handler: controller.GetAllUsers},
+	{method: http.MethodGet, path: "/topup", permission: authz.PaymentRead, handler: controller.GetAllTopUps},
+	{method: http.MethodPost, path: "/topup/complete", permission: authz.PaymentWrite, handler: controller.AdminCompleteTopUp},
+	{method: http.MethodPost, path: "/topup/refund", permission: authz.PaymentRefund, handler: controller.AdminRefundTopUp},
+	{method: http.MethodGet, path: "/topup/refunds", permission: authz.PaymentRead, handler: controller.GetTopUpRefunds},
+	{method: http.MethodGet, path: "/search", permission: authz.UserRead, handler: controller.SearchUsers},
+	{method: http.MethodGet, path: "/:id/oauth/bindings", permission: authz.UserRead, handler: controller.GetUserOAuthBindingsByAdmin},
+	{method: http.MethodDelete, path: "/:id/oauth/bindings/:provider_id", permission: authz.UserSecurityReset, handler: controller.UnbindCustomOAuthByAdmin},
+	{method: http.MethodDelete, path: "/:id/bindings/:binding_type", permission: authz.UserSecurityReset, handler: controller.AdminClearUserBinding},
+	{method: http.MethodGet, path: "/:id", permission: authz.UserRead, handler: controller.GetUser},
+	{method: http.MethodPost, path: "/", permission: authz.UserWrite, handler: controller.CreateUser},
+	{method: http.MethodPost, path: "/manage", permission: authz.UserWrite, handler: controller.ManageUser},
+	{method: http.MethodPut, path: "/", permission: authz.UserWrite, handler: controller.UpdateUser},
+	{method: http.MethodDelete, path: "/:id", permission: authz.UserSensitiveWrite, handler: controller.DeleteUser},
+	{method: http.MethodDelete, path: "/:id/reset_passkey", permission: authz.UserSecurityReset, handler: controller.AdminResetPasskey},
+	{method: http.MethodGet, path: "/2fa/stats", permission: authz.UserRead, handler: controller.Admin2FAStats},
+	{method: http.MethodDelete, path: "/:id/2fa", permission: authz.UserSecurityReset, handler: controller.AdminDisable2FA},
+}
+
+var tokenAdminPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/users/:id", permission: authz.TokenRead, handler: controller.AdminGetUserTokens},
+	{method: http.MethodPut, path: "/:id/status", permission: authz.TokenWrite, handler: controller.AdminUpdateTokenStatus},
+}
+
+var redemptionPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.RedemptionRead, handler: controller.GetAllRedemptions},
+	{method: http.MethodGet, path: "/search", permission: authz.RedemptionRead, handler: controller.SearchRedemptions},
+	{method: http.MethodGet, path: "/:id", permission: authz.RedemptionRead, handler: controller.GetRedemption},
+	{method: http.MethodPost, path: "/", permission: authz.RedemptionWrite, handler: controller.AddRedemption},
+	{method: http.MethodPut, path: "/", permission: authz.RedemptionWrite, handler: controller.UpdateRedemption},
+	{method: http.MethodDelete, path: "/invalid", permission: authz.RedemptionWrite, handler: controller.DeleteInvalidRedemption},
+	{method: http.MethodDelete, path: "/:id", permission: authz.RedemptionWrite, handler: controller.DeleteRedemption},
+}
+
+var logPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.LogRead, handler: controller.GetAllLogs},
+	{method: http.MethodGet, path: "/stat", permission: authz.LogRead, handler: controller.GetLogsStat},
+	{method: http.MethodGet, path: "/channel_affinity_usage_cache", permission: authz.LogRead, handler: controller.GetChannelAffinityUsageCacheStats},
+	{method: http.MethodGet, path: "/search", permission: authz.LogRead, handler: controller.SearchAllLogs},
+	{method: http.MethodGet, path: "/body/:request_id", permission: authz.LogContentView, handler: controller.GetLogBody},
+}
+
+var dataPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.LogRead, handler: controller.GetAllQuotaDates},
+	{method: http.MethodGet, path: "/users", permission: authz.LogRead, handler: controller.GetQuotaDatesByUser},
+	{method: http.MethodGet, path: "/flow", permission: authz.LogRead, handler: controller.GetAllFlowQuotaDates},
+}
+
+var optionPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.OptionRead, handler: controller.GetOptions},
+	{method: http.MethodPut, path: "/", permission: authz.OptionWrite, handler: controller.UpdateOption},
+	{method: http.MethodGet, path: "/channel_affinity_cache", permission: authz.OptionRead, handler: controller.GetChannelAffinityCacheStats},
+	{method: http.MethodDelete, path: "/channel_affinity_cache", permission: authz.OptionWrite, handler: controller.ClearChannelAffinityCache},
+	{method: http.MethodDelete, path: "/response_cache", permission: authz.OptionWrite, handler: controller.ClearResponseCache},
+	{method: http.MethodPost, path: "/rest_model_ratio", permission: authz.ModelPricingWrite, handler: controller.ResetModelRatio},
+}
+
+var subscriptionPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/plans", permission: authz.SubscriptionRead, handler: controller.AdminListSubscriptionPlans},
+	{method: http.MethodPost, path: "/plans", permission: authz.SubscriptionWrite, handler: controller.AdminCreateSubscriptionPlan},
+	{method: http.MethodPut, path: "/plans/:id", permission: authz.SubscriptionWrite, handler: controller.AdminUpdateSubscriptionPlan},
+	{method: http.MethodPatch, path: "/plans/:id", permission: authz.SubscriptionWrite, handler: controller.AdminUpdateSubscriptionPlanStatus},
+	{method: http.MethodPost, path: "/bind", permission: authz.SubscriptionGrant, handler: controller.AdminBindSubscription},
+	{method: http.MethodPost, path: "/plans/:id/subscriptions/reset", permission: authz.SubscriptionGrant, handler: controller.AdminResetPlanSubscriptions},
+	{method: http.MethodGet, path: "/users/:id/subscriptions", permission: authz.SubscriptionRead, handler: controller.AdminListUserSubscriptions},
+	{method: http.MethodPost, path: "/users/:id/subscriptions", permission: authz.SubscriptionGrant, handler: controller.AdminCreateUserSubscription},
+	{method: http.MethodPost, path: "/users/:id/subscriptions/reset", permission: authz.SubscriptionGrant, handler: controller.AdminResetUserSubscriptionsByPlan},
+	{method: http.MethodPost, path: "/user_subscriptions/:id/invalidate", permission: authz.SubscriptionGrant, handler: controller.AdminInvalidateUserSubscription},
+	{method: http.MethodDelete, path: "/user_subscriptions/:id", permission: authz.SubscriptionGrant, handler: controller.AdminDeleteUserSubscription},
+}
+
+var budgetPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/users/:id", permission: authz.BudgetRead, handler: controller.AdminListUserBudgets},
+	{method: http.MethodPost, path: "/users/:id", permission: authz.BudgetWrite, handler: controller.AdminCreateUserBudget},
+	{method: http.MethodPut, path: "/:id", permission: authz.BudgetWrite, handler: controller.AdminUpdateBudget},
+	{method: http.MethodDelete, path: "/:id", permission: authz.BudgetWrite, handler: controller.AdminDeleteBudget},
+}
+
+// Minting organization quota and binding organization subscriptions are
+// gated like the same operations on users.
+var organizationPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "", permission: authz.OrganizationRead, handler: controller.AdminListOrganizations},
+	{method: http.MethodPost, path: "", permission: authz.OrganizationWrite, handler: controller.AdminCreateOrganization},
+	{method: http.MethodPut, path: "/:id", permission: authz.OrganizationWrite, handler: controller.AdminUpdateOrganization},
+	{method: http.MethodDelete, path: "/:id", permission: authz.OrganizationWrite, handler: controller.AdminDeleteOrganization},
+	{method: http.MethodPost, path: "/:id/quota", permission: authz.PaymentWrite, handler: controller.AdminAddOrganizationQuota},
+	{method: http.MethodGet, path: "/:id/members", permission: authz.OrganizationRead, handler: controller.AdminListOrganizationMembers},
+	{method: http.MethodPost, path: "/:id/members", permission: authz.OrganizationWrite, handler: controller.AdminAddOrganizationMember},
+	{method: http.MethodPut, path: "/:id/members/:user_id", permission: authz.OrganizationWrite, handler: controller.AdminUpdateOrganizationMember},
+	{method: http.MethodDelete, path: "/:id/members/:user_id", permission: authz.OrganizationWrite, handler: controller.AdminRemoveOrganizationMember},
+	{method: http.MethodGet, path: "/:id/subscriptions", permission: authz.SubscriptionRead, handler: controller.AdminListOrganizationSubscriptions},
+	{method: http.MethodPost, path: "/:id/subscriptions", permission: authz.SubscriptionGrant, handler: controller.AdminCreateOrganizationSubscription},
+	{method: http.MethodGet, path: "/:id/usage", permission: authz.OrganizationRead, handler: controller.AdminGetOrganizationUsage},
+}
+
+var ratioSyncPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/channels", permission: authz.ModelPricingWrite, handler: controller.GetSyncableChannels},
+	{method: http.MethodPost, path: "/fetch", permission: authz.ModelPricingWrite, handler: controller.FetchUpstreamRatios},
+}
+
+var systemTaskPermissionRoutes = []permissionRoute{
+	{method: http.MethodPost, path: "/log-cleanup", permission: authz.SystemTaskWrite, handler: controller.CreateLogCleanupSystemTask},
+	{method: http.MethodGet, path: "/list", permission: authz.SystemTaskRead, handler: controller.ListSystemTasks},
+	{method: http.MethodGet, path: "/current", permission: authz.SystemTaskRead, handler: controller.GetCurrentSystemTask},
+	{method: http.MethodGet, path: "/:task_id", permission: authz.SystemTaskRead, handler: controller.GetSystemTask},
+}
+
+var prefillGroupPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetPrefillGroups},
+	{method: http.MethodPost, path: "/", permission: authz.ModelWrite, handler: controller.CreatePrefillGroup},
+	{method: http.MethodPut, path: "/", permission: authz.ModelWrite, handler: controller.UpdatePrefillGroup},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ModelWrite, handler: controller.DeletePrefillGroup},
+}
+
+var vendorPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetAllVendors},
+	{method: http.MethodGet, path: "/search", permission: authz.ModelRead, handler: controller.SearchVendors},
+	{method: http.MethodGet, path: "/:id", permission: authz.ModelRead, handler: controller.GetVendorMeta},
+	{method: http.MethodPost, path: "/", permission: authz.ModelWrite, handler: controller.CreateVendorMeta},
+	{method: http.MethodPut, path: "/", permission: authz.ModelWrite, handler: controller.UpdateVendorMeta},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ModelWrite, handler: controller.DeleteVendorMeta},
+}
+
+var modelPermissionRoutes = []permissionRoute{
+	{method: http.MethodGet, path: "/sync_upstream/preview", permission: authz.ModelRead, handler: controller.SyncUpstreamPreview},
+	{method: http.MethodPost, path: "/sync_upstream", permission: authz.ModelWrite, handler: controller.SyncUpstreamModels},
+	{method: http.MethodGet, path: "/missing", permission: authz.ModelRead, handler: controller.GetMissingModels},
+	{method: http.MethodGet, path: "/", permission: authz.ModelRead, handler: controller.GetAllModelsMeta},
+	{method: http.MethodGet, path: "/search", permission: authz.ModelRead, handler: controller.SearchModelsMeta},
+	{method: http.MethodGet, path: "/:id", permission: authz.ModelRead, handler: controller.GetModelMeta},
+	{method: http.MethodPost, path: "/", permission: authz.ModelWrite, handler: controller.CreateModelMeta},
+	{method: http.MethodPut, path: "/", permission: authz.ModelWrite, handler: controller.UpdateModelMeta},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ModelWrite, handler: controller.DeleteModelMeta},
+}
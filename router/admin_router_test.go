@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/service/authz"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAdminRoutesSplitReadWriteAndSecurityReset(t *testing.T) {
+	assertRoutePermission(t, userPermissionRoutes, http.MethodGet, "/search", authz.UserRead, controller.SearchUsers)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodPost, "/manage", authz.UserWrite, controller.ManageUser)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodDelete, "/:id", authz.UserSensitiveWrite, controller.DeleteUser)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodDelete, "/:id/2fa", authz.UserSecurityReset, controller.AdminDisable2FA)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodGet, "/topup", authz.PaymentRead, controller.GetAllTopUps)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodPost, "/topup/complete", authz.PaymentWrite, controller.AdminCompleteTopUp)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodPost, "/topup/refund", authz.PaymentRefund, controller.AdminRefundTopUp)
+	assertRoutePermission(t, userPermissionRoutes, http.MethodGet, "/topup/refunds", authz.PaymentRead, controller.GetTopUpRefunds)
+	assertRoutePermission(t, budgetPermissionRoutes, http.MethodGet, "/users/:id", authz.BudgetRead, controller.AdminListUserBudgets)
+	assertRoutePermission(t, budgetPermissionRoutes, http.MethodPost, "/users/:id", authz.BudgetWrite, controller.AdminCreateUserBudget)
+	assertRoutePermission(t, organizationPermissionRoutes, http.MethodPost, "/:id/quota", authz.PaymentWrite, controller.AdminAddOrganizationQuota)
+	assertRoutePermission(t, organizationPermissionRoutes, http.MethodPost, "/:id/subscriptions", authz.SubscriptionGrant, controller.AdminCreateOrganizationSubscription)
+	assertRoutePermission(t, organizationPermissionRoutes, http.MethodPost, "/:id/members", authz.OrganizationWrite, controller.AdminAddOrganizationMember)
+	assertRoutePermission(t, organizationPermissionRoutes, http.MethodGet, "/:id/usage", authz.OrganizationRead, controller.AdminGetOrganizationUsage)
+}
+
+func TestFormerlyRootRoutesUseRootOnlyPermissions(t *testing.T) {
+	assertRoutePermission(t, optionPermissionRoutes, http.MethodPut, "/", authz.OptionWrite, controller.UpdateOption)
+	assertRoutePermission(t, optionPermissionRoutes, http.MethodPost, "/rest_model_ratio", authz.ModelPricingWrite, controller.ResetModelRatio)
+	assertRoutePermission(t, ratioSyncPermissionRoutes, http.MethodPost, "/fetch", authz.ModelPricingWrite, controller.FetchUpstreamRatios)
+	assertRoutePermission(t, systemTaskPermissionRoutes, http.MethodPost, "/log-cleanup", authz.SystemTaskWrite, controller.CreateLogCleanupSystemTask)
+	assertRoutePermission(t, logPermissionRoutes, http.MethodGet, "/body/:request_id", authz.LogContentView, controller.GetLogBody)
+}
+
+func TestApiRoutesRegisterWithoutConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+
+	require.NotPanics(t, func() {
+		SetApiRouter(engine)
+	})
+}
+
+func assertRoutePermission(t *testing.T, routes []permissionRoute, method string, path string, permission authz.Permission, handler any) {
+	t.Helper()
+	for _, route := range routes {
+		if route.method == method && route.path == path {
+			assert.Equal(t, permission, route.permission)
+			assert.Equal(t, reflect.ValueOf(handler).Pointer(), reflect.ValueOf(route.handler).Pointer())
+			return
+		}
+	}
+	t.Fatalf("route %s %s not found", method, path)
+}
@@ -28,8 +28,14 @@ func registerChannelRoutes(apiRouter *gin.RouterGroup) {
 		controller.GetChannelKey,
 	)
 
-	for _, route := range channelPermissionRoutes {
-		channelRoute.Handle(route.method, route.path,
+	handlePermissionRoutes(channelRoute, channelPermissionRoutes)
+}
+
+// handlePermissionRoutes mounts routes on group, each behind the permission it
+// declares. The group is expected to require admin authentication already.
+func handlePermissionRoutes(group *gin.RouterGroup, routes []permissionRoute) {
+	for _, route := range routes {
+		group.Handle(route.method, route.path,
 			middleware.RequirePermission(route.permission),
 			route.handler,
 		)
@@ -42,6 +48,10 @@ var channelPermissionRoutes = []permissionRoute{
 	{method: http.MethodGet, path: "/models", permission: authz.ChannelRead, handler: controller.ChannelListModels},
 	{method: http.MethodGet, path: "/models_enabled", permission: authz.ChannelRead, handler: controller.EnabledListModels},
 	{method: http.MethodGet, path: "/ops", permission: authz.ChannelRead, handler: controller.GetChannelOps},
+	{method: http.MethodGet, path: "/adaptive_scores", permission: authz.ChannelRead, handler: controller.GetChannelAdaptiveScores},
+	{method: http.MethodDelete, path: "/adaptive_scores", permission: authz.ChannelOperate, handler: controller.ResetChannelAdaptiveScores},
+	{method: http.MethodGet, path: "/circuit_breakers", permission: authz.ChannelRead, handler: controller.GetChannelCircuitBreakers},
+	{method: http.MethodDelete, path: "/circuit_breakers", permission: authz.ChannelOperate, handler: controller.ResetChannelCircuitBreakers},
 	{method: http.MethodGet, path: "/:id", permission: authz.ChannelRead, handler: controller.GetChannel},
 	{method: http.MethodGet, path: "/test", permission: authz.ChannelOperate, handler: controller.TestAllChannels},
 	{method: http.MethodGet, path: "/test/:id", permission: authz.ChannelOperate, handler: controller.TestChannel},
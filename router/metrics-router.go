@@ -0,0 +1,21 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	if !constant.MetricsEnabled {
+		return
+	}
+	if constant.MetricsToken == "" && len(constant.MetricsAllowedIPs) == 0 {
+		common.SysError("METRICS_ENABLED is set without METRICS_TOKEN or METRICS_ALLOWED_IPS, /metrics will refuse every scrape")
+	}
+	router.GET("/metrics", middleware.RouteTag("metrics"), middleware.MetricsAuth(), gin.WrapH(prommetrics.Handler()))
+	common.SysLog("prometheus metrics enabled at /metrics")
+}
@@ -46,3 +46,140 @@ func DecodeBase64AudioData(audioBase64 string) (string, error) {
 
 	return audioBase64, nil
 }
+
+// RealtimeAudioToPCM16 decodes audio in a realtime session format into
+// little-endian 16-bit PCM and returns it with its sample rate.
+func RealtimeAudioToPCM16(audio []byte, format string) ([]byte, int) {
+	switch format {
+	case "g711_ulaw":
+		return decodeG711(audio, ulawToLinear), 8000
+	case "g711_alaw":
+		return decodeG711(audio, alawToLinear), 8000
+	default:
+		return audio, 24000
+	}
+}
+
+// PCM16ToRealtimeAudio resamples 16-bit PCM at sampleRate to the rate of a
+// realtime session format and encodes it in that format.
+func PCM16ToRealtimeAudio(pcm []byte, sampleRate int, format string) []byte {
+	switch format {
+	case "g711_ulaw":
+		return encodeG711(ResamplePCM16(pcm, sampleRate, 8000), linearToUlaw)
+	case "g711_alaw":
+		return encodeG711(ResamplePCM16(pcm, sampleRate, 8000), linearToAlaw)
+	default:
+		return ResamplePCM16(pcm, sampleRate, 24000)
+	}
+}
+
+// ResamplePCM16 converts mono 16-bit PCM between sample rates by linear
+// interpolation.
+func ResamplePCM16(pcm []byte, from int, to int) []byte {
+	if from <= 0 || to <= 0 || from == to || len(pcm) < 2 {
+		return pcm
+	}
+	in := len(pcm) / 2
+	out := int(int64(in) * int64(to) / int64(from))
+	result := make([]byte, out*2)
+	sample := func(i int) float64 {
+		return float64(int16(uint16(pcm[2*i]) | uint16(pcm[2*i+1])<<8))
+	}
+	for i := 0; i < out; i++ {
+		pos := float64(i) * float64(from) / float64(to)
+		j := int(pos)
+		value := sample(min(j, in-1))
+		if j+1 < in {
+			value += (sample(j+1) - value) * (pos - float64(j))
+		}
+		v := uint16(int16(value))
+		result[2*i] = byte(v)
+		result[2*i+1] = byte(v >> 8)
+	}
+	return result
+}
+
+func decodeG711(audio []byte, decode func(byte) int16) []byte {
+	pcm := make([]byte, len(audio)*2)
+	for i, b := range audio {
+		v := uint16(decode(b))
+		pcm[2*i] = byte(v)
+		pcm[2*i+1] = byte(v >> 8)
+	}
+	return pcm
+}
+
+func encodeG711(pcm []byte, encode func(int16) byte) []byte {
+	audio := make([]byte, len(pcm)/2)
+	for i := range audio {
+		audio[i] = encode(int16(uint16(pcm[2*i]) | uint16(pcm[2*i+1])<<8))
+	}
+	return audio
+}
+
+func ulawToLinear(b byte) int16 {
+	b = ^b
+	t := (int16(b&0x0f) << 3) + 0x84
+	t <<= (b & 0x70) >> 4
+	if b&0x80 != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+func linearToUlaw(sample int16) byte {
+	const bias, clip = 0x84, 32635
+	s := int32(sample)
+	sign := byte(0)
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	s = min(s, clip) + bias
+	exponent := byte(7)
+	for mask := int32(0x4000); s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := byte(s>>(exponent+3)) & 0x0f
+	return ^(sign | exponent<<4 | mantissa)
+}
+
+func alawToLinear(b byte) int16 {
+	b ^= 0x55
+	t := int16(b&0x0f) << 4
+	segment := (b & 0x70) >> 4
+	switch segment {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= segment - 1
+	}
+	if b&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+func linearToAlaw(sample int16) byte {
+	s := int32(sample)
+	sign := byte(0x80)
+	if s < 0 {
+		s = -s - 1
+		sign = 0
+	}
+	s = min(s, 0x7fff)
+	var compressed byte
+	if s < 256 {
+		compressed = byte(s >> 4)
+	} else {
+		exponent := byte(7)
+		for mask := int32(0x4000); s&mask == 0 && exponent > 1; mask >>= 1 {
+			exponent--
+		}
+		compressed = exponent<<4 | byte(s>>(exponent+3))&0x0f
+	}
+	return (sign | compressed) ^ 0x55
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestG711RoundTrip(t *testing.T) {
+	for _, sample := range []int16{0, 1, -1, 100, -100, 1000, -1000, 12345, -12345, 32767, -32768} {
+		ulaw := ulawToLinear(linearToUlaw(sample))
+		assert.InDelta(t, float64(sample), float64(ulaw), max(16, 0.07*float64(absInt16(sample))), "ulaw %d", sample)
+		alaw := alawToLinear(linearToAlaw(sample))
+		assert.InDelta(t, float64(sample), float64(alaw), max(16, 0.07*float64(absInt16(sample))), "alaw %d", sample)
+	}
+}
+
+func absInt16(v int16) int32 {
+	if v < 0 {
+		return -int32(v)
+	}
+	return int32(v)
+}
+
+func TestRealtimeAudioConversion(t *testing.T) {
+	pcm, rate := RealtimeAudioToPCM16([]byte{0xff, 0x7f, 0x00}, "g711_ulaw")
+	assert.Equal(t, 8000, rate)
+	assert.Len(t, pcm, 6)
+
+	pcm24k := make([]byte, 480)
+	assert.Len(t, PCM16ToRealtimeAudio(pcm24k, 24000, "g711_alaw"), 80)
+	assert.Len(t, PCM16ToRealtimeAudio(pcm24k, 16000, "pcm16"), 720)
+	assert.Equal(t, pcm24k, PCM16ToRealtimeAudio(pcm24k, 24000, "pcm16"))
+}
+
+func TestResamplePCM16Interpolates(t *testing.T) {
+	// 0 and 100 at 8kHz become 0, 33, 66, 100, 100, 100 at 24kHz
+	pcm := []byte{0, 0, 100, 0}
+	resampled := ResamplePCM16(pcm, 8000, 24000)
+	assert.Equal(t, []byte{0, 0, 33, 0, 66, 0, 100, 0, 100, 0, 100, 0}, resampled)
+}
@@ -97,15 +97,13 @@ func TestSetUserPermissionsStoresOnlyOverrides(t *testing.T) {
 
 	assert.True(t, Can(42, common.RoleAdminUser, ChannelSensitiveWrite))
 	assert.False(t, Can(42, common.RoleAdminUser, ChannelWrite))
-	assert.Equal(t, PermissionsMap{
-		ResourceChannel: {
-			ActionRead:           true,
-			ActionOperate:        true,
-			ActionWrite:          false,
-			ActionSensitiveWrite: true,
-			ActionSecretView:     false,
-		},
-	}, ExplicitUserPermissions(42))
+	assert.Equal(t, map[string]bool{
+		ActionRead:           true,
+		ActionOperate:        true,
+		ActionWrite:          false,
+		ActionSensitiveWrite: true,
+		ActionSecretView:     false,
+	}, ExplicitUserPermissions(42)[ResourceChannel])
 	assert.Equal(t, PermissionsMap{
 		ResourceChannel: {
 			ActionSensitiveWrite: true,
@@ -125,15 +123,13 @@ func TestSetUserPermissionsStoresOnlyOverrides(t *testing.T) {
 		ActionSecretView:     false,
 	}}))
 	assert.False(t, Can(42, common.RoleAdminUser, ChannelSensitiveWrite))
-	assert.Equal(t, PermissionsMap{
-		ResourceChannel: {
-			ActionRead:           true,
-			ActionOperate:        true,
-			ActionWrite:          true,
-			ActionSensitiveWrite: false,
-			ActionSecretView:     false,
-		},
-	}, ExplicitUserPermissions(42))
+	assert.Equal(t, map[string]bool{
+		ActionRead:           true,
+		ActionOperate:        true,
+		ActionWrite:          true,
+		ActionSensitiveWrite: false,
+		ActionSecretView:     false,
+	}, ExplicitUserPermissions(42)[ResourceChannel])
 	assert.Empty(t, ExplicitUserOverrides(42))
 }
 
@@ -227,3 +223,39 @@ func TestCapabilitiesUseCatalogShape(t *testing.T) {
 	assert.False(t, capabilities[ResourceChannel][ActionSensitiveWrite])
 	assert.False(t, capabilities[ResourceChannel][ActionSecretView])
 }
+
+func TestAdminBaselineCoversRegisteredAdminResources(t *testing.T) {
+	db := newAuthzTestDB(t)
+	require.NoError(t, Init(db))
+
+	for _, permission := range []Permission{UserRead, UserWrite, UserSecurityReset, TokenRead, RedemptionWrite, LogRead, LogContentView, SubscriptionGrant, PaymentRead, ModelWrite} {
+		assert.True(t, Can(2, common.RoleAdminUser, permission), "%s.%s", permission.Resource, permission.Action)
+	}
+	// Settings, pricing and system tasks used to be root-only and stay so
+	// unless a user override grants them.
+	for _, permission := range []Permission{OptionRead, OptionWrite, ModelPricingWrite, SystemTaskRead, SystemTaskWrite} {
+		assert.False(t, Can(2, common.RoleAdminUser, permission), "%s.%s", permission.Resource, permission.Action)
+		assert.True(t, Can(1, common.RoleRootUser, permission), "%s.%s", permission.Resource, permission.Action)
+	}
+	assert.False(t, Can(3, common.RoleCommonUser, LogRead))
+}
+
+func TestUserOverridesNarrowAdminToSupportRole(t *testing.T) {
+	db := newAuthzTestDB(t)
+	require.NoError(t, Init(db))
+
+	require.NoError(t, SetUserPermissions(9, PermissionsMap{
+		ResourceUser:       {ActionRead: true, ActionWrite: false, ActionSensitiveWrite: false, ActionSecurityReset: true},
+		ResourceRedemption: {ActionRead: false, ActionWrite: false},
+		ResourcePayment:    {ActionRead: true, ActionWrite: false},
+	}))
+
+	assert.True(t, Can(9, common.RoleAdminUser, UserRead))
+	assert.True(t, Can(9, common.RoleAdminUser, UserSecurityReset))
+	assert.True(t, Can(9, common.RoleAdminUser, LogRead))
+	assert.True(t, Can(9, common.RoleAdminUser, PaymentRead))
+	assert.False(t, Can(9, common.RoleAdminUser, UserWrite))
+	assert.False(t, Can(9, common.RoleAdminUser, UserSensitiveWrite))
+	assert.False(t, Can(9, common.RoleAdminUser, RedemptionRead))
+	assert.False(t, Can(9, common.RoleAdminUser, PaymentWrite))
+}
@@ -0,0 +1,114 @@
+package authz
+
+const (
+	ResourceSubscription = "subscription"
+	ResourcePayment      = "payment"
+	ResourceBudget       = "budget"
+	ResourceOrganization = "organization"
+
+	ActionGrant  = "grant"
+	ActionRefund = "refund"
+)
+
+var (
+	SubscriptionRead  = Permission{Resource: ResourceSubscription, Action: ActionRead}
+	SubscriptionWrite = Permission{Resource: ResourceSubscription, Action: ActionWrite}
+	SubscriptionGrant = Permission{Resource: ResourceSubscription, Action: ActionGrant}
+
+	PaymentRead   = Permission{Resource: ResourcePayment, Action: ActionRead}
+	PaymentWrite  = Permission{Resource: ResourcePayment, Action: ActionWrite}
+	PaymentRefund = Permission{Resource: ResourcePayment, Action: ActionRefund}
+
+	BudgetRead  = Permission{Resource: ResourceBudget, Action: ActionRead}
+	BudgetWrite = Permission{Resource: ResourceBudget, Action: ActionWrite}
+
+	OrganizationRead  = Permission{Resource: ResourceOrganization, Action: ActionRead}
+	OrganizationWrite = Permission{Resource: ResourceOrganization, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceSubscription,
+		LabelKey: "Subscriptions",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read subscriptions",
+				DescriptionKey: "View subscription plans and the subscriptions of any user.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit subscription plans",
+				DescriptionKey: "Create and edit subscription plans and change their status.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionGrant,
+				LabelKey:       "Grant subscriptions",
+				DescriptionKey: "Bind, reset, invalidate, and delete the subscriptions of users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+	RegisterResource(ResourceDefinition{
+		Resource: ResourcePayment,
+		LabelKey: "Payments",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read top-ups",
+				DescriptionKey: "View the top-up orders of all users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Complete top-ups",
+				DescriptionKey: "Manually mark pending top-up orders as paid.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionRefund,
+				LabelKey:       "Refund payments",
+				DescriptionKey: "Refund paid top-ups and subscription orders through their payment provider.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceBudget,
+		LabelKey: "Budgets",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read budgets",
+				DescriptionKey: "View the spend budgets of any user and its tokens.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit budgets",
+				DescriptionKey: "Create, edit, and delete the spend budgets of any user.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceOrganization,
+		LabelKey: "Organizations",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read organizations",
+				DescriptionKey: "View organizations, their members, subscriptions, and usage.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit organizations",
+				DescriptionKey: "Create, edit, and delete organizations and manage their members.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
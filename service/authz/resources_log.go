@@ -0,0 +1,33 @@
+package authz
+
+const (
+	ResourceLog = "log"
+
+	ActionContentView = "content_view"
+)
+
+var (
+	LogRead        = Permission{Resource: ResourceLog, Action: ActionRead}
+	LogContentView = Permission{Resource: ResourceLog, Action: ActionContentView}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceLog,
+		LabelKey: "Logs and Usage",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read logs",
+				DescriptionKey: "View usage logs, statistics, and Midjourney and async task records of all users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionContentView,
+				LabelKey:       "View request bodies",
+				DescriptionKey: "View the stored request and response bodies of a log entry.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
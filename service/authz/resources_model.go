@@ -0,0 +1,39 @@
+package authz
+
+const (
+	ResourceModel = "model"
+
+	ActionPricingWrite = "pricing_write"
+)
+
+var (
+	ModelRead         = Permission{Resource: ResourceModel, Action: ActionRead}
+	ModelWrite        = Permission{Resource: ResourceModel, Action: ActionWrite}
+	ModelPricingWrite = Permission{Resource: ResourceModel, Action: ActionPricingWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceModel,
+		LabelKey: "Models and Pricing",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read models",
+				DescriptionKey: "View model metadata, vendors, and prefill groups.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit models",
+				DescriptionKey: "Edit model metadata, vendors, and prefill groups, and sync them from upstream.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionPricingWrite,
+				LabelKey:       "Edit pricing",
+				DescriptionKey: "Fetch upstream ratios for comparison and reset model ratios.",
+			},
+		},
+	})
+}
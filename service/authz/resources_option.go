@@ -0,0 +1,27 @@
+package authz
+
+const ResourceOption = "option"
+
+var (
+	OptionRead  = Permission{Resource: ResourceOption, Action: ActionRead}
+	OptionWrite = Permission{Resource: ResourceOption, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceOption,
+		LabelKey: "System Settings",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read settings",
+				DescriptionKey: "View system settings and cache statistics.",
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit settings",
+				DescriptionKey: "Change system settings and clear caches.",
+			},
+		},
+	})
+}
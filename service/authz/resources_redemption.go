@@ -0,0 +1,29 @@
+package authz
+
+const ResourceRedemption = "redemption"
+
+var (
+	RedemptionRead  = Permission{Resource: ResourceRedemption, Action: ActionRead}
+	RedemptionWrite = Permission{Resource: ResourceRedemption, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceRedemption,
+		LabelKey: "Redemption Codes",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read redemption codes",
+				DescriptionKey: "View and search redemption codes.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit redemption codes",
+				DescriptionKey: "Create, edit, and delete redemption codes.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package authz
+
+const ResourceSystemTask = "system_task"
+
+var (
+	SystemTaskRead  = Permission{Resource: ResourceSystemTask, Action: ActionRead}
+	SystemTaskWrite = Permission{Resource: ResourceSystemTask, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceSystemTask,
+		LabelKey: "System Tasks",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read system tasks",
+				DescriptionKey: "View system maintenance tasks and their progress.",
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Run system tasks",
+				DescriptionKey: "Start system maintenance tasks such as log cleanup.",
+			},
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package authz
+
+const ResourceToken = "token"
+
+var (
+	TokenRead  = Permission{Resource: ResourceToken, Action: ActionRead}
+	TokenWrite = Permission{Resource: ResourceToken, Action: ActionWrite}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceToken,
+		LabelKey: "Token Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read tokens",
+				DescriptionKey: "View the API tokens of any user with masked keys.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Enable or disable tokens",
+				DescriptionKey: "Enable or disable the API tokens of any user.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package authz
+
+const (
+	ResourceUser = "user"
+
+	ActionSecurityReset = "security_reset"
+)
+
+var (
+	UserRead           = Permission{Resource: ResourceUser, Action: ActionRead}
+	UserWrite          = Permission{Resource: ResourceUser, Action: ActionWrite}
+	UserSensitiveWrite = Permission{Resource: ResourceUser, Action: ActionSensitiveWrite}
+	UserSecurityReset  = Permission{Resource: ResourceUser, Action: ActionSecurityReset}
+)
+
+func init() {
+	RegisterResource(ResourceDefinition{
+		Resource: ResourceUser,
+		LabelKey: "User Management",
+		Actions: []ActionDefinition{
+			{
+				Action:         ActionRead,
+				LabelKey:       "Read users",
+				DescriptionKey: "View user lists, details, OAuth bindings, and two-factor statistics.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionWrite,
+				LabelKey:       "Edit users",
+				DescriptionKey: "Create and edit users, adjust quota, and enable, disable, promote, or demote them.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionSensitiveWrite,
+				LabelKey:       "Delete users",
+				DescriptionKey: "Permanently delete users.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+			{
+				Action:         ActionSecurityReset,
+				LabelKey:       "Reset user security",
+				DescriptionKey: "Disable two-factor authentication, reset passkeys, and clear account bindings.",
+				DefaultRoles:   []string{BuiltInRoleAdmin},
+			},
+		},
+	})
+}
@@ -1,10 +1,12 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -25,16 +27,38 @@ import (
 type BillingSession struct {
 	relayInfo        *relaycommon.RelayInfo
 	funding          FundingSource
-	preConsumedQuota int  // 实际预扣额度（信任用户可能为 0）
-	tokenConsumed    int  // 令牌额度实际扣减量
-	extraReserved    int  // 发送前补充预扣的额度（订阅退款时需要单独回滚）
-	trusted          bool // 是否命中信任额度旁路
-	fundingSettled   bool // funding.Settle 已成功，资金来源已提交
-	settled          bool // Settle 全部完成（资金 + 令牌）
-	refunded         bool // Refund 已调用
+	preConsumedQuota int       // 实际预扣额度（信任用户可能为 0）
+	tokenConsumed    int       // 令牌额度实际扣减量
+	extraReserved    int       // 发送前补充预扣的额度（订阅退款时需要单独回滚）
+	trusted          bool      // 是否命中信任额度旁路
+	fundingSettled   bool      // funding.Settle 已成功，资金来源已提交
+	settled          bool      // Settle 全部完成（资金 + 令牌）
+	refunded         bool      // Refund 已调用
+	budgetReserved   int       // 预算中为本请求预留的额度
+	budgetReservedAt time.Time // 预留时间，跨日结算时退回预留所在的周期
+	budgetHeld       bool      // 持有预算预留，结算时换成实际消耗，退款时释放
 	mu               sync.Mutex
 }
 
+// holdBudgetReservation 记录 PreConsumeBilling 在预算中预留的额度。
+func (s *BillingSession) holdBudgetReservation(quota int, reservedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.budgetReserved = quota
+	s.budgetReservedAt = reservedAt
+	s.budgetHeld = true
+}
+
+// settleBudgetLocked 将预算预留换成实际消耗，并标记消费日志无需再计入预算。
+func (s *BillingSession) settleBudgetLocked(actualQuota int) {
+	if !s.budgetHeld {
+		return
+	}
+	s.budgetHeld = false
+	model.SettleBudgetReservation(s.relayInfo.UserId, s.relayInfo.TokenId, s.budgetReserved, actualQuota, s.budgetReservedAt)
+	s.relayInfo.BudgetSettled = true
+}
+
 // Settle 根据实际消耗额度进行结算。
 // 资金来源和令牌额度分两步提交：若资金来源已提交但令牌调整失败，
 // 会标记 fundingSettled 防止 Refund 对已提交的资金来源执行退款。
@@ -44,6 +68,8 @@ func (s *BillingSession) Settle(actualQuota int) error {
 	if s.settled {
 		return nil
 	}
+	// 请求已完成，无论资金结算是否成功，实际消耗都计入预算
+	s.settleBudgetLocked(actualQuota)
 	delta := actualQuota - s.preConsumedQuota
 	if delta == 0 {
 		s.settled = true
@@ -59,11 +85,7 @@ func (s *BillingSession) Settle(actualQuota int) error {
 	// 2) 调整令牌额度
 	var tokenErr error
 	if !s.relayInfo.IsPlayground {
-		if delta > 0 {
-			tokenErr = model.DecreaseTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, delta)
-		} else {
-			tokenErr = model.IncreaseTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, -delta)
-		}
+		tokenErr = model.AdjustTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, s.relayInfo.TokenParentId, delta)
 		if tokenErr != nil {
 			// 资金来源已提交，令牌调整失败只能记录日志；标记 settled 防止 Refund 误退资金
 			common.SysLog(fmt.Sprintf("error adjusting token quota after funding settled (userId=%d, tokenId=%d, delta=%d): %s",
@@ -81,6 +103,14 @@ func (s *BillingSession) Settle(actualQuota int) error {
 // Refund 退还所有预扣费，幂等安全，异步执行。
 func (s *BillingSession) Refund(c *gin.Context) {
 	s.mu.Lock()
+	if !s.settled && s.budgetHeld {
+		// 信任用户没有预扣费，但预算预留仍需释放
+		s.budgetHeld = false
+		userId, tokenId, reserved, reservedAt := s.relayInfo.UserId, s.relayInfo.TokenId, s.budgetReserved, s.budgetReservedAt
+		gopool.Go(func() {
+			model.ReleaseBudgetReservation(userId, tokenId, reserved, reservedAt)
+		})
+	}
 	if s.settled || s.refunded || !s.needsRefundLocked() {
 		s.mu.Unlock()
 		return
@@ -97,6 +127,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	// 复制需要的值到闭包中
 	tokenId := s.relayInfo.TokenId
 	tokenKey := s.relayInfo.TokenKey
+	tokenParentId := s.relayInfo.TokenParentId
 	isPlayground := s.relayInfo.IsPlayground
 	tokenConsumed := s.tokenConsumed
 	extraReserved := s.extraReserved
@@ -115,7 +146,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 		}
 		// 2) 退还令牌额度
 		if tokenConsumed > 0 && !isPlayground {
-			if err := model.IncreaseTokenQuota(tokenId, tokenKey, tokenConsumed); err != nil {
+			if err := model.AdjustTokenQuota(tokenId, tokenKey, tokenParentId, -tokenConsumed); err != nil {
 				common.SysLog("error refunding token quota: " + err.Error())
 			}
 		}
@@ -207,12 +238,15 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 	if err := s.funding.PreConsume(effectiveQuota); err != nil {
 		// 预扣费失败，回滚令牌额度
 		if s.tokenConsumed > 0 && !s.relayInfo.IsPlayground {
-			if rollbackErr := model.IncreaseTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, s.tokenConsumed); rollbackErr != nil {
+			if rollbackErr := model.AdjustTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, s.relayInfo.TokenParentId, -s.tokenConsumed); rollbackErr != nil {
 				common.SysLog(fmt.Sprintf("error rolling back token quota (userId=%d, tokenId=%d, amount=%d, fundingErr=%s): %s",
 					s.relayInfo.UserId, s.relayInfo.TokenId, s.tokenConsumed, err.Error(), rollbackErr.Error()))
 			}
 			s.tokenConsumed = 0
 		}
+		if errors.Is(err, model.ErrOrganizationQuotaInsufficient) || errors.Is(err, model.ErrOrganizationMemberLimitExceeded) || errors.Is(err, model.ErrOrganizationDisabled) {
+			return types.NewErrorWithStatusCode(fmt.Errorf("组织额度不足或超出成员额度上限: %s", err.Error()), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
 		// TODO: model 层应定义哨兵错误（如 ErrNoActiveSubscription），用 errors.Is 替代字符串匹配
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "no active subscription") || strings.Contains(errMsg, "subscription quota insufficient") {
@@ -247,6 +281,19 @@ func (s *BillingSession) reserveFunding(delta int) error {
 				types.ErrOptionWithNoRecordErrorLog(),
 			)
 		}
+		funding.addOrganizationSpend(delta)
+		return nil
+	case *OrganizationFunding:
+		if err := model.PreConsumeOrganizationQuota(funding.organizationId, funding.userId, delta, true); err != nil {
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("组织额度不足或超出成员额度上限: %s", err.Error()),
+				types.ErrorCodeInsufficientUserQuota,
+				http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(),
+				types.ErrOptionWithNoRecordErrorLog(),
+			)
+		}
+		funding.consumed += delta
 		return nil
 	default:
 		return types.NewError(fmt.Errorf("unsupported funding source: %s", s.funding.Source()), types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
@@ -264,6 +311,14 @@ func (s *BillingSession) rollbackFundingReserve(delta int) {
 	case *SubscriptionFunding:
 		if err := model.PostConsumeUserSubscriptionDelta(funding.subscriptionId, -int64(delta)); err != nil {
 			common.SysLog("error rolling back subscription funding reserve: " + err.Error())
+		} else {
+			funding.addOrganizationSpend(-delta)
+		}
+	case *OrganizationFunding:
+		if err := model.AdjustOrganizationQuota(funding.organizationId, funding.userId, -delta, true); err != nil {
+			common.SysLog("error rolling back organization funding reserve: " + err.Error())
+		} else {
+			funding.consumed -= delta
 		}
 	}
 }
@@ -309,6 +364,9 @@ func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 		// 2. SubscriptionFunding.PreConsume 忽略参数，始终用 s.amount 预扣
 		// 3. 若信任旁路将 effectiveQuota 设为 0，会导致 preConsumedQuota 与实际订阅预扣不一致
 		return false
+	case BillingSourceOrganization:
+		// 组织额度池由多个成员共享，成员额度上限也需要逐次检查，不启用信任旁路
+		return false
 	default:
 		return false
 	}
@@ -319,6 +377,14 @@ func (s *BillingSession) syncRelayInfo() {
 	info := s.relayInfo
 	info.FinalPreConsumedQuota = s.preConsumedQuota
 	info.BillingSource = s.funding.Source()
+	switch funding := s.funding.(type) {
+	case *OrganizationFunding:
+		info.OrganizationId = funding.organizationId
+	case *SubscriptionFunding:
+		info.OrganizationId = funding.organizationId
+	default:
+		info.OrganizationId = 0
+	}
 
 	if sub, ok := s.funding.(*SubscriptionFunding); ok {
 		info.SubscriptionId = sub.subscriptionId
@@ -344,6 +410,18 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return nil, types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	organizationId, err := model.GetUserOrganizationId(relayInfo.UserId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if organizationId != 0 {
+		organization, err := model.GetOrganizationById(organizationId)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		return newOrganizationBillingSession(c, relayInfo, organization, preConsumedQuota)
+	}
+
 	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
 
 	// 钱包路径需要先检查用户额度
@@ -440,3 +518,62 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return session, nil
 	}
 }
+
+// newOrganizationBillingSession 为组织成员创建 BillingSession：组织订阅优先，
+// 订阅额度不足且允许回退时使用组织额度池。成员个人的钱包、订阅和计费偏好不参与。
+func newOrganizationBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, organization *model.Organization, preConsumedQuota int) (*BillingSession, *types.NewAPIError) {
+	if organization.Status != model.OrganizationStatusEnabled {
+		return nil, types.NewErrorWithStatusCode(
+			fmt.Errorf("组织 %s 已被禁用", organization.Name),
+			types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+			types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+
+	tryBalance := func() (*BillingSession, *types.NewAPIError) {
+		session := &BillingSession{
+			relayInfo: relayInfo,
+			funding:   &OrganizationFunding{organizationId: organization.Id, userId: relayInfo.UserId},
+		}
+		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
+			return nil, apiErr
+		}
+		return session, nil
+	}
+
+	hasSub, err := model.HasActiveOrganizationSubscription(organization.Id)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if !hasSub {
+		return tryBalance()
+	}
+	subConsume := int64(preConsumedQuota)
+	if subConsume <= 0 {
+		subConsume = 1
+	}
+	session := &BillingSession{
+		relayInfo: relayInfo,
+		funding: &SubscriptionFunding{
+			requestId:      relayInfo.RequestId,
+			userId:         relayInfo.UserId,
+			modelName:      relayInfo.OriginModelName,
+			amount:         subConsume,
+			organizationId: organization.Id,
+		},
+	}
+	apiErr := session.preConsume(c, int(subConsume))
+	if apiErr == nil {
+		return session, nil
+	}
+	if apiErr.GetErrorCode() != types.ErrorCodeInsufficientUserQuota {
+		return nil, apiErr
+	}
+	allowOverflow, overflowErr := model.OrganizationSubscriptionsAllowWalletOverflow(organization.Id)
+	if overflowErr != nil {
+		return nil, types.NewError(overflowErr, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if !allowOverflow {
+		return nil, apiErr
+	}
+	return tryBalance()
+}
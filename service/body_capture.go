@@ -0,0 +1,332 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const bodyCaptureRedacted = "[REDACTED]"
+
+// bodyCaptureCredentialHeaders are masked whatever the redaction settings
+// say, since they carry the API keys of the caller.
+var bodyCaptureCredentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"X-Api-Key",
+	"Api-Key",
+	"X-Goog-Api-Key",
+	"Mj-Api-Secret",
+	"Cookie",
+	"Sec-WebSocket-Protocol",
+}
+
+// bodyCaptureWriter copies the response of a captured request into a bounded
+// buffer. Whether the request is captured is decided on the first write,
+// once authentication and channel selection have run.
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	c         *gin.Context
+	decided   bool
+	capturing bool
+	body      bytes.Buffer
+	maxSize   int
+	truncated bool
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.capturing && !w.truncated {
+		if room := w.maxSize - w.body.Len(); len(b) > room {
+			w.body.Write(b[:room])
+			w.truncated = true
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bodyCaptureWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.capturing = shouldCaptureBodies(w.c)
+	if w.capturing {
+		common.SetContextKey(w.c, constant.ContextKeyBodyCaptured, true)
+	}
+}
+
+func shouldCaptureBodies(c *gin.Context) bool {
+	if !operation_setting.IsBodyCaptureTarget(c.GetInt("id"), c.GetInt("token_id"), common.GetContextKeyInt(c, constant.ContextKeyChannelId)) {
+		return false
+	}
+	rate := operation_setting.GetBodyCaptureSetting().SampleRate
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// StartBodyCapture starts copying the response of the request in c when body
+// capture is enabled. The returned function stores the capture and must run
+// once the request is handled, before the request body storage is released.
+func StartBodyCapture(c *gin.Context) func() {
+	setting := operation_setting.GetBodyCaptureSetting()
+	if !setting.Enabled {
+		return func() {}
+	}
+	writer := &bodyCaptureWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		maxSize:        max(setting.MaxBodyBytes, 1),
+	}
+	c.Writer = writer
+	return func() {
+		finishBodyCapture(c, writer)
+	}
+}
+
+func finishBodyCapture(c *gin.Context, writer *bodyCaptureWriter) {
+	writer.decide()
+	if !writer.capturing {
+		return
+	}
+	setting := operation_setting.GetBodyCaptureSetting()
+	requestBody, requestTruncated := readCapturedRequestBody(c, writer.maxSize)
+	body := &model.LogBody{
+		RequestId:      c.GetString(common.RequestIdKey),
+		UserId:         c.GetInt("id"),
+		TokenId:        c.GetInt("token_id"),
+		ChannelId:      common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		ModelName:      common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		StatusCode:     writer.Status(),
+		RequestHeaders: captureRequestHeaders(c.Request.Header, setting.RedactHeaders),
+		RequestBody:    redactCapturedBody(c.Request.Header.Get("Content-Type"), requestBody, requestTruncated, setting.RedactJSONPaths),
+		ResponseBody:   redactCapturedBody(writer.Header().Get("Content-Type"), writer.body.Bytes(), writer.truncated, setting.RedactJSONPaths),
+		Truncated:      requestTruncated || writer.truncated,
+	}
+	gopool.Go(func() {
+		if err := model.CreateLogBody(body); err != nil {
+			common.SysError(fmt.Sprintf("failed to store captured bodies of request %s: %s", body.RequestId, err.Error()))
+		}
+	})
+}
+
+// readCapturedRequestBody returns up to maxSize bytes of the request body
+// kept by the relay. Bodies the relay never read are not captured.
+func readCapturedRequestBody(c *gin.Context, maxSize int) ([]byte, bool) {
+	storage, exists := c.Get(common.KeyBodyStorage)
+	if !exists || storage == nil {
+		return nil, false
+	}
+	bs, ok := storage.(common.BodyStorage)
+	if !ok {
+		return nil, false
+	}
+	if _, err := bs.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+	data, err := io.ReadAll(io.LimitReader(bs, int64(maxSize)+1))
+	if err != nil {
+		return nil, false
+	}
+	if len(data) > maxSize {
+		return data[:maxSize], true
+	}
+	return data, false
+}
+
+func captureRequestHeaders(header http.Header, redactHeaders []string) string {
+	captured := make(map[string]string, len(header))
+	for key, values := range header {
+		captured[key] = strings.Join(values, ", ")
+	}
+	for _, key := range slices.Concat(bodyCaptureCredentialHeaders, redactHeaders) {
+		key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+		if _, ok := captured[key]; ok {
+			captured[key] = bodyCaptureRedacted
+		}
+	}
+	data, err := common.Marshal(captured)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// redactCapturedBody masks the configured JSON paths in a JSON body or in
+// each event of an SSE body. A truncated JSON body cannot be parsed, so it
+// is left out when there is anything to mask; a truncated SSE body loses its
+// last, incomplete event instead.
+func redactCapturedBody(contentType string, body []byte, truncated bool, paths []string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(mediaType, "event-stream"):
+		return string(redactSSEBody(body, truncated, paths))
+	case strings.Contains(mediaType, "json") || (mediaType == "" && gjson.ValidBytes(body)):
+		if truncated && len(paths) > 0 {
+			return fmt.Sprintf("[truncated JSON body omitted: %d bytes captured, redaction needs the complete body]", len(body))
+		}
+		return string(redactJSONBody(body, paths))
+	case strings.HasPrefix(mediaType, "text/"), strings.Contains(mediaType, "x-www-form-urlencoded"):
+		return string(body)
+	default:
+		return fmt.Sprintf("[%s body omitted: %d bytes captured]", contentType, len(body))
+	}
+}
+
+func redactSSEBody(body []byte, truncated bool, paths []string) []byte {
+	lines := bytes.Split(body, []byte("\n"))
+	if truncated && len(lines) > 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(paths) == 0 {
+		return bytes.Join(lines, []byte("\n"))
+	}
+	for i, line := range lines {
+		payload, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		payload = bytes.TrimSpace(payload)
+		if !gjson.ValidBytes(payload) {
+			continue
+		}
+		lines[i] = append([]byte("data: "), redactJSONBody(payload, paths)...)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func redactJSONBody(body []byte, paths []string) []byte {
+	if len(paths) == 0 || !gjson.ValidBytes(body) {
+		return body
+	}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		for _, concrete := range expandRedactPath(gjson.ParseBytes(body), strings.Split(path, "."), "") {
+			if updated, err := sjson.SetBytes(body, concrete, bodyCaptureRedacted); err == nil {
+				body = updated
+			}
+		}
+	}
+	return body
+}
+
+// expandRedactPath resolves the * segments of a redaction path against value
+// and returns the matching paths in sjson syntax.
+func expandRedactPath(value gjson.Result, segments []string, prefix string) []string {
+	if len(segments) == 0 {
+		if prefix == "" {
+			return nil
+		}
+		return []string{prefix}
+	}
+	join := func(key string) string {
+		if prefix == "" {
+			return escapeJSONPathKey(key)
+		}
+		return prefix + "." + escapeJSONPathKey(key)
+	}
+	segment := segments[0]
+	if segment != "*" {
+		child := value.Get(escapeJSONPathKey(segment))
+		if !child.Exists() {
+			return nil
+		}
+		return expandRedactPath(child, segments[1:], join(segment))
+	}
+	var paths []string
+	if value.IsArray() {
+		for i, item := range value.Array() {
+			paths = append(paths, expandRedactPath(item, segments[1:], join(strconv.Itoa(i)))...)
+		}
+	} else if value.IsObject() {
+		value.ForEach(func(key, item gjson.Result) bool {
+			paths = append(paths, expandRedactPath(item, segments[1:], join(key.String()))...)
+			return true
+		})
+	}
+	return paths
+}
+
+func escapeJSONPathKey(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch r {
+		case '\\', '.', '*', '?', '|', '#', '@', '!', '=', '<', '>', '%', ':':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func appendBodyCaptureInfo(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	if common.GetContextKeyBool(ctx, constant.ContextKeyBodyCaptured) {
+		other["body_captured"] = true
+	}
+}
+
+// logBodyCleanupHandler deletes captured bodies older than the configured
+// retention.
+type logBodyCleanupHandler struct{}
+
+func (logBodyCleanupHandler) Type() string { return model.SystemTaskTypeLogBodyCleanup }
+
+func (logBodyCleanupHandler) Enabled() bool {
+	return operation_setting.GetBodyCaptureSetting().RetentionDays > 0
+}
+
+func (logBodyCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (logBodyCleanupHandler) NewPayload() any { return nil }
+
+func (logBodyCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	retentionDays := operation_setting.GetBodyCaptureSetting().RetentionDays
+	if retentionDays <= 0 {
+		if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, LogCleanupResult{}, ""); err != nil {
+			logSystemTaskLockError(ctx, task, err)
+		}
+		return
+	}
+	targetTimestamp := common.GetTimestamp() - int64(retentionDays)*24*3600
+	deleted, err := model.DeleteOldLogBodies(ctx, targetTimestamp)
+	if err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+	if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, LogCleanupResult{DeletedCount: deleted}, ""); err != nil {
+		logSystemTaskLockError(ctx, task, err)
+	}
+}
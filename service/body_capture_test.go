@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withBodyCaptureSetting(t *testing.T, setting operation_setting.BodyCaptureSetting) {
+	t.Helper()
+	current := operation_setting.GetBodyCaptureSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func TestBodyCaptureWriterDecidesOnFirstWrite(t *testing.T) {
+	withBodyCaptureSetting(t, operation_setting.BodyCaptureSetting{
+		Enabled:      true,
+		ChannelIds:   []int{5},
+		SampleRate:   1,
+		MaxBodyBytes: 8,
+	})
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	StartBodyCapture(ctx)
+	writer, ok := ctx.Writer.(*bodyCaptureWriter)
+	require.True(t, ok)
+
+	// The channel is only known once distribution has run.
+	common.SetContextKey(ctx, constant.ContextKeyChannelId, 5)
+	_, err := ctx.Writer.WriteString("0123456789")
+	require.NoError(t, err)
+
+	assert.True(t, writer.capturing)
+	assert.True(t, writer.truncated)
+	assert.Equal(t, "01234567", writer.body.String())
+	assert.Equal(t, "0123456789", recorder.Body.String(), "the client gets the whole response")
+	assert.True(t, common.GetContextKeyBool(ctx, constant.ContextKeyBodyCaptured))
+}
+
+func TestBodyCaptureSkipsRequestsNotOptedIn(t *testing.T) {
+	withBodyCaptureSetting(t, operation_setting.BodyCaptureSetting{
+		Enabled:      true,
+		UserIds:      []int{1},
+		SampleRate:   1,
+		MaxBodyBytes: 1024,
+	})
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	ctx.Set("id", 2)
+
+	StartBodyCapture(ctx)
+	_, err := ctx.Writer.WriteString("{}")
+	require.NoError(t, err)
+
+	writer := ctx.Writer.(*bodyCaptureWriter)
+	assert.False(t, writer.capturing)
+	assert.Zero(t, writer.body.Len())
+}
+
+func TestRedactCapturedBody(t *testing.T) {
+	paths := []string{"messages.*.content", "metadata.api.key"}
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"secret"},{"role":"assistant","content":"reply"}],"metadata":{"api.key":"sk"}}`
+	redacted := redactCapturedBody("application/json", []byte(body), false, paths)
+	assert.Equal(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"[REDACTED]"},{"role":"assistant","content":"[REDACTED]"}],"metadata":{"api.key":"sk"}}`, redacted,
+		"dots inside keys are not path separators")
+
+	redacted = redactCapturedBody("application/json", []byte(body[:20]), true, paths)
+	assert.NotContains(t, redacted, "gpt-4o", "truncated JSON cannot be redacted")
+
+	stream := "data: {\"messages\":[{\"content\":\"hi\"}]}\n\ndata: [DONE]\n\ndata: {\"mess"
+	redacted = redactCapturedBody("text/event-stream", []byte(stream), true, paths)
+	assert.Equal(t, "data: {\"messages\":[{\"content\":\"[REDACTED]\"}]}\n\ndata: [DONE]\n", redacted)
+
+	assert.Contains(t, redactCapturedBody("image/png", []byte{0x89, 'P', 'N', 'G'}, false, paths), "omitted")
+}
+
+func TestCaptureRequestHeadersMasksCredentials(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer sk-test")
+	header.Set("X-Trace-Secret", "abc")
+	header.Set("Content-Type", "application/json")
+
+	captured := captureRequestHeaders(header, []string{"x-trace-secret"})
+	assert.NotContains(t, captured, "sk-test")
+	assert.NotContains(t, captured, "abc")
+	assert.True(t, strings.Contains(captured, "application/json"))
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+func init() {
+	model.SetBudgetNotifier(notifyBudgetCrossing)
+}
+
+var budgetPeriodNames = map[string]string{
+	model.BudgetPeriodDay:   "每日",
+	model.BudgetPeriodWeek:  "每周",
+	model.BudgetPeriodMonth: "每月",
+}
+
+// ReserveBudget reserves preConsumedQuota against the budgets of the user and
+// token, or rejects the request when a budget has no room left for it in its
+// current window. It reports whether a reservation was taken, which the
+// billing session then settles or releases.
+func ReserveBudget(relayInfo *relaycommon.RelayInfo, preConsumedQuota int) (bool, *types.NewAPIError) {
+	usage, err := model.ReserveBudgets(relayInfo.UserId, relayInfo.TokenId, preConsumedQuota)
+	if err != nil {
+		// The quota checks still apply; a broken budget store must not take
+		// the relay down with it. The spend is counted when it is logged.
+		common.SysError(fmt.Sprintf("failed to reserve budgets of user %d: %s", relayInfo.UserId, err.Error()))
+		return false, nil
+	}
+	if usage == nil {
+		return true, nil
+	}
+	subject := "用户"
+	if usage.TokenId != 0 {
+		subject = "令牌"
+	}
+	return false, types.NewErrorWithStatusCode(
+		fmt.Errorf("%s%s预算不足，已使用 %s / %s，将于 %s 重置",
+			subject, budgetPeriodNames[usage.Period],
+			logger.FormatQuota(int(usage.Spent)), logger.FormatQuota(int(usage.QuotaLimit)),
+			time.Unix(usage.ResetAt, 0).Format("2006-01-02 15:04:05")),
+		types.ErrorCodeBudgetExceeded,
+		http.StatusForbidden,
+		types.ErrOptionWithSkipRetry(),
+		types.ErrOptionWithNoRecordErrorLog(),
+	)
+}
+
+func notifyBudgetCrossing(userId int, crossing model.BudgetCrossing) {
+	gopool.Go(func() {
+		user, err := model.GetUserCache(userId)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get user %d for budget notify: %s", userId, err.Error()))
+			return
+		}
+		budget := crossing.Budget
+		subject := "您的"
+		if budget.TokenId != 0 {
+			tokenName := fmt.Sprintf("#%d", budget.TokenId)
+			if token, err := model.GetTokenById(budget.TokenId); err == nil {
+				tokenName = token.Name
+			}
+			subject = fmt.Sprintf("令牌「%s」的", tokenName)
+		}
+		periodName := budgetPeriodNames[budget.Period]
+		notifyType := dto.NotifyTypeBudgetWarning
+		prompt := fmt.Sprintf("%s%s预算已使用 %d%%", subject, periodName, budget.WarningPercent)
+		if crossing.Exceeded {
+			notifyType = dto.NotifyTypeBudgetExceeded
+			prompt = fmt.Sprintf("%s%s预算已用尽，后续请求将被拒绝", subject, periodName)
+		}
+		spent := logger.FormatQuota(int(crossing.Spent))
+		limit := logger.FormatQuota(int(budget.QuotaLimit))
+		resetAt := time.Unix(crossing.ResetAt, 0).Format("2006-01-02 15:04:05")
+
+		userSetting := user.GetSetting()
+		channel := userSetting.NotifyType
+		if channel == "" {
+			channel = dto.NotifyTypeEmail
+		}
+
+		var content string
+		if channel == dto.NotifyTypeBark {
+			content = "{{value}}，已使用：{{value}} / {{value}}，重置时间：{{value}}"
+		} else if channel == dto.NotifyTypeGotify {
+			content = "{{value}}，当前周期已使用 {{value}}，预算为 {{value}}，将于 {{value}} 重置。"
+		} else {
+			content = "{{value}}。<br/>当前周期已使用 {{value}}，预算为 {{value}}，将于 {{value}} 重置。"
+		}
+		values := []interface{}{prompt, spent, limit, resetAt}
+
+		if err := NotifyUser(userId, user.Email, userSetting, dto.NewNotify(notifyType, prompt, content, values)); err != nil {
+			common.SysError(fmt.Sprintf("failed to send budget notify to user %d: %s", userId, err.Error()))
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http"
+
+	channelscore "github.com/QuantumNous/new-api/pkg/channel_score"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// RecordChannelRelayFailure lowers the adaptive routing score of a channel
+// when a relay attempt failed because of the channel. Client errors and
+// errors raised locally before reaching upstream are ignored.
+func RecordChannelRelayFailure(channelId int, err *types.NewAPIError) {
+	if isChannelHealthFailure(err) {
+		channelscore.RecordFailure(channelId)
+	}
+}
+
+func isChannelHealthFailure(err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	if types.IsChannelError(err) {
+		return true
+	}
+	if types.IsSkipRetryError(err) {
+		return false
+	}
+	switch err.GetErrorCode() {
+	case types.ErrorCodeDoRequestFailed,
+		types.ErrorCodeReadResponseBodyFailed,
+		types.ErrorCodeBadResponse,
+		types.ErrorCodeBadResponseBody,
+		types.ErrorCodeEmptyResponse:
+		return true
+	case types.ErrorCodeBadResponseStatusCode:
+		// judged by the upstream status code below
+	default:
+		if err.GetErrorType() == types.ErrorTypeNewAPIError {
+			return false
+		}
+	}
+	code := err.StatusCode
+	return code >= http.StatusInternalServerError ||
+		code == http.StatusTooManyRequests ||
+		code == http.StatusUnauthorized ||
+		code == http.StatusForbidden
+}
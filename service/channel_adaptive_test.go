@@ -0,0 +1,27 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsChannelHealthFailure(t *testing.T) {
+	upstream := func(status int) *types.NewAPIError {
+		return types.NewOpenAIError(errors.New("upstream"), types.ErrorCodeBadResponseStatusCode, status)
+	}
+
+	require.True(t, isChannelHealthFailure(upstream(http.StatusInternalServerError)))
+	require.True(t, isChannelHealthFailure(upstream(http.StatusTooManyRequests)))
+	require.True(t, isChannelHealthFailure(upstream(http.StatusUnauthorized)))
+	require.False(t, isChannelHealthFailure(upstream(http.StatusBadRequest)))
+
+	require.True(t, isChannelHealthFailure(types.NewError(errors.New("dial"), types.ErrorCodeDoRequestFailed)))
+	require.True(t, isChannelHealthFailure(types.NewError(errors.New("key"), types.ErrorCodeChannelInvalidKey)))
+	require.False(t, isChannelHealthFailure(types.NewError(errors.New("count"), types.ErrorCodeCountTokenFailed)))
+	require.False(t, isChannelHealthFailure(types.NewErrorWithStatusCode(errors.New("quota"), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry())))
+	require.False(t, isChannelHealthFailure(nil))
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordChannelCircuitResult feeds the result of a relay attempt to the
+// circuit breaker of the channel and, for multi-key channels, to the one of
+// the key that was used. A nil err is a success; errors that are not the
+// channel's fault are ignored.
+func RecordChannelCircuitResult(c *gin.Context, channelId int, err *types.NewAPIError) {
+	if err != nil && !isChannelHealthFailure(err) {
+		return
+	}
+	targets := []circuitbreaker.Target{circuitbreaker.ChannelTarget(channelId)}
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+		targets = append(targets, circuitbreaker.KeyTarget(channelId, keyIndex))
+	}
+	for _, target := range targets {
+		if err == nil {
+			circuitbreaker.RecordSuccess(target)
+		} else {
+			circuitbreaker.RecordFailure(target)
+		}
+	}
+}
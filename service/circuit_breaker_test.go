@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordChannelCircuitResultTripsChannelAndKey(t *testing.T) {
+	current := operation_setting.GetCircuitBreakerSetting()
+	saved := *current
+	current.Enabled = true
+	current.ConsecutiveFailures = 2
+	t.Cleanup(func() {
+		*current = saved
+		circuitbreaker.ResetAll()
+	})
+
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(ctx, constant.ContextKeyChannelIsMultiKey, true)
+	common.SetContextKey(ctx, constant.ContextKeyChannelMultiKeyIndex, 1)
+
+	clientErr := types.NewOpenAIError(errors.New("bad request"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest)
+	RecordChannelCircuitResult(ctx, 2001, clientErr)
+	RecordChannelCircuitResult(ctx, 2001, clientErr)
+	require.True(t, circuitbreaker.Allow(circuitbreaker.ChannelTarget(2001)), "client errors are ignored")
+
+	upstreamErr := types.NewOpenAIError(errors.New("overloaded"), types.ErrorCodeBadResponseStatusCode, http.StatusServiceUnavailable)
+	RecordChannelCircuitResult(ctx, 2001, upstreamErr)
+	RecordChannelCircuitResult(ctx, 2001, upstreamErr)
+
+	require.False(t, circuitbreaker.Allow(circuitbreaker.ChannelTarget(2001)))
+	require.False(t, circuitbreaker.Allow(circuitbreaker.KeyTarget(2001, 1)))
+	require.True(t, circuitbreaker.Allow(circuitbreaker.KeyTarget(2001, 0)))
+}
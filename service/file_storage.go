@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const FileStorageBackendLocal = "local"
+
+// ErrFileTooLarge is returned by a storage backend when the written stream
+// exceeds the limit passed to Save.
+var ErrFileTooLarge = errors.New("file exceeds the maximum allowed size")
+
+// FileStorage stores the bodies of files uploaded through /v1/files. Keys are
+// opaque to callers; backends may map them to paths, object names, etc.
+type FileStorage interface {
+	Name() string
+	// Save writes at most limit bytes from r under key and returns the size
+	// written. A limit <= 0 means unlimited.
+	Save(key string, r io.Reader, limit int64) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var (
+	fileStoragesMu sync.RWMutex
+	fileStorages   = map[string]FileStorage{}
+)
+
+// RegisterFileStorage registers a backend under its Name(). Re-registering a
+// name replaces the previous backend.
+func RegisterFileStorage(storage FileStorage) {
+	if storage == nil {
+		return
+	}
+	fileStoragesMu.Lock()
+	defer fileStoragesMu.Unlock()
+	fileStorages[storage.Name()] = storage
+}
+
+// GetFileStorage returns the backend registered under name.
+func GetFileStorage(name string) (FileStorage, error) {
+	fileStoragesMu.RLock()
+	defer fileStoragesMu.RUnlock()
+	storage, ok := fileStorages[name]
+	if !ok {
+		return nil, fmt.Errorf("file storage backend %q is not registered", name)
+	}
+	return storage, nil
+}
+
+// GetActiveFileStorage returns the backend configured in file_setting.
+func GetActiveFileStorage() (FileStorage, error) {
+	name := operation_setting.GetFileSetting().StorageBackend
+	if name == "" {
+		name = FileStorageBackendLocal
+	}
+	return GetFileStorage(name)
+}
+
+func init() {
+	RegisterFileStorage(&localFileStorage{})
+}
+
+// localFileStorage keeps files in a "files" sub directory of the disk cache
+// directory. CleanupOldDiskCacheFiles only removes top-level entries, so
+// stored files are not swept by the request body cache cleanup.
+type localFileStorage struct {
+	// baseDir overrides the default directory, used by tests.
+	baseDir string
+}
+
+func (s *localFileStorage) Name() string { return FileStorageBackendLocal }
+
+func (s *localFileStorage) dir() string {
+	if s.baseDir != "" {
+		return s.baseDir
+	}
+	return filepath.Join(common.GetDiskCacheDir(), "files")
+}
+
+func (s *localFileStorage) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid file storage key %q", key)
+	}
+	return filepath.Join(s.dir(), key), nil
+}
+
+func (s *localFileStorage) Save(key string, r io.Reader, limit int64) (int64, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(s.dir(), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create file storage directory: %w", err)
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create stored file: %w", err)
+	}
+
+	reader := r
+	if limit > 0 {
+		// read one extra byte to detect oversized streams
+		reader = io.LimitReader(r, limit+1)
+	}
+	written, err := io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil && limit > 0 && written > limit {
+		err = ErrFileTooLarge
+	}
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(filePath)
+		return 0, err
+	}
+	return written, nil
+}
+
+func (s *localFileStorage) Open(key string) (io.ReadCloser, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+func (s *localFileStorage) Delete(key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFileStorageRoundTrip(t *testing.T) {
+	storage := &localFileStorage{baseDir: t.TempDir()}
+
+	size, err := storage.Save("file-abc", strings.NewReader("hello world"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), size)
+
+	reader, err := storage.Open("file-abc")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, reader.Close())
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	require.NoError(t, storage.Delete("file-abc"))
+	_, err = storage.Open("file-abc")
+	assert.Error(t, err)
+	// deleting a missing file is not an error
+	assert.NoError(t, storage.Delete("file-abc"))
+}
+
+func TestLocalFileStorageEnforcesLimit(t *testing.T) {
+	storage := &localFileStorage{baseDir: t.TempDir()}
+
+	_, err := storage.Save("file-big", strings.NewReader("0123456789"), 5)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	_, err = storage.Open("file-big")
+	assert.Error(t, err, "oversized uploads must not leave a partial file behind")
+
+	size, err := storage.Save("file-exact", strings.NewReader("01234"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+}
+
+func TestLocalFileStorageRejectsPathKeys(t *testing.T) {
+	storage := &localFileStorage{baseDir: t.TempDir()}
+
+	for _, key := range []string{"", ".", "..", "../escape", "a/b", `a\b`} {
+		_, err := storage.Save(key, strings.NewReader("x"), 0)
+		assert.Error(t, err, "key %q", key)
+	}
+}
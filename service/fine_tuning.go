@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// DoFineTuningJobRequest sends a request for an existing fine-tuning job to
+// the channel and key that created it. subPath is appended to the job URL,
+// e.g. "/cancel" or "/events"; query is forwarded as-is.
+func DoFineTuningJobRequest(ctx context.Context, task *model.Task, method string, subPath string, query url.Values) (*http.Response, error) {
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	key := task.PrivateData.Key
+	if key == "" {
+		key = channel.Key
+	}
+	path := "/fine_tuning/jobs/" + url.PathEscape(task.GetUpstreamTaskID()) + subPath
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return doChannelRequestWithKey(ctx, channel, key, method, path, nil, "")
+}
+
+// ReadFineTuningJobResponse reads an upstream fine-tuning response and
+// returns an error carrying the upstream body for non-2xx statuses.
+func ReadFineTuningJobResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return body, fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// pinFineTunedModel routes the model produced by a fine-tuning task back to
+// the channel slot that trained it.
+func pinFineTunedModel(ctx context.Context, ch *model.Channel, task *model.Task, modelName string) {
+	keyIndex := 0
+	if ch.ChannelInfo.IsMultiKey && task.PrivateData.Key != "" {
+		for i, key := range ch.GetKeys() {
+			if key == task.PrivateData.Key {
+				keyIndex = i
+				break
+			}
+		}
+	}
+	baseModel := ""
+	var job map[string]any
+	if err := common.Unmarshal(task.Data, &job); err == nil {
+		baseModel, _ = job["model"].(string)
+	}
+	err := model.PinFineTunedModel(&model.FineTunedModel{
+		ModelName:       modelName,
+		BaseModel:       baseModel,
+		UserId:          task.UserId,
+		ChannelId:       ch.Id,
+		ChannelKeyIndex: keyIndex,
+		TaskId:          task.TaskID,
+	})
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to pin fine-tuned model %s to channel #%d: %s", modelName, ch.Id, err.Error()))
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("fine-tuned model %s pinned to channel #%d key #%d", modelName, ch.Id, keyIndex))
+}
@@ -1,8 +1,10 @@
 package service
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 )
 
@@ -12,7 +14,7 @@ import (
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "organization"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -63,6 +65,40 @@ func (w *WalletFunding) Refund() error {
 	return model.IncreaseUserQuota(w.userId, w.consumed, false)
 }
 
+// ---------------------------------------------------------------------------
+// OrganizationFunding — 组织额度池资金来源实现
+// ---------------------------------------------------------------------------
+
+type OrganizationFunding struct {
+	organizationId int
+	userId         int
+	consumed       int // 实际预扣的组织额度
+}
+
+func (o *OrganizationFunding) Source() string { return BillingSourceOrganization }
+
+func (o *OrganizationFunding) PreConsume(amount int) error {
+	// amount 为 0 时仍需检查组织状态、余额和成员额度上限
+	if err := model.PreConsumeOrganizationQuota(o.organizationId, o.userId, amount, true); err != nil {
+		return err
+	}
+	o.consumed = amount
+	return nil
+}
+
+func (o *OrganizationFunding) Settle(delta int) error {
+	return model.AdjustOrganizationQuota(o.organizationId, o.userId, delta, true)
+}
+
+func (o *OrganizationFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	return refundWithRetry(func() error {
+		return model.AdjustOrganizationQuota(o.organizationId, o.userId, -o.consumed, true)
+	})
+}
+
 // ---------------------------------------------------------------------------
 // SubscriptionFunding — 订阅资金来源实现
 // ---------------------------------------------------------------------------
@@ -74,6 +110,9 @@ type SubscriptionFunding struct {
 	amount         int64 // 预扣的订阅额度（subConsume）
 	subscriptionId int
 	preConsumed    int64
+	// 组织订阅：organizationId > 0 时从组织订阅扣费，消耗同时计入成员额度上限
+	organizationId    int
+	organizationSpend int
 	// 以下字段在 PreConsume 成功后填充，供 RelayInfo 同步使用
 	AmountTotal     int64
 	AmountUsedAfter int64
@@ -85,9 +124,23 @@ func (s *SubscriptionFunding) Source() string { return BillingSourceSubscription
 
 func (s *SubscriptionFunding) PreConsume(_ int) error {
 	// amount 参数被忽略，使用内部 s.amount（已在构造时根据 preConsumedQuota 计算）
-	res, err := model.PreConsumeUserSubscription(s.requestId, s.userId, s.modelName, 0, s.amount)
-	if err != nil {
-		return err
+	var res *model.SubscriptionPreConsumeResult
+	var err error
+	if s.organizationId > 0 {
+		if err = model.PreConsumeOrganizationQuota(s.organizationId, s.userId, int(s.amount), false); err != nil {
+			return err
+		}
+		s.organizationSpend = int(s.amount)
+		res, err = model.PreConsumeOrganizationSubscription(s.requestId, s.organizationId, s.userId, s.amount)
+		if err != nil {
+			s.addOrganizationSpend(-s.organizationSpend)
+			return err
+		}
+	} else {
+		res, err = model.PreConsumeUserSubscription(s.requestId, s.userId, s.modelName, 0, s.amount)
+		if err != nil {
+			return err
+		}
 	}
 	s.subscriptionId = res.UserSubscriptionId
 	s.preConsumed = res.PreConsumed
@@ -105,16 +158,37 @@ func (s *SubscriptionFunding) Settle(delta int) error {
 	if delta == 0 {
 		return nil
 	}
-	return model.PostConsumeUserSubscriptionDelta(s.subscriptionId, int64(delta))
+	if err := model.PostConsumeUserSubscriptionDelta(s.subscriptionId, int64(delta)); err != nil {
+		return err
+	}
+	s.addOrganizationSpend(delta)
+	return nil
 }
 
 func (s *SubscriptionFunding) Refund() error {
 	if s.preConsumed <= 0 {
 		return nil
 	}
-	return refundWithRetry(func() error {
+	if err := refundWithRetry(func() error {
 		return model.RefundSubscriptionPreConsume(s.requestId)
-	})
+	}); err != nil {
+		return err
+	}
+	s.addOrganizationSpend(-s.organizationSpend)
+	return nil
+}
+
+// addOrganizationSpend 调整组织订阅计入成员额度上限的消耗，失败只记录日志。
+func (s *SubscriptionFunding) addOrganizationSpend(delta int) {
+	if s.organizationId <= 0 || delta == 0 {
+		return
+	}
+	if err := model.AdjustOrganizationQuota(s.organizationId, s.userId, delta, false); err != nil {
+		common.SysLog(fmt.Sprintf("error adjusting organization member spend (organizationId=%d, userId=%d, delta=%d): %s",
+			s.organizationId, s.userId, delta, err.Error()))
+		return
+	}
+	s.organizationSpend += delta
 }
 
 // refundWithRetry 尝试多次执行退款操作以提高成功率，只能用于基于事务的退款函数！！！！！！
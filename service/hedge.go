@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errHedgeLost = errors.New("hedged request lost the race")
+
+// ShouldHedgeRequest reports whether the first relay attempt of a request may
+// be hedged. Only chat completions are hedged, and never when the client
+// pinned a channel or the request body is passed through untouched.
+func ShouldHedgeRequest(c *gin.Context, info *relaycommon.RelayInfo, retry int) bool {
+	hedgeSetting := operation_setting.GetHedgeSetting()
+	if !hedgeSetting.Enabled || hedgeSetting.DelayMs <= 0 || retry != 0 {
+		return false
+	}
+	if info.RelayFormat != types.RelayFormatOpenAI || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return false
+	}
+	if hedgeSetting.StreamOnly && !info.IsStream {
+		return false
+	}
+	if !operation_setting.IsHedgeModelEnabled(info.OriginModelName) {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return !model_setting.GetGlobalSettings().PassThroughRequestEnabled
+}
+
+func GetHedgeDelay() time.Duration {
+	return time.Duration(operation_setting.GetHedgeSetting().DelayMs) * time.Millisecond
+}
+
+// HedgeRace runs relay attempts of one request concurrently. Each attempt
+// writes to its own buffered writer; the first attempt to write a response
+// byte wins and is connected to the client, every other write fails.
+type HedgeRace struct {
+	mu       sync.Mutex
+	writer   gin.ResponseWriter
+	winner   *HedgeAttempt
+	attempts []*HedgeAttempt
+}
+
+func NewHedgeRace(c *gin.Context) *HedgeRace {
+	return &HedgeRace{writer: c.Writer}
+}
+
+// Winner returns the attempt connected to the client, or nil when no
+// attempt has written anything yet.
+func (r *HedgeRace) Winner() *HedgeAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// HedgeAttempt is one relay attempt of a hedged request. Ctx is a copy of
+// the request context with its own body, keys and cancelable request.
+type HedgeAttempt struct {
+	Ctx       *gin.Context
+	Info      *relaycommon.RelayInfo
+	ChannelId int
+	Hedged    bool
+	// Err is the result of the attempt, valid once Done is closed.
+	Err *types.NewAPIError
+
+	race     *HedgeRace
+	cancel   context.CancelFunc
+	canceled atomic.Bool
+	won      chan struct{}
+	done     chan struct{}
+}
+
+// NewAttempt prepares an attempt running on a copy of c. Hedged marks the
+// attempt sent after the hedge delay rather than the original one.
+func (r *HedgeRace) NewAttempt(c *gin.Context, info *relaycommon.RelayInfo, hedged bool) (*HedgeAttempt, error) {
+	bodyStorage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	body, err := bodyStorage.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	attemptStorage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attemptCtx := c.Copy()
+	attemptCtx.Request = c.Request.Clone(ctx)
+	attemptCtx.Request.Body = io.NopCloser(attemptStorage)
+	attemptCtx.Set(common.KeyBodyStorage, attemptStorage)
+
+	attemptInfo := info.CloneForAttempt()
+	// a keepalive ping would count as the first byte of the attempt
+	attemptInfo.DisablePing = true
+
+	attempt := &HedgeAttempt{
+		Ctx:    attemptCtx,
+		Info:   attemptInfo,
+		Hedged: hedged,
+		race:   r,
+		cancel: cancel,
+		won:    make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	attemptCtx.Writer = &hedgeWriter{
+		ResponseWriter: r.writer,
+		attempt:        attempt,
+		header:         http.Header{},
+		status:         http.StatusOK,
+	}
+	common.SetContextKey(attemptCtx, constant.ContextKeyHedgeAttempt, attempt)
+	return attempt, nil
+}
+
+// Run starts handler on the attempt in a new goroutine. ChannelId must be
+// set before.
+func (a *HedgeAttempt) Run(handler func(*gin.Context, *relaycommon.RelayInfo) *types.NewAPIError) {
+	a.race.mu.Lock()
+	a.race.attempts = append(a.race.attempts, a)
+	a.race.mu.Unlock()
+	go func() {
+		defer close(a.done)
+		defer common.CleanupBodyStorage(a.Ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysLog(fmt.Sprintf("hedge attempt panic: %v", r))
+				a.Err = types.NewError(fmt.Errorf("hedge attempt panic: %v", r), types.ErrorCodeDoRequestFailed)
+			}
+		}()
+		a.Err = handler(a.Ctx, a.Info)
+	}()
+}
+
+// Won is closed when the attempt wrote the first byte of the response.
+func (a *HedgeAttempt) Won() <-chan struct{} {
+	return a.won
+}
+
+// Done is closed when the attempt finished.
+func (a *HedgeAttempt) Done() <-chan struct{} {
+	return a.done
+}
+
+// Cancel aborts the attempt and its upstream request.
+func (a *HedgeAttempt) Cancel() {
+	a.canceled.Store(true)
+	a.cancel()
+}
+
+// Discard releases an attempt that was never run.
+func (a *HedgeAttempt) Discard() {
+	a.cancel()
+	common.CleanupBodyStorage(a.Ctx)
+}
+
+// Canceled reports whether the attempt was aborted by Cancel, in which case
+// its error says nothing about the channel.
+func (a *HedgeAttempt) Canceled() bool {
+	return a.canceled.Load()
+}
+
+// IsHedgeAttempt reports whether c is the context of a hedge attempt.
+func IsHedgeAttempt(c *gin.Context) bool {
+	return getHedgeAttempt(c) != nil
+}
+
+// IsHedgeLoser reports whether c belongs to a hedge attempt whose response
+// did not reach the client. Such an attempt must not be billed.
+func IsHedgeLoser(c *gin.Context) bool {
+	attempt := getHedgeAttempt(c)
+	return attempt != nil && attempt.race.Winner() != attempt
+}
+
+func getHedgeAttempt(c *gin.Context) *HedgeAttempt {
+	if c == nil {
+		return nil
+	}
+	value, ok := common.GetContextKey(c, constant.ContextKeyHedgeAttempt)
+	if !ok {
+		return nil
+	}
+	attempt, _ := value.(*HedgeAttempt)
+	return attempt
+}
+
+func appendHedgeInfo(ctx *gin.Context, other map[string]interface{}) {
+	if other == nil {
+		return
+	}
+	attempt := getHedgeAttempt(ctx)
+	if attempt == nil {
+		return
+	}
+	race := attempt.race
+	race.mu.Lock()
+	defer race.mu.Unlock()
+	if len(race.attempts) < 2 {
+		return
+	}
+	hedgeInfo := map[string]interface{}{
+		"delay_ms": operation_setting.GetHedgeSetting().DelayMs,
+	}
+	for _, a := range race.attempts {
+		if a.Hedged {
+			hedgeInfo["hedge_channel"] = a.ChannelId
+		} else {
+			hedgeInfo["primary_channel"] = a.ChannelId
+		}
+	}
+	if race.winner != nil {
+		winner := "primary"
+		if race.winner.Hedged {
+			winner = "hedge"
+		}
+		hedgeInfo["winner"] = winner
+	}
+	other["hedge"] = hedgeInfo
+}
+
+// hedgeWriter buffers the status and headers of an attempt until its first
+// write, which either connects the attempt to the client or fails with
+// errHedgeLost when another attempt got there first.
+type hedgeWriter struct {
+	gin.ResponseWriter
+	attempt   *HedgeAttempt
+	header    http.Header
+	status    int
+	committed atomic.Bool
+}
+
+func (w *hedgeWriter) commit() bool {
+	if w.committed.Load() {
+		return true
+	}
+	race := w.attempt.race
+	race.mu.Lock()
+	defer race.mu.Unlock()
+	if race.winner != nil {
+		return false
+	}
+	race.winner = w.attempt
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.committed.Store(true)
+	close(w.attempt.won)
+	return true
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.committed.Load() {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.committed.Load() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.commit() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if !w.commit() {
+		return 0, errHedgeLost
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	if !w.commit() {
+		return 0, errHedgeLost
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.committed.Load() {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.committed.Load() {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.committed.Load()
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.committed.Load() {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withHedgeSetting(t *testing.T, setting operation_setting.HedgeSetting) {
+	t.Helper()
+	current := operation_setting.GetHedgeSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func newHedgeContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","stream":true}`))
+	return ctx, recorder
+}
+
+func newHedgeRelayInfo() *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAI,
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		OriginModelName: "gpt-4o",
+		IsStream:        true,
+		Request:         &dto.GeneralOpenAIRequest{Model: "gpt-4o"},
+	}
+}
+
+func TestShouldHedgeRequest(t *testing.T) {
+	withHedgeSetting(t, operation_setting.HedgeSetting{
+		Enabled:    true,
+		Models:     []string{"gpt-4o"},
+		DelayMs:    500,
+		StreamOnly: true,
+	})
+	ctx, _ := newHedgeContext(t)
+	info := newHedgeRelayInfo()
+
+	require.True(t, ShouldHedgeRequest(ctx, info, 0))
+	require.False(t, ShouldHedgeRequest(ctx, info, 1), "only the first attempt is hedged")
+
+	info.IsStream = false
+	require.False(t, ShouldHedgeRequest(ctx, info, 0))
+
+	info = newHedgeRelayInfo()
+	info.OriginModelName = "gpt-4o-mini"
+	require.False(t, ShouldHedgeRequest(ctx, info, 0))
+
+	ctx.Set("specific_channel_id", "3")
+	require.False(t, ShouldHedgeRequest(ctx, newHedgeRelayInfo(), 0))
+}
+
+func TestHedgeRaceFirstWriterWins(t *testing.T) {
+	withHedgeSetting(t, operation_setting.HedgeSetting{Enabled: true, DelayMs: 500})
+	ctx, recorder := newHedgeContext(t)
+	info := newHedgeRelayInfo()
+	race := NewHedgeRace(ctx)
+
+	primary, err := race.NewAttempt(ctx, info, false)
+	require.NoError(t, err)
+	secondary, err := race.NewAttempt(ctx, info, true)
+	require.NoError(t, err)
+	require.True(t, primary.Info.DisablePing)
+	require.NotSame(t, info, primary.Info)
+
+	primary.ChannelId = 1
+	primary.Run(func(c *gin.Context, _ *relaycommon.RelayInfo) *types.NewAPIError {
+		<-secondary.Won()
+		body, _ := io.ReadAll(c.Request.Body)
+		require.Contains(t, string(body), "gpt-4o")
+		c.Writer.Header().Set("X-Attempt", "primary")
+		_, writeErr := c.Writer.Write([]byte("primary"))
+		return types.NewError(writeErr, types.ErrorCodeBadResponse)
+	})
+	secondary.ChannelId = 2
+	secondary.Run(func(c *gin.Context, _ *relaycommon.RelayInfo) *types.NewAPIError {
+		c.Writer.Header().Set("X-Attempt", "hedge")
+		c.Writer.WriteHeader(http.StatusAccepted)
+		_, writeErr := c.Writer.WriteString("hedge")
+		require.NoError(t, writeErr)
+		return nil
+	})
+	<-primary.Done()
+	<-secondary.Done()
+
+	require.Same(t, secondary, race.Winner())
+	require.True(t, errors.Is(primary.Err, errHedgeLost))
+	require.Nil(t, secondary.Err)
+	require.True(t, IsHedgeLoser(primary.Ctx))
+	require.False(t, IsHedgeLoser(secondary.Ctx))
+	require.False(t, IsHedgeLoser(ctx))
+
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Equal(t, "hedge", recorder.Header().Get("X-Attempt"))
+	require.Equal(t, "hedge", recorder.Body.String())
+
+	other := map[string]interface{}{}
+	appendHedgeInfo(secondary.Ctx, other)
+	require.Equal(t, map[string]interface{}{
+		"delay_ms":        500,
+		"primary_channel": 1,
+		"hedge_channel":   2,
+		"winner":          "hedge",
+	}, other["hedge"])
+}
@@ -0,0 +1,512 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const (
+	moderationCacheNamespace = "new-api:moderation:v1"
+	moderationRedactedText   = "[REDACTED]"
+)
+
+var (
+	moderationCacheOnce sync.Once
+	moderationCache     *cachex.HybridCache[ModerationResult]
+)
+
+// ModerationResult is the verdict of the provider on one input, in the
+// format of the OpenAI moderation API.
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// ModerationVerdict is the outcome of moderating the prompt of a request. It
+// is recorded in the Other field of the request's log.
+type ModerationVerdict struct {
+	Provider   string   `json:"provider"`
+	Action     string   `json:"action"`
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories,omitempty"`
+	Inputs     int      `json:"inputs"`
+	Cached     int      `json:"cached,omitempty"`
+	Redacted   int      `json:"redacted,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type moderationRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+type moderationWebhookRequest struct {
+	moderationRequest
+	UserId    int    `json:"user_id"`
+	Group     string `json:"group"`
+	RequestId string `json:"request_id"`
+}
+
+type moderationResponse struct {
+	Results []ModerationResult `json:"results"`
+}
+
+// moderationInput is a piece of the prompt sent to the provider. Redact is
+// nil when the input cannot be replaced in the request.
+type moderationInput struct {
+	text   string
+	redact func()
+}
+
+func getModerationCache() *cachex.HybridCache[ModerationResult] {
+	moderationCacheOnce.Do(func() {
+		moderationCache = cachex.NewHybridCache[ModerationResult](cachex.HybridCacheConfig[ModerationResult]{
+			Namespace: cachex.Namespace(moderationCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ModerationResult]{},
+			Memory: func() *hot.HotCache[string, ModerationResult] {
+				return hot.NewHotCache[string, ModerationResult](hot.LRU, 10000).
+					WithTTL(time.Duration(max(operation_setting.GetModerationSetting().CacheTTLSeconds, 1)) * time.Second).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return moderationCache
+}
+
+// moderationCacheKey hashes text together with the provider that judged it,
+// so changing the provider or model does not reuse old verdicts.
+func moderationCacheKey(text string) string {
+	setting := operation_setting.GetModerationSetting()
+	target := setting.Model
+	if setting.Provider == operation_setting.ModerationProviderWebhook {
+		target = setting.WebhookURL
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", setting.Provider, target)
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// moderationInputs returns the user messages of chat requests in the OpenAI,
+// Claude and Gemini formats, each of which can be redacted on its own. Other
+// requests are moderated as a whole and cannot be redacted.
+func moderationInputs(request dto.Request) []moderationInput {
+	var inputs []moderationInput
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		for i := range req.Messages {
+			message := &req.Messages[i]
+			if message.Role != "user" {
+				continue
+			}
+			var texts []string
+			for _, content := range message.ParseContent() {
+				if content.Type == dto.ContentTypeText && content.Text != "" {
+					texts = append(texts, content.Text)
+				}
+			}
+			if len(texts) == 0 {
+				continue
+			}
+			inputs = append(inputs, moderationInput{
+				text: strings.Join(texts, "\n"),
+				redact: func() {
+					if message.IsStringContent() {
+						message.SetStringContent(moderationRedactedText)
+						return
+					}
+					contents := slices.Clone(message.ParseContent())
+					for j := range contents {
+						if contents[j].Type == dto.ContentTypeText {
+							contents[j].Text = moderationRedactedText
+						}
+					}
+					message.SetMediaContent(contents)
+				},
+			})
+		}
+		if len(req.Messages) > 0 {
+			return inputs
+		}
+	case *dto.ClaudeRequest:
+		for i := range req.Messages {
+			message := &req.Messages[i]
+			if message.Role != "user" {
+				continue
+			}
+			text := message.GetStringContent()
+			if text == "" {
+				continue
+			}
+			inputs = append(inputs, moderationInput{
+				text: text,
+				redact: func() {
+					if message.IsStringContent() {
+						message.SetStringContent(moderationRedactedText)
+						return
+					}
+					contents, err := message.ParseContent()
+					if err != nil {
+						message.SetStringContent(moderationRedactedText)
+						return
+					}
+					for j := range contents {
+						if contents[j].Type == dto.ContentTypeText {
+							contents[j].Text = common.GetPointer(moderationRedactedText)
+						}
+					}
+					message.SetContent(contents)
+				},
+			})
+		}
+		return inputs
+	case *dto.GeminiChatRequest:
+		for i := range req.Contents {
+			content := &req.Contents[i]
+			if content.Role != "" && content.Role != "user" {
+				continue
+			}
+			var texts []string
+			for _, part := range content.Parts {
+				if part.Text != "" {
+					texts = append(texts, part.Text)
+				}
+			}
+			if len(texts) == 0 {
+				continue
+			}
+			inputs = append(inputs, moderationInput{
+				text: strings.Join(texts, "\n"),
+				redact: func() {
+					for j := range content.Parts {
+						if content.Parts[j].Text != "" {
+							content.Parts[j].Text = moderationRedactedText
+						}
+					}
+				},
+			})
+		}
+		return inputs
+	}
+	meta := request.GetTokenCountMeta()
+	if meta == nil || strings.TrimSpace(meta.CombineText) == "" {
+		return nil
+	}
+	return []moderationInput{{text: meta.CombineText}}
+}
+
+// moderationFlaggedCategories returns the categories of result that count as
+// flagged under policy.
+func moderationFlaggedCategories(policy *operation_setting.ModerationPolicy, result ModerationResult) []string {
+	var categories []string
+	if len(policy.Thresholds) > 0 {
+		for category, threshold := range policy.Thresholds {
+			if score, ok := result.CategoryScores[category]; ok && score >= threshold {
+				categories = append(categories, category)
+			}
+		}
+		return categories
+	}
+	for category, flagged := range result.Categories {
+		if flagged {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) == 0 && result.Flagged {
+		categories = append(categories, "flagged")
+	}
+	return categories
+}
+
+func callModerationProvider(c *gin.Context, info *relaycommon.RelayInfo, inputs []string) ([]ModerationResult, error) {
+	setting := operation_setting.GetModerationSetting()
+	statusCode := 0 // of the provider response, 0 when none was received
+	client := GetHttpClient()
+	var url, key string
+	var payload any
+	switch setting.Provider {
+	case operation_setting.ModerationProviderWebhook:
+		if setting.WebhookURL == "" {
+			return nil, errors.New("moderation webhook url is not configured")
+		}
+		url = setting.WebhookURL
+		key = setting.WebhookSecret
+		payload = moderationWebhookRequest{
+			moderationRequest: moderationRequest{Model: setting.Model, Input: inputs},
+			UserId:            info.UserId,
+			Group:             info.UsingGroup,
+			RequestId:         c.GetString(common.RequestIdKey),
+		}
+	default:
+		channel, err := model.GetRandomSatisfiedChannel(info.UsingGroup, setting.Model, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, fmt.Errorf("no available channel for moderation model %s in group %s", setting.Model, info.UsingGroup)
+		}
+		// only OpenAI serves the moderations endpoint, Azure OpenAI has none
+		if channel.Type != constant.ChannelTypeOpenAI {
+			return nil, fmt.Errorf("moderation model %s is served by channel #%d, which is not an OpenAI channel", setting.Model, channel.Id)
+		}
+		var keyIndex int
+		var apiErr *types.NewAPIError
+		key, keyIndex, apiErr = channel.GetNextEnabledKey()
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		// the selection took a probe slot of a half-open breaker, report back
+		// unless the client went away first
+		defer func() {
+			if c.Request.Context().Err() == nil {
+				recordModerationChannelResult(channel, keyIndex, statusCode)
+			}
+		}()
+		url = OpenAIChannelAPIURL(channel.Type, channel.GetBaseURL(), "", "/moderations")
+		if proxy := channel.GetSetting().Proxy; proxy != "" {
+			client, err = GetHttpClientWithProxy(proxy)
+			if err != nil {
+				return nil, err
+			}
+		}
+		payload = moderationRequest{Model: setting.Model, Input: inputs}
+	}
+
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(max(setting.TimeoutMs, 100))*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	statusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation provider returned status %d: %s", resp.StatusCode, common.LocalLogPreview(string(data)))
+	}
+	var parsed moderationResponse
+	if err := common.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Results) != len(inputs) {
+		return nil, fmt.Errorf("moderation provider returned %d results for %d inputs", len(parsed.Results), len(inputs))
+	}
+	return parsed.Results, nil
+}
+
+// recordModerationChannelResult feeds the outcome of a moderation call to the
+// circuit breakers of the channel and key, judged like a relay attempt.
+func recordModerationChannelResult(channel *model.Channel, keyIndex int, statusCode int) {
+	targets := []circuitbreaker.Target{circuitbreaker.ChannelTarget(channel.Id)}
+	if channel.ChannelInfo.IsMultiKey {
+		targets = append(targets, circuitbreaker.KeyTarget(channel.Id, keyIndex))
+	}
+	failed := statusCode == 0 || statusCode >= http.StatusInternalServerError ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusUnauthorized ||
+		statusCode == http.StatusForbidden
+	for _, target := range targets {
+		switch {
+		case failed:
+			circuitbreaker.RecordFailure(target)
+		case statusCode == http.StatusOK:
+			circuitbreaker.RecordSuccess(target)
+		}
+	}
+}
+
+// moderateInputs returns the verdict on each input, asking the provider only
+// about the inputs without a cached verdict.
+func moderateInputs(c *gin.Context, info *relaycommon.RelayInfo, inputs []moderationInput, verdict *ModerationVerdict) ([]ModerationResult, error) {
+	ttl := time.Duration(operation_setting.GetModerationSetting().CacheTTLSeconds) * time.Second
+	results := make([]ModerationResult, len(inputs))
+	var pending []int
+	var pendingTexts []string
+	for i, input := range inputs {
+		if ttl > 0 {
+			if cached, found, err := getModerationCache().Get(moderationCacheKey(input.text)); err == nil && found {
+				results[i] = cached
+				verdict.Cached++
+				continue
+			}
+		}
+		pending = append(pending, i)
+		pendingTexts = append(pendingTexts, input.text)
+	}
+	if len(pending) == 0 {
+		return results, nil
+	}
+	fetched, err := callModerationProvider(c, info, pendingTexts)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range pending {
+		results[i] = fetched[j]
+		if ttl > 0 {
+			if err := getModerationCache().SetWithTTL(moderationCacheKey(inputs[i].text), fetched[j], ttl); err != nil {
+				logger.LogWarn(c, "failed to cache moderation verdict: "+err.Error())
+			}
+		}
+	}
+	return results, nil
+}
+
+// ModerateRequest asks the moderation provider about the prompt of the
+// request before it is relayed and applies the moderation policy of the
+// group. It returns an error when the request must not be relayed.
+func ModerateRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) *types.NewAPIError {
+	policy := operation_setting.GetModerationPolicy(info.UsingGroup)
+	if policy == nil || request == nil {
+		return nil
+	}
+	inputs := moderationInputs(request)
+	if len(inputs) == 0 {
+		return nil
+	}
+	setting := operation_setting.GetModerationSetting()
+	verdict := &ModerationVerdict{
+		Provider: setting.Provider,
+		Action:   policy.Action,
+		Inputs:   len(inputs),
+	}
+	defer common.SetContextKey(c, constant.ContextKeyModerationVerdict, verdict)
+
+	results, err := moderateInputs(c, info, inputs, verdict)
+	if err != nil {
+		logger.LogError(c, "moderation failed: "+err.Error())
+		verdict.Error = err.Error()
+		if setting.FailOpen {
+			return nil
+		}
+		return types.NewErrorWithStatusCode(fmt.Errorf("moderation failed: %w", err), types.ErrorCodeModerationFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+
+	var flagged []int
+	for i, result := range results {
+		categories := moderationFlaggedCategories(policy, result)
+		if len(categories) == 0 {
+			continue
+		}
+		flagged = append(flagged, i)
+		for _, category := range categories {
+			if !slices.Contains(verdict.Categories, category) {
+				verdict.Categories = append(verdict.Categories, category)
+			}
+		}
+	}
+	if len(flagged) == 0 {
+		return nil
+	}
+	verdict.Flagged = true
+	slices.Sort(verdict.Categories)
+	logger.LogWarn(c, fmt.Sprintf("prompt flagged by moderation (%s): %s", policy.Action, strings.Join(verdict.Categories, ", ")))
+
+	switch policy.Action {
+	case operation_setting.ModerationActionFlag:
+		return nil
+	case operation_setting.ModerationActionRedact:
+		// a flagged input that cannot be redacted blocks the request
+		if !slices.ContainsFunc(flagged, func(i int) bool { return inputs[i].redact == nil }) {
+			for _, i := range flagged {
+				inputs[i].redact()
+			}
+			err := replaceRequestBody(c, request)
+			if err == nil {
+				verdict.Redacted = len(flagged)
+				return nil
+			}
+			logger.LogError(c, "failed to rewrite redacted request: "+err.Error())
+		}
+	}
+	recordModerationBlock(c, info, verdict)
+	return types.NewErrorWithStatusCode(fmt.Errorf("prompt flagged by moderation: %s", strings.Join(verdict.Categories, ", ")), types.ErrorCodeModerationFlagged, http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// replaceRequestBody stores the redacted request as the request body, so
+// channels relaying the original body do not send the flagged messages.
+func replaceRequestBody(c *gin.Context, request dto.Request) error {
+	body, err := common.Marshal(request)
+	if err != nil {
+		return err
+	}
+	storage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return err
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyBodyStorage, storage)
+	c.Request.Body = io.NopCloser(storage)
+	c.Request.ContentLength = int64(len(body))
+	return nil
+}
+
+func recordModerationBlock(c *gin.Context, info *relaycommon.RelayInfo, verdict *ModerationVerdict) {
+	if !constant.ErrorLogEnabled {
+		return
+	}
+	other := map[string]interface{}{
+		"moderation": verdict,
+	}
+	if c.Request != nil && c.Request.URL != nil {
+		other["request_path"] = c.Request.URL.Path
+	}
+	content := fmt.Sprintf("prompt flagged by moderation: %s", strings.Join(verdict.Categories, ", "))
+	useTimeSeconds := int(time.Since(info.StartTime).Seconds())
+	model.RecordErrorLog(c, info.UserId, 0, info.OriginModelName, c.GetString("token_name"), content, info.TokenId, useTimeSeconds, info.IsStream, info.UsingGroup, other)
+}
+
+func appendModerationInfo(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	verdict, ok := common.GetContextKeyType[*ModerationVerdict](ctx, constant.ContextKeyModerationVerdict)
+	if !ok || verdict == nil {
+		return
+	}
+	other["moderation"] = verdict
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	circuitbreaker "github.com/QuantumNous/new-api/pkg/circuit_breaker"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withModerationSetting(t *testing.T, setting operation_setting.ModerationSetting) {
+	t.Helper()
+	current := operation_setting.GetModerationSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func newModerationTestContext(t *testing.T) (*gin.Context, *relaycommon.RelayInfo) {
+	t.Helper()
+	if GetHttpClient() == nil {
+		InitHttpClient()
+	}
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return ctx, &relaycommon.RelayInfo{UserId: 1, UsingGroup: "default", StartTime: time.Now()}
+}
+
+func TestModerationFlaggedCategoriesUsesThresholds(t *testing.T) {
+	result := ModerationResult{
+		Flagged:        true,
+		Categories:     map[string]bool{"violence": true, "harassment": false},
+		CategoryScores: map[string]float64{"violence": 0.4, "harassment": 0.9},
+	}
+
+	withThresholds := &operation_setting.ModerationPolicy{Thresholds: map[string]float64{"violence": 0.5, "harassment": 0.8}}
+	assert.Equal(t, []string{"harassment"}, moderationFlaggedCategories(withThresholds, result))
+
+	withoutThresholds := &operation_setting.ModerationPolicy{}
+	assert.Equal(t, []string{"violence"}, moderationFlaggedCategories(withoutThresholds, result))
+
+	flaggedOnly := ModerationResult{Flagged: true}
+	assert.Equal(t, []string{"flagged"}, moderationFlaggedCategories(withoutThresholds, flaggedOnly))
+}
+
+func TestModerationInputsRedactUserMessages(t *testing.T) {
+	request := &dto.GeneralOpenAIRequest{
+		Messages: []dto.Message{
+			{Role: "system", Content: "be nice"},
+			{Role: "user", Content: "first"},
+			{Role: "assistant", Content: "ok"},
+			{Role: "user", Content: []any{
+				map[string]any{"type": "text", "text": "second"},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/a.png"}},
+			}},
+		},
+	}
+
+	inputs := moderationInputs(request)
+	require.Len(t, inputs, 2)
+	assert.Equal(t, "first", inputs[0].text)
+	assert.Equal(t, "second", inputs[1].text)
+
+	inputs[1].redact()
+	contents := request.Messages[3].ParseContent()
+	require.Len(t, contents, 2)
+	assert.Equal(t, moderationRedactedText, contents[0].Text)
+	assert.Equal(t, dto.ContentTypeImageURL, contents[1].Type)
+	assert.Equal(t, "first", request.Messages[1].StringContent())
+}
+
+func TestModerateRequestWebhookCachesVerdicts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		var req moderationWebhookRequest
+		require.NoError(t, common.Unmarshal(body, &req))
+		results := make([]ModerationResult, len(req.Input))
+		for i, input := range req.Input {
+			if input == "bad words" {
+				results[i] = ModerationResult{Flagged: true, Categories: map[string]bool{"hate": true}}
+			}
+		}
+		data, _ := common.Marshal(moderationResponse{Results: results})
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled:         true,
+		Provider:        operation_setting.ModerationProviderWebhook,
+		WebhookURL:      server.URL,
+		WebhookSecret:   "secret",
+		TimeoutMs:       1000,
+		CacheTTLSeconds: 60,
+		DefaultPolicy:   operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionBlock},
+		GroupPolicies: map[string]operation_setting.ModerationPolicy{
+			"vip": {Action: operation_setting.ModerationActionFlag},
+		},
+	})
+
+	request := func() *dto.GeneralOpenAIRequest {
+		return &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "bad words"}}}
+	}
+
+	ctx, info := newModerationTestContext(t)
+	apiErr := ModerateRequest(ctx, info, request())
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeModerationFlagged, apiErr.GetErrorCode())
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	verdict, ok := common.GetContextKeyType[*ModerationVerdict](ctx, constant.ContextKeyModerationVerdict)
+	require.True(t, ok)
+	assert.True(t, verdict.Flagged)
+	assert.Equal(t, []string{"hate"}, verdict.Categories)
+	assert.Equal(t, 0, verdict.Cached)
+
+	ctx, info = newModerationTestContext(t)
+	info.UsingGroup = "vip"
+	assert.Nil(t, ModerateRequest(ctx, info, request()), "flag-only groups are relayed")
+	verdict, ok = common.GetContextKeyType[*ModerationVerdict](ctx, constant.ContextKeyModerationVerdict)
+	require.True(t, ok)
+	assert.True(t, verdict.Flagged)
+	assert.Equal(t, 1, verdict.Cached)
+	assert.Equal(t, int32(1), calls.Load(), "the second verdict comes from the cache")
+
+	other := map[string]interface{}{}
+	appendModerationInfo(ctx, other)
+	assert.Same(t, verdict, other["moderation"])
+}
+
+func TestModerateRequestRedactsFlaggedMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := common.Marshal(moderationResponse{Results: []ModerationResult{
+			{CategoryScores: map[string]float64{"violence": 0.1}},
+			{CategoryScores: map[string]float64{"violence": 0.9}},
+		}})
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled:    true,
+		Provider:   operation_setting.ModerationProviderWebhook,
+		WebhookURL: server.URL,
+		TimeoutMs:  1000,
+		DefaultPolicy: operation_setting.ModerationPolicy{
+			Action:     operation_setting.ModerationActionRedact,
+			Thresholds: map[string]float64{"violence": 0.5},
+		},
+	})
+
+	ctx, info := newModerationTestContext(t)
+	request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{
+		{Role: "user", Content: "hello"},
+		{Role: "user", Content: "something violent"},
+	}}
+	require.Nil(t, ModerateRequest(ctx, info, request))
+	t.Cleanup(func() { common.CleanupBodyStorage(ctx) })
+
+	assert.Equal(t, "hello", request.Messages[0].StringContent())
+	assert.Equal(t, moderationRedactedText, request.Messages[1].StringContent())
+
+	body, err := common.GetRequestBody(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(body.(io.Reader))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), moderationRedactedText)
+	assert.NotContains(t, string(data), "something violent")
+}
+
+func TestModerateRequestFailOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	setting := operation_setting.ModerationSetting{
+		Enabled:       true,
+		Provider:      operation_setting.ModerationProviderWebhook,
+		WebhookURL:    server.URL,
+		TimeoutMs:     1000,
+		FailOpen:      true,
+		DefaultPolicy: operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionBlock},
+	}
+	withModerationSetting(t, setting)
+	request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "hello"}}}
+
+	ctx, info := newModerationTestContext(t)
+	assert.Nil(t, ModerateRequest(ctx, info, request))
+	verdict, ok := common.GetContextKeyType[*ModerationVerdict](ctx, constant.ContextKeyModerationVerdict)
+	require.True(t, ok)
+	assert.NotEmpty(t, verdict.Error)
+
+	setting.FailOpen = false
+	withModerationSetting(t, setting)
+	ctx, info = newModerationTestContext(t)
+	apiErr := ModerateRequest(ctx, info, request)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeModerationFailed, apiErr.GetErrorCode())
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+}
+
+func TestModerateRequestReportsChannelToCircuitBreaker(t *testing.T) {
+	breaker := operation_setting.GetCircuitBreakerSetting()
+	savedBreaker := *breaker
+	breaker.Enabled = true
+	breaker.ConsecutiveFailures = 2
+	t.Cleanup(func() {
+		*breaker = savedBreaker
+		circuitbreaker.ResetAll()
+	})
+	require.NoError(t, model.DB.AutoMigrate(&model.Ability{}))
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM abilities")
+		model.DB.Exec("DELETE FROM channels")
+	})
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	baseURL := server.URL
+	channel := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-moderation", Name: "moderation", BaseURL: &baseURL,
+		Status: common.ChannelStatusEnabled, Group: "default", Models: "omni-moderation-latest"}
+	require.NoError(t, model.DB.Create(channel).Error)
+	require.NoError(t, model.DB.Create(&model.Ability{Group: "default", Model: "omni-moderation-latest", ChannelId: channel.Id, Enabled: true}).Error)
+	memoryCacheEnabled := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = true
+	t.Cleanup(func() { common.MemoryCacheEnabled = memoryCacheEnabled })
+	model.InitChannelCache()
+
+	withModerationSetting(t, operation_setting.ModerationSetting{
+		Enabled:       true,
+		Provider:      operation_setting.ModerationProviderOpenAI,
+		Model:         "omni-moderation-latest",
+		TimeoutMs:     1000,
+		DefaultPolicy: operation_setting.ModerationPolicy{Action: operation_setting.ModerationActionBlock},
+	})
+
+	for i := 0; i < 2; i++ {
+		ctx, info := newModerationTestContext(t)
+		apiErr := ModerateRequest(ctx, info, &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "hello"}}})
+		require.NotNil(t, apiErr)
+		assert.Equal(t, types.ErrorCodeModerationFailed, apiErr.GetErrorCode())
+	}
+	assert.Equal(t, []string{"/v1/moderations", "/v1/moderations"}, paths)
+	assert.False(t, circuitbreaker.Allow(circuitbreaker.ChannelTarget(channel.Id)), "failed moderation calls count against the channel")
+}
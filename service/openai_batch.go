@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// batchMaxReportedErrors caps the validation errors recorded on a batch so a
+// malformed input file cannot bloat the batch row.
+const batchMaxReportedErrors = 100
+
+// ParseBatchInput reads a batch input JSONL file and validates every line
+// against the batch endpoint. Validation problems are returned as OpenAI batch
+// errors (1-based line numbers); the error return is only set for I/O failures.
+func ParseBatchInput(r io.Reader, endpoint string, maxRequests int) ([]dto.OpenAIBatchInputLine, []dto.OpenAIBatchError, error) {
+	reader := bufio.NewReader(r)
+	lines := make([]dto.OpenAIBatchInputLine, 0)
+	validationErrors := make([]dto.OpenAIBatchError, 0)
+	customIds := make(map[string]bool)
+	addError := func(lineNo int, code string, message string) {
+		if len(validationErrors) >= batchMaxReportedErrors {
+			return
+		}
+		line := lineNo
+		validationErrors = append(validationErrors, dto.OpenAIBatchError{Code: code, Message: message, Line: &line})
+	}
+
+	lineNo := 0
+	for {
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, nil, readErr
+		}
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 {
+			lineNo++
+			var line dto.OpenAIBatchInputLine
+			switch {
+			case common.Unmarshal(raw, &line) != nil:
+				addError(lineNo, "invalid_json_line", "This line is not parseable as valid JSON.")
+			case line.CustomId == "":
+				addError(lineNo, "missing_required_parameter", "Missing required parameter: 'custom_id'.")
+			case customIds[line.CustomId]:
+				addError(lineNo, "duplicate_custom_id", fmt.Sprintf("The custom_id '%s' is used more than once.", line.CustomId))
+			case line.Method != http.MethodPost:
+				addError(lineNo, "invalid_method", "Only the POST method is supported.")
+			case line.Url != endpoint:
+				addError(lineNo, "mismatched_endpoint", fmt.Sprintf("The url '%s' does not match the batch endpoint '%s'.", line.Url, endpoint))
+			case len(line.Body) == 0 || line.Body[0] != '{':
+				addError(lineNo, "invalid_request", "The request body must be a JSON object.")
+			default:
+				customIds[line.CustomId] = true
+				lines = append(lines, line)
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+
+	if lineNo == 0 {
+		validationErrors = append(validationErrors, dto.OpenAIBatchError{Code: "empty_file", Message: "The input file is empty."})
+	} else if maxRequests > 0 && lineNo > maxRequests {
+		validationErrors = append(validationErrors, dto.OpenAIBatchError{
+			Code:    "too_many_requests",
+			Message: fmt.Sprintf("The input file contains %d requests, the limit is %d.", lineNo, maxRequests),
+		})
+	}
+	return lines, validationErrors, nil
+}
+
+// BatchToOpenAIObject converts a stored batch to the OpenAI batch object.
+func BatchToOpenAIObject(batch *model.Batch) dto.OpenAIBatch {
+	object := dto.OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTimestamp(batch.InProgressAt),
+		ExpiresAt:        optionalTimestamp(batch.ExpiresAt),
+		FinalizingAt:     optionalTimestamp(batch.FinalizingAt),
+		CompletedAt:      optionalTimestamp(batch.CompletedAt),
+		FailedAt:         optionalTimestamp(batch.FailedAt),
+		ExpiredAt:        optionalTimestamp(batch.ExpiredAt),
+		CancellingAt:     optionalTimestamp(batch.CancellingAt),
+		CancelledAt:      optionalTimestamp(batch.CancelledAt),
+		RequestCounts: dto.OpenAIBatchCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.OutputFileId != "" {
+		outputFileId := batch.OutputFileId
+		object.OutputFileId = &outputFileId
+	}
+	if batch.ErrorFileId != "" {
+		errorFileId := batch.ErrorFileId
+		object.ErrorFileId = &errorFileId
+	}
+	if batch.Errors != "" {
+		var data []dto.OpenAIBatchError
+		if err := common.UnmarshalJsonStr(batch.Errors, &data); err == nil && len(data) > 0 {
+			object.Errors = &dto.OpenAIBatchErrors{Object: "list", Data: data}
+		}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &object.Metadata)
+	}
+	return object
+}
+
+func optionalTimestamp(timestamp int64) *int64 {
+	if timestamp == 0 {
+		return nil
+	}
+	return &timestamp
+}
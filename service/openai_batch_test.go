@@ -0,0 +1,62 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchInputAcceptsValidLines(t *testing.T) {
+	input := `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}
+
+{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}`
+
+	lines, validationErrors, err := ParseBatchInput(strings.NewReader(input), "/v1/chat/completions", 10)
+	require.NoError(t, err)
+	assert.Empty(t, validationErrors)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "a", lines[0].CustomId)
+	assert.Equal(t, "b", lines[1].CustomId)
+}
+
+func TestParseBatchInputReportsLineErrors(t *testing.T) {
+	input := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`not json`,
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"c","method":"GET","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"d","method":"POST","url":"/v1/embeddings","body":{}}`,
+		`{"method":"POST","url":"/v1/chat/completions","body":{}}`,
+	}, "\n")
+
+	_, validationErrors, err := ParseBatchInput(strings.NewReader(input), "/v1/chat/completions", 0)
+	require.NoError(t, err)
+	require.Len(t, validationErrors, 5)
+	codes := make([]string, 0, len(validationErrors))
+	for _, validationError := range validationErrors {
+		codes = append(codes, validationError.Code)
+	}
+	assert.Equal(t, []string{"invalid_json_line", "duplicate_custom_id", "invalid_method", "mismatched_endpoint", "missing_required_parameter"}, codes)
+	require.NotNil(t, validationErrors[0].Line)
+	assert.Equal(t, 2, *validationErrors[0].Line)
+}
+
+func TestParseBatchInputEnforcesLimits(t *testing.T) {
+	_, validationErrors, err := ParseBatchInput(strings.NewReader("\n\n"), "/v1/embeddings", 10)
+	require.NoError(t, err)
+	require.Len(t, validationErrors, 1)
+	assert.Equal(t, "empty_file", validationErrors[0].Code)
+
+	line := `{"custom_id":"%s","method":"POST","url":"/v1/embeddings","body":{"input":"x"}}`
+	input := strings.Join([]string{
+		strings.Replace(line, "%s", "1", 1),
+		strings.Replace(line, "%s", "2", 1),
+		strings.Replace(line, "%s", "3", 1),
+	}, "\n")
+	_, validationErrors, err = ParseBatchInput(strings.NewReader(input), "/v1/embeddings", 2)
+	require.NoError(t, err)
+	require.Len(t, validationErrors, 1)
+	assert.Equal(t, "too_many_requests", validationErrors[0].Code)
+}
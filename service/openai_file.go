@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var (
+	ErrFileStorageQuotaExceeded = errors.New("file storage quota exceeded")
+	ErrFileUploadQuotaExhausted = errors.New("user quota is exhausted")
+)
+
+// FileUploadLimit returns how many bytes a user of group with quota left may
+// still upload in one file: the per-file cap, further reduced by what is left
+// of the storage cap of the group. Stored files only serve requests that are
+// billed, so a user without quota cannot upload any.
+func FileUploadLimit(userId int, group string, quota int) (int64, error) {
+	if quota <= 0 {
+		return 0, ErrFileUploadQuotaExhausted
+	}
+	limit := operation_setting.GetMaxFileSizeBytes()
+	storageMB := operation_setting.GetMaxUserStorageMB(group)
+	if storageMB <= 0 {
+		return limit, nil
+	}
+	used, err := model.SumUserFileBytes(userId)
+	if err != nil {
+		return 0, err
+	}
+	remaining := int64(storageMB)<<20 - used
+	if remaining <= 0 {
+		return 0, ErrFileStorageQuotaExceeded
+	}
+	if remaining < limit {
+		limit = remaining
+	}
+	return limit, nil
+}
+
+// SaveUploadedFile streams r into the active storage backend and records the
+// file for the owning token.
+func SaveUploadedFile(userId int, tokenId int, filename string, purpose string, r io.Reader, limit int64) (*model.File, error) {
+	storage, err := GetActiveFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	fileId, err := model.GenerateFileId()
+	if err != nil {
+		return nil, err
+	}
+	size, err := storage.Save(fileId, r, limit)
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		FileId:         fileId,
+		UserId:         userId,
+		TokenId:        tokenId,
+		Filename:       filename,
+		Purpose:        purpose,
+		Bytes:          size,
+		Status:         model.FileStatusProcessed,
+		StorageBackend: storage.Name(),
+		StorageKey:     fileId,
+	}
+	if err := file.Insert(); err != nil {
+		_ = storage.Delete(fileId)
+		return nil, err
+	}
+	return file, nil
+}
+
+// SaveGeneratedFile stores gateway-produced content (e.g. batch output) as a
+// file owned by the given token.
+func SaveGeneratedFile(userId int, tokenId int, filename string, purpose string, content []byte) (*model.File, error) {
+	return SaveUploadedFile(userId, tokenId, filename, purpose, bytes.NewReader(content), 0)
+}
+
+// OpenStoredFile opens the local copy of a file, falling back to the upstream
+// copy when the body is not available in the storage backend (e.g. a local
+// disk backend on another node).
+func OpenStoredFile(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	storage, err := GetFileStorage(file.StorageBackend)
+	if err == nil && file.StorageKey != "" {
+		reader, openErr := storage.Open(file.StorageKey)
+		if openErr == nil {
+			return reader, nil
+		}
+		err = openErr
+	}
+	if file.ChannelId == 0 || file.UpstreamFileId == "" {
+		return nil, err
+	}
+	resp, upstreamErr := doChannelFileRequest(ctx, file.ChannelId, file.ChannelKeyIndex, http.MethodGet, "/"+file.UpstreamFileId+"/content", nil, "")
+	if upstreamErr != nil {
+		return nil, upstreamErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		CloseResponseBodyGracefully(resp)
+		return nil, fmt.Errorf("upstream file content returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// DeleteStoredFile removes a file from the storage backend, the upstream
+// channel (best effort) and the database.
+func DeleteStoredFile(ctx context.Context, file *model.File) error {
+	if storage, err := GetFileStorage(file.StorageBackend); err == nil && file.StorageKey != "" {
+		if err := storage.Delete(file.StorageKey); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete stored file %s: %s", file.FileId, err.Error()))
+		}
+	}
+	if file.ChannelId != 0 && file.UpstreamFileId != "" {
+		resp, err := doChannelFileRequest(ctx, file.ChannelId, file.ChannelKeyIndex, http.MethodDelete, "/"+file.UpstreamFileId, nil, "")
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to delete upstream file %s: %s", file.UpstreamFileId, err.Error()))
+		} else {
+			CloseResponseBodyGracefully(resp)
+		}
+	}
+	return model.DeleteFile(file)
+}
+
+// ForwardFileToChannel uploads a stored file to an OpenAI/Azure channel and
+// records the upstream file id so later requests can be routed back to it.
+func ForwardFileToChannel(ctx context.Context, file *model.File, channelId int, keyIndex int) error {
+	reader, err := OpenStoredFile(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	bodyReader, bodyWriter := io.Pipe()
+	formWriter := multipart.NewWriter(bodyWriter)
+	go func() {
+		err := formWriter.WriteField("purpose", file.Purpose)
+		if err == nil {
+			var part io.Writer
+			part, err = formWriter.CreateFormFile("file", file.Filename)
+			if err == nil {
+				_, err = io.Copy(part, reader)
+			}
+		}
+		if err == nil {
+			err = formWriter.Close()
+		}
+		_ = bodyWriter.CloseWithError(err)
+	}()
+
+	resp, err := doChannelFileRequest(ctx, channelId, keyIndex, http.MethodPost, "", bodyReader, formWriter.FormDataContentType())
+	if err != nil {
+		_ = bodyReader.CloseWithError(err)
+		return err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream file upload returned status %d: %s", resp.StatusCode, common.LocalLogPreview(string(responseBody)))
+	}
+	var upstreamFile dto.OpenAIFile
+	if err := common.Unmarshal(responseBody, &upstreamFile); err != nil {
+		return err
+	}
+	if upstreamFile.Id == "" {
+		return errors.New("upstream file upload returned an empty id")
+	}
+	return file.UpdateUpstream(channelId, keyIndex, upstreamFile.Id)
+}
+
+// EnsureFileOnChannel returns the upstream id of a file on the given channel
+// key, uploading the file first when it only exists elsewhere.
+func EnsureFileOnChannel(ctx context.Context, file *model.File, channelId int, keyIndex int) (string, error) {
+	if file.UpstreamFileId != "" && file.ChannelId == channelId && file.ChannelKeyIndex == keyIndex {
+		return file.UpstreamFileId, nil
+	}
+	if err := ForwardFileToChannel(ctx, file, channelId, keyIndex); err != nil {
+		return "", err
+	}
+	return file.UpstreamFileId, nil
+}
+
+// IsFileForwardableChannel reports whether a channel type speaks the OpenAI
+// files API.
+func IsFileForwardableChannel(channelType int) bool {
+	return channelType == constant.ChannelTypeOpenAI || channelType == constant.ChannelTypeAzure
+}
+
+func FileToOpenAIObject(file *model.File) dto.OpenAIFile {
+	object := dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+	if file.ExpiresAt > 0 {
+		expiresAt := file.ExpiresAt
+		object.ExpiresAt = &expiresAt
+	}
+	return object
+}
+
+// doChannelFileRequest sends a request to the files endpoint of a channel.
+// subPath is appended to the files collection URL ("" for the collection).
+func doChannelFileRequest(ctx context.Context, channelId int, keyIndex int, method string, subPath string, body io.Reader, contentType string) (*http.Response, error) {
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		return nil, err
+	}
+	return doChannelRequest(ctx, channel, keyIndex, method, "/files"+subPath, body, contentType)
+}
+
+// doChannelRequest sends a request to an OpenAI-style management endpoint
+// (files, batches, fine-tuning) of an OpenAI or Azure channel. path is
+// relative to /v1 (OpenAI) or /openai (Azure).
+func doChannelRequest(ctx context.Context, channel *model.Channel, keyIndex int, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	return doChannelRequestWithKey(ctx, channel, channelKeyAt(channel, keyIndex), method, path, body, contentType)
+}
+
+// doChannelRequestWithKey is doChannelRequest for callers that already hold
+// the exact upstream key, e.g. async tasks that recorded it on submission.
+func doChannelRequestWithKey(ctx context.Context, channel *model.Channel, key string, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	if !IsFileForwardableChannel(channel.Type) {
+		return nil, fmt.Errorf("channel type %d does not support the files API", channel.Type)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, OpenAIChannelAPIURL(channel.Type, channel.GetBaseURL(), channel.Other, path), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if channel.Type == constant.ChannelTypeAzure {
+		req.Header.Set("api-key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+		if channel.OpenAIOrganization != nil && *channel.OpenAIOrganization != "" {
+			req.Header.Set("OpenAI-Organization", *channel.OpenAIOrganization)
+		}
+	}
+
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// OpenAIChannelAPIURL builds the URL of an OpenAI management API path (files,
+// fine-tuning, ...) for an OpenAI or Azure OpenAI channel. apiVersion is only
+// used by Azure and falls back to the default version when empty.
+func OpenAIChannelAPIURL(channelType int, baseURL string, apiVersion string, path string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if channelType == constant.ChannelTypeAzure {
+		if apiVersion == "" {
+			apiVersion = constant.AzureDefaultAPIVersion
+		}
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		return fmt.Sprintf("%s/openai%s%sapi-version=%s", baseURL, path, separator, apiVersion)
+	}
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[constant.ChannelTypeOpenAI]
+	}
+	return fmt.Sprintf("%s/v1%s", baseURL, path)
+}
+
+// channelKeyAt returns the key at index for multi-key channels so follow-up
+// requests reach the same upstream account that owns the uploaded file.
+func channelKeyAt(channel *model.Channel, index int) string {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key
+	}
+	keys := channel.GetKeys()
+	if index >= 0 && index < len(keys) {
+		return keys[index]
+	}
+	if len(keys) > 0 {
+		return keys[0]
+	}
+	return channel.Key
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedOrganizationMember(t *testing.T, userId int, quota int, quotaLimit int) *model.Organization {
+	t.Helper()
+	organization := &model.Organization{Name: "acme", Quota: quota, Status: model.OrganizationStatusEnabled}
+	require.NoError(t, organization.Insert())
+	require.NoError(t, model.AddOrganizationMember(&model.OrganizationMember{
+		OrganizationId: organization.Id,
+		UserId:         userId,
+		Role:           model.OrganizationRoleMember,
+		QuotaLimit:     quotaLimit,
+	}))
+	return organization
+}
+
+// newOrganizationRelayInfo returns a playground request, which leaves token
+// quota out of the billing under test.
+func newOrganizationRelayInfo(requestId string) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		UserId:          1,
+		RequestId:       requestId,
+		OriginModelName: "test-model",
+		IsPlayground:    true,
+	}
+}
+
+func TestNewBillingSessionBillsOrganizationOfMember(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 5000)
+	organization := seedOrganizationMember(t, 1, 1000, 600)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	info := newOrganizationRelayInfo("req-org-1")
+	session, apiErr := NewBillingSession(c, info, 400)
+	require.Nil(t, apiErr)
+	assert.Equal(t, BillingSourceOrganization, info.BillingSource)
+	assert.Equal(t, organization.Id, info.OrganizationId)
+	require.NoError(t, session.Settle(500))
+
+	organization, err := model.GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 500, organization.Quota)
+	assert.Equal(t, 500, organization.UsedQuota)
+	member, err := model.GetOrganizationMemberByUserId(1)
+	require.NoError(t, err)
+	assert.Equal(t, 500, member.UsedQuota)
+	assert.Equal(t, 5000, getUserQuota(t, 1), "the wallet of the member is not charged")
+
+	// 500 spent of a 600 limit leaves no room for another 200.
+	_, apiErr = NewBillingSession(c, newOrganizationRelayInfo("req-org-2"), 200)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeInsufficientUserQuota, apiErr.GetErrorCode())
+}
+
+func TestNewBillingSessionRejectsDisabledOrganization(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 5000)
+	organization := seedOrganizationMember(t, 1, 1000, 0)
+	organization.Status = model.OrganizationStatusDisabled
+	require.NoError(t, organization.Update())
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	_, apiErr := NewBillingSession(c, newOrganizationRelayInfo("req-org-3"), 100)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeInsufficientUserQuota, apiErr.GetErrorCode())
+	assert.Equal(t, 5000, getUserQuota(t, 1))
+}
+
+func TestRefundMidjourneyQuotaReturnsOrganizationQuota(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 5000)
+	organization := seedOrganizationMember(t, 1, 1000, 0)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	info := newOrganizationRelayInfo("req-org-mj")
+	info.ForcePreConsume = true
+	require.Nil(t, PreConsumeBilling(c, 300, info))
+	require.NoError(t, SettleBilling(c, info, 300))
+
+	task := &model.Midjourney{
+		UserId:         1,
+		Quota:          300,
+		BillingSource:  info.BillingSource,
+		OrganizationId: info.OrganizationId,
+	}
+	require.NoError(t, RefundMidjourneyQuota(task))
+
+	organization, err := model.GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, organization.Quota)
+	assert.Equal(t, 0, organization.UsedQuota)
+	assert.Equal(t, 5000, getUserQuota(t, 1))
+}
+
+func TestPreWssConsumeQuotaChecksOrganizationOfMember(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 0)
+	// the token is read from the cache, the query by key needs the column
+	// names only the model package sets up
+	useIndependentAuthSessionRedis(t)
+	require.NoError(t, common.RedisHSetObj("token:"+common.GenerateHMAC("realtime-key"), &model.Token{Id: 1, UserId: 1, Status: common.TokenStatusEnabled, UnlimitedQuota: true}, time.Minute))
+	organization := seedOrganizationMember(t, 1, 100000, 0)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	usage := &dto.RealtimeUsage{InputTokenDetails: dto.InputTokenDetails{TextTokens: 100}}
+	newInfo := func() *relaycommon.RelayInfo {
+		info := newOrganizationRelayInfo("req-wss")
+		info.TokenKey = "sk-realtime-key"
+		info.OriginModelName = "gpt-4o-realtime-preview"
+		info.UsingGroup = "default"
+		info.BillingSource = BillingSourceOrganization
+		info.OrganizationId = organization.Id
+		return info
+	}
+
+	// the empty wallet of the member does not matter, the organization pays
+	require.NoError(t, PreWssConsumeQuota(c, newInfo(), usage))
+	member, err := model.GetOrganizationMemberByUserId(1)
+	require.NoError(t, err)
+	require.Positive(t, member.UsedQuota)
+	organization, err = model.GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 100000-member.UsedQuota, organization.Quota)
+	assert.Equal(t, 0, getUserQuota(t, 1))
+
+	// a limit the next event would pass is enforced before it is charged
+	member.QuotaLimit = member.UsedQuota + 1
+	require.NoError(t, model.UpdateOrganizationMember(member))
+	assert.Error(t, PreWssConsumeQuota(c, newInfo(), usage))
+	organization, err = model.GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 100000-member.UsedQuota, organization.Quota)
+}
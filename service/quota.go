@@ -90,11 +90,6 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
-	if err != nil {
-		return err
-	}
-
 	token, err := model.GetTokenByKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"), false)
 	if err != nil {
 		return err
@@ -139,8 +134,20 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	quota, clamp := calculateAudioQuota(quotaInfo)
 	noteQuotaClamp(relayInfo, clamp)
 
-	if userQuota < quota {
-		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
+	if relayInfo.OrganizationId != 0 {
+		// PostConsumeQuota charges the organization, within the limit of the member
+		fromBalance := relayInfo.BillingSource == BillingSourceOrganization
+		if err := model.CheckOrganizationQuota(relayInfo.OrganizationId, relayInfo.UserId, quota, fromBalance); err != nil {
+			return fmt.Errorf("organization quota is not enough, need quota: %s: %w", logger.FormatQuota(quota), err)
+		}
+	} else {
+		userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+		if err != nil {
+			return err
+		}
+		if userQuota < quota {
+			return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
+		}
 	}
 
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
@@ -255,6 +262,8 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
 		Other:            other,
+		OrganizationId:   relayInfo.OrganizationId,
+		BudgetSettled:    relayInfo.BudgetSettled,
 	})
 }
 
@@ -280,6 +289,9 @@ func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData types.PriceData)
 }
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	if IsHedgeLoser(ctx) {
+		return
+	}
 
 	var tieredUsedVars map[string]bool
 	if snap := relayInfo.TieredBillingSnapshot; snap != nil {
@@ -378,6 +390,8 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
 		Other:            other,
+		OrganizationId:   relayInfo.OrganizationId,
+		BudgetSettled:    relayInfo.BudgetSettled,
 	})
 	gopool.Go(func() {
 		perfmetrics.RecordRelaySample(relayInfo, true, int64(usage.CompletionTokens))
@@ -401,16 +415,16 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
-	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
-	if err != nil {
+	// 派生令牌的消耗汇总到父令牌，父令牌余额也须覆盖本次预扣
+	if err = model.CheckParentTokenQuota(relayInfo.TokenParentId, quota); err != nil {
 		return err
 	}
-	return nil
+	return model.AdjustTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, relayInfo.TokenParentId, quota)
 }
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
-	// 1) Consume from wallet quota OR subscription item
+	// 1) Consume from wallet quota, subscription item OR organization quota pool
 	if relayInfo != nil && relayInfo.BillingSource == BillingSourceSubscription {
 		if relayInfo.SubscriptionId == 0 {
 			return errors.New("subscription id is missing")
@@ -421,6 +435,18 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 				return err
 			}
 			relayInfo.SubscriptionPostDelta += delta
+			if relayInfo.OrganizationId > 0 {
+				if err := model.AdjustOrganizationQuota(relayInfo.OrganizationId, relayInfo.UserId, quota, false); err != nil {
+					return err
+				}
+			}
+		}
+	} else if relayInfo != nil && relayInfo.BillingSource == BillingSourceOrganization {
+		if relayInfo.OrganizationId == 0 {
+			return errors.New("organization id is missing")
+		}
+		if err := model.AdjustOrganizationQuota(relayInfo.OrganizationId, relayInfo.UserId, quota, true); err != nil {
+			return err
 		}
 	} else {
 		// Wallet
@@ -435,12 +461,7 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 	}
 
 	if !relayInfo.IsPlayground {
-		if quota > 0 {
-			err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
-		} else {
-			err = model.IncreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, -quota)
-		}
-		if err != nil {
+		if err = model.AdjustTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, relayInfo.TokenParentId, quota); err != nil {
 			return err
 		}
 	}
@@ -19,6 +19,8 @@ type ClaudeResponseInfo struct {
 	ResponseText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
+	// ResponsesStream is set while relaying the stream to a Responses client.
+	ResponsesStream *ClaudeToResponsesStreamState
 }
 
 func StopReasonClaudeToOpenAI(reason string) string {
@@ -0,0 +1,490 @@
+package claudemessages
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	responsesEventCreated               = "response.created"
+	responsesEventCompleted             = "response.completed"
+	responsesEventIncomplete            = "response.incomplete"
+	responsesEventOutputItemAdded       = "response.output_item.added"
+	responsesEventOutputItemDone        = "response.output_item.done"
+	responsesEventContentPartAdded      = "response.content_part.added"
+	responsesEventContentPartDone       = "response.content_part.done"
+	responsesEventOutputTextDelta       = "response.output_text.delta"
+	responsesEventOutputTextDone        = "response.output_text.done"
+	responsesEventFunctionArgsDelta     = "response.function_call_arguments.delta"
+	responsesEventFunctionArgsDone      = "response.function_call_arguments.done"
+	responsesEventReasoningPartAdded    = "response.reasoning_summary_part.added"
+	responsesEventReasoningPartDone     = "response.reasoning_summary_part.done"
+	responsesEventReasoningSummaryDelta = "response.reasoning_summary_text.delta"
+	responsesEventReasoningSummaryDone  = "response.reasoning_summary_text.done"
+
+	responsesOutputTypeMessage      = "message"
+	responsesOutputTypeReasoning    = "reasoning"
+	responsesOutputTypeFunctionCall = "function_call"
+)
+
+// ClaudeMessagesResponseToResponsesResponse maps every Claude content block to
+// its own Responses output item so the client sees them in upstream order.
+// Thinking signatures travel as encrypted_content, which lets the client send
+// the reasoning item back on the next turn as required for tool use.
+func ClaudeMessagesResponseToResponsesResponse(resp *dto.ClaudeResponse, id string) (*dto.OpenAIResponsesResponse, error) {
+	if resp == nil {
+		return nil, errors.New("response is nil")
+	}
+	status, details := claudeStopReasonToResponsesStatus(resp.StopReason)
+	itemStatus := responsesItemStatus(status)
+	out := &dto.OpenAIResponsesResponse{
+		ID:                id,
+		Object:            "response",
+		CreatedAt:         int(time.Now().Unix()),
+		Status:            []byte(fmt.Sprintf("%q", status)),
+		IncompleteDetails: details,
+		Model:             resp.Model,
+		Output:            make([]dto.ResponsesOutput, 0, len(resp.Content)),
+		Usage:             ResponsesUsageFromClaudeAPIUsage(resp.Usage),
+	}
+	for i, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			out.Output = append(out.Output, responsesMessageOutput(fmt.Sprintf("%s_msg_%d", id, i), block.GetText(), itemStatus))
+		case "thinking":
+			thinking := ""
+			if block.Thinking != nil {
+				thinking = *block.Thinking
+			}
+			out.Output = append(out.Output, responsesReasoningOutput(fmt.Sprintf("%s_reasoning_%d", id, i), thinking, block.Signature, itemStatus))
+		case "tool_use":
+			args, err := common.Marshal(block.Input)
+			if err != nil {
+				return nil, err
+			}
+			out.Output = append(out.Output, responsesFunctionCallOutput(block.Id, block.Name, string(args), itemStatus))
+		}
+	}
+	return out, nil
+}
+
+// ResponsesUsageFromClaudeAPIUsage reports Claude usage with the input/output
+// token names of the Responses API, cache reads and writes included in input.
+func ResponsesUsageFromClaudeAPIUsage(usage *dto.ClaudeUsage) *dto.Usage {
+	return responsesUsageFromOpenAIStyleUsage(UsageFromClaudeAPIUsage(usage))
+}
+
+func responsesUsageFromOpenAIStyleUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return &dto.Usage{}
+	}
+	usage.InputTokens = usage.PromptTokens
+	usage.OutputTokens = usage.CompletionTokens
+	if usage.PromptTokensDetails.CachedTokens != 0 || usage.PromptTokensDetails.CacheWriteTokens != 0 {
+		details := usage.PromptTokensDetails
+		usage.InputTokensDetails = &details
+	}
+	return usage
+}
+
+func claudeStopReasonToResponsesStatus(stopReason string) (string, *dto.IncompleteDetails) {
+	switch stopReason {
+	case "max_tokens", "model_context_window_exceeded":
+		return "incomplete", &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	case "refusal":
+		return "incomplete", &dto.IncompleteDetails{Reason: "content_filter"}
+	default:
+		return "completed", nil
+	}
+}
+
+func responsesItemStatus(status string) string {
+	if status == "incomplete" {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+func responsesMessageOutput(id string, text string, status string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:   responsesOutputTypeMessage,
+		ID:     id,
+		Status: status,
+		Role:   "assistant",
+		Content: []dto.ResponsesOutputContent{
+			{
+				Type:        "output_text",
+				Text:        text,
+				Annotations: []interface{}{},
+			},
+		},
+	}
+}
+
+func responsesReasoningOutput(id string, thinking string, signature string, status string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:   responsesOutputTypeReasoning,
+		ID:     id,
+		Status: status,
+		Summary: []dto.ResponsesReasoningSummaryPart{
+			{
+				Type: "summary_text",
+				Text: thinking,
+			},
+		},
+		EncryptedContent: signature,
+	}
+}
+
+func responsesFunctionCallOutput(callID string, name string, arguments string, status string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:      responsesOutputTypeFunctionCall,
+		ID:        callID,
+		Status:    status,
+		CallId:    callID,
+		Name:      name,
+		Arguments: responsesArgumentsRawMessage(arguments),
+	}
+}
+
+func responsesArgumentsRawMessage(arguments string) []byte {
+	raw, err := common.Marshal(arguments)
+	if err != nil {
+		return []byte(`""`)
+	}
+	return raw
+}
+
+type ClaudeToResponsesStreamState struct {
+	ID      string
+	Model   string
+	Created int64
+	Usage   *dto.Usage
+
+	status            string
+	incompleteDetails *dto.IncompleteDetails
+	sentCreated       bool
+	finalized         bool
+	claudeUsage       dto.ClaudeUsage
+	blocks            map[int]*claudeToResponsesBlock
+	output            []*claudeToResponsesBlock
+	text              strings.Builder
+}
+
+type claudeToResponsesBlock struct {
+	Kind        string
+	OutputIndex int
+	ID          string
+	Name        string
+	Signature   string
+	Content     strings.Builder
+	Done        bool
+}
+
+func NewClaudeToResponsesStreamState(id string, model string) *ClaudeToResponsesStreamState {
+	return &ClaudeToResponsesStreamState{
+		ID:      id,
+		Model:   model,
+		Created: time.Now().Unix(),
+		Usage:   &dto.Usage{},
+		status:  "completed",
+		blocks:  make(map[int]*claudeToResponsesBlock),
+	}
+}
+
+// ClaudeStreamEventToResponsesEvents translates one Claude SSE event. Blocks
+// Responses has no counterpart for (server tools, redacted thinking) are
+// dropped; the terminal response event is only produced by the finalizer.
+func ClaudeStreamEventToResponsesEvents(event *dto.ClaudeResponse, state *ClaudeToResponsesStreamState) []dto.ResponsesStreamResponse {
+	if event == nil || state == nil || state.finalized {
+		return nil
+	}
+	events := make([]dto.ResponsesStreamResponse, 0, 2)
+	if !state.sentCreated {
+		state.sentCreated = true
+		if event.Message != nil && state.Model == "" {
+			state.Model = event.Message.Model
+		}
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:     responsesEventCreated,
+			Response: state.response("in_progress", []dto.ResponsesOutput{}),
+		})
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			state.mergeUsage(event.Message.Usage)
+		}
+	case "content_block_start":
+		if event.ContentBlock != nil {
+			events = append(events, state.startBlock(event.GetIndex(), event.ContentBlock)...)
+		}
+	case "content_block_delta":
+		if event.Delta != nil {
+			events = append(events, state.blockDelta(event.GetIndex(), event.Delta)...)
+		}
+	case "content_block_stop":
+		if block := state.blocks[event.GetIndex()]; block != nil {
+			events = append(events, state.finishBlock(block)...)
+		}
+	case "message_delta":
+		if event.Delta != nil && event.Delta.StopReason != nil {
+			state.status, state.incompleteDetails = claudeStopReasonToResponsesStatus(*event.Delta.StopReason)
+		}
+		state.mergeUsage(event.Usage)
+	}
+	return events
+}
+
+func FinalizeClaudeStreamToResponses(state *ClaudeToResponsesStreamState) []dto.ResponsesStreamResponse {
+	if state == nil || state.finalized {
+		return nil
+	}
+	events := make([]dto.ResponsesStreamResponse, 0)
+	for _, block := range state.output {
+		events = append(events, state.finishBlock(block)...)
+	}
+	state.finalized = true
+
+	output := make([]dto.ResponsesOutput, 0, len(state.output))
+	for _, block := range state.output {
+		output = append(output, state.blockOutput(block))
+	}
+	eventType := responsesEventCompleted
+	if state.status == "incomplete" {
+		eventType = responsesEventIncomplete
+	}
+	return append(events, dto.ResponsesStreamResponse{
+		Type:     eventType,
+		Response: state.response(state.status, output),
+	})
+}
+
+func (s *ClaudeToResponsesStreamState) UsageText() string {
+	if s == nil {
+		return ""
+	}
+	return s.text.String()
+}
+
+func (s *ClaudeToResponsesStreamState) startBlock(index int, contentBlock *dto.ClaudeMediaMessage) []dto.ResponsesStreamResponse {
+	block := &claudeToResponsesBlock{OutputIndex: len(s.output)}
+	switch contentBlock.Type {
+	case "text":
+		block.Kind = responsesOutputTypeMessage
+		block.ID = fmt.Sprintf("%s_msg_%d", s.ID, index)
+	case "thinking":
+		block.Kind = responsesOutputTypeReasoning
+		block.ID = fmt.Sprintf("%s_reasoning_%d", s.ID, index)
+	case "tool_use":
+		block.Kind = responsesOutputTypeFunctionCall
+		block.ID = contentBlock.Id
+		block.Name = contentBlock.Name
+		if block.ID == "" {
+			block.ID = fmt.Sprintf("%s_call_%d", s.ID, index)
+		}
+	default:
+		return nil
+	}
+	s.blocks[index] = block
+	s.output = append(s.output, block)
+
+	item := s.blockOutput(block)
+	item.Status = "in_progress"
+	events := []dto.ResponsesStreamResponse{{
+		Type:        responsesEventOutputItemAdded,
+		OutputIndex: common.GetPointer(block.OutputIndex),
+		ItemID:      block.ID,
+		Item:        &item,
+	}}
+	switch block.Kind {
+	case responsesOutputTypeMessage:
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:         responsesEventContentPartAdded,
+			OutputIndex:  common.GetPointer(block.OutputIndex),
+			ContentIndex: common.GetPointer(0),
+			ItemID:       block.ID,
+			Part:         &dto.ResponsesReasoningSummaryPart{Type: "output_text"},
+		})
+		if text := contentBlock.GetText(); text != "" {
+			events = append(events, s.blockDelta(index, &dto.ClaudeMediaMessage{Type: "text_delta", Text: &text})...)
+		}
+	case responsesOutputTypeReasoning:
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:         responsesEventReasoningPartAdded,
+			OutputIndex:  common.GetPointer(block.OutputIndex),
+			SummaryIndex: common.GetPointer(0),
+			ItemID:       block.ID,
+			Part:         &dto.ResponsesReasoningSummaryPart{Type: "summary_text"},
+		})
+	}
+	return events
+}
+
+func (s *ClaudeToResponsesStreamState) blockDelta(index int, delta *dto.ClaudeMediaMessage) []dto.ResponsesStreamResponse {
+	block := s.blocks[index]
+	if block == nil || block.Done {
+		return nil
+	}
+	switch delta.Type {
+	case "text_delta":
+		text := delta.GetText()
+		if text == "" {
+			return nil
+		}
+		block.Content.WriteString(text)
+		s.text.WriteString(text)
+		return []dto.ResponsesStreamResponse{{
+			Type:         responsesEventOutputTextDelta,
+			OutputIndex:  common.GetPointer(block.OutputIndex),
+			ContentIndex: common.GetPointer(0),
+			ItemID:       block.ID,
+			Delta:        text,
+		}}
+	case "thinking_delta":
+		if delta.Thinking == nil || *delta.Thinking == "" {
+			return nil
+		}
+		block.Content.WriteString(*delta.Thinking)
+		s.text.WriteString(*delta.Thinking)
+		return []dto.ResponsesStreamResponse{{
+			Type:         responsesEventReasoningSummaryDelta,
+			OutputIndex:  common.GetPointer(block.OutputIndex),
+			SummaryIndex: common.GetPointer(0),
+			ItemID:       block.ID,
+			Delta:        *delta.Thinking,
+		}}
+	case "signature_delta":
+		block.Signature += delta.Signature
+	case "input_json_delta":
+		if delta.PartialJson == nil || *delta.PartialJson == "" {
+			return nil
+		}
+		block.Content.WriteString(*delta.PartialJson)
+		return []dto.ResponsesStreamResponse{{
+			Type:        responsesEventFunctionArgsDelta,
+			OutputIndex: common.GetPointer(block.OutputIndex),
+			ItemID:      block.ID,
+			Delta:       *delta.PartialJson,
+		}}
+	}
+	return nil
+}
+
+func (s *ClaudeToResponsesStreamState) finishBlock(block *claudeToResponsesBlock) []dto.ResponsesStreamResponse {
+	if block.Done {
+		return nil
+	}
+	block.Done = true
+	events := make([]dto.ResponsesStreamResponse, 0, 3)
+	switch block.Kind {
+	case responsesOutputTypeMessage:
+		events = append(events,
+			dto.ResponsesStreamResponse{
+				Type:         responsesEventOutputTextDone,
+				OutputIndex:  common.GetPointer(block.OutputIndex),
+				ContentIndex: common.GetPointer(0),
+				ItemID:       block.ID,
+			},
+			dto.ResponsesStreamResponse{
+				Type:         responsesEventContentPartDone,
+				OutputIndex:  common.GetPointer(block.OutputIndex),
+				ContentIndex: common.GetPointer(0),
+				ItemID:       block.ID,
+				Part:         &dto.ResponsesReasoningSummaryPart{Type: "output_text", Text: block.Content.String()},
+			},
+		)
+	case responsesOutputTypeReasoning:
+		part := &dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: block.Content.String()}
+		events = append(events,
+			dto.ResponsesStreamResponse{
+				Type:         responsesEventReasoningSummaryDone,
+				OutputIndex:  common.GetPointer(block.OutputIndex),
+				SummaryIndex: common.GetPointer(0),
+				ItemID:       block.ID,
+				Part:         part,
+			},
+			dto.ResponsesStreamResponse{
+				Type:         responsesEventReasoningPartDone,
+				OutputIndex:  common.GetPointer(block.OutputIndex),
+				SummaryIndex: common.GetPointer(0),
+				ItemID:       block.ID,
+				Part:         part,
+			},
+		)
+	case responsesOutputTypeFunctionCall:
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:        responsesEventFunctionArgsDone,
+			OutputIndex: common.GetPointer(block.OutputIndex),
+			ItemID:      block.ID,
+		})
+	}
+	item := s.blockOutput(block)
+	return append(events, dto.ResponsesStreamResponse{
+		Type:        responsesEventOutputItemDone,
+		OutputIndex: common.GetPointer(block.OutputIndex),
+		ItemID:      block.ID,
+		Item:        &item,
+	})
+}
+
+func (s *ClaudeToResponsesStreamState) blockOutput(block *claudeToResponsesBlock) dto.ResponsesOutput {
+	status := responsesItemStatus(s.status)
+	switch block.Kind {
+	case responsesOutputTypeReasoning:
+		return responsesReasoningOutput(block.ID, block.Content.String(), block.Signature, status)
+	case responsesOutputTypeFunctionCall:
+		arguments := block.Content.String()
+		if arguments == "" {
+			arguments = "{}"
+		}
+		return responsesFunctionCallOutput(block.ID, block.Name, arguments, status)
+	default:
+		return responsesMessageOutput(block.ID, block.Content.String(), status)
+	}
+}
+
+func (s *ClaudeToResponsesStreamState) mergeUsage(usage *dto.ClaudeUsage) {
+	if usage == nil {
+		return
+	}
+	if usage.InputTokens > 0 {
+		s.claudeUsage.InputTokens = usage.InputTokens
+	}
+	if usage.CacheReadInputTokens > 0 {
+		s.claudeUsage.CacheReadInputTokens = usage.CacheReadInputTokens
+	}
+	if usage.CacheCreationInputTokens > 0 {
+		s.claudeUsage.CacheCreationInputTokens = usage.CacheCreationInputTokens
+	}
+	if usage.CacheCreation != nil {
+		s.claudeUsage.CacheCreation = usage.CacheCreation
+	}
+	if usage.OutputTokens > 0 {
+		s.claudeUsage.OutputTokens = usage.OutputTokens
+	}
+	claudeUsage := s.claudeUsage
+	s.Usage = ResponsesUsageFromClaudeAPIUsage(&claudeUsage)
+}
+
+func (s *ClaudeToResponsesStreamState) response(status string, output []dto.ResponsesOutput) *dto.OpenAIResponsesResponse {
+	resp := &dto.OpenAIResponsesResponse{
+		ID:        s.ID,
+		Object:    "response",
+		CreatedAt: int(s.Created),
+		Status:    []byte(fmt.Sprintf("%q", status)),
+		Model:     s.Model,
+		Output:    output,
+	}
+	if status != "in_progress" {
+		resp.IncompleteDetails = s.incompleteDetails
+		resp.Usage = s.Usage
+	}
+	return resp
+}
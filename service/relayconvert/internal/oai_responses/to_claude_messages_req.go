@@ -28,7 +28,7 @@ func OpenAIResponsesRequestToClaudeMessages(c *gin.Context, req *dto.OpenAIRespo
 	if req.Model == "" {
 		return nil, fmt.Errorf("model is required")
 	}
-	if err := ValidateRequestChatUnsupportedFields(req); err != nil {
+	if err := validateResponsesRequestClaudeUnsupportedFields(req); err != nil {
 		return nil, err
 	}
 
@@ -85,11 +85,17 @@ func OpenAIResponsesRequestToClaudeMessages(c *gin.Context, req *dto.OpenAIRespo
 		itemType := strings.TrimSpace(common.Interface2String(item["type"]))
 		switch itemType {
 		case ResponsesInputTypeFunctionCall:
-			claudeRequest.Messages = appendClaudeToolUse(claudeRequest.Messages, responsesFunctionCallItemToClaudeToolUse(item, "arguments"))
+			claudeRequest.Messages = appendClaudeAssistantContent(claudeRequest.Messages, responsesFunctionCallItemToClaudeToolUse(item, "arguments"))
 		case ResponsesInputTypeCustomToolCall:
-			claudeRequest.Messages = appendClaudeToolUse(claudeRequest.Messages, responsesFunctionCallItemToClaudeToolUse(item, "input"))
+			claudeRequest.Messages = appendClaudeAssistantContent(claudeRequest.Messages, responsesFunctionCallItemToClaudeToolUse(item, "input"))
 		case ResponsesInputTypeFunctionCallOutput, ResponsesInputTypeCustomToolOutput:
 			claudeRequest.Messages = appendClaudeToolResult(claudeRequest.Messages, responsesFunctionOutputItemToClaudeToolResult(item))
+		case responsesInputTypeReasoning:
+			if thinking, ok := responsesReasoningItemToClaudeThinking(item); ok {
+				claudeRequest.Messages = appendClaudeAssistantContent(claudeRequest.Messages, thinking)
+			}
+		case responsesInputTypeItemReference:
+			return nil, fmt.Errorf("item_reference input items require stored responses, which Claude Messages does not keep")
 		default:
 			role := responsesClaudeRole(item)
 			parts, err := responsesInputContentToClaudeMediaMessages(c, item["content"])
@@ -108,6 +114,12 @@ func OpenAIResponsesRequestToClaudeMessages(c *gin.Context, req *dto.OpenAIRespo
 					},
 				}
 			}
+			if role == "assistant" {
+				// keep replayed reasoning, text and tool_use of one turn in a
+				// single assistant message as Claude returned them
+				claudeRequest.Messages = appendClaudeAssistantContent(claudeRequest.Messages, parts...)
+				continue
+			}
 			claudeRequest.Messages = append(claudeRequest.Messages, dto.ClaudeMessage{
 				Role:    role,
 				Content: parts,
@@ -122,6 +134,16 @@ func OpenAIResponsesRequestToClaudeMessages(c *gin.Context, req *dto.OpenAIRespo
 	return claudeRequest, nil
 }
 
+// validateResponsesRequestClaudeUnsupportedFields rejects the stateful fields
+// Claude cannot resolve, telling clients how to continue a conversation
+// without previous_response_id.
+func validateResponsesRequestClaudeUnsupportedFields(req *dto.OpenAIResponsesRequest) error {
+	if strings.TrimSpace(req.PreviousResponseID) != "" {
+		return fmt.Errorf("previous_response_id is not supported by Claude Messages upstreams, send the full conversation in input instead")
+	}
+	return ValidateRequestChatUnsupportedFields(req)
+}
+
 func responsesFunctionDeclarationsToClaudeTools(functions []dto.FunctionRequest) []any {
 	tools := make([]any, 0, len(functions))
 	for _, function := range functions {
@@ -244,18 +266,38 @@ func responsesToolOutputValue(value any) any {
 	return value
 }
 
-func appendClaudeToolUse(messages []dto.ClaudeMessage, toolUse dto.ClaudeMediaMessage) []dto.ClaudeMessage {
+// responsesReasoningItemToClaudeThinking restores a thinking block from a
+// reasoning item produced by the Claude response converter. Items without
+// encrypted_content carry no Claude signature and cannot be replayed.
+func responsesReasoningItemToClaudeThinking(item map[string]any) (dto.ClaudeMediaMessage, bool) {
+	signature := strings.TrimSpace(common.Interface2String(item["encrypted_content"]))
+	if signature == "" {
+		return dto.ClaudeMediaMessage{}, false
+	}
+	var thinking strings.Builder
+	summaries, _ := item["summary"].([]any)
+	for _, summary := range summaries {
+		if part, ok := summary.(map[string]any); ok {
+			thinking.WriteString(common.Interface2String(part["text"]))
+		}
+	}
+	return dto.ClaudeMediaMessage{
+		Type:      "thinking",
+		Thinking:  common.GetPointer(thinking.String()),
+		Signature: signature,
+	}, true
+}
+
+func appendClaudeAssistantContent(messages []dto.ClaudeMessage, parts ...dto.ClaudeMediaMessage) []dto.ClaudeMessage {
 	if len(messages) > 0 && messages[len(messages)-1].Role == "assistant" {
 		last := messages[len(messages)-1]
-		parts := claudeMessageContentParts(last.Content)
-		parts = append(parts, toolUse)
-		last.Content = parts
+		last.Content = append(claudeMessageContentParts(last.Content), parts...)
 		messages[len(messages)-1] = last
 		return messages
 	}
 	return append(messages, dto.ClaudeMessage{
 		Role:    "assistant",
-		Content: []dto.ClaudeMediaMessage{toolUse},
+		Content: parts,
 	})
 }
 
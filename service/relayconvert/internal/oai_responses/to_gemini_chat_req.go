@@ -134,6 +134,8 @@ func OpenAIResponsesRequestToGeminiChat(c *gin.Context, req *dto.OpenAIResponses
 		case ResponsesInputTypeFunctionCallOutput:
 			part := responsesFunctionOutputItemToGeminiPart(item, callNames)
 			appendGeminiContentPart(geminiRequest, "user", part)
+		case ResponsesInputTypeReasoning:
+			// Reasoning of other providers cannot be replayed to Gemini.
 		default:
 			role := responsesGeminiRole(item)
 			parts, err := responsesInputContentToGeminiParts(c, item["content"])
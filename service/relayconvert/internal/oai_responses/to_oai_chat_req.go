@@ -15,6 +15,8 @@ const (
 	responsesInputTypeFunctionCallOutput = "function_call_output"
 	responsesInputTypeCustomToolCall     = "custom_tool_call"
 	responsesInputTypeCustomToolOutput   = "custom_tool_call_output"
+	responsesInputTypeReasoning          = "reasoning"
+	responsesInputTypeItemReference      = "item_reference"
 )
 
 const (
@@ -22,6 +24,7 @@ const (
 	ResponsesInputTypeFunctionCallOutput = responsesInputTypeFunctionCallOutput
 	ResponsesInputTypeCustomToolCall     = responsesInputTypeCustomToolCall
 	ResponsesInputTypeCustomToolOutput   = responsesInputTypeCustomToolOutput
+	ResponsesInputTypeReasoning          = responsesInputTypeReasoning
 )
 
 func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
@@ -182,6 +185,9 @@ func responsesInputItemToChatMessages(item map[string]any, messages []dto.Messag
 		callID := strings.TrimSpace(common.Interface2String(item["call_id"]))
 		content := responseToolOutputToChatContent(item["output"])
 		return append(messages, dto.Message{Role: "tool", ToolCallId: callID, Content: content}), nil
+	case responsesInputTypeReasoning:
+		// Chat Completions has no way to replay reasoning.
+		return messages, nil
 	}
 
 	role := strings.TrimSpace(common.Interface2String(item["role"]))
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	claudemessages "github.com/QuantumNous/new-api/service/relayconvert/internal/claude_messages"
 	geminichat "github.com/QuantumNous/new-api/service/relayconvert/internal/gemini_chat"
@@ -15,6 +16,7 @@ import (
 	oairesponses "github.com/QuantumNous/new-api/service/relayconvert/internal/oai_responses"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type RequestConverterFunc func(c *gin.Context, info *relaycommon.RelayInfo, request any) (any, error)
@@ -236,18 +238,27 @@ func executeRequestSpec(c *gin.Context, info *relaycommon.RelayInfo, from types.
 }
 
 func executeRequestSteps(c *gin.Context, info *relaycommon.RelayInfo, from types.RelayFormat, target types.RelayFormat, request any, converter string, quality RequestConverterQuality, specs []RequestConverterSpec) (*RequestResult, error) {
+	span := tracing.StartSpan(c, "request_conversion",
+		attribute.String("from", string(from)),
+		attribute.String("to", string(target)),
+		attribute.Int("steps", len(specs)),
+	)
+	defer span.End()
+
 	current := request
 	steps := make([]RequestStep, 0, len(specs))
 	for _, spec := range specs {
 		var err error
 		current, err = prepareRequestForStep(current, spec, target)
 		if err != nil {
+			span.SetError(err)
 			return nil, err
 		}
 
 		var step RequestStep
 		current, step, err = executeRequestStep(c, info, spec, current)
 		if err != nil {
+			span.SetError(err)
 			return nil, err
 		}
 		steps = append(steps, step)
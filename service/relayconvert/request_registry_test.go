@@ -607,6 +607,46 @@ func TestConvertRequestResponsesToClaudeUsesDirectConverter(t *testing.T) {
 	assert.Equal(t, map[string]any{"ok": true}, toolResultParts[0].Content)
 }
 
+func TestConvertRequestResponsesToClaudeReplaysReasoningItems(t *testing.T) {
+	req := &dto.OpenAIResponsesRequest{
+		Model: "claude-test",
+		Input: mustRawMessage(t, []map[string]any{
+			{"role": "user", "content": "question"},
+			{
+				"type":              "reasoning",
+				"id":                "rs_1",
+				"summary":           []map[string]any{{"type": "summary_text", "text": "think "}, {"type": "summary_text", "text": "hard"}},
+				"encrypted_content": "sig_1",
+			},
+			{"type": "reasoning", "id": "rs_openai", "summary": []map[string]any{{"type": "summary_text", "text": "unsigned"}}},
+			{"type": "message", "role": "assistant", "content": []map[string]any{{"type": "output_text", "text": "calling"}}},
+			{"type": "function_call", "call_id": "call_1", "name": "lookup", "arguments": `{"q":"x"}`},
+			{"type": "function_call_output", "call_id": "call_1", "output": "ok"},
+		}),
+	}
+
+	result, err := ConvertRequest(nil, &relaycommon.RelayInfo{}, types.RelayFormatClaude, req)
+	require.NoError(t, err)
+	claudeReq, ok := result.Value.(*dto.ClaudeRequest)
+	require.True(t, ok)
+
+	require.Len(t, claudeReq.Messages, 3)
+	assert.Equal(t, "assistant", claudeReq.Messages[1].Role)
+	assistantParts, err := claudeReq.Messages[1].ParseContent()
+	require.NoError(t, err)
+	require.Len(t, assistantParts, 3, "unsigned reasoning is dropped and the turn stays in one message")
+	assert.Equal(t, "thinking", assistantParts[0].Type)
+	assert.Equal(t, "think hard", *assistantParts[0].Thinking)
+	assert.Equal(t, "sig_1", assistantParts[0].Signature)
+	assert.Equal(t, "calling", assistantParts[1].GetText())
+	assert.Equal(t, "tool_use", assistantParts[2].Type)
+
+	req.PreviousResponseID = "resp_1"
+	_, err = ConvertRequest(nil, &relaycommon.RelayInfo{}, types.RelayFormatClaude, req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "previous_response_id")
+}
+
 func TestConvertRequestViaResponsesToGeminiStillUsesDirectSteps(t *testing.T) {
 	info := &relaycommon.RelayInfo{
 		RelayFormat:            types.RelayFormatOpenAIResponses,
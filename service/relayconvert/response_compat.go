@@ -10,6 +10,7 @@ import (
 )
 
 type ClaudeResponseInfo = claudemessages.ClaudeResponseInfo
+type ClaudeToResponsesStreamState = claudemessages.ClaudeToResponsesStreamState
 
 type ChatToResponsesStreamEvent = oaichat.ChatToResponsesStreamEvent
 type ChatToResponsesStreamState = oaichat.ChatToResponsesStreamState
@@ -60,6 +61,22 @@ func FormatClaudeResponseInfo(claudeResponse *dto.ClaudeResponse, oaiResponse *d
 	return claudemessages.FormatClaudeResponseInfo(claudeResponse, oaiResponse, claudeInfo)
 }
 
+func ClaudeMessagesResponseToResponsesResponse(claudeResponse *dto.ClaudeResponse, id string) (*dto.OpenAIResponsesResponse, error) {
+	return claudemessages.ClaudeMessagesResponseToResponsesResponse(claudeResponse, id)
+}
+
+func NewClaudeToResponsesStreamState(id string, model string) *ClaudeToResponsesStreamState {
+	return claudemessages.NewClaudeToResponsesStreamState(id, model)
+}
+
+func ClaudeStreamEventToResponsesEvents(claudeResponse *dto.ClaudeResponse, state *ClaudeToResponsesStreamState) []dto.ResponsesStreamResponse {
+	return claudemessages.ClaudeStreamEventToResponsesEvents(claudeResponse, state)
+}
+
+func FinalizeClaudeStreamToResponses(state *ClaudeToResponsesStreamState) []dto.ResponsesStreamResponse {
+	return claudemessages.FinalizeClaudeStreamToResponses(state)
+}
+
 func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.GeminiChatResponse {
 	return oaichat.ResponseOpenAI2Gemini(openAIResponse, info)
 }
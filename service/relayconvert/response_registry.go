@@ -373,6 +373,10 @@ func (s *ResponseStreamState) Usage() *dto.Usage {
 			if typed.Usage != nil {
 				return typed.Usage
 			}
+		case *ClaudeToResponsesStreamState:
+			if typed.Usage != nil {
+				return typed.Usage
+			}
 		}
 	}
 	return nil
@@ -389,6 +393,8 @@ func (s *ResponseStreamState) SetUsage(usage *dto.Usage) {
 			typed.Usage = UsageFromChatUsage(usage)
 		case *ResponsesToChatStreamState:
 			typed.Usage = usage
+		case *ClaudeToResponsesStreamState:
+			typed.Usage = UsageFromChatUsage(usage)
 		}
 	}
 }
@@ -939,6 +945,56 @@ func convertClaudeMessagesStreamResponseToOAIChat(_ *gin.Context, _ *relaycommon
 	return openAIResponse, usage, nil
 }
 
+func convertClaudeMessagesResponseToOAIResponses(_ *gin.Context, _ *relaycommon.RelayInfo, response any) (any, *dto.Usage, error) {
+	claudeResponse, err := asClaudeResponse(response)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := strings.TrimSpace(claudeResponse.Id)
+	if id == "" {
+		id = fmt.Sprintf("resp_%s", common.GetUUID())
+	}
+	responsesResponse, err := ClaudeMessagesResponseToResponsesResponse(claudeResponse, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return responsesResponse, responsesResponse.Usage, nil
+}
+
+func newClaudeMessagesToOAIResponsesStreamState(options ResponseStreamOptions) any {
+	id := strings.TrimSpace(options.ID)
+	if id == "" {
+		id = fmt.Sprintf("resp_%s", common.GetUUID())
+	}
+	state := NewClaudeToResponsesStreamState(id, strings.TrimSpace(options.Model))
+	if options.Created != 0 {
+		state.Created = options.Created
+	}
+	return state
+}
+
+func convertClaudeMessagesStreamResponseToOAIResponses(_ *gin.Context, _ *relaycommon.RelayInfo, response any, state any) ([]any, *dto.Usage, error) {
+	claudeResponse, err := asClaudeResponse(response)
+	if err != nil {
+		return nil, nil, err
+	}
+	streamState, ok := state.(*ClaudeToResponsesStreamState)
+	if !ok || streamState == nil {
+		return nil, nil, errors.New("Claude messages to OAI responses stream state is required")
+	}
+	events := ClaudeStreamEventToResponsesEvents(claudeResponse, streamState)
+	return streamValuesFromAny(events), streamState.Usage, nil
+}
+
+func finalizeClaudeMessagesStreamResponseToOAIResponses(_ *gin.Context, _ *relaycommon.RelayInfo, state any) ([]any, *dto.Usage, error) {
+	streamState, ok := state.(*ClaudeToResponsesStreamState)
+	if !ok || streamState == nil {
+		return nil, nil, errors.New("Claude messages to OAI responses stream state is required")
+	}
+	events := FinalizeClaudeStreamToResponses(streamState)
+	return streamValuesFromAny(events), streamState.Usage, nil
+}
+
 func convertGeminiChatResponseToOAIChat(_ *gin.Context, info *relaycommon.RelayInfo, response any) (any, *dto.Usage, error) {
 	geminiResponse, err := asGeminiChatResponse(response)
 	if err != nil {
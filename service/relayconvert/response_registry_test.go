@@ -42,10 +42,6 @@ func TestLookupBuiltinResponseConverters(t *testing.T) {
 			from:     types.RelayFormatClaude,
 			to:       types.RelayFormatOpenAIResponses,
 			quality:  ResponseConverterQualityFair,
-			stepConverters: []string{
-				ConverterClaudeMessagesToOpenAIChat,
-				ConverterOpenAIChatToOpenAIResponses,
-			},
 		},
 		{
 			lookupID: responseConverterGeminiToClaude,
@@ -531,6 +527,103 @@ func TestConvertStreamResponseStatefulMultiHopResponsesToClaude(t *testing.T) {
 	assert.Equal(t, 5, state.Usage().TotalTokens)
 }
 
+func TestConvertResponseClaudeToResponsesKeepsReasoningSignature(t *testing.T) {
+	claude := &dto.ClaudeResponse{
+		Id:         "msg_1",
+		Type:       "message",
+		Role:       "assistant",
+		Model:      "claude-test",
+		StopReason: "tool_use",
+		Content: []dto.ClaudeMediaMessage{
+			{Type: "thinking", Thinking: respPtr("pondering"), Signature: "sig_1"},
+			{Type: "text", Text: respPtr("let me check")},
+			{Type: "tool_use", Id: "toolu_1", Name: "lookup", Input: map[string]interface{}{"q": "x"}},
+		},
+		Usage: &dto.ClaudeUsage{InputTokens: 4, CacheReadInputTokens: 6, OutputTokens: 5},
+	}
+
+	result, err := ConvertResponse(nil, nil, types.RelayFormatOpenAIResponses, claude)
+	require.NoError(t, err)
+	assert.Equal(t, requestConverterClaudeToResponses, result.Converter)
+	require.IsType(t, &dto.OpenAIResponsesResponse{}, result.Value)
+	responses := result.Value.(*dto.OpenAIResponsesResponse)
+	assert.JSONEq(t, `"completed"`, string(responses.Status))
+	require.Len(t, responses.Output, 3)
+	assert.Equal(t, "reasoning", responses.Output[0].Type)
+	assert.Equal(t, "pondering", responses.Output[0].Summary[0].Text)
+	assert.Equal(t, "sig_1", responses.Output[0].EncryptedContent)
+	assert.Equal(t, "message", responses.Output[1].Type)
+	assert.Equal(t, "let me check", responses.Output[1].Content[0].Text)
+	assert.Equal(t, "function_call", responses.Output[2].Type)
+	assert.Equal(t, "toolu_1", responses.Output[2].CallId)
+	assert.JSONEq(t, `{"q":"x"}`, responses.Output[2].ArgumentsString())
+	assert.Equal(t, 10, result.Usage.InputTokens)
+	assert.Equal(t, 5, result.Usage.OutputTokens)
+	assert.Equal(t, 15, result.Usage.TotalTokens)
+}
+
+func TestConvertStreamResponseClaudeToResponses(t *testing.T) {
+	state, err := NewResponseStreamState(types.RelayFormatClaude, types.RelayFormatOpenAIResponses, ResponseStreamOptions{
+		ID:    "resp_1",
+		Model: "claude-test",
+	})
+	require.NoError(t, err)
+
+	chunks := []*dto.ClaudeResponse{
+		{Type: "message_start", Message: &dto.ClaudeMediaMessage{Model: "claude-test", Usage: &dto.ClaudeUsage{InputTokens: 3}}},
+		{Type: "content_block_start", Index: respPtr(0), ContentBlock: &dto.ClaudeMediaMessage{Type: "thinking", Thinking: respPtr("")}},
+		{Type: "content_block_delta", Index: respPtr(0), Delta: &dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: respPtr("hmm")}},
+		{Type: "content_block_delta", Index: respPtr(0), Delta: &dto.ClaudeMediaMessage{Type: "signature_delta", Signature: "sig_1"}},
+		{Type: "content_block_stop", Index: respPtr(0)},
+		{Type: "content_block_start", Index: respPtr(1), ContentBlock: &dto.ClaudeMediaMessage{Type: "tool_use", Id: "toolu_1", Name: "lookup"}},
+		{Type: "content_block_delta", Index: respPtr(1), Delta: &dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: respPtr(`{"q":`)}},
+		{Type: "content_block_delta", Index: respPtr(1), Delta: &dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: respPtr(`"x"}`)}},
+		{Type: "content_block_stop", Index: respPtr(1)},
+		{Type: "message_delta", Delta: &dto.ClaudeMediaMessage{StopReason: respPtr("tool_use")}, Usage: &dto.ClaudeUsage{OutputTokens: 7}},
+		{Type: "message_stop"},
+	}
+	eventTypes := make([]string, 0)
+	for _, chunk := range chunks {
+		results, err := ConvertStreamResponseChunk(nil, nil, state, chunk)
+		require.NoError(t, err)
+		for _, result := range results {
+			event, ok := result.Value.(dto.ResponsesStreamResponse)
+			require.True(t, ok)
+			eventTypes = append(eventTypes, event.Type)
+		}
+	}
+	assert.Equal(t, []string{
+		"response.created",
+		"response.output_item.added",
+		"response.reasoning_summary_part.added",
+		"response.reasoning_summary_text.delta",
+		"response.reasoning_summary_text.done",
+		"response.reasoning_summary_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+	}, eventTypes)
+	assert.Equal(t, 10, state.Usage().TotalTokens)
+
+	finalResults, err := FinalizeStreamResponse(nil, nil, state)
+	require.NoError(t, err)
+	require.Len(t, finalResults, 1)
+	completed, ok := finalResults[0].Value.(dto.ResponsesStreamResponse)
+	require.True(t, ok)
+	assert.Equal(t, "response.completed", completed.Type)
+	output := completed.Response.Output
+	require.Len(t, output, 2)
+	assert.Equal(t, "sig_1", output[0].EncryptedContent)
+	assert.Equal(t, "hmm", output[0].Summary[0].Text)
+	assert.Equal(t, "toolu_1", output[1].CallId)
+	assert.JSONEq(t, `{"q":"x"}`, output[1].ArgumentsString())
+	assert.Equal(t, 3, completed.Response.Usage.InputTokens)
+	assert.Equal(t, 7, completed.Response.Usage.OutputTokens)
+}
+
 func TestResponseUsageMatrixChatAndResponsesDetails(t *testing.T) {
 	chat := textRegistryChatResponse()
 	chat.Usage = dto.Usage{
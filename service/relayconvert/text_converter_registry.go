@@ -166,11 +166,11 @@ var builtinTextConverters = []TextConverterSpec{
 			},
 		},
 		Resp: TextResponseSide{
-			StepConverters: []string{
-				ConverterClaudeMessagesToOpenAIChat,
-				ConverterOpenAIChatToOpenAIResponses,
-			},
-			Aliases: []string{responseConverterClaudeToResponses},
+			Convert:            convertClaudeMessagesResponseToOAIResponses,
+			NewStreamState:     newClaudeMessagesToOAIResponsesStreamState,
+			ConvertStreamChunk: convertClaudeMessagesStreamResponseToOAIResponses,
+			FinalizeStream:     finalizeClaudeMessagesStreamResponseToOAIResponses,
+			Aliases:            []string{responseConverterClaudeToResponses},
 		},
 	},
 	{
@@ -51,11 +51,9 @@ func TestLookupBuiltinTextConverters(t *testing.T) {
 				ConverterClaudeMessagesToOpenAIChat,
 				ConverterOpenAIChatToOpenAIResponses,
 			},
-			respSteps: []string{
-				ConverterClaudeMessagesToOpenAIChat,
-				ConverterOpenAIChatToOpenAIResponses,
-			},
-			respAlias: responseConverterClaudeToResponses,
+			respDirect:   true,
+			respAlias:    responseConverterClaudeToResponses,
+			streamDirect: true,
 		},
 		{
 			id:      requestConverterGeminiToClaude,
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const responseCacheNamespace = "new-api:response_cache:v1"
+
+// ResponseCacheHeader tells clients whether a response was replayed from the
+// response cache.
+const ResponseCacheHeader = "X-New-Api-Response-Cache"
+
+var (
+	responseCacheOnce sync.Once
+	responseCache     *cachex.HybridCache[ResponseCacheEntry]
+)
+
+// ResponseCacheEntry is a stored upstream response together with the usage
+// it was billed with, so a replay can be billed the same way.
+type ResponseCacheEntry struct {
+	ContentType string    `json:"content_type"`
+	IsStream    bool      `json:"is_stream"`
+	Body        []byte    `json:"body"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+// responseCaptureWriter copies the response body into a bounded buffer while
+// it is written to the client. Once the limit is exceeded the response is not
+// cached.
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	maxSize  int
+	overflow bool
+}
+
+func (w *responseCaptureWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.maxSize {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+type responseCacheCapture struct {
+	key    string
+	writer *responseCaptureWriter
+}
+
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	responseCacheOnce.Do(func() {
+		capacity := operation_setting.GetResponseCacheSetting().MaxEntries
+		if capacity <= 0 {
+			capacity = 10000
+		}
+		responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+			Namespace: cachex.Namespace(responseCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+				return hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, capacity).
+					WithTTL(time.Duration(operation_setting.GetResponseCacheTTLSeconds()) * time.Second).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responseCache
+}
+
+// ResponseCacheKey returns the cache key of the current request, or "" when
+// the request may not use the response cache.
+func ResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo) string {
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.Enabled || !common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache) {
+		return ""
+	}
+	if info.RelayFormat != types.RelayFormatOpenAI ||
+		(info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions) {
+		return ""
+	}
+	if !operation_setting.IsResponseCacheModelEnabled(info.OriginModelName) {
+		return ""
+	}
+	if setting.DeterministicOnly {
+		request, ok := info.Request.(*dto.GeneralOpenAIRequest)
+		if !ok || request.Temperature == nil || *request.Temperature != 0 {
+			return ""
+		}
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return ""
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return ""
+	}
+	normalized, err := normalizeResponseCacheBody(body)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", info.RequestURLPath, info.OriginModelName, info.UsingGroup)
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeResponseCacheBody re-encodes a JSON request body with sorted keys
+// and drops fields that do not influence the response, so semantically equal
+// requests share a cache key.
+func normalizeResponseCacheBody(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]any
+	if err := decoder.Decode(&request); err != nil {
+		return nil, err
+	}
+	delete(request, "user")
+	return common.Marshal(request)
+}
+
+// GetCachedResponse looks up a cached response by key.
+func GetCachedResponse(key string) (*ResponseCacheEntry, bool) {
+	entry, found, err := getResponseCache().Get(key)
+	if err != nil {
+		common.SysError("failed to read response cache: " + err.Error())
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// ReplayCachedResponse writes a cached response to the client and bills it
+// like the original request, scaled by the cache hit billing ratio.
+func ReplayCachedResponse(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) {
+	info.InitChannelMeta(c)
+	info.IsStream = entry.IsStream
+	info.ResponseCacheHit = true
+	info.SetFirstResponseTime()
+	common.SetContextKey(c, constant.ContextKeyResponseCacheHit, true)
+	info.PriceData.AddOtherRatio("response_cache", operation_setting.GetResponseCacheBillingRatio())
+
+	c.Header(ResponseCacheHeader, "hit")
+	c.Data(http.StatusOK, entry.ContentType, entry.Body)
+
+	usage := entry.Usage
+	PostTextConsumeQuota(c, info, &usage, []string{"响应缓存命中"})
+}
+
+// CaptureResponseForCache starts copying the response of the current request
+// so it can be stored under key once the request is billed successfully.
+func CaptureResponseForCache(c *gin.Context, key string) {
+	writer := &responseCaptureWriter{
+		ResponseWriter: c.Writer,
+		maxSize:        max(operation_setting.GetResponseCacheSetting().MaxBodyBytes, 1),
+	}
+	c.Writer = writer
+	c.Header(ResponseCacheHeader, "miss")
+	common.SetContextKey(c, constant.ContextKeyResponseCacheCapture, &responseCacheCapture{key: key, writer: writer})
+}
+
+// storeResponseCache saves the captured response of a successful request.
+// Responses with errors, interrupted streams or no usage are not cached.
+func storeResponseCache(c *gin.Context, info *relaycommon.RelayInfo, usage *dto.Usage) {
+	value, ok := common.GetContextKey(c, constant.ContextKeyResponseCacheCapture)
+	if !ok {
+		return
+	}
+	capture, ok := value.(*responseCacheCapture)
+	if !ok || capture == nil {
+		return
+	}
+	// a request is stored at most once, even if billing runs again
+	common.SetContextKey(c, constant.ContextKeyResponseCacheCapture, nil)
+
+	writer := capture.writer
+	if usage == nil || usage.TotalTokens == 0 || writer.overflow || writer.body.Len() == 0 || writer.Status() != http.StatusOK {
+		return
+	}
+	if info.IsStream && info.StreamStatus != nil && (!info.StreamStatus.IsNormalEnd() || info.StreamStatus.HasErrors()) {
+		return
+	}
+	entry := ResponseCacheEntry{
+		ContentType: writer.Header().Get("Content-Type"),
+		IsStream:    info.IsStream,
+		Body:        bytes.Clone(writer.body.Bytes()),
+		Usage:       *usage,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	ttl := time.Duration(operation_setting.GetResponseCacheTTLSeconds()) * time.Second
+	if err := getResponseCache().SetWithTTL(capture.key, entry, ttl); err != nil {
+		logger.LogWarn(c, "failed to store response cache: "+err.Error())
+	}
+}
+
+// PurgeResponseCache drops every cached response.
+func PurgeResponseCache() error {
+	return getResponseCache().Purge()
+}
+
+func appendResponseCacheInfo(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	if common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+		other["response_cache_hit"] = true
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withResponseCacheSetting(t *testing.T, setting operation_setting.ResponseCacheSetting) {
+	t.Helper()
+	current := operation_setting.GetResponseCacheSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func newResponseCacheContext(t *testing.T, body string) *gin.Context {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(ctx, constant.ContextKeyTokenResponseCache, true)
+	return ctx
+}
+
+func newResponseCacheRelayInfo(temperature *float64) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAI,
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		RequestURLPath:  "/v1/chat/completions",
+		OriginModelName: "gpt-4o-mini",
+		UsingGroup:      "default",
+		Request:         &dto.GeneralOpenAIRequest{Model: "gpt-4o-mini", Temperature: temperature},
+	}
+}
+
+func TestNormalizeResponseCacheBodyIgnoresKeyOrderAndUser(t *testing.T) {
+	a, err := normalizeResponseCacheBody([]byte(`{"model":"m","seed":12345678901234567,"messages":[{"role":"user","content":"hi"}],"user":"alice"}`))
+	require.NoError(t, err)
+	b, err := normalizeResponseCacheBody([]byte(`{"messages":[{"content":"hi","role":"user"}],"user":"bob","seed":12345678901234567,"model":"m"}`))
+	require.NoError(t, err)
+
+	require.Equal(t, string(a), string(b))
+	require.Contains(t, string(a), "12345678901234567")
+}
+
+func TestResponseCacheKeyRequiresOptIn(t *testing.T) {
+	zero := 0.0
+	body := `{"model":"gpt-4o-mini","temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true, DeterministicOnly: true})
+
+	require.NotEmpty(t, ResponseCacheKey(newResponseCacheContext(t, body), newResponseCacheRelayInfo(&zero)))
+
+	ctx := newResponseCacheContext(t, body)
+	common.SetContextKey(ctx, constant.ContextKeyTokenResponseCache, false)
+	require.Empty(t, ResponseCacheKey(ctx, newResponseCacheRelayInfo(&zero)), "token has not opted in")
+
+	warm := 0.7
+	require.Empty(t, ResponseCacheKey(newResponseCacheContext(t, body), newResponseCacheRelayInfo(&warm)), "non-deterministic request")
+	require.Empty(t, ResponseCacheKey(newResponseCacheContext(t, body), newResponseCacheRelayInfo(nil)), "temperature not set")
+
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true, Models: []string{"gpt-4o"}})
+	require.Empty(t, ResponseCacheKey(newResponseCacheContext(t, body), newResponseCacheRelayInfo(&zero)), "model not enabled")
+}
+
+func TestResponseCacheKeyDependsOnGroup(t *testing.T) {
+	body := `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true})
+
+	defaultKey := ResponseCacheKey(newResponseCacheContext(t, body), newResponseCacheRelayInfo(nil))
+	info := newResponseCacheRelayInfo(nil)
+	info.UsingGroup = "vip"
+	vipKey := ResponseCacheKey(newResponseCacheContext(t, body), info)
+
+	require.NotEmpty(t, defaultKey)
+	require.NotEqual(t, defaultKey, vipKey)
+}
+
+func TestStoreResponseCacheSavesCapturedResponse(t *testing.T) {
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true, MaxBodyBytes: 1024, TTLSeconds: 60})
+	ctx := newResponseCacheContext(t, `{}`)
+	key := "test-store-" + common.GetRandomString(8)
+
+	CaptureResponseForCache(ctx, key)
+	ctx.Data(http.StatusOK, "application/json", []byte(`{"id":"chatcmpl-1"}`))
+	storeResponseCache(ctx, &relaycommon.RelayInfo{}, &dto.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+
+	entry, hit := GetCachedResponse(key)
+	require.True(t, hit)
+	require.Equal(t, `{"id":"chatcmpl-1"}`, string(entry.Body))
+	require.Equal(t, "application/json", entry.ContentType)
+	require.Equal(t, 5, entry.Usage.TotalTokens)
+}
+
+func TestStoreResponseCacheSkipsOversizedAndErrorResponses(t *testing.T) {
+	withResponseCacheSetting(t, operation_setting.ResponseCacheSetting{Enabled: true, MaxBodyBytes: 8, TTLSeconds: 60})
+	usage := &dto.Usage{TotalTokens: 5}
+
+	ctx := newResponseCacheContext(t, `{}`)
+	oversizedKey := "test-oversized-" + common.GetRandomString(8)
+	CaptureResponseForCache(ctx, oversizedKey)
+	ctx.Data(http.StatusOK, "application/json", []byte(`{"id":"chatcmpl-1"}`))
+	storeResponseCache(ctx, &relaycommon.RelayInfo{}, usage)
+	_, hit := GetCachedResponse(oversizedKey)
+	require.False(t, hit)
+
+	ctx = newResponseCacheContext(t, `{}`)
+	errorKey := "test-error-" + common.GetRandomString(8)
+	CaptureResponseForCache(ctx, errorKey)
+	ctx.Data(http.StatusBadGateway, "application/json", []byte(`{}`))
+	storeResponseCache(ctx, &relaycommon.RelayInfo{}, usage)
+	_, hit = GetCachedResponse(errorKey)
+	require.False(t, hit)
+}
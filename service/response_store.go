@@ -0,0 +1,287 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ResolvePreviousResponse replaces the previous_response_id of request with
+// the conversation the gateway stored for it, prepended to the new input, so
+// the request no longer depends on upstream state. Ids the store does not know
+// for the caller are left for the upstream to resolve.
+func ResolvePreviousResponse(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) error {
+	if !operation_setting.GetResponseStoreSetting().Enabled || request.PreviousResponseID == "" {
+		return nil
+	}
+	stored, err := model.GetStoredResponse(info.UserId, info.TokenId, request.PreviousResponseID)
+	if errors.Is(err, model.ErrStoredResponseNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load previous response %s: %w", request.PreviousResponseID, err)
+	}
+	var history []json.RawMessage
+	if err := common.UnmarshalJsonStr(stored.Items, &history); err != nil {
+		return fmt.Errorf("invalid stored conversation of response %s: %w", request.PreviousResponseID, err)
+	}
+	input, err := responsesInputItems(request.Input)
+	if err != nil {
+		return err
+	}
+	merged, err := common.Marshal(append(history, input...))
+	if err != nil {
+		return err
+	}
+	request.Input = merged
+	request.PreviousResponseID = ""
+	return nil
+}
+
+// responsesInputItems returns the Responses input as a list of items, turning
+// the plain string form into a user message.
+func responsesInputItems(input json.RawMessage) ([]json.RawMessage, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, fmt.Errorf("invalid input string: %w", err)
+		}
+		item, err := common.Marshal(map[string]any{"role": "user", "content": text})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input array: %w", err)
+		}
+		return items, nil
+	case "null", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported responses input type %q", common.GetJsonType(input))
+	}
+}
+
+// responseStoreWriter watches the Responses API result written to the client
+// for the final response object: the whole body of a non-streaming response,
+// or the response carried by the terminal event of a stream.
+type responseStoreWriter struct {
+	gin.ResponseWriter
+	maxSize  int
+	decided  bool
+	stream   bool
+	pending  bytes.Buffer
+	final    []byte
+	overflow bool
+}
+
+func (w *responseStoreWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseStoreWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseStoreWriter) capture(b []byte) {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.Contains(strings.ToLower(w.Header().Get("Content-Type")), "event-stream")
+	}
+	if w.overflow {
+		return
+	}
+	w.pending.Write(b)
+	if !w.stream {
+		if w.pending.Len() > w.maxSize {
+			w.overflow = true
+			w.pending.Reset()
+		}
+		return
+	}
+	for {
+		line, err := w.pending.ReadBytes('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.pending.Reset()
+			w.pending.Write(line)
+			break
+		}
+		w.captureEvent(line)
+	}
+	if w.pending.Len() > w.maxSize {
+		w.overflow = true
+		w.pending.Reset()
+	}
+}
+
+func (w *responseStoreWriter) captureEvent(line []byte) {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	event := gjson.ParseBytes(bytes.TrimSpace(payload))
+	switch event.Get("type").String() {
+	case "response.completed", "response.done", "response.incomplete":
+		w.final = []byte(event.Get("response").Raw)
+	}
+}
+
+func (w *responseStoreWriter) finalResponse() []byte {
+	if w.overflow {
+		return nil
+	}
+	if w.stream {
+		return w.final
+	}
+	return w.pending.Bytes()
+}
+
+// StartResponseStore records the Responses API result of request when the
+// response store is enabled. The returned function restores the writer of c
+// and, if the relay succeeded, stores the conversation so far under the id of
+// the response.
+func StartResponseStore(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) func(succeeded bool) {
+	setting := operation_setting.GetResponseStoreSetting()
+	// The conversation before an unresolved previous_response_id lives
+	// upstream, so what this request sees is not the whole history.
+	if !setting.Enabled || request.PreviousResponseID != "" || string(request.Store) == "false" {
+		return func(bool) {}
+	}
+	writer := &responseStoreWriter{
+		ResponseWriter: c.Writer,
+		maxSize:        max(setting.MaxHistoryBytes, 1),
+	}
+	c.Writer = writer
+	return func(succeeded bool) {
+		c.Writer = writer.ResponseWriter
+		if !succeeded {
+			return
+		}
+		if err := storeResponse(info, request, writer.finalResponse(), setting); err != nil {
+			logger.LogWarn(c, "failed to store response for previous_response_id: "+err.Error())
+		}
+	}
+}
+
+func storeResponse(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, final []byte, setting *operation_setting.ResponseStoreSetting) error {
+	response := gjson.ParseBytes(final)
+	responseId := response.Get("id").String()
+	if responseId == "" {
+		return nil
+	}
+	items, err := responsesInputItems(request.Input)
+	if err != nil {
+		return err
+	}
+	for _, output := range response.Get("output").Array() {
+		item := portableResponseItem(output)
+		if item == nil {
+			continue
+		}
+		raw, err := common.Marshal(item)
+		if err != nil {
+			return err
+		}
+		items = append(items, raw)
+	}
+	data, err := common.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if len(data) > setting.MaxHistoryBytes {
+		return fmt.Errorf("conversation of response %s is %d bytes, over the %d bytes limit", responseId, len(data), setting.MaxHistoryBytes)
+	}
+	now := common.GetTimestamp()
+	return model.SaveStoredResponse(&model.StoredResponse{
+		UserId:     info.UserId,
+		TokenId:    info.TokenId,
+		ResponseId: responseId,
+		ModelName:  info.OriginModelName,
+		Items:      string(data),
+		CreatedAt:  now,
+		ExpiresAt:  now + int64(setting.TTLHours)*3600,
+	})
+}
+
+// portableResponseItem returns the fields of an output item that any channel
+// accepts as input, or nil for items only the upstream that produced them can
+// read back. Provider item ids are dropped, as are reasoning items, whose
+// encrypted content is bound to the upstream account.
+func portableResponseItem(output gjson.Result) map[string]any {
+	switch output.Get("type").String() {
+	case "message":
+		var content []map[string]any
+		for _, part := range output.Get("content").Array() {
+			switch part.Get("type").String() {
+			case "output_text", "input_text", "text":
+				content = append(content, map[string]any{"type": part.Get("type").String(), "text": part.Get("text").String()})
+			case "refusal":
+				content = append(content, map[string]any{"type": "output_text", "text": part.Get("refusal").String()})
+			}
+		}
+		if len(content) == 0 {
+			return nil
+		}
+		return map[string]any{"type": "message", "role": output.Get("role").String(), "content": content}
+	case "function_call":
+		return map[string]any{
+			"type":      "function_call",
+			"call_id":   output.Get("call_id").String(),
+			"name":      output.Get("name").String(),
+			"arguments": output.Get("arguments").String(),
+		}
+	case "function_call_output":
+		return map[string]any{
+			"type":    "function_call_output",
+			"call_id": output.Get("call_id").String(),
+			"output":  output.Get("output").Value(),
+		}
+	default:
+		return nil
+	}
+}
+
+// storedResponseCleanupHandler deletes stored responses past their TTL.
+type storedResponseCleanupHandler struct{}
+
+func (storedResponseCleanupHandler) Type() string {
+	return model.SystemTaskTypeStoredResponseCleanup
+}
+
+func (storedResponseCleanupHandler) Enabled() bool {
+	return operation_setting.GetResponseStoreSetting().Enabled
+}
+
+func (storedResponseCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (storedResponseCleanupHandler) NewPayload() any { return nil }
+
+func (storedResponseCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	deleted, err := model.DeleteExpiredStoredResponses(ctx, common.GetTimestamp())
+	if err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+	if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, LogCleanupResult{DeletedCount: deleted}, ""); err != nil {
+		logSystemTaskLockError(ctx, task, err)
+	}
+}
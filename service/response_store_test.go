@@ -0,0 +1,150 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service/relayconvert"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withResponseStoreSetting(t *testing.T, setting operation_setting.ResponseStoreSetting) {
+	t.Helper()
+	current := operation_setting.GetResponseStoreSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func newResponseStoreTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	return ctx, recorder
+}
+
+func TestResponseStoreReplaysConversationAcrossRequests(t *testing.T) {
+	truncate(t)
+	withResponseStoreSetting(t, operation_setting.ResponseStoreSetting{Enabled: true, TTLHours: 1, MaxHistoryBytes: 1 << 20})
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 10}
+
+	first := &dto.OpenAIResponsesRequest{Model: "gpt-test", Input: []byte(`"hi"`)}
+	ctx, recorder := newResponseStoreTestContext()
+	finish := StartResponseStore(ctx, info, first)
+	ctx.Header("Content-Type", "text/event-stream")
+	// The terminal event arrives split across writes.
+	_, err := ctx.Writer.WriteString("event: response.created\ndata: {\"type\":\"response.created\"}\n\nevent: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",")
+	require.NoError(t, err)
+	_, err = ctx.Writer.WriteString("\"output\":[{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"hello\"}]}]}}\n\n")
+	require.NoError(t, err)
+	finish(true)
+	_, isStoreWriter := ctx.Writer.(*responseStoreWriter)
+	assert.False(t, isStoreWriter, "the original writer is restored")
+	assert.Contains(t, recorder.Body.String(), "response.completed")
+
+	follow := &dto.OpenAIResponsesRequest{
+		Model:              "claude-test",
+		PreviousResponseID: "resp_1",
+		Input:              []byte(`[{"role":"user","content":"again"}]`),
+	}
+	require.NoError(t, ResolvePreviousResponse(info, follow))
+	assert.Empty(t, follow.PreviousResponseID)
+	assert.JSONEq(t, `[
+		{"role":"user","content":"hi"},
+		{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hello"}]},
+		{"role":"user","content":"again"}
+	]`, string(follow.Input))
+
+	otherToken := &dto.OpenAIResponsesRequest{PreviousResponseID: "resp_1", Input: []byte(`"again"`)}
+	require.NoError(t, ResolvePreviousResponse(&relaycommon.RelayInfo{UserId: 1, TokenId: 11}, otherToken))
+	assert.Equal(t, "resp_1", otherToken.PreviousResponseID, "unknown ids are left for the upstream")
+}
+
+func TestResponseStoreSkipsFailedAndUnstoredResponses(t *testing.T) {
+	truncate(t)
+	withResponseStoreSetting(t, operation_setting.ResponseStoreSetting{Enabled: true, TTLHours: 1, MaxHistoryBytes: 1 << 20})
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 10}
+	body := `{"id":"resp_1","output":[]}`
+
+	ctx, _ := newResponseStoreTestContext()
+	finish := StartResponseStore(ctx, info, &dto.OpenAIResponsesRequest{Input: []byte(`"hi"`)})
+	ctx.Header("Content-Type", "application/json")
+	_, err := ctx.Writer.WriteString(body)
+	require.NoError(t, err)
+	finish(false)
+
+	ctx, _ = newResponseStoreTestContext()
+	finish = StartResponseStore(ctx, info, &dto.OpenAIResponsesRequest{Input: []byte(`"hi"`), Store: []byte(`false`)})
+	_, isStoreWriter := ctx.Writer.(*responseStoreWriter)
+	assert.False(t, isStoreWriter)
+	finish(true)
+
+	_, err = model.GetStoredResponse(1, 10, "resp_1")
+	assert.ErrorIs(t, err, model.ErrStoredResponseNotFound)
+
+	ctx, _ = newResponseStoreTestContext()
+	finish = StartResponseStore(ctx, info, &dto.OpenAIResponsesRequest{Input: []byte(`"hi"`)})
+	ctx.Header("Content-Type", "application/json")
+	_, err = ctx.Writer.WriteString(body)
+	require.NoError(t, err)
+	finish(true)
+	stored, err := model.GetStoredResponse(1, 10, "resp_1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"role":"user","content":"hi"}]`, stored.Items)
+}
+
+func TestResponseStoreReplaysPortableItemsOnly(t *testing.T) {
+	truncate(t)
+	withResponseStoreSetting(t, operation_setting.ResponseStoreSetting{Enabled: true, TTLHours: 1, MaxHistoryBytes: 1 << 20})
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 10}
+
+	ctx, _ := newResponseStoreTestContext()
+	finish := StartResponseStore(ctx, info, &dto.OpenAIResponsesRequest{Model: "gpt-test", Input: []byte(`"weather?"`)})
+	ctx.Header("Content-Type", "application/json")
+	_, err := ctx.Writer.WriteString(`{"id":"resp_1","output":[
+		{"id":"rs_1","type":"reasoning","summary":[{"type":"summary_text","text":"look it up"}],"encrypted_content":"gAAAA-openai-only"},
+		{"id":"msg_1","type":"message","status":"completed","role":"assistant","content":[{"type":"output_text","text":"Checking.","annotations":[],"logprobs":[]}]},
+		{"id":"fc_1","type":"function_call","status":"completed","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"}
+	]}`)
+	require.NoError(t, err)
+	finish(true)
+
+	follow := &dto.OpenAIResponsesRequest{
+		Model:              "claude-test",
+		PreviousResponseID: "resp_1",
+		Input:              []byte(`[{"type":"function_call_output","call_id":"call_1","output":"sunny"}]`),
+	}
+	require.NoError(t, ResolvePreviousResponse(info, follow))
+	assert.JSONEq(t, `[
+		{"role":"user","content":"weather?"},
+		{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Checking."}]},
+		{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+		{"type":"function_call_output","call_id":"call_1","output":"sunny"}
+	]`, string(follow.Input))
+
+	// the replayed conversation is accepted by channels of another type
+	claudeCtx, _ := newResponseStoreTestContext()
+	claudeRequest, err := relayconvert.OpenAIResponsesRequestToClaudeMessages(claudeCtx, follow)
+	require.NoError(t, err)
+	require.Len(t, claudeRequest.Messages, 3)
+	assert.Equal(t, "assistant", claudeRequest.Messages[1].Role)
+	claudeBody, err := common.Marshal(claudeRequest)
+	require.NoError(t, err)
+	assert.NotContains(t, string(claudeBody), "gAAAA-openai-only")
+	assert.Contains(t, string(claudeBody), `"tool_use_id":"call_1"`)
+
+	chatRequest, err := ResponsesRequestToChatCompletionsRequest(follow)
+	require.NoError(t, err)
+	require.Len(t, chatRequest.Messages, 3)
+	assert.Equal(t, "call_1", chatRequest.Messages[2].ToolCallId)
+}
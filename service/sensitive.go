@@ -2,10 +2,16 @@ package service
 
 import (
 	"errors"
+	"slices"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
 )
 
 func CheckSensitiveMessages(messages []dto.Message) ([]string, error) {
@@ -75,3 +81,132 @@ func SensitiveWordReplace(text string, returnImmediately bool) (bool, []string,
 	}
 	return false, nil, text
 }
+
+// CompletionSensitiveFilter checks generated text as it is streamed. It holds
+// back the end of each text that could be the start of a word completed by
+// the next chunk, so a word split across chunks is masked as a whole before
+// any part of it is sent.
+type CompletionSensitiveFilter struct {
+	dict    []string
+	maxTail int
+	held    map[string]*heldCompletionText
+	words   []string
+}
+
+// heldCompletionText is generated text checked but not sent yet, with the
+// runes that belong to a sensitive word.
+type heldCompletionText struct {
+	runes  []rune
+	masked []bool
+}
+
+// NewCompletionSensitiveFilter returns nil when completions are not checked.
+func NewCompletionSensitiveFilter() *CompletionSensitiveFilter {
+	if !setting.ShouldCheckCompletionSensitive() || len(setting.SensitiveWords) == 0 {
+		return nil
+	}
+	dict := setting.SensitiveWords
+	longest := 0
+	for _, word := range dict {
+		longest = max(longest, utf8.RuneCountInString(strings.TrimSpace(word)))
+	}
+	return &CompletionSensitiveFilter{
+		dict:    dict,
+		maxTail: max(longest-1, 0),
+		held:    make(map[string]*heldCompletionText),
+	}
+}
+
+// Check scans chunk, the next piece of the generated text identified by key,
+// after the text held back for key. It returns the sensitive words completed
+// by chunk and the text that may be sent, with every word masked. Unless final
+// is set, the last runes that could start a word are held back until the next
+// chunk of key or Release.
+func (f *CompletionSensitiveFilter) Check(key string, chunk string, final bool) ([]string, string) {
+	held := f.held[key]
+	if held == nil {
+		held = &heldCompletionText{}
+	}
+	offset := len(held.runes)
+	text := append(held.runes, []rune(chunk)...)
+	masked := append(held.masked, make([]bool, len(text)-offset)...)
+
+	var words []string
+	if m := getOrBuildAC(f.dict); m != nil && len(text) > offset {
+		for _, hit := range m.MultiPatternSearch([]rune(strings.ToLower(string(text))), false) {
+			end := min(hit.Pos+len(hit.Word), len(text))
+			if end <= offset {
+				// reported with an earlier chunk
+				continue
+			}
+			words = append(words, string(hit.Word))
+			for i := hit.Pos; i < end; i++ {
+				masked[i] = true
+			}
+		}
+	}
+	f.words = append(f.words, words...)
+
+	cut := len(text)
+	if !final {
+		cut = max(len(text)-f.maxTail, 0)
+		// a masked word is sent as a whole so it is masked only once
+		for cut > 0 && cut < len(text) && masked[cut-1] && masked[cut] {
+			cut++
+		}
+	}
+	if cut < len(text) {
+		f.held[key] = &heldCompletionText{runes: slices.Clone(text[cut:]), masked: slices.Clone(masked[cut:])}
+	} else {
+		delete(f.held, key)
+	}
+	return words, maskCompletionText(text[:cut], masked[:cut])
+}
+
+// Release returns the text still held back for key, masked, once the text of
+// key ended.
+func (f *CompletionSensitiveFilter) Release(key string) string {
+	held := f.held[key]
+	if held == nil {
+		return ""
+	}
+	delete(f.held, key)
+	return maskCompletionText(held.runes, held.masked)
+}
+
+// maskCompletionText replaces every run of masked runes by one mask.
+func maskCompletionText(runes []rune, masked []bool) string {
+	var builder strings.Builder
+	builder.Grow(len(runes))
+	for i, r := range runes {
+		if !masked[i] {
+			builder.WriteRune(r)
+		} else if i == 0 || !masked[i-1] {
+			builder.WriteString("**###**")
+		}
+	}
+	return builder.String()
+}
+
+// Words returns the sensitive words found so far.
+func (f *CompletionSensitiveFilter) Words() []string {
+	return f.words
+}
+
+func appendCompletionSensitiveInfo(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	words := common.GetContextKeyStringSlice(ctx, constant.ContextKeyCompletionSensitiveWords)
+	if len(words) == 0 {
+		return
+	}
+	action := "mask"
+	if common.GetContextKeyBool(ctx, constant.ContextKeyCompletionSensitiveStopped) {
+		action = "stop"
+	}
+	other["completion_sensitive"] = map[string]interface{}{
+		"words":  words,
+		"action": action,
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withCompletionSensitiveWords(t *testing.T, words ...string) {
+	t.Helper()
+	savedEnabled, savedCompletion, savedWords := setting.CheckSensitiveEnabled, setting.CheckSensitiveOnCompletionEnabled, setting.SensitiveWords
+	setting.CheckSensitiveEnabled = true
+	setting.CheckSensitiveOnCompletionEnabled = true
+	setting.SensitiveWords = words
+	t.Cleanup(func() {
+		setting.CheckSensitiveEnabled = savedEnabled
+		setting.CheckSensitiveOnCompletionEnabled = savedCompletion
+		setting.SensitiveWords = savedWords
+	})
+}
+
+func TestCompletionSensitiveFilter(t *testing.T) {
+	withCompletionSensitiveWords(t, "secret", "敏感词")
+	filter := NewCompletionSensitiveFilter()
+	require.NotNil(t, filter)
+
+	words, masked := filter.Check("0", "nothing here", false)
+	assert.Empty(t, words)
+	assert.Equal(t, "nothing", masked, "the runes that could start a word are held back")
+
+	words, masked = filter.Check("0", " and the SECRET is out", false)
+	assert.Equal(t, []string{"secret"}, words)
+	assert.Equal(t, " here and the **###** i", masked)
+	assert.Equal(t, "s out", filter.Release("0"))
+
+	// a word split over chunks is masked as a whole
+	_, masked = filter.Check("1", "这是敏", false)
+	assert.Empty(t, masked)
+	words, masked = filter.Check("1", "感词。", true)
+	assert.Equal(t, []string{"敏感词"}, words)
+	assert.Equal(t, "这是**###**。", masked)
+	assert.Empty(t, filter.Release("1"))
+
+	// a word already reported is not reported again
+	_, masked = filter.Check("2", "top secret", false)
+	assert.Equal(t, "top **###**", masked)
+	words, masked = filter.Check("2", " ok", true)
+	assert.Empty(t, words)
+	assert.Equal(t, " ok", masked)
+	assert.Equal(t, []string{"secret", "敏感词", "secret"}, filter.Words())
+}
+
+func TestNewCompletionSensitiveFilterDisabled(t *testing.T) {
+	withCompletionSensitiveWords(t, "secret")
+	setting.CheckSensitiveOnCompletionEnabled = false
+	assert.Nil(t, NewCompletionSensitiveFilter())
+}
+
+func TestViolationFeeForSensitiveCompletion(t *testing.T) {
+	savedEnabled, savedAmount := setting.SensitiveViolationFeeEnabled, setting.SensitiveViolationFeeAmount
+	t.Cleanup(func() {
+		setting.SensitiveViolationFeeEnabled = savedEnabled
+		setting.SensitiveViolationFeeAmount = savedAmount
+	})
+	apiErr := types.NewError(errors.New("sensitive words detected in completion"), types.ErrorCodeViolationFeeSensitive)
+
+	setting.SensitiveViolationFeeEnabled = false
+	assert.Nil(t, violationFeeFor(apiErr))
+
+	setting.SensitiveViolationFeeEnabled = true
+	setting.SensitiveViolationFeeAmount = 0.2
+	fee := violationFeeFor(apiErr)
+	require.NotNil(t, fee)
+	assert.Equal(t, types.ErrorCodeViolationFeeSensitive, fee.code)
+	assert.Equal(t, 0.2, fee.amount)
+
+	assert.Nil(t, violationFeeFor(types.NewError(errors.New("bad request"), types.ErrorCodeInvalidRequest)))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 
 	"github.com/bytedance/gopkg/util/gopool"
 )
@@ -85,6 +86,28 @@ func (logCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runner
 
 func init() {
 	RegisterSystemTaskHandler(logCleanupHandler{})
+	RegisterSystemTaskHandler(logBodyCleanupHandler{})
+	RegisterSystemTaskHandler(storedResponseCleanupHandler{})
+	prommetrics.SetSystemTaskSource(systemTaskQueueDepth)
+}
+
+func systemTaskQueueDepth() ([]prommetrics.SystemTaskCount, error) {
+	if model.DB == nil {
+		return nil, nil
+	}
+	counts, err := model.CountActiveSystemTasks()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]prommetrics.SystemTaskCount, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, prommetrics.SystemTaskCount{
+			Type:   count.Type,
+			Status: string(count.Status),
+			Count:  count.Count,
+		})
+	}
+	return result, nil
 }
 
 type LogCleanupPayload struct {
@@ -409,6 +432,12 @@ func runLogCleanupTask(ctx context.Context, task *model.SystemTask, runnerID str
 		}
 	}
 
+	// Bodies captured for the deleted logs go with them.
+	if _, err := model.DeleteOldLogBodies(ctx, payload.TargetTimestamp); err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+
 	state.Remaining = 0
 	state.Progress = 100
 	if state.Total < state.Processed {
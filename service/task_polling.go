@@ -402,7 +402,9 @@ func updateVideoTasks(ctx context.Context, platform constant.TaskPlatform, chann
 	}
 	info := &relaycommon.RelayInfo{}
 	info.ChannelMeta = &relaycommon.ChannelMeta{
+		ChannelType:    cacheGetChannel.Type,
 		ChannelBaseUrl: cacheGetChannel.GetBaseURL(),
+		ApiVersion:     cacheGetChannel.Other,
 	}
 	info.ApiKey = cacheGetChannel.Key
 	adaptor.Init(info)
@@ -582,6 +584,9 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 	}
 
 	if shouldSettle {
+		if taskResult.FineTunedModel != "" {
+			pinFineTunedModel(ctx, ch, task, taskResult.FineTunedModel)
+		}
 		settleTaskBillingOnComplete(ctx, adaptor, task, taskResult)
 	}
 	if shouldRefund {
@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -21,6 +22,7 @@ const (
 	ViolationFeeCodePrefix     = "violation_fee."
 	CSAMViolationMarker        = "Failed check: SAFETY_CHECK_TYPE"
 	ContentViolatesUsageMarker = "Content violates usage guidelines"
+	SensitiveCompletionMarker  = "Sensitive words in completion"
 )
 
 func IsViolationFeeCode(code types.ErrorCode) bool {
@@ -99,8 +101,42 @@ func calcViolationFeeQuota(amount, groupRatio float64) int {
 	return int(quota)
 }
 
+// violationFee is the fee policy applying to a violation error.
+type violationFee struct {
+	code   types.ErrorCode
+	amount float64
+	marker string
+}
+
+// violationFeeFor returns the fee policy for apiErr, or nil when apiErr is
+// not charged. Sensitive completions use the sensitive word settings, the
+// other violations the Grok fee settings.
+func violationFeeFor(apiErr *types.NewAPIError) *violationFee {
+	if apiErr.GetErrorCode() == types.ErrorCodeViolationFeeSensitive {
+		if !setting.SensitiveViolationFeeEnabled {
+			return nil
+		}
+		return &violationFee{
+			code:   types.ErrorCodeViolationFeeSensitive,
+			amount: setting.SensitiveViolationFeeAmount,
+			marker: SensitiveCompletionMarker,
+		}
+	}
+	if !shouldChargeViolationFee(apiErr) {
+		return nil
+	}
+	settings := model_setting.GetGrokSettings()
+	if settings == nil || !settings.ViolationDeductionEnabled {
+		return nil
+	}
+	return &violationFee{
+		code:   types.ErrorCodeViolationFeeGrokCSAM,
+		amount: settings.ViolationDeductionAmount,
+		marker: CSAMViolationMarker,
+	}
+}
+
 // ChargeViolationFeeIfNeeded charges an additional fee after the normal flow finishes (including refund).
-// It uses Grok fee settings as the fee policy.
 func ChargeViolationFeeIfNeeded(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, apiErr *types.NewAPIError) bool {
 	if ctx == nil || relayInfo == nil || apiErr == nil {
 		return false
@@ -108,17 +144,13 @@ func ChargeViolationFeeIfNeeded(ctx *gin.Context, relayInfo *relaycommon.RelayIn
 	//if relayInfo.IsPlayground {
 	//	return false
 	//}
-	if !shouldChargeViolationFee(apiErr) {
-		return false
-	}
-
-	settings := model_setting.GetGrokSettings()
-	if settings == nil || !settings.ViolationDeductionEnabled {
+	fee := violationFeeFor(apiErr)
+	if fee == nil {
 		return false
 	}
 
 	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
-	feeQuota := calcViolationFeeQuota(settings.ViolationDeductionAmount, groupRatio)
+	feeQuota := calcViolationFeeQuota(fee.amount, groupRatio)
 	if feeQuota <= 0 {
 		return false
 	}
@@ -137,14 +169,14 @@ func ChargeViolationFeeIfNeeded(ctx *gin.Context, relayInfo *relaycommon.RelayIn
 
 	other := map[string]any{
 		"violation_fee":        true,
-		"violation_fee_code":   string(types.ErrorCodeViolationFeeGrokCSAM),
+		"violation_fee_code":   string(fee.code),
 		"fee_quota":            feeQuota,
-		"base_amount":          settings.ViolationDeductionAmount,
+		"base_amount":          fee.amount,
 		"group_ratio":          groupRatio,
 		"status_code":          apiErr.StatusCode,
 		"upstream_error_type":  oai.Type,
 		"upstream_error_code":  fmt.Sprintf("%v", oai.Code),
-		"violation_fee_marker": CSAMViolationMarker,
+		"violation_fee_marker": fee.marker,
 	}
 
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
@@ -158,6 +190,7 @@ func ChargeViolationFeeIfNeeded(ctx *gin.Context, relayInfo *relaycommon.RelayIn
 		IsStream:       relayInfo.IsStream,
 		Group:          relayInfo.UsingGroup,
 		Other:          other,
+		OrganizationId: relayInfo.OrganizationId,
 	})
 
 	return true
@@ -0,0 +1,51 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AdaptiveRoutingSetting scales the weight of channels sharing a priority by
+// their recent success rate, time to first token and throughput. Scores are
+// kept in memory per instance and decay with HalfLifeSeconds, so a channel
+// recovers its static weight once an upstream incident is over.
+type AdaptiveRoutingSetting struct {
+	Enabled         bool `json:"enabled"`
+	HalfLifeSeconds int  `json:"half_life_seconds"`
+	// MinSamples is the decayed request count a channel needs before its score
+	// affects routing; channels with fewer samples keep their static weight.
+	MinSamples float64 `json:"min_samples"`
+	// MinFactor is the lowest weight multiplier, so a penalized channel still
+	// receives some traffic to prove it has recovered.
+	MinFactor float64 `json:"min_factor"`
+	// SuccessRateExponent is applied to the success rate, higher values punish
+	// flaky channels harder.
+	SuccessRateExponent float64 `json:"success_rate_exponent"`
+	// LatencyWeight and ThroughputWeight are the exponents of the time to first
+	// token and tokens per second compared with the best channel of the tier;
+	// 0 ignores the metric.
+	LatencyWeight    float64 `json:"latency_weight"`
+	ThroughputWeight float64 `json:"throughput_weight"`
+}
+
+var adaptiveRoutingSetting = AdaptiveRoutingSetting{
+	Enabled:             false,
+	HalfLifeSeconds:     300,
+	MinSamples:          5,
+	MinFactor:           0.05,
+	SuccessRateExponent: 2,
+	LatencyWeight:       0.5,
+	ThroughputWeight:    0.5,
+}
+
+func init() {
+	config.GlobalConfig.Register("adaptive_routing_setting", &adaptiveRoutingSetting)
+}
+
+func GetAdaptiveRoutingSetting() *AdaptiveRoutingSetting {
+	return &adaptiveRoutingSetting
+}
+
+func GetAdaptiveRoutingHalfLifeSeconds() int {
+	if adaptiveRoutingSetting.HalfLifeSeconds <= 0 {
+		return 300
+	}
+	return adaptiveRoutingSetting.HalfLifeSeconds
+}
@@ -0,0 +1,62 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting controls the gateway-executed OpenAI Batch API (/v1/batches).
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// DiscountRatio multiplies the quota of every batch line, e.g. 0.5 bills
+	// batch requests at half price. Only ratio/price billed models are
+	// discounted; tiered expression billing is charged as usual.
+	DiscountRatio float64 `json:"discount_ratio"`
+	// MaxRequestsPerBatch caps the number of lines in one input file.
+	MaxRequestsPerBatch int `json:"max_requests_per_batch"`
+	// Concurrency is the number of lines of one batch relayed in parallel.
+	Concurrency int `json:"concurrency"`
+}
+
+var batchSetting = BatchSetting{
+	Enabled:             false,
+	DiscountRatio:       0.5,
+	MaxRequestsPerBatch: 50000,
+	Concurrency:         4,
+}
+
+// BatchSupportedEndpoints lists the relay endpoints a batch input file may target.
+var BatchSupportedEndpoints = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/responses",
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
+
+func GetBatchDiscountRatio() float64 {
+	if batchSetting.DiscountRatio <= 0 {
+		return 1
+	}
+	return batchSetting.DiscountRatio
+}
+
+func GetBatchConcurrency() int {
+	if batchSetting.Concurrency <= 0 {
+		return 1
+	}
+	return batchSetting.Concurrency
+}
+
+func IsBatchEndpointSupported(endpoint string) bool {
+	for _, e := range BatchSupportedEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BodyCaptureSetting controls storing the request and response bodies of
+// relay requests for audit and debugging. A request is captured when capture
+// is enabled, its user, token or final channel is listed, and it falls within
+// SampleRate.
+type BodyCaptureSetting struct {
+	Enabled    bool  `json:"enabled"`
+	UserIds    []int `json:"user_ids"`
+	TokenIds   []int `json:"token_ids"`
+	ChannelIds []int `json:"channel_ids"`
+	// SampleRate is the fraction of matching requests captured, from 0 to 1.
+	SampleRate float64 `json:"sample_rate"`
+	// MaxBodyBytes truncates each stored request and response body.
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// RedactJSONPaths lists dot paths, with * matching any key or array
+	// element, whose values are masked in JSON bodies and SSE events, e.g.
+	// "messages.*.content".
+	RedactJSONPaths []string `json:"redact_json_paths"`
+	// RedactHeaders lists request headers masked in addition to the
+	// credential headers, which are always masked.
+	RedactHeaders []string `json:"redact_headers"`
+	// RetentionDays deletes captured bodies older than this many days; 0
+	// keeps them until a log cleanup removes them.
+	RetentionDays int `json:"retention_days"`
+}
+
+var bodyCaptureSetting = BodyCaptureSetting{
+	Enabled:         false,
+	UserIds:         []int{},
+	TokenIds:        []int{},
+	ChannelIds:      []int{},
+	SampleRate:      1,
+	MaxBodyBytes:    64 << 10,
+	RedactJSONPaths: []string{},
+	RedactHeaders:   []string{},
+	RetentionDays:   7,
+}
+
+func init() {
+	config.GlobalConfig.Register("body_capture_setting", &bodyCaptureSetting)
+}
+
+func GetBodyCaptureSetting() *BodyCaptureSetting {
+	return &bodyCaptureSetting
+}
+
+// IsBodyCaptureTarget reports whether requests of the user, token or channel
+// were opted in to body capture.
+func IsBodyCaptureTarget(userId int, tokenId int, channelId int) bool {
+	return (userId > 0 && slices.Contains(bodyCaptureSetting.UserIds, userId)) ||
+		(tokenId > 0 && slices.Contains(bodyCaptureSetting.TokenIds, tokenId)) ||
+		(channelId > 0 && slices.Contains(bodyCaptureSetting.ChannelIds, channelId))
+}
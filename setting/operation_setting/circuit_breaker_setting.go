@@ -0,0 +1,47 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// CircuitBreakerSetting controls the circuit breakers kept per channel and
+// per key of multi-key channels. An open breaker takes its channel or key out
+// of selection for OpenSeconds, after which a few probe requests decide
+// whether it closes again.
+type CircuitBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// ConsecutiveFailures trips the breaker after this many failures in a
+	// row; 0 disables the rule.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// ErrorRateThreshold trips the breaker when the failure rate within
+	// WindowSeconds reaches it, once MinRequests were seen; 0 disables the rule.
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	MinRequests        int     `json:"min_requests"`
+	WindowSeconds      int     `json:"window_seconds"`
+	OpenSeconds        int     `json:"open_seconds"`
+	// HalfOpenMaxProbes is the number of requests let through once the open
+	// period is over; HalfOpenSuccesses of them must succeed to close again.
+	HalfOpenMaxProbes int `json:"half_open_max_probes"`
+	HalfOpenSuccesses int `json:"half_open_successes"`
+	// ProbeTimeoutSeconds frees the probe slots of requests that never
+	// reported a result.
+	ProbeTimeoutSeconds int `json:"probe_timeout_seconds"`
+}
+
+var circuitBreakerSetting = CircuitBreakerSetting{
+	Enabled:             false,
+	ConsecutiveFailures: 5,
+	ErrorRateThreshold:  0.5,
+	MinRequests:         20,
+	WindowSeconds:       60,
+	OpenSeconds:         30,
+	HalfOpenMaxProbes:   3,
+	HalfOpenSuccesses:   2,
+	ProbeTimeoutSeconds: 60,
+}
+
+func init() {
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
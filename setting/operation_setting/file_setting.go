@@ -0,0 +1,66 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// FileSetting controls the OpenAI-compatible /v1/files API.
+type FileSetting struct {
+	Enabled bool `json:"enabled"`
+	// StorageBackend selects a registered file storage backend ("local" by default).
+	StorageBackend string `json:"storage_backend"`
+	// MaxFileSizeMB caps a single upload.
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// MaxUserStorageMB caps the total bytes a user can keep stored, 0 means unlimited.
+	MaxUserStorageMB int `json:"max_user_storage_mb"`
+	// GroupMaxUserStorageMB overrides MaxUserStorageMB for the users of a group.
+	GroupMaxUserStorageMB map[string]int `json:"group_max_user_storage_mb"`
+	// ForwardToUpstream uploads the file to the channel selected for the
+	// request's "model" form field so upstream batch/fine-tuning jobs can use it.
+	ForwardToUpstream bool     `json:"forward_to_upstream"`
+	AllowedPurposes   []string `json:"allowed_purposes"`
+}
+
+var fileSetting = FileSetting{
+	Enabled:               false,
+	StorageBackend:        "local",
+	MaxFileSizeMB:         100,
+	MaxUserStorageMB:      1024,
+	GroupMaxUserStorageMB: map[string]int{},
+	ForwardToUpstream:     true,
+	AllowedPurposes:       []string{"assistants", "batch", "fine-tune", "vision", "user_data", "evals"},
+}
+
+func init() {
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
+
+func GetMaxFileSizeBytes() int64 {
+	if fileSetting.MaxFileSizeMB <= 0 {
+		return 100 << 20
+	}
+	return int64(fileSetting.MaxFileSizeMB) << 20
+}
+
+// GetMaxUserStorageMB returns the storage cap of a user in group, 0 means
+// unlimited.
+func GetMaxUserStorageMB(group string) int {
+	if storageMB, ok := fileSetting.GroupMaxUserStorageMB[group]; ok {
+		return storageMB
+	}
+	return fileSetting.MaxUserStorageMB
+}
+
+func IsFilePurposeAllowed(purpose string) bool {
+	if len(fileSetting.AllowedPurposes) == 0 {
+		return true
+	}
+	for _, p := range fileSetting.AllowedPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// HedgeSetting controls hedged chat completion requests: when the first
+// channel has not sent a byte after DelayMs, the same request is also sent to
+// another eligible channel and whichever responds first is used.
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// Models lists the models whose requests may be hedged; empty hedges none,
+	// since every hedge can double the upstream cost of a slow request.
+	Models  []string `json:"models"`
+	DelayMs int      `json:"delay_ms"`
+	// StreamOnly restricts hedging to streaming requests.
+	StreamOnly bool `json:"stream_only"`
+}
+
+var hedgeSetting = HedgeSetting{
+	Enabled:    false,
+	Models:     []string{},
+	DelayMs:    2000,
+	StreamOnly: true,
+}
+
+func init() {
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+func IsHedgeModelEnabled(modelName string) bool {
+	return slices.Contains(hedgeSetting.Models, modelName)
+}
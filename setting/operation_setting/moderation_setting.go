@@ -0,0 +1,83 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	ModerationProviderOpenAI  = "openai"
+	ModerationProviderWebhook = "webhook"
+
+	ModerationActionOff    = "off"
+	ModerationActionBlock  = "block"
+	ModerationActionFlag   = "flag"
+	ModerationActionRedact = "redact"
+)
+
+// ModerationPolicy decides what happens to a request whose prompt is
+// flagged by the moderation provider.
+type ModerationPolicy struct {
+	// Action is one of off, block, flag (relay and record the verdict) or
+	// redact (replace the flagged messages before relaying).
+	Action string `json:"action"`
+	// Thresholds maps a category to the score from which it counts as
+	// flagged. When empty, the categories flagged by the provider are used.
+	Thresholds map[string]float64 `json:"thresholds"`
+}
+
+// ModerationSetting configures the external moderation of prompts before
+// they are relayed upstream.
+type ModerationSetting struct {
+	Enabled bool `json:"enabled"`
+	// Provider is openai, which calls /v1/moderations on one of our own
+	// channels serving Model, or webhook, which posts to WebhookURL.
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	WebhookURL    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+	TimeoutMs     int    `json:"timeout_ms"`
+	// FailOpen relays requests when the provider cannot be reached instead
+	// of rejecting them.
+	FailOpen bool `json:"fail_open"`
+	// CacheTTLSeconds keeps verdicts by content hash; 0 disables the cache.
+	CacheTTLSeconds int              `json:"cache_ttl_seconds"`
+	DefaultPolicy   ModerationPolicy `json:"default_policy"`
+	// GroupPolicies overrides DefaultPolicy for the listed groups.
+	GroupPolicies map[string]ModerationPolicy `json:"group_policies"`
+}
+
+var moderationSetting = ModerationSetting{
+	Enabled:         false,
+	Provider:        ModerationProviderOpenAI,
+	Model:           "omni-moderation-latest",
+	TimeoutMs:       3000,
+	FailOpen:        true,
+	CacheTTLSeconds: 3600,
+	DefaultPolicy: ModerationPolicy{
+		Action:     ModerationActionBlock,
+		Thresholds: map[string]float64{},
+	},
+	GroupPolicies: map[string]ModerationPolicy{},
+}
+
+func init() {
+	config.GlobalConfig.Register("moderation_setting", &moderationSetting)
+}
+
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+// GetModerationPolicy returns the policy of group, or nil when prompts of
+// the group are not moderated.
+func GetModerationPolicy(group string) *ModerationPolicy {
+	if !moderationSetting.Enabled {
+		return nil
+	}
+	policy, ok := moderationSetting.GroupPolicies[group]
+	if !ok {
+		policy = moderationSetting.DefaultPolicy
+	}
+	if policy.Action == "" || policy.Action == ModerationActionOff {
+		return nil
+	}
+	return &policy
+}
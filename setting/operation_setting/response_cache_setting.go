@@ -0,0 +1,65 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting controls the exact-match response cache for chat
+// completions. A request is only cached when the cache is enabled here, the
+// model is allowed and the calling token has opted in.
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// Models lists the models whose responses may be cached; empty allows all.
+	Models []string `json:"models"`
+	// DeterministicOnly restricts caching to requests sent with temperature 0.
+	DeterministicOnly bool `json:"deterministic_only"`
+	TTLSeconds        int  `json:"ttl_seconds"`
+	// BillingRatio multiplies the quota of a cache hit, e.g. 0.1 bills a
+	// replayed response at 10% of the original price.
+	BillingRatio float64 `json:"billing_ratio"`
+	// MaxBodyBytes skips caching responses larger than this many bytes.
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// MaxEntries bounds the in-memory cache used when Redis is disabled.
+	MaxEntries int `json:"max_entries"`
+}
+
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:           false,
+	Models:            []string{},
+	DeterministicOnly: true,
+	TTLSeconds:        3600,
+	BillingRatio:      0.1,
+	MaxBodyBytes:      1 << 20,
+	MaxEntries:        10000,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+func GetResponseCacheBillingRatio() float64 {
+	if responseCacheSetting.BillingRatio <= 0 {
+		return 1
+	}
+	return responseCacheSetting.BillingRatio
+}
+
+func GetResponseCacheTTLSeconds() int {
+	if responseCacheSetting.TTLSeconds <= 0 {
+		return 3600
+	}
+	return responseCacheSetting.TTLSeconds
+}
+
+func IsResponseCacheModelEnabled(modelName string) bool {
+	if len(responseCacheSetting.Models) == 0 {
+		return true
+	}
+	return slices.Contains(responseCacheSetting.Models, modelName)
+}
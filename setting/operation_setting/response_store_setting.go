@@ -0,0 +1,33 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseStoreSetting controls the gateway-side store of Responses API
+// results. When enabled, previous_response_id is resolved by the gateway
+// against the conversations it stored, so a follow-up request can land on any
+// channel, including upstreams that keep no state of their own. Ids the store
+// does not know are still passed through to the upstream.
+type ResponseStoreSetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLHours is how long a stored response can be continued from.
+	TTLHours int `json:"ttl_hours"`
+	// MaxHistoryBytes caps the stored conversation of one response; a longer
+	// conversation is not stored and cannot be continued by id.
+	MaxHistoryBytes int `json:"max_history_bytes"`
+}
+
+var responseStoreSetting = ResponseStoreSetting{
+	Enabled:         false,
+	TTLHours:        72,
+	MaxHistoryBytes: 4 << 20,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_store_setting", &responseStoreSetting)
+}
+
+func GetResponseStoreSetting() *ResponseStoreSetting {
+	return &responseStoreSetting
+}
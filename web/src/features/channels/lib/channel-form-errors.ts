@@ -49,6 +49,7 @@ const ADVANCED_SETTINGS_FIELDS = new Set<FieldPath<ChannelFormValues>>([
   'allow_speed',
   'claude_beta_query',
   'disable_task_polling_sleep',
+  'propagate_trace_context',
   'upstream_model_update_check_enabled',
   'upstream_model_update_auto_sync_enabled',
   'upstream_model_update_ignored_models',
@@ -18,7 +18,7 @@ For commercial licensing, please contact support@quantumnous.com
 */
 import { zodResolver } from '@hookform/resolvers/zod'
 import { useEffect } from 'react'
-import { useForm } from 'react-hook-form'
+import { useForm, type Resolver } from 'react-hook-form'
 import { useTranslation } from 'react-i18next'
 import * as z from 'zod'
 
@@ -31,6 +31,7 @@ import {
   FormLabel,
   FormMessage,
 } from '@/components/ui/form'
+import { Input } from '@/components/ui/input'
 import { Switch } from '@/components/ui/switch'
 import { Textarea } from '@/components/ui/textarea'
 
@@ -46,6 +47,10 @@ import { useUpdateOption } from '../hooks/use-update-option'
 const sensitiveSchema = z.object({
   CheckSensitiveEnabled: z.boolean(),
   CheckSensitiveOnPromptEnabled: z.boolean(),
+  CheckSensitiveOnCompletionEnabled: z.boolean(),
+  StopOnSensitiveEnabled: z.boolean(),
+  SensitiveViolationFeeEnabled: z.boolean(),
+  SensitiveViolationFeeAmount: z.coerce.number().min(0),
   SensitiveWords: z.string().optional(),
 })
 
@@ -61,7 +66,9 @@ export function SensitiveWordsSection({
   const { t } = useTranslation()
   const updateOption = useUpdateOption()
   const form = useForm<SensitiveFormValues>({
-    resolver: zodResolver(sensitiveSchema),
+    resolver: zodResolver(
+      sensitiveSchema
+    ) as unknown as Resolver<SensitiveFormValues>,
     defaultValues,
   })
 
@@ -135,6 +142,92 @@ export function SensitiveWordsSection({
                 </SettingsSwitchItem>
               )}
             />
+
+            <FormField
+              control={form.control}
+              name='CheckSensitiveOnCompletionEnabled'
+              render={({ field }) => (
+                <SettingsSwitchItem>
+                  <SettingsSwitchContent>
+                    <FormLabel>{t('Inspect streamed completions')}</FormLabel>
+                    <FormDescription>
+                      {t(
+                        'When enabled, streamed model output is scanned while it is sent to the client.'
+                      )}
+                    </FormDescription>
+                  </SettingsSwitchContent>
+                  <FormControl>
+                    <Switch
+                      checked={field.value}
+                      onCheckedChange={field.onChange}
+                    />
+                  </FormControl>
+                </SettingsSwitchItem>
+              )}
+            />
+
+            <FormField
+              control={form.control}
+              name='StopOnSensitiveEnabled'
+              render={({ field }) => (
+                <SettingsSwitchItem>
+                  <SettingsSwitchContent>
+                    <FormLabel>{t('Stop on detection')}</FormLabel>
+                    <FormDescription>
+                      {t(
+                        'Ends the stream when a keyword is generated instead of masking it.'
+                      )}
+                    </FormDescription>
+                  </SettingsSwitchContent>
+                  <FormControl>
+                    <Switch
+                      checked={field.value}
+                      onCheckedChange={field.onChange}
+                    />
+                  </FormControl>
+                </SettingsSwitchItem>
+              )}
+            />
+
+            <FormField
+              control={form.control}
+              name='SensitiveViolationFeeEnabled'
+              render={({ field }) => (
+                <SettingsSwitchItem>
+                  <SettingsSwitchContent>
+                    <FormLabel>{t('Charge violation fee')}</FormLabel>
+                    <FormDescription>
+                      {t(
+                        'Charges an extra fee when a stream is stopped for sensitive keywords.'
+                      )}
+                    </FormDescription>
+                  </SettingsSwitchContent>
+                  <FormControl>
+                    <Switch
+                      checked={field.value}
+                      onCheckedChange={field.onChange}
+                    />
+                  </FormControl>
+                </SettingsSwitchItem>
+              )}
+            />
+
+            <FormField
+              control={form.control}
+              name='SensitiveViolationFeeAmount'
+              render={({ field }) => (
+                <FormItem>
+                  <FormLabel>{t('Violation fee (USD)')}</FormLabel>
+                  <FormControl>
+                    <Input type='number' min={0} step='0.01' {...field} />
+                  </FormControl>
+                  <FormDescription>
+                    {t('Multiplied by the group ratio of the request.')}
+                  </FormDescription>
+                  <FormMessage />
+                </FormItem>
+              )}
+            />
           </div>
 
           <FormField
@@ -32,6 +32,10 @@ const defaultSecuritySettings: SecuritySettings = {
   ModelRequestRateLimitGroup: '',
   CheckSensitiveEnabled: false,
   CheckSensitiveOnPromptEnabled: false,
+  CheckSensitiveOnCompletionEnabled: false,
+  StopOnSensitiveEnabled: true,
+  SensitiveViolationFeeEnabled: false,
+  SensitiveViolationFeeAmount: 0,
   SensitiveWords: '',
   'fetch_setting.enable_ssrf_protection': true,
   'fetch_setting.allow_private_ip': false,
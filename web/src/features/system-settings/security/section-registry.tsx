@@ -49,6 +49,11 @@ const SECURITY_SECTIONS = [
         defaultValues={{
           CheckSensitiveEnabled: settings.CheckSensitiveEnabled,
           CheckSensitiveOnPromptEnabled: settings.CheckSensitiveOnPromptEnabled,
+          CheckSensitiveOnCompletionEnabled:
+            settings.CheckSensitiveOnCompletionEnabled,
+          StopOnSensitiveEnabled: settings.StopOnSensitiveEnabled,
+          SensitiveViolationFeeEnabled: settings.SensitiveViolationFeeEnabled,
+          SensitiveViolationFeeAmount: settings.SensitiveViolationFeeAmount,
           SensitiveWords: settings.SensitiveWords,
         }}
       />
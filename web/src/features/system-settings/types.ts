@@ -369,6 +369,10 @@ export type SecuritySettings = {
   ModelRequestRateLimitGroup: string
   CheckSensitiveEnabled: boolean
   CheckSensitiveOnPromptEnabled: boolean
+  CheckSensitiveOnCompletionEnabled: boolean
+  StopOnSensitiveEnabled: boolean
+  SensitiveViolationFeeEnabled: boolean
+  SensitiveViolationFeeAmount: number
   SensitiveWords: string
   'fetch_setting.enable_ssrf_protection': boolean
   'fetch_setting.allow_private_ip': boolean
@@ -655,6 +655,9 @@ export function DetailsDialog(props: DetailsDialogProps) {
               mono
             />
           )}
+          {other?.trace_id && (
+            <DetailRow label={t('Trace ID')} value={other.trace_id} mono />
+          )}
 
           {props.isAdmin && props.log.channel > 0 && (
             <DetailRow
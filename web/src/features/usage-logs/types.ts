@@ -156,6 +156,7 @@ export interface LogOtherData {
   user_agent?: string
   request_path?: string
   request_conversion?: string[]
+  trace_id?: string
   ws?: boolean
   audio?: boolean
   audio_input?: number